@@ -0,0 +1,128 @@
+// Package cli holds what the rpulse subcommands share: parsing their flags and opening the
+// storage backend selected by the configuration.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/database/memory"
+	"github.com/gateixeira/rpulse/internal/database/sqlite"
+)
+
+// ErrUsage is returned for invalid arguments, after the usage of the command was printed
+var ErrUsage = errors.New("invalid arguments")
+
+// Output is where commands write their usage and results
+var Output io.Writer = os.Stdout
+
+// NewFlagSet creates the flag set of a subcommand. Its usage starts with the given synopsis
+// and description, followed by the flags.
+func NewFlagSet(name, synopsis, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: rpulse %s %s\n\n%s\n", name, synopsis, description)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprint(fs.Output(), "\nFlags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// Parse parses the arguments of a subcommand. It returns flag.ErrHelp when help was requested,
+// and ErrUsage when the arguments are invalid or there are more positional arguments than maxArgs.
+func Parse(fs *flag.FlagSet, args []string, maxArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return ErrUsage
+	}
+
+	if fs.NArg() > maxArgs {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(maxArgs))
+		fs.Usage()
+		return ErrUsage
+	}
+
+	return nil
+}
+
+// Usagef reports invalid arguments that were parsed successfully, such as a bad combination of flags
+func Usagef(fs *flag.FlagSet, format string, args ...any) error {
+	fmt.Fprintf(fs.Output(), format+"\n", args...)
+	fs.Usage()
+	return ErrUsage
+}
+
+// timeValue is a flag holding an RFC3339 timestamp
+type timeValue struct {
+	t *time.Time
+}
+
+func (v timeValue) String() string {
+	if v.t == nil || v.t.IsZero() {
+		return ""
+	}
+	return v.t.Format(time.RFC3339)
+}
+
+func (v timeValue) Set(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return errors.New("must be an RFC3339 timestamp")
+	}
+	*v.t = t
+	return nil
+}
+
+// TimeVar defines a flag holding an RFC3339 timestamp, which is left zero when the flag is not given
+func TimeVar(fs *flag.FlagSet, t *time.Time, name, usage string) {
+	fs.Var(timeValue{t}, name, usage)
+}
+
+// OpenStorage opens the storage backend selected by STORAGE_BACKEND and returns it with a function that closes it
+func OpenStorage(ctx context.Context, config *config.Config) (database.DatabaseInterface, func() error, error) {
+	switch config.Vars.StorageBackend {
+	case "postgres":
+		db, err := database.Open(ctx, config.GetDSN(), database.Options{
+			MaxOpenConns: config.Vars.DbMaxOpenConns,
+			MaxIdleConns: config.Vars.DbMaxIdleConns,
+			QueryTimeout: config.Vars.DbQueryTimeout,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, db.Close, nil
+	case "sqlite":
+		store, err := sqlite.Open(config.Vars.SQLitePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case "memory":
+		return memory.NewStore(), func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage backend %q", config.Vars.StorageBackend)
+	}
+}
+
+// OpenPersistentStorage opens the storage backend like OpenStorage, but fails for the in-memory
+// backend, which holds no data outside of a running server
+func OpenPersistentStorage(ctx context.Context, config *config.Config) (database.DatabaseInterface, func() error, error) {
+	if config.Vars.StorageBackend == "memory" {
+		return nil, nil, errors.New("the memory storage backend keeps no data outside of a running server")
+	}
+	return OpenStorage(ctx, config)
+}
@@ -0,0 +1,120 @@
+// Package cmd is the command line of rpulse. Every subcommand shares the configuration read from
+// the environment and a context that is cancelled on SIGINT or SIGTERM.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/cmd/export"
+	"github.com/gateixeira/rpulse/cmd/migrate"
+	"github.com/gateixeira/rpulse/cmd/replay"
+	"github.com/gateixeira/rpulse/cmd/server"
+	"github.com/gateixeira/rpulse/cmd/simulate"
+	"github.com/gateixeira/rpulse/cmd/token"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/version"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// command is a subcommand of rpulse
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, config *config.Config, args []string) error
+}
+
+var commands = []command{
+	{name: "serve", summary: "Start the server (default)", run: server.Run},
+	{name: "migrate", summary: "Apply or roll back the database migrations", run: migrate.Run},
+	{name: "replay", summary: "Re-ingest the stored webhook deliveries", run: replay.Run},
+	{name: "export", summary: "Export the runner demand history as CSV or JSON", run: export.Run},
+	{name: "simulate", summary: "Send simulated workflow job webhooks to a server", run: simulate.Run},
+	{name: "token", summary: "Create, list and revoke API tokens", run: token.Run},
+	{name: "version", summary: "Print the build commit and date", run: printVersion},
+}
+
+// Execute runs the subcommand named by the first argument, or serve without one, and returns
+// the exit code: 0 on success, 2 for invalid arguments and 1 when the command failed
+func Execute(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			usage(cli.Output)
+			return 0
+		}
+	}
+
+	// Flags without a command are the flags of serve
+	name, rest := "serve", args
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, rest = args[0], args[1:]
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		return 2
+	}
+
+	config, err := config.NewConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		return 2
+	}
+
+	// Only the server logs to standard output, other commands write their results there
+	if cmd.name == "serve" {
+		logger.InitLogger(config.Vars.LogLevel)
+	} else {
+		logger.InitLoggerTo(config.Vars.LogLevel, os.Stderr)
+	}
+	defer logger.SyncLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = cmd.run(ctx, config, rest)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, cli.ErrUsage):
+		return 2
+	default:
+		logger.Logger.Error("Command failed", zap.String("command", cmd.name), zap.Error(err))
+		return 1
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Usage: rpulse [command] [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(w, "\nRun 'rpulse <command> -help' for the flags of a command.\n")
+}
+
+func printVersion(_ context.Context, _ *config.Config, args []string) error {
+	fs := cli.NewFlagSet("version", "", "Print the commit and date the binary was built from.")
+	if err := cli.Parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cli.Output, version.Get())
+	return nil
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+)
+
+func TestExecute(t *testing.T) {
+	var out bytes.Buffer
+	cli.Output = &out
+	t.Cleanup(func() { cli.Output = os.Stdout })
+
+	testCases := []struct {
+		name     string
+		args     []string
+		code     int
+		expected string
+	}{
+		{name: "help", args: []string{"help"}, code: 0, expected: "Commands:"},
+		{name: "help flag", args: []string{"-help"}, code: 0, expected: "Commands:"},
+		{name: "version", args: []string{"version"}, code: 0, expected: "rpulse commit"},
+		{name: "unknown command", args: []string{"bogus"}, code: 2},
+		{name: "unexpected argument", args: []string{"version", "extra"}, code: 2},
+		{name: "invalid flag", args: []string{"export", "-format", "xml"}, code: 2},
+		{name: "command help", args: []string{"export", "-help"}, code: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out.Reset()
+
+			if code := Execute(tc.args); code != tc.code {
+				t.Errorf("Expected exit code %d, got %d", tc.code, code)
+			}
+			if !strings.Contains(out.String(), tc.expected) {
+				t.Errorf("Expected the output to contain %q, got %q", tc.expected, out.String())
+			}
+		})
+	}
+}
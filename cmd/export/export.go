@@ -0,0 +1,138 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const description = `Export the runner demand history of a time range, for the whole fleet or one runner pool,
+as CSV or JSON. Each bucket of -step holds the average counts and the peak demand.`
+
+// Run writes the history selected by args to standard output or a file
+func Run(ctx context.Context, config *config.Config, args []string) error {
+	fs := cli.NewFlagSet("export", "[flags]", description)
+	var r models.TimeRange
+	cli.TimeVar(fs, &r.From, "from", "start of the range as an `RFC3339` time (default: 24 hours before -to)")
+	cli.TimeVar(fs, &r.To, "to", "end of the range as an `RFC3339` time (default: now)")
+	fs.DurationVar(&r.Step, "step", time.Hour, "size of the buckets, a whole number of seconds")
+	pool := fs.String("pool", "", "export the history of this runner pool instead of the whole fleet")
+	format := fs.String("format", "csv", "output format, csv or json")
+	output := fs.String("o", "", "file to write to (default: standard output)")
+	if err := cli.Parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if r.To.IsZero() {
+		r.To = now
+	}
+	if r.From.IsZero() {
+		r.From = r.To.Add(-24 * time.Hour)
+	}
+	if !r.From.Before(r.To) {
+		return cli.Usagef(fs, "-from must be before -to")
+	}
+	if r.Step < time.Second || r.Step%time.Second != 0 {
+		return cli.Usagef(fs, "-step must be a whole number of seconds such as 30s or 5m")
+	}
+	if *format != "csv" && *format != "json" {
+		return cli.Usagef(fs, "-format must be csv or json")
+	}
+
+	db, closeDB, err := cli.OpenPersistentStorage(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() {
+		if err := closeDB(); err != nil {
+			logger.Logger.Error("Failed to close database connection", zap.Error(err))
+		}
+	}()
+
+	if unit := db.StepGranularity(r.From, now); r.Step%unit != 0 {
+		return cli.Usagef(fs, "-step must be a multiple of %s for a range starting at %s", unit, r.From.Format(time.RFC3339))
+	}
+
+	// The JSON export holds the entries as the API returns them, the CSV export one row per entry
+	var entries any
+	var rows [][]string
+	if *pool == "" {
+		history, err := db.GetHistoricalDataByRange(ctx, r)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve history: %w", err)
+		}
+		entries, rows = append([]models.HistoricalEntry{}, history...), historyRows(history)
+	} else {
+		history, err := db.GetPoolHistoricalDataByRange(ctx, r, *pool)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve pool history: %w", err)
+		}
+		entries, rows = append([]models.PoolHistoricalEntry{}, history...), poolHistoryRows(history)
+	}
+
+	if *output == "" {
+		return write(cli.Output, *format, entries, rows)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := write(f, *format, entries, rows); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// write writes the entries in the given format
+func write(w io.Writer, format string, entries any, rows [][]string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	cw := csv.NewWriter(w)
+	return cw.WriteAll(rows)
+}
+
+func historyRows(entries []models.HistoricalEntry) [][]string {
+	rows := [][]string{{"timestamp", "self_hosted", "github_hosted", "queued", "peak_total"}}
+	for _, e := range entries {
+		rows = append(rows, []string{
+			e.Timestamp,
+			strconv.Itoa(e.CountSelfHosted),
+			strconv.Itoa(e.CountGitHubHosted),
+			strconv.Itoa(e.CountQueued),
+			strconv.Itoa(e.PeakTotal),
+		})
+	}
+	return rows
+}
+
+func poolHistoryRows(entries []models.PoolHistoricalEntry) [][]string {
+	rows := [][]string{{"timestamp", "pool", "running", "queued", "peak_total"}}
+	for _, e := range entries {
+		rows = append(rows, []string{
+			e.Timestamp,
+			e.Pool,
+			strconv.Itoa(e.CountRunning),
+			strconv.Itoa(e.CountQueued),
+			strconv.Itoa(e.PeakTotal),
+		})
+	}
+	return rows
+}
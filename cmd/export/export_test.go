@@ -0,0 +1,91 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/database/sqlite"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRun(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rpulse.db")
+	from := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+
+	store, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i, count := range []int{2, 4} {
+		timestamp := from.Add(time.Duration(i)*time.Hour + time.Minute).Format(time.RFC3339)
+		if err := store.AddHistoricalEntry(ctx, models.HistoricalEntry{Timestamp: timestamp, CountSelfHosted: count, PeakTotal: count}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := store.AddPoolHistoricalEntries(ctx, []models.PoolHistoricalEntry{{Timestamp: timestamp, Pool: "linux", CountRunning: count, PeakTotal: count}}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var out bytes.Buffer
+	cli.Output = &out
+	t.Cleanup(func() { cli.Output = os.Stdout })
+
+	cfg := &config.Config{Vars: config.Vars{StorageBackend: "sqlite", SQLitePath: path}}
+	rangeArgs := []string{"-from", from.Format(time.RFC3339), "-to", from.Add(2 * time.Hour).Format(time.RFC3339), "-step", "1h"}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "history as csv",
+			args: rangeArgs,
+			expected: "timestamp,self_hosted,github_hosted,queued,peak_total\n" +
+				from.Format(time.RFC3339) + ",2,0,0,2\n" +
+				from.Add(time.Hour).Format(time.RFC3339) + ",4,0,0,4\n",
+		},
+		{
+			name: "pool history as csv",
+			args: append([]string{"-pool", "linux"}, rangeArgs...),
+			expected: "timestamp,pool,running,queued,peak_total\n" +
+				from.Format(time.RFC3339) + ",linux,2,0,2\n" +
+				from.Add(time.Hour).Format(time.RFC3339) + ",linux,4,0,4\n",
+		},
+		{
+			name:     "empty range as json",
+			args:     []string{"-from", from.Add(-time.Hour).Format(time.RFC3339), "-to", from.Format(time.RFC3339), "-format", "json"},
+			expected: "[]\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out.Reset()
+
+			if err := Run(ctx, cfg, tc.args); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if out.String() != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, out.String())
+			}
+		})
+	}
+
+	if err := Run(ctx, cfg, []string{"-step", "90s500ms"}); err != cli.ErrUsage {
+		t.Errorf("Expected a usage error for a fractional step, got %v", err)
+	}
+}
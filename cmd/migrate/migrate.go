@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/database"
+)
+
+const description = `Apply or roll back the PostgreSQL schema migrations embedded in the binary, and print
+the resulting schema version.
+
+Commands:
+  up             Apply all pending migrations
+  down [N]       Roll back the last N migrations (default: 1)
+  version        Print the current schema version
+  force VERSION  Set the schema version without migrating, after repairing a failed migration`
+
+// Run applies the migrate command given by args to the PostgreSQL database of the configuration
+func Run(ctx context.Context, config *config.Config, args []string) error {
+	fs := cli.NewFlagSet("migrate", "up|down [N]|version|force VERSION", description)
+	if err := cli.Parse(fs, args, 2); err != nil {
+		return err
+	}
+
+	migrate, err := parse(fs.Args())
+	if err != nil {
+		return cli.Usagef(fs, "%v", err)
+	}
+
+	if config.Vars.StorageBackend != "postgres" {
+		return fmt.Errorf("migrations only apply to the postgres storage backend, not %q", config.Vars.StorageBackend)
+	}
+
+	db, err := database.Connect(ctx, config.GetDSN(), database.Options{
+		MaxOpenConns: config.Vars.DbMaxOpenConns,
+		MaxIdleConns: config.Vars.DbMaxIdleConns,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	m, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := migrate(m); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	if dirty {
+		fmt.Fprintf(cli.Output, "%d (dirty)\n", version)
+	} else {
+		fmt.Fprintln(cli.Output, version)
+	}
+
+	return nil
+}
+
+// parse returns the migration selected by args
+func parse(args []string) (func(m *database.Migrator) error, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing command")
+	}
+	command, rest := args[0], args[1:]
+
+	switch {
+	case command == "up" && len(rest) == 0:
+		return (*database.Migrator).Up, nil
+	case command == "down" && len(rest) <= 1:
+		steps := 1
+		if len(rest) == 1 {
+			n, err := strconv.Atoi(rest[0])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid number of migrations %q", rest[0])
+			}
+			steps = n
+		}
+		return func(m *database.Migrator) error { return m.Down(steps) }, nil
+	case command == "force" && len(rest) == 1:
+		version, err := strconv.Atoi(rest[0])
+		if err != nil || version < 0 {
+			return nil, fmt.Errorf("invalid version %q", rest[0])
+		}
+		return func(m *database.Migrator) error { return m.Force(version) }, nil
+	case command == "version" && len(rest) == 0:
+		return func(*database.Migrator) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("invalid command %q", args)
+	}
+}
@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/ingest"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/internal/sampler"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const description = `Re-ingest the webhook deliveries stored in the delivery log, in the order they were received.
+By default only the deliveries that were never processed successfully are replayed. With -all,
+processed deliveries are replayed too: the job state they lead to is the same, and the queue and
+approval wait times of their jobs are only recorded if they are missing. Durations are recorded at
+the time their job started or was approved, so they count in the period they happened in rather
+than the current one.`
+
+// Run replays the stored deliveries selected by args through the ingest processor
+func Run(ctx context.Context, config *config.Config, args []string) error {
+	fs := cli.NewFlagSet("replay", "[flags]", description)
+	var filter models.DeliveryFilter
+	cli.TimeVar(fs, &filter.From, "from", "replay the deliveries received at or after this `RFC3339` time")
+	cli.TimeVar(fs, &filter.To, "to", "replay the deliveries received before this `RFC3339` time")
+	all := fs.Bool("all", false, "also replay the deliveries that were already processed")
+	fs.IntVar(&filter.Limit, "batch", 500, "number of deliveries read from the delivery log at once")
+	if err := cli.Parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	if filter.Limit <= 0 {
+		return cli.Usagef(fs, "-batch must be positive")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return cli.Usagef(fs, "-from must be before -to")
+	}
+	filter.Unprocessed = !*all
+
+	db, closeDB, err := cli.OpenPersistentStorage(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() {
+		if err := closeDB(); err != nil {
+			logger.Logger.Error("Failed to close database connection", zap.Error(err))
+		}
+	}()
+
+	classifier, err := pools.Load(config.Vars.RunnerPoolsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load runner pools: %w", err)
+	}
+
+	// The sampler is not started: replayed events are stored without recording demand samples
+	processor := ingest.NewProcessor(db, classifier, sampler.NewSampler(db, classifier, config.Vars.SampleInterval, nil))
+
+	var replayed, failed, skipped int
+	start := time.Now()
+	for {
+		deliveries, err := db.GetDeliveries(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to read deliveries: %w", err)
+		}
+
+		for _, d := range deliveries {
+			if !processor.Handles(d.Event) {
+				skipped++
+				continue
+			}
+
+			err := processor.Process(ctx, ingest.Delivery{
+				ID:         d.ID,
+				Event:      d.Event,
+				Payload:    d.Payload,
+				ReceivedAt: d.ReceivedAt,
+			})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				failed++
+				logger.Logger.Error("Failed to replay delivery", zap.Error(err), zap.String("deliveryID", d.ID))
+				continue
+			}
+			replayed++
+		}
+
+		if len(deliveries) < filter.Limit {
+			break
+		}
+		last := deliveries[len(deliveries)-1]
+		filter.AfterReceivedAt, filter.AfterID = last.ReceivedAt, last.ID
+	}
+
+	fmt.Fprintf(cli.Output, "Replayed %d deliveries in %s (%d failed, %d skipped)\n",
+		replayed, time.Since(start).Round(time.Millisecond), failed, skipped)
+
+	if failed > 0 {
+		return fmt.Errorf("%d deliveries failed to replay", failed)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/database/sqlite"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap/zaptest"
+)
+
+const payload = `{
+	"action": "in_progress",
+	"workflow_job": {
+		"id": 123,
+		"run_id": 987,
+		"labels": ["self-hosted", "linux"],
+		"created_at": "2025-03-24T17:25:36Z",
+		"started_at": "2025-03-24T17:30:36Z"
+	},
+	"repository": {"id": 1001, "full_name": "octo-org/app"}
+}`
+
+func TestRun(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rpulse.db")
+
+	store, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	receivedAt := time.Now()
+	for _, d := range []struct{ id, event string }{{"guid-1", "workflow_job"}, {"guid-2", "push"}} {
+		if _, err := store.RecordDelivery(ctx, d.id, d.event, []byte(payload), receivedAt); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var out bytes.Buffer
+	cli.Output = &out
+	t.Cleanup(func() { cli.Output = os.Stdout })
+
+	cfg := &config.Config{Vars: config.Vars{StorageBackend: "sqlite", SQLitePath: path, SampleInterval: time.Minute}}
+	if err := Run(ctx, cfg, []string{"-batch", "1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Replayed 1 deliveries") || !strings.Contains(out.String(), "1 skipped") {
+		t.Errorf("Expected one replayed and one skipped delivery, got %q", out.String())
+	}
+
+	store, err = sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer store.Close()
+
+	if jobs, err := store.GetRunningJobs(ctx, models.RunnerTypeSelfHosted); err != nil || len(jobs) != 1 {
+		t.Errorf("Expected the replayed job to be running, got %v (%v)", jobs, err)
+	}
+	deliveries, err := store.GetDeliveries(ctx, models.DeliveryFilter{Unprocessed: true})
+	if err != nil || len(deliveries) != 1 || deliveries[0].ID != "guid-2" {
+		t.Errorf("Expected only the skipped delivery to be left unprocessed, got %+v (%v)", deliveries, err)
+	}
+}
+
+func TestRunMemory(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	cfg := &config.Config{Vars: config.Vars{StorageBackend: "memory"}}
+	if err := Run(context.Background(), cfg, nil); err == nil {
+		t.Error("Expected an error replaying from the memory backend")
+	}
+}
@@ -1,58 +1,172 @@
 package server
 
 import (
-	"os"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
 
+	"github.com/gateixeira/rpulse/cmd/cli"
 	"github.com/gateixeira/rpulse/handlers"
 	"github.com/gateixeira/rpulse/internal/config"
-	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/ingest"
+	"github.com/gateixeira/rpulse/internal/live"
+	"github.com/gateixeira/rpulse/internal/metrics"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/internal/reaper"
+	"github.com/gateixeira/rpulse/internal/sampler"
+	"github.com/gateixeira/rpulse/models"
 	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gateixeira/rpulse/templates"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-// SetupAndRun configures the router and starts the server
-func SetupAndRun() {
-	// Initialize the application state
-	config := config.NewConfig()
-
-	logger.InitLogger(config.Vars.LogLevel)
-	defer logger.SyncLogger()
+// Run configures the router and serves until ctx is cancelled
+func Run(ctx context.Context, config *config.Config, args []string) error {
+	fs := cli.NewFlagSet("serve", "", "Start the server. Running rpulse without a command does the same.")
+	if err := cli.Parse(fs, args, 0); err != nil {
+		return err
+	}
 
-	err := database.InitDB(config.GetDSN())
+	db, closeDB, err := cli.OpenStorage(ctx, config)
 	if err != nil {
-		logger.Logger.Error("Failed to initialize database", zap.Error(err))
-		os.Exit(1)
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 
 	defer func() {
-		if err := database.CloseDB(); err != nil {
+		if err := closeDB(); err != nil {
 			logger.Logger.Error("Failed to close database connection", zap.Error(err))
 		}
 	}()
 
-	// Initialize database wrapper
-	db := database.NewDBWrapper()
+	// Every database operation of the server is timed
+	db = metrics.InstrumentDB(db)
+
+	if err := db.ApplyRetentionPolicies(ctx, models.RetentionPolicies{
+		Raw:       config.Vars.RetentionRaw,
+		Jobs:      config.Vars.RetentionJobs,
+		Durations: config.Vars.RetentionDurations,
+		Rollup1m:  config.Vars.RetentionRollup1m,
+		Rollup15m: config.Vars.RetentionRollup15m,
+		Rollup1h:  config.Vars.RetentionRollup1h,
+	}); err != nil {
+		return fmt.Errorf("failed to apply retention policies: %w", err)
+	}
+
+	classifier, err := pools.Load(config.Vars.RunnerPoolsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load runner pools: %w", err)
+	}
+
+	// Report the current job counts on every scrape
+	metrics.Registry.MustRegister(metrics.NewDemandCollector(db, classifier))
+
+	// Start recording demand at a fixed interval, streaming it to the open dashboards
+	broadcaster := live.NewBroadcaster()
+	demandSampler := sampler.NewSampler(db, classifier, config.Vars.SampleInterval, broadcaster)
+	demandSampler.Start()
+
+	// Start the background ingestion of webhook deliveries
+	pipeline := ingest.NewPipeline(ingest.NewProcessor(db, classifier, demandSampler), config.Vars.IngestWorkers, config.Vars.IngestQueueSize)
+	pipeline.Start()
+
+	// Start abandoning jobs whose completed event never arrived
+	jobReaper := reaper.NewReaper(db, map[models.JobStatus]time.Duration{
+		models.JobStatusWaiting:    config.Vars.ReaperWaitingMaxAge,
+		models.JobStatusQueued:     config.Vars.ReaperQueuedMaxAge,
+		models.JobStatusInProgress: config.Vars.ReaperInProgressMaxAge,
+	}, config.Vars.ReaperInterval)
+	jobReaper.Start()
 
 	// Initialize handlers with dependencies
-	webhookHandler := handlers.NewWebhookHandler(db)
+	webhookHandler := handlers.NewWebhookHandler(db, pipeline)
 	apiHandler := handlers.NewAPIHandler(db)
 	dashboardHandler := handlers.NewDashboardHandler()
 	rootHandler := handlers.NewRootHandler()
+	statusHandler := handlers.NewStatusHandler(pipeline, jobReaper)
+	adminHandler := handlers.NewAdminHandler(db)
+	apiV1Handler := handlers.NewAPIV1Handler(db)
+	tokenHandler := handlers.NewTokenHandler(db)
+	liveHandler := handlers.NewLiveHandler(broadcaster)
 
 	r := gin.Default()
 
 	r.Static("/static", "./static")
-	r.LoadHTMLGlob("templates/*")
+	r.SetHTMLTemplate(template.Must(template.ParseFS(templates.FS, "*.html")))
 
 	r.GET("/", rootHandler.Root())
+	r.GET("/status", statusHandler.Status())
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 	r.POST("/webhook", handlers.ValidateGitHubWebhook(config), webhookHandler.Handle())
 	r.GET("/running-count", handlers.ValidateDashboardOrigin(), apiHandler.GetRunningCount())
+	r.GET("/history", handlers.ValidateDashboardOrigin(), apiHandler.GetHistory())
+	r.GET("/pools", handlers.ValidateDashboardOrigin(), apiHandler.GetPools())
+	r.GET("/pools/:pool/history", handlers.ValidateDashboardOrigin(), apiHandler.GetPoolHistory())
+	r.GET("/queue-time", handlers.ValidateDashboardOrigin(), apiHandler.GetQueueTime())
+	r.GET("/queue-time/histogram", handlers.ValidateDashboardOrigin(), apiHandler.GetQueueTimeHistogram())
+	r.GET("/job-durations", handlers.ValidateDashboardOrigin(), apiHandler.GetJobDurations())
+	r.GET("/job-durations/jobs", handlers.ValidateDashboardOrigin(), apiHandler.GetLongestJobs())
+	r.GET("/live", handlers.ValidateDashboardStream(), liveHandler.Stream())
 	r.GET("/dashboard", dashboardHandler.Dashboard())
 
-	logger.Logger.Info("Starting server on :" + config.Vars.Port + "...")
-	if err := r.Run(":" + config.Vars.Port); err != nil {
-		logger.Logger.Error("Failed to start server", zap.Error(err))
-		os.Exit(1)
+	// The versioned API authenticates with bearer tokens instead of the dashboard origin
+	v1 := r.Group("/api/v1")
+	read := v1.Group("", handlers.RequireAPIToken(db, models.TokenScopeRead))
+	read.GET("/counts", apiV1Handler.GetCounts())
+	read.GET("/history", apiV1Handler.GetHistory())
+	read.GET("/pools/:pool/history", apiV1Handler.GetPoolHistory())
+	read.GET("/queue-time", apiV1Handler.GetQueueTime())
+	read.GET("/job-durations", apiV1Handler.GetJobDurations())
+	read.GET("/job-durations/jobs", apiV1Handler.GetLongestJobs())
+	read.GET("/jobs", apiV1Handler.GetJobs())
+	read.GET("/jobs/:id", apiV1Handler.GetJob())
+	admin := v1.Group("", handlers.RequireAPIToken(db, models.TokenScopeAdmin))
+	admin.GET("/tokens", tokenHandler.ListTokens())
+	admin.POST("/tokens", tokenHandler.CreateToken())
+	admin.DELETE("/tokens/:id", tokenHandler.RevokeToken())
+	admin.GET("/retention", adminHandler.GetRetentionPolicies())
+
+	srv := &http.Server{
+		Addr:    ":" + config.Vars.Port,
+		Handler: r,
 	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Logger.Info("Starting server on :" + config.Vars.Port + "...")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- fmt.Errorf("failed to start server: %w", err)
+		}
+	}()
+
+	// Serve until the command is cancelled, shutting down the same way if the server failed to start
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-serveErr:
+	}
+
+	logger.Logger.Info("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Vars.ShutdownTimeout)
+	defer cancel()
+
+	// End the live streams, which would otherwise keep the server from shutting down.
+	// Then stop accepting deliveries and drain the ones already queued.
+	broadcaster.Close()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Logger.Error("Failed to shut down server", zap.Error(err))
+	}
+
+	if err := pipeline.Shutdown(shutdownCtx); err != nil {
+		logger.Logger.Error("Failed to drain ingest pipeline", zap.Error(err))
+	}
+
+	jobReaper.Shutdown()
+	demandSampler.Shutdown()
+
+	return runErr
 }
@@ -0,0 +1,237 @@
+package simulate
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/handlers"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const description = `Send simulated workflow_job webhooks to a running rpulse server. Every job is queued, starts
+after a random queue time and completes after a random run time, on a runner picked from the
+-labels sets. Deliveries are signed with WEBHOOK_SECRET.`
+
+// labelSets is a flag holding the label sets simulated jobs pick from, one comma-separated set per use
+type labelSets [][]string
+
+func (l *labelSets) String() string {
+	sets := make([]string, len(*l))
+	for i, labels := range *l {
+		sets[i] = strings.Join(labels, ",")
+	}
+	return strings.Join(sets, " ")
+}
+
+func (l *labelSets) Set(s string) error {
+	*l = append(*l, strings.Split(s, ","))
+	return nil
+}
+
+var defaultLabelSets = labelSets{
+	{"ubuntu-latest"},
+	{"windows-latest"},
+	{"self-hosted", "linux", "x64"},
+	{"self-hosted", "linux", "arm64"},
+}
+
+// Run sends the simulated jobs selected by args until they all completed or ctx is cancelled
+func Run(ctx context.Context, config *config.Config, args []string) error {
+	fs := cli.NewFlagSet("simulate", "[flags]", description)
+	url := fs.String("url", "http://localhost:"+config.Vars.Port+"/webhook", "webhook URL of the rpulse server")
+	jobs := fs.Int("jobs", 50, "number of jobs to simulate")
+	rate := fs.Float64("rate", 1, "number of jobs queued per second")
+	maxQueueTime := fs.Duration("max-queue-time", 30*time.Second, "longest time a job stays queued")
+	maxRunTime := fs.Duration("max-run-time", 2*time.Minute, "longest time a job runs")
+	var labels labelSets
+	fs.Var(&labels, "labels", "comma-separated `labels` of a runner, repeated for every kind of runner (default: GitHub-hosted Ubuntu and Windows, self-hosted Linux x64 and arm64)")
+	if err := cli.Parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *jobs <= 0 || *rate <= 0 {
+		return cli.Usagef(fs, "-jobs and -rate must be positive")
+	}
+	if *maxQueueTime < 0 || *maxRunTime < 0 {
+		return cli.Usagef(fs, "-max-queue-time and -max-run-time must not be negative")
+	}
+	if len(labels) == 0 {
+		labels = defaultLabelSets
+	}
+
+	s := &simulator{
+		client: &http.Client{Timeout: 10 * time.Second},
+		url:    *url,
+		secret: config.Vars.WebhookSecret,
+	}
+
+	logger.Logger.Info("Simulating jobs", zap.String("url", s.url), zap.Int("jobs", *jobs), zap.Float64("rate", *rate))
+
+	// Job IDs are based on the start time so that consecutive simulations do not collide
+	base := time.Now().Unix() * 1000
+	interval := time.Duration(float64(time.Second) / *rate)
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for i := range *jobs {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		job := models.WebhookWorkflowJob{
+			ID:           base + int64(i),
+			RunID:        base + int64(i),
+			RunAttempt:   1,
+			WorkflowName: "Simulation",
+			Name:         fmt.Sprintf("job-%d", i+1),
+			HeadBranch:   "main",
+			Labels:       labels[rand.N(len(labels))],
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.run(ctx, job, randomDuration(*maxQueueTime), randomDuration(*maxRunTime))
+		}()
+	}
+	wg.Wait()
+
+	fmt.Fprintf(cli.Output, "Sent %d deliveries (%d failed)\n", s.sent.Load(), s.failed.Load())
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed := s.failed.Load(); failed > 0 {
+		return fmt.Errorf("%d deliveries failed", failed)
+	}
+	return nil
+}
+
+// simulator sends the webhook deliveries of simulated jobs
+type simulator struct {
+	client *http.Client
+	url    string
+	secret string
+
+	sent   atomic.Int64
+	failed atomic.Int64
+}
+
+// run sends the queued, in_progress and completed events of a job, waiting queueTime and runTime in between
+func (s *simulator) run(ctx context.Context, job models.WebhookWorkflowJob, queueTime, runTime time.Duration) {
+	job.CreatedAt = time.Now().UTC()
+	s.send(ctx, "queued", job)
+
+	if !sleep(ctx, queueTime) {
+		return
+	}
+	job.StartedAt = time.Now().UTC()
+	job.RunnerID = job.ID
+	job.RunnerName = fmt.Sprintf("simulated-runner-%d", job.ID)
+	s.send(ctx, "in_progress", job)
+
+	if !sleep(ctx, runTime) {
+		return
+	}
+	job.CompletedAt = time.Now().UTC()
+	job.Conclusion = "success"
+	s.send(ctx, "completed", job)
+}
+
+// send delivers a workflow_job event the way GitHub does, counting whether it was accepted
+func (s *simulator) send(ctx context.Context, action string, job models.WebhookWorkflowJob) {
+	if err := s.deliver(ctx, action, job); err != nil {
+		s.failed.Add(1)
+		logger.Logger.Error("Failed to send simulated delivery",
+			zap.Error(err), zap.Int64("jobID", job.ID), zap.String("action", action))
+		return
+	}
+	s.sent.Add(1)
+}
+
+func (s *simulator) deliver(ctx context.Context, action string, job models.WebhookWorkflowJob) error {
+	body, err := json.Marshal(models.WebhookEvent{
+		Action:       action,
+		WorkflowJob:  job,
+		Repository:   models.Repository{ID: 1, FullName: "rpulse/simulation"},
+		Organization: models.Organization{ID: 1, Login: "rpulse"},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(handlers.EventHeader, "workflow_job")
+	req.Header.Set(handlers.DeliveryHeader, deliveryID())
+	if s.secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.secret))
+		mac.Write(body)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// deliveryID returns a random delivery GUID
+func deliveryID() string {
+	b := make([]byte, 16)
+	_, _ = cryptorand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// randomDuration returns a random duration from zero up to limit
+func randomDuration(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// sleep waits for d and reports whether it did so before ctx was cancelled
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
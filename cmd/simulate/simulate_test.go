@@ -0,0 +1,75 @@
+package simulate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/handlers"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = zaptest.NewLogger(t)
+
+	cfg := &config.Config{Vars: config.Vars{WebhookSecret: "test-secret", Port: "8080"}}
+
+	// Deliveries pass the signature validation of the server
+	var mu sync.Mutex
+	actions := make(map[int64][]string)
+	router := gin.New()
+	router.POST("/webhook", handlers.ValidateGitHubWebhook(cfg), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		var event models.WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil || c.GetHeader(handlers.EventHeader) != "workflow_job" || c.GetHeader(handlers.DeliveryHeader) == "" {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		actions[event.WorkflowJob.ID] = append(actions[event.WorkflowJob.ID], event.Action)
+		mu.Unlock()
+		c.Status(http.StatusAccepted)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var out bytes.Buffer
+	cli.Output = &out
+	t.Cleanup(func() { cli.Output = os.Stdout })
+
+	err := Run(context.Background(), cfg, []string{
+		"-url", server.URL + "/webhook",
+		"-jobs", "3",
+		"-rate", "1000",
+		"-max-queue-time", "0",
+		"-max-run-time", "0",
+		"-labels", "self-hosted,linux",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(actions) != 3 {
+		t.Fatalf("Expected 3 jobs, got %v", actions)
+	}
+	for id, sequence := range actions {
+		if len(sequence) != 3 || sequence[0] != "queued" || sequence[1] != "in_progress" || sequence[2] != "completed" {
+			t.Errorf("Expected job %d to be queued, started and completed, got %v", id, sequence)
+		}
+	}
+	if out.String() != "Sent 9 deliveries (0 failed)\n" {
+		t.Errorf("Expected a summary of 9 deliveries, got %q", out.String())
+	}
+}
@@ -0,0 +1,164 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/internal/apitoken"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const description = `Manage the bearer tokens of the /api/v1 endpoints. Tokens are stored in the postgres or
+sqlite storage backend, and the server sees changes immediately.
+
+Commands:
+  create    Create a token and print its secret, which cannot be shown again
+  list      List the tokens with their scope, expiry and status
+  revoke    Revoke a token by ID
+
+Run 'rpulse token <command> -help' for the flags of a command.`
+
+// Run applies the token command given by args
+func Run(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := cli.NewFlagSet("token", "create|list|revoke [flags]", description)
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if err := cli.Parse(fs, args, 0); err != nil {
+			return err
+		}
+		return cli.Usagef(fs, "missing command")
+	}
+
+	var run func(context.Context, *config.Config, []string) error
+	switch args[0] {
+	case "create":
+		run = create
+	case "list":
+		run = list
+	case "revoke":
+		run = revoke
+	default:
+		return cli.Usagef(fs, "unknown command %q", args[0])
+	}
+
+	return run(ctx, cfg, args[1:])
+}
+
+// withStorage calls fn with the persistent storage backend, which is closed when fn returns
+func withStorage(ctx context.Context, config *config.Config, fn func(db database.DatabaseInterface) error) error {
+	db, closeDB, err := cli.OpenPersistentStorage(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() {
+		if err := closeDB(); err != nil {
+			logger.Logger.Error("Failed to close database connection", zap.Error(err))
+		}
+	}()
+
+	return fn(db)
+}
+
+// create creates a token and prints its ID and secret
+func create(ctx context.Context, config *config.Config, args []string) error {
+	fs := cli.NewFlagSet("token create", "-name NAME [flags]", "Create an API token and print its secret, which cannot be shown again.")
+	name := fs.String("name", "", "what the token is used for, such as the tool using it")
+	scope := fs.String("scope", string(models.TokenScopeRead), "access granted by the token: read, or admin to also manage tokens")
+	expires := fs.Duration("expires", 0, "how long the token is valid for, such as 720h; it never expires when 0")
+	if err := cli.Parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	tokenScope, err := apitoken.ParseScope(*scope)
+	if err != nil {
+		return cli.Usagef(fs, "%v", err)
+	}
+	if strings.TrimSpace(*name) == "" {
+		return cli.Usagef(fs, "-name is required")
+	}
+	if *expires < 0 {
+		return cli.Usagef(fs, "-expires must not be negative")
+	}
+
+	now := time.Now()
+	var expiresAt time.Time
+	if *expires > 0 {
+		expiresAt = now.Add(*expires)
+	}
+
+	token, secret, err := apitoken.New(*name, tokenScope, now, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	if err := withStorage(ctx, config, func(db database.DatabaseInterface) error {
+		return db.CreateAPIToken(ctx, token)
+	}); err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+
+	fmt.Fprintf(cli.Output, "Created %s token %s\n%s\n", token.Scope, token.ID, secret)
+	return nil
+}
+
+// list prints every token as a table
+func list(ctx context.Context, config *config.Config, args []string) error {
+	fs := cli.NewFlagSet("token list", "", "List the API tokens with their scope, expiry and status.")
+	if err := cli.Parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	var tokens []models.APIToken
+	if err := withStorage(ctx, config, func(db database.DatabaseInterface) (err error) {
+		tokens, err = db.ListAPITokens(ctx)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(cli.Output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCOPE\tCREATED\tEXPIRES\tSTATUS")
+	for _, token := range tokens {
+		expires := "never"
+		if !token.ExpiresAt.IsZero() {
+			expires = token.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			token.ID, token.Name, token.Scope, token.CreatedAt.UTC().Format(time.RFC3339), expires, apitoken.Status(token, now))
+	}
+	return w.Flush()
+}
+
+// revoke revokes the token with the ID given as argument
+func revoke(ctx context.Context, config *config.Config, args []string) error {
+	fs := cli.NewFlagSet("token revoke", "ID", "Revoke an API token. Requests made with it are rejected from then on.")
+	if err := cli.Parse(fs, args, 1); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return cli.Usagef(fs, "missing token ID")
+	}
+	id := fs.Arg(0)
+
+	var found bool
+	if err := withStorage(ctx, config, func(db database.DatabaseInterface) (err error) {
+		found, err = db.RevokeAPIToken(ctx, id, time.Now())
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("token %s not found", id)
+	}
+
+	fmt.Fprintf(cli.Output, "Revoked token %s\n", id)
+	return nil
+}
@@ -0,0 +1,96 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gateixeira/rpulse/cmd/cli"
+	"github.com/gateixeira/rpulse/internal/apitoken"
+	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/database/sqlite"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRun(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rpulse.db")
+
+	var out bytes.Buffer
+	cli.Output = &out
+	t.Cleanup(func() { cli.Output = os.Stdout })
+
+	cfg := &config.Config{Vars: config.Vars{StorageBackend: "sqlite", SQLitePath: path}}
+	if err := Run(ctx, cfg, []string{"create", "-name", "grafana", "-scope", "admin", "-expires", "24h"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], apitoken.Prefix) {
+		t.Fatalf("Expected the token ID and secret, got %q", out.String())
+	}
+	id := strings.TrimPrefix(lines[0], "Created admin token ")
+	secret := lines[1]
+
+	store, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	token, found, err := store.GetAPIToken(ctx, apitoken.Hash(secret))
+	store.Close()
+	if err != nil || !found {
+		t.Fatalf("Expected the token to be stored, got %v (%v)", found, err)
+	}
+	if token.ID != id || token.Name != "grafana" || token.Scope != models.TokenScopeAdmin || token.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected token %+v", token)
+	}
+
+	out.Reset()
+	if err := Run(ctx, cfg, []string{"revoke", id}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := Run(ctx, cfg, []string{"revoke", "unknown"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected an unknown token to be reported, got %v", err)
+	}
+
+	out.Reset()
+	if err := Run(ctx, cfg, []string{"list"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	lines = strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], id) || !strings.HasSuffix(lines[1], "revoked") {
+		t.Errorf("Expected the revoked token to be listed, got %q", out.String())
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	cfg := &config.Config{Vars: config.Vars{StorageBackend: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "rpulse.db")}}
+	for _, args := range [][]string{
+		nil,
+		{"rotate"},
+		{"create"},
+		{"create", "-name", "ci", "-scope", "write"},
+		{"create", "-name", "ci", "-expires", "-1h"},
+		{"revoke"},
+		{"list", "extra"},
+	} {
+		if err := Run(context.Background(), cfg, args); !errors.Is(err, cli.ErrUsage) {
+			t.Errorf("Expected a usage error for %q, got %v", args, err)
+		}
+	}
+}
+
+func TestRunMemory(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+	cfg := &config.Config{Vars: config.Vars{StorageBackend: "memory"}}
+	if err := Run(context.Background(), cfg, []string{"list"}); err == nil || errors.Is(err, cli.ErrUsage) {
+		t.Errorf("Expected the memory backend to be rejected, got %v", err)
+	}
+}
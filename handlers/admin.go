@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type AdminHandler struct {
+	db database.DatabaseInterface
+}
+
+func NewAdminHandler(db database.DatabaseInterface) *AdminHandler {
+	return &AdminHandler{db: db}
+}
+
+// GetRetentionPolicies reports the retention policy in effect on every table
+func (h *AdminHandler) GetRetentionPolicies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies, err := h.db.GetRetentionPolicies(c.Request.Context())
+		if err != nil {
+			logger.Logger.Error("Failed to get retention policies", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"policies": policies})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupAdminTest(t *testing.T) (*gin.Engine, *MockDB) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = zaptest.NewLogger(t)
+
+	mockDB := new(MockDB)
+	router := gin.New()
+	router.GET("/api/v1/retention", NewAdminHandler(mockDB).GetRetentionPolicies())
+
+	return router, mockDB
+}
+
+func TestAdminHandler_GetRetentionPolicies(t *testing.T) {
+	router, mockDB := setupAdminTest(t)
+
+	mockDB.On("GetRetentionPolicies").Return([]models.RetentionPolicy{
+		{Table: "historical_entries", DataClass: "raw", DropAfter: "30 days"},
+		{Table: "runner_stats_1h", DataClass: "rollup_1h", DropAfter: "730 days"},
+	}, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/retention", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `{"table":"historical_entries","data_class":"raw","drop_after":"30 days"}`)
+	assert.Contains(t, w.Body.String(), `"drop_after":"730 days"`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAdminHandler_GetRetentionPolicies_Error(t *testing.T) {
+	router, mockDB := setupAdminTest(t)
+
+	mockDB.On("GetRetentionPolicies").Return(nil, errors.New("database error"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/retention", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockDB.AssertExpectations(t)
+}
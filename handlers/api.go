@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gateixeira/rpulse/internal/database"
@@ -28,7 +33,13 @@ func NewAPIHandler(db database.DatabaseInterface) *APIHandler {
 // GetRunningCount returns the current count of running workflows and historical data
 func (h *APIHandler) GetRunningCount() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		period := c.DefaultQuery("period", "all")
+		ctx := c.Request.Context()
+		period := c.DefaultQuery("period", "hour")
+
+		if !historyPeriods[period] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period"})
+			return
+		}
 
 		historicalChan := make(chan dataResult)
 		queueTimeChan := make(chan dataResult)
@@ -36,19 +47,21 @@ func (h *APIHandler) GetRunningCount() gin.HandlerFunc {
 		githubHostedChan := make(chan dataResult)
 		selfHostedChan := make(chan dataResult)
 		queuedChan := make(chan dataResult)
+		waitingChan := make(chan dataResult)
+		approvalWaitChan := make(chan dataResult)
 
 		go func() {
-			data, err := h.db.GetHistoricalDataByPeriod(period)
+			data, err := h.db.GetHistoricalDataByPeriod(ctx, period)
 			historicalChan <- dataResult{value: data, err: err}
 		}()
 
 		go func() {
-			avgTime, err := h.db.GetAverageQueueTime()
-			queueTimeChan <- dataResult{value: avgTime, err: err}
+			stats, err := h.db.GetQueueTimeStats(ctx, models.QueueTimeFilter{Period: period})
+			queueTimeChan <- dataResult{value: stats, err: err}
 		}()
 
 		go func() {
-			peak, timestamp, err := h.db.CalculatePeakDemand(period)
+			peak, timestamp, err := h.db.CalculatePeakDemand(ctx, period)
 			peakDemandChan <- dataResult{value: map[string]interface{}{
 				"count":     peak,
 				"timestamp": timestamp,
@@ -56,31 +69,43 @@ func (h *APIHandler) GetRunningCount() gin.HandlerFunc {
 		}()
 
 		go func() {
-			workflows, err := h.db.GetRunningJobs(utils.GetRunnerType([]string{}))
+			workflows, err := h.db.GetRunningJobs(ctx, utils.GetRunnerType([]string{}))
 			githubHostedChan <- dataResult{value: len(workflows), err: err}
 		}()
 
 		go func() {
-			workflows, err := h.db.GetRunningJobs(utils.GetRunnerType([]string{"self-hosted"}))
+			workflows, err := h.db.GetRunningJobs(ctx, utils.GetRunnerType([]string{"self-hosted"}))
 			selfHostedChan <- dataResult{value: len(workflows), err: err}
 		}()
 
 		go func() {
-			count, err := h.db.CountQueuedJobs()
+			count, err := h.db.CountQueuedJobs(ctx)
 			if err == nil && count > 0 {
 				logger.Logger.Debug("Queued jobs", zap.Int("count", count))
 			}
 			queuedChan <- dataResult{value: count, err: err}
 		}()
 
+		go func() {
+			count, err := h.db.CountWaitingJobs(ctx)
+			waitingChan <- dataResult{value: count, err: err}
+		}()
+
+		go func() {
+			avgTime, err := h.db.GetAverageApprovalWaitTime(ctx, period)
+			approvalWaitChan <- dataResult{value: avgTime, err: err}
+		}()
+
 		historical := <-historicalChan
 		queueTime := <-queueTimeChan
 		peakDemand := <-peakDemandChan
 		githubHosted := <-githubHostedChan
 		selfHosted := <-selfHostedChan
 		queued := <-queuedChan
+		waiting := <-waitingChan
+		approvalWait := <-approvalWaitChan
 
-		for _, result := range []dataResult{historical, queueTime, peakDemand, githubHosted, selfHosted, queued} {
+		for _, result := range []dataResult{historical, queueTime, peakDemand, githubHosted, selfHosted, queued, waiting, approvalWait} {
 			if result.err != nil {
 				logger.Logger.Error("Error retrieving data", zap.Error(result.err))
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
@@ -92,11 +117,546 @@ func (h *APIHandler) GetRunningCount() gin.HandlerFunc {
 			"current_count_github_hosted": githubHosted.value.(int),
 			"current_count_self_hosted":   selfHosted.value.(int),
 			"current_queued_count":        queued.value.(int),
+			"current_waiting_count":       waiting.value.(int),
 			"historical_data":             historical.value.([]models.HistoricalEntry),
-			"avg_queue_time_ms":           queueTime.value.(time.Duration).Milliseconds(),
+			"avg_queue_time_ms":           queueTime.value.(models.QueueTimeStats).AvgMs,
+			"queue_time":                  queueTime.value.(models.QueueTimeStats),
+			"avg_approval_wait_time_ms":   approvalWait.value.(time.Duration).Milliseconds(),
 			"peak_demand":                 peakDemand.value.(map[string]interface{})["count"],
 			"peak_demand_timestamp":       peakDemand.value.(map[string]interface{})["timestamp"],
 			"period":                      period,
 		})
 	}
 }
+
+// historyPeriods are the fixed periods history and analytics can be requested for
+var historyPeriods = map[string]bool{"hour": true, "day": true, "week": true, "month": true}
+
+// GetPools returns the current job counts of every runner pool and its average queue and approval
+// wait times over a period
+func (h *APIHandler) GetPools() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		period := c.DefaultQuery("period", "hour")
+
+		if !historyPeriods[period] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period"})
+			return
+		}
+
+		runningChan := make(chan dataResult)
+		queuedChan := make(chan dataResult)
+		waitingChan := make(chan dataResult)
+		queueTimeChan := make(chan dataResult)
+		approvalWaitChan := make(chan dataResult)
+
+		go func() {
+			counts, err := h.db.CountRunningJobsByPool(ctx)
+			runningChan <- dataResult{value: counts, err: err}
+		}()
+
+		go func() {
+			counts, err := h.db.CountQueuedJobsByPool(ctx)
+			queuedChan <- dataResult{value: counts, err: err}
+		}()
+
+		go func() {
+			counts, err := h.db.CountWaitingJobsByPool(ctx)
+			waitingChan <- dataResult{value: counts, err: err}
+		}()
+
+		go func() {
+			averages, err := h.db.GetAverageQueueTimeByPool(ctx, period)
+			queueTimeChan <- dataResult{value: averages, err: err}
+		}()
+
+		go func() {
+			averages, err := h.db.GetAverageApprovalWaitTimeByPool(ctx, period)
+			approvalWaitChan <- dataResult{value: averages, err: err}
+		}()
+
+		running := <-runningChan
+		queued := <-queuedChan
+		waiting := <-waitingChan
+		queueTime := <-queueTimeChan
+		approvalWait := <-approvalWaitChan
+
+		for _, result := range []dataResult{running, queued, waiting, queueTime, approvalWait} {
+			if result.err != nil {
+				logger.Logger.Error("Error retrieving pool data", zap.Error(result.err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+				return
+			}
+		}
+
+		runningCounts := running.value.(map[string]int)
+		queuedCounts := queued.value.(map[string]int)
+		waitingCounts := waiting.value.(map[string]int)
+		averages := queueTime.value.(map[string]time.Duration)
+		approvalAverages := approvalWait.value.(map[string]time.Duration)
+
+		names := map[string]bool{}
+		for _, counts := range []map[string]int{runningCounts, queuedCounts, waitingCounts} {
+			for pool := range counts {
+				names[pool] = true
+			}
+		}
+		for _, durations := range []map[string]time.Duration{averages, approvalAverages} {
+			for pool := range durations {
+				names[pool] = true
+			}
+		}
+
+		pools := make([]gin.H, 0, len(names))
+		for pool := range names {
+			pools = append(pools, gin.H{
+				"pool":                      pool,
+				"current_running_count":     runningCounts[pool],
+				"current_queued_count":      queuedCounts[pool],
+				"current_waiting_count":     waitingCounts[pool],
+				"avg_queue_time_ms":         averages[pool].Milliseconds(),
+				"avg_approval_wait_time_ms": approvalAverages[pool].Milliseconds(),
+			})
+		}
+		sort.Slice(pools, func(i, j int) bool {
+			return pools[i]["pool"].(string) < pools[j]["pool"].(string)
+		})
+
+		c.JSON(http.StatusOK, gin.H{"pools": pools, "period": period})
+	}
+}
+
+// GetPoolHistory returns the historical data and peak demand of a runner pool for a period,
+// or for a time range when from is given
+func (h *APIHandler) GetPoolHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		pool := c.Param("pool")
+		period := c.DefaultQuery("period", "hour")
+
+		if c.Query("from") != "" {
+			h.poolHistoryByRange(c, pool)
+			return
+		}
+
+		if !historyPeriods[period] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period"})
+			return
+		}
+
+		historicalChan := make(chan dataResult)
+		peakDemandChan := make(chan dataResult)
+
+		go func() {
+			data, err := h.db.GetPoolHistoricalDataByPeriod(ctx, period, pool)
+			historicalChan <- dataResult{value: data, err: err}
+		}()
+
+		go func() {
+			peak, timestamp, err := h.db.CalculatePeakDemandByPool(ctx, period, pool)
+			peakDemandChan <- dataResult{value: map[string]interface{}{
+				"count":     peak,
+				"timestamp": timestamp,
+			}, err: err}
+		}()
+
+		historical := <-historicalChan
+		peakDemand := <-peakDemandChan
+
+		for _, result := range []dataResult{historical, peakDemand} {
+			if result.err != nil {
+				logger.Logger.Error("Error retrieving pool data", zap.Error(result.err), zap.String("pool", pool))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"pool":                  pool,
+			"historical_data":       historical.value.([]models.PoolHistoricalEntry),
+			"peak_demand":           peakDemand.value.(map[string]interface{})["count"],
+			"peak_demand_timestamp": peakDemand.value.(map[string]interface{})["timestamp"],
+			"period":                period,
+		})
+	}
+}
+
+// GetHistory returns the historical data and peak demand of the time range given by from, to and step
+func (h *APIHandler) GetHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := timeRange(c, h.db, time.Now())
+		if !ok {
+			return
+		}
+
+		entries, err := h.db.GetHistoricalDataByRange(c.Request.Context(), r)
+		if err != nil {
+			logger.Logger.Error("Error retrieving historical data", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		peak, peakTimestamp := 0, ""
+		for _, entry := range entries {
+			if entry.PeakTotal > peak {
+				peak, peakTimestamp = entry.PeakTotal, entry.Timestamp
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":                  r.From.Format(time.RFC3339),
+			"to":                    r.To.Format(time.RFC3339),
+			"step":                  r.Step.String(),
+			"historical_data":       entries,
+			"peak_demand":           peak,
+			"peak_demand_timestamp": peakTimestamp,
+		})
+	}
+}
+
+// poolHistoryByRange answers GetPoolHistory for the time range given by from, to and step
+func (h *APIHandler) poolHistoryByRange(c *gin.Context, pool string) {
+	r, ok := timeRange(c, h.db, time.Now())
+	if !ok {
+		return
+	}
+
+	entries, err := h.db.GetPoolHistoricalDataByRange(c.Request.Context(), r, pool)
+	if err != nil {
+		logger.Logger.Error("Error retrieving pool data", zap.Error(err), zap.String("pool", pool))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+		return
+	}
+
+	peak, peakTimestamp := 0, ""
+	for _, entry := range entries {
+		if entry.PeakTotal > peak {
+			peak, peakTimestamp = entry.PeakTotal, entry.Timestamp
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pool":                  pool,
+		"from":                  r.From.Format(time.RFC3339),
+		"to":                    r.To.Format(time.RFC3339),
+		"step":                  r.Step.String(),
+		"historical_data":       entries,
+		"peak_demand":           peak,
+		"peak_demand_timestamp": peakTimestamp,
+	})
+}
+
+const (
+	// maxRangePoints caps the number of buckets a time range may be split into
+	maxRangePoints = 1000
+	// defaultRangePoints is the number of buckets aimed for when no step is given
+	defaultRangePoints = 300
+)
+
+// rangeSteps are the steps picked from when no step is given
+var rangeSteps = []time.Duration{
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+}
+
+// timeRange reads the from and to RFC3339 timestamps and the step duration query parameters.
+// The end defaults to now and the step to the smallest of rangeSteps that keeps the range
+// within defaultRangePoints. Older ranges are only kept by the coarser rollups, so the step
+// must be a multiple of the StepGranularity of the database. It answers 400 and returns false
+// when the range is invalid.
+func timeRange(c *gin.Context, db database.DatabaseInterface, now time.Time) (models.TimeRange, bool) {
+	r, err := parseTimeRange(c.Query("from"), c.Query("to"), c.Query("step"), now, db.StepGranularity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time range: " + err.Error()})
+		return models.TimeRange{}, false
+	}
+	return r, true
+}
+
+func parseTimeRange(from, to, step string, now time.Time, granularity func(from, now time.Time) time.Duration) (models.TimeRange, error) {
+	var r models.TimeRange
+	var err error
+
+	if r.From, err = time.Parse(time.RFC3339, from); err != nil {
+		return models.TimeRange{}, errors.New("from must be an RFC3339 timestamp")
+	}
+
+	r.To = now
+	if to != "" {
+		if r.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return models.TimeRange{}, errors.New("to must be an RFC3339 timestamp")
+		}
+	}
+
+	if !r.From.Before(r.To) {
+		return models.TimeRange{}, errors.New("from must be before to")
+	}
+
+	unit := granularity(r.From, now)
+	span := r.To.Sub(r.From)
+
+	if step == "" {
+		r.Step = defaultStep(span, unit)
+		return r, nil
+	}
+
+	if r.Step, err = time.ParseDuration(step); err != nil || r.Step < time.Second || r.Step%time.Second != 0 {
+		return models.TimeRange{}, errors.New("step must be a whole number of seconds such as 30s or 5m")
+	}
+
+	if r.Step%unit != 0 {
+		return models.TimeRange{}, fmt.Errorf("step must be a multiple of %s for a range starting at %s", unit, from)
+	}
+
+	if (span+r.Step-1)/r.Step > maxRangePoints {
+		// The smallest multiple of unit that fits the range in maxRangePoints buckets
+		minStep := (span + maxRangePoints*unit - 1) / (maxRangePoints * unit) * unit
+		return models.TimeRange{}, fmt.Errorf("more than %d points, use a step of at least %s", maxRangePoints, minStep)
+	}
+
+	return r, nil
+}
+
+// defaultStep returns the smallest multiple of unit among rangeSteps splitting span into at
+// most defaultRangePoints buckets
+func defaultStep(span, unit time.Duration) time.Duration {
+	for _, step := range rangeSteps {
+		if step%unit != 0 {
+			continue
+		}
+		if span/step <= defaultRangePoints {
+			return step
+		}
+	}
+
+	// Spans of many months are split into whole days
+	days := (span/defaultRangePoints + 24*time.Hour - 1) / (24 * time.Hour)
+	return days * 24 * time.Hour
+}
+
+// defaultHistogramBounds split queue times into buckets from seconds up to an hour
+var defaultHistogramBounds = []time.Duration{
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+}
+
+// GetQueueTime returns the queue time percentiles for a period, optionally filtered by runner pool, repository and labels
+func (h *APIHandler) GetQueueTime() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := queueTimeFilter(c)
+		if !ok {
+			return
+		}
+
+		stats, err := h.db.GetQueueTimeStats(c.Request.Context(), filter)
+		if err != nil {
+			logger.Logger.Error("Error retrieving queue time stats", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"period":     filter.Period,
+			"queue_time": stats,
+		})
+	}
+}
+
+// GetQueueTimeHistogram returns the number of queue times in each duration bucket, filtered like GetQueueTime
+func (h *APIHandler) GetQueueTimeHistogram() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := queueTimeFilter(c)
+		if !ok {
+			return
+		}
+
+		bounds := defaultHistogramBounds
+		if value := c.Query("bounds"); value != "" {
+			parsed, err := parseHistogramBounds(value)
+			if err != nil {
+				logger.Logger.Debug("Invalid histogram bounds", zap.String("bounds", value), zap.Error(err))
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bounds"})
+				return
+			}
+			bounds = parsed
+		}
+
+		buckets, err := h.db.GetQueueTimeHistogram(c.Request.Context(), filter, bounds)
+		if err != nil {
+			logger.Logger.Error("Error retrieving queue time histogram", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"period":  filter.Period,
+			"buckets": buckets,
+		})
+	}
+}
+
+// queueTimeFilter reads the period, pool, repo and comma-separated labels query parameters.
+// It answers 400 and returns false when the period is invalid.
+func queueTimeFilter(c *gin.Context) (models.QueueTimeFilter, bool) {
+	filter := models.QueueTimeFilter{
+		Period:     c.DefaultQuery("period", "day"),
+		Pool:       c.Query("pool"),
+		Repository: c.Query("repo"),
+	}
+
+	if !historyPeriods[filter.Period] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period"})
+		return models.QueueTimeFilter{}, false
+	}
+	filter.Labels = queryLabels(c)
+
+	return filter, true
+}
+
+// queryLabels reads the comma-separated labels query parameter
+func queryLabels(c *gin.Context) []string {
+	var labels []string
+	for _, label := range strings.Split(c.Query("labels"), ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// parseHistogramBounds parses comma-separated durations such as "30s,1m,5m" into ascending bucket bounds
+func parseHistogramBounds(value string) ([]time.Duration, error) {
+	var bounds []time.Duration
+	for _, field := range strings.Split(value, ",") {
+		bound, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if bound <= 0 || (len(bounds) > 0 && bound <= bounds[len(bounds)-1]) {
+			return nil, errors.New("bounds must be positive and ascending")
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// jobDurationGroupings are the ways job durations can be grouped
+var jobDurationGroupings = map[string]bool{"pool": true, "repository": true, "workflow": true, "job": true}
+
+// GetJobDurations returns the run duration aggregates of completed jobs grouped by pool, repository, workflow or job,
+// with the groups that used the most runner minutes first
+func (h *APIHandler) GetJobDurations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupBy := c.DefaultQuery("group_by", "workflow")
+		if !jobDurationGroupings[groupBy] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_by"})
+			return
+		}
+
+		filter, ok := jobDurationFilter(c)
+		if !ok {
+			return
+		}
+
+		limit, ok := queryLimit(c)
+		if !ok {
+			return
+		}
+
+		stats, err := h.db.GetJobDurationStats(c.Request.Context(), groupBy, filter, limit)
+		if err != nil {
+			logger.Logger.Error("Error retrieving job duration stats", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"period":   filter.Period,
+			"group_by": groupBy,
+			"groups":   stats,
+		})
+	}
+}
+
+// GetLongestJobs returns the completed jobs that ran the longest, filtered like GetJobDurations
+func (h *APIHandler) GetLongestJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := jobDurationFilter(c)
+		if !ok {
+			return
+		}
+
+		limit, ok := queryLimit(c)
+		if !ok {
+			return
+		}
+
+		jobs, err := h.db.GetLongestJobs(c.Request.Context(), filter, limit)
+		if err != nil {
+			logger.Logger.Error("Error retrieving longest jobs", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"period": filter.Period,
+			"jobs":   jobs,
+		})
+	}
+}
+
+// jobDurationFilter reads the period, pool, repo, workflow and job query parameters.
+// It answers 400 and returns false when the period is invalid.
+func jobDurationFilter(c *gin.Context) (models.JobDurationFilter, bool) {
+	filter := models.JobDurationFilter{
+		Period:     c.DefaultQuery("period", "day"),
+		Pool:       c.Query("pool"),
+		Repository: c.Query("repo"),
+		Workflow:   c.Query("workflow"),
+		Job:        c.Query("job"),
+	}
+
+	if !historyPeriods[filter.Period] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period"})
+		return models.JobDurationFilter{}, false
+	}
+
+	return filter, true
+}
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// queryLimit reads the limit query parameter. It answers 400 and returns false when the limit
+// is not a number between 1 and maxLimit.
+func queryLimit(c *gin.Context) (int, bool) {
+	value := c.Query("limit")
+	if value == "" {
+		return defaultLimit, true
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 || limit > maxLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return 0, false
+	}
+
+	return limit, true
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gateixeira/rpulse/internal/database"
 	"github.com/gateixeira/rpulse/models"
 	"github.com/gateixeira/rpulse/pkg/logger"
 	"github.com/gin-gonic/gin"
@@ -22,6 +23,13 @@ func setupAPITest(t *testing.T) (*gin.Engine, *MockDB) {
 	router := gin.New()
 	apiHandler := NewAPIHandler(mockDB)
 	router.GET("/running-count", apiHandler.GetRunningCount())
+	router.GET("/history", apiHandler.GetHistory())
+	router.GET("/pools", apiHandler.GetPools())
+	router.GET("/pools/:pool/history", apiHandler.GetPoolHistory())
+	router.GET("/queue-time", apiHandler.GetQueueTime())
+	router.GET("/queue-time/histogram", apiHandler.GetQueueTimeHistogram())
+	router.GET("/job-durations", apiHandler.GetJobDurations())
+	router.GET("/job-durations/jobs", apiHandler.GetLongestJobs())
 
 	return router, mockDB
 }
@@ -39,12 +47,14 @@ func TestAPIHandler_GetRunningCount_Success(t *testing.T) {
 	}
 
 	// Setup mock expectations
-	mockDB.On("GetHistoricalDataByPeriod", "all").Return(historicalData, nil)
-	mockDB.On("GetAverageQueueTime").Return(time.Duration(5*time.Minute), nil)
-	mockDB.On("CalculatePeakDemand", "all").Return(10, "2025-03-24T12:00:00Z", nil)
+	mockDB.On("GetHistoricalDataByPeriod", "hour").Return(historicalData, nil)
+	mockDB.On("GetQueueTimeStats", models.QueueTimeFilter{Period: "hour"}).Return(models.QueueTimeStats{Count: 4, AvgMs: 300000, P95Ms: 540000}, nil)
+	mockDB.On("CalculatePeakDemand", "hour").Return(10, "2025-03-24T12:00:00Z", nil)
 	mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"job1"}, nil)
 	mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"job2", "job3"}, nil)
 	mockDB.On("CountQueuedJobs").Return(1, nil)
+	mockDB.On("CountWaitingJobs").Return(0, nil)
+	mockDB.On("GetAverageApprovalWaitTime", "hour").Return(time.Duration(0), nil)
 
 	req, _ := http.NewRequest("GET", "/running-count", nil)
 	w := httptest.NewRecorder()
@@ -54,8 +64,11 @@ func TestAPIHandler_GetRunningCount_Success(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "current_count_github_hosted")
 	assert.Contains(t, w.Body.String(), "current_count_self_hosted")
 	assert.Contains(t, w.Body.String(), "historical_data")
-	assert.Contains(t, w.Body.String(), "avg_queue_time_ms")
+	assert.Contains(t, w.Body.String(), `"avg_queue_time_ms":300000`)
+	assert.Contains(t, w.Body.String(), `"p95_ms":540000`)
 	assert.Contains(t, w.Body.String(), "peak_demand")
+	assert.Contains(t, w.Body.String(), "current_waiting_count")
+	assert.Contains(t, w.Body.String(), "avg_approval_wait_time_ms")
 
 	mockDB.AssertExpectations(t)
 }
@@ -70,24 +83,28 @@ func TestAPIHandler_GetRunningCount_DatabaseErrors(t *testing.T) {
 			setupMocks: func(mockDB *MockDB) {
 				mockDB.On("GetHistoricalDataByPeriod", mock.Anything).
 					Return([]models.HistoricalEntry{}, assert.AnError)
-				mockDB.On("GetAverageQueueTime").Return(time.Duration(5*time.Minute), nil)
+				mockDB.On("GetQueueTimeStats", mock.Anything).Return(models.QueueTimeStats{AvgMs: 300000}, nil)
 				mockDB.On("CalculatePeakDemand", mock.Anything).Return(10, "2025-03-24T12:00:00Z", nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"job1"}, nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"job2"}, nil)
 				mockDB.On("CountQueuedJobs").Return(0, nil)
+				mockDB.On("CountWaitingJobs").Return(0, nil)
+				mockDB.On("GetAverageApprovalWaitTime", mock.Anything).Return(time.Duration(0), nil)
 			},
 		},
 		{
-			name: "GetAverageQueueTime error",
+			name: "GetQueueTimeStats error",
 			setupMocks: func(mockDB *MockDB) {
 				mockDB.On("GetHistoricalDataByPeriod", mock.Anything).
 					Return([]models.HistoricalEntry{}, nil)
-				mockDB.On("GetAverageQueueTime").
-					Return(time.Duration(0), assert.AnError)
+				mockDB.On("GetQueueTimeStats", mock.Anything).
+					Return(models.QueueTimeStats{}, assert.AnError)
 				mockDB.On("CalculatePeakDemand", mock.Anything).Return(10, "2025-03-24T12:00:00Z", nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"job1"}, nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"job2"}, nil)
 				mockDB.On("CountQueuedJobs").Return(0, nil)
+				mockDB.On("CountWaitingJobs").Return(0, nil)
+				mockDB.On("GetAverageApprovalWaitTime", mock.Anything).Return(time.Duration(0), nil)
 			},
 		},
 		{
@@ -95,13 +112,15 @@ func TestAPIHandler_GetRunningCount_DatabaseErrors(t *testing.T) {
 			setupMocks: func(mockDB *MockDB) {
 				mockDB.On("GetHistoricalDataByPeriod", mock.Anything).
 					Return([]models.HistoricalEntry{}, nil)
-				mockDB.On("GetAverageQueueTime").
-					Return(time.Duration(5*time.Minute), nil)
+				mockDB.On("GetQueueTimeStats", mock.Anything).
+					Return(models.QueueTimeStats{AvgMs: 300000}, nil)
 				mockDB.On("CalculatePeakDemand", mock.Anything).
 					Return(0, "", assert.AnError)
 				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"job1"}, nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"job2"}, nil)
 				mockDB.On("CountQueuedJobs").Return(0, nil)
+				mockDB.On("CountWaitingJobs").Return(0, nil)
+				mockDB.On("GetAverageApprovalWaitTime", mock.Anything).Return(time.Duration(0), nil)
 			},
 		},
 		{
@@ -109,8 +128,8 @@ func TestAPIHandler_GetRunningCount_DatabaseErrors(t *testing.T) {
 			setupMocks: func(mockDB *MockDB) {
 				mockDB.On("GetHistoricalDataByPeriod", mock.Anything).
 					Return([]models.HistoricalEntry{}, nil)
-				mockDB.On("GetAverageQueueTime").
-					Return(time.Duration(5*time.Minute), nil)
+				mockDB.On("GetQueueTimeStats", mock.Anything).
+					Return(models.QueueTimeStats{AvgMs: 300000}, nil)
 				mockDB.On("CalculatePeakDemand", mock.Anything).
 					Return(10, "2025-03-24T12:00:00Z", nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).
@@ -118,6 +137,8 @@ func TestAPIHandler_GetRunningCount_DatabaseErrors(t *testing.T) {
 				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).
 					Return([]string{"job2"}, nil)
 				mockDB.On("CountQueuedJobs").Return(0, nil)
+				mockDB.On("CountWaitingJobs").Return(0, nil)
+				mockDB.On("GetAverageApprovalWaitTime", mock.Anything).Return(time.Duration(0), nil)
 			},
 		},
 		{
@@ -125,8 +146,8 @@ func TestAPIHandler_GetRunningCount_DatabaseErrors(t *testing.T) {
 			setupMocks: func(mockDB *MockDB) {
 				mockDB.On("GetHistoricalDataByPeriod", mock.Anything).
 					Return([]models.HistoricalEntry{}, nil)
-				mockDB.On("GetAverageQueueTime").
-					Return(time.Duration(5*time.Minute), nil)
+				mockDB.On("GetQueueTimeStats", mock.Anything).
+					Return(models.QueueTimeStats{AvgMs: 300000}, nil)
 				mockDB.On("CalculatePeakDemand", mock.Anything).
 					Return(10, "2025-03-24T12:00:00Z", nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).
@@ -134,6 +155,8 @@ func TestAPIHandler_GetRunningCount_DatabaseErrors(t *testing.T) {
 				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).
 					Return(nil, assert.AnError)
 				mockDB.On("CountQueuedJobs").Return(0, nil)
+				mockDB.On("CountWaitingJobs").Return(0, nil)
+				mockDB.On("GetAverageApprovalWaitTime", mock.Anything).Return(time.Duration(0), nil)
 			},
 		},
 		{
@@ -141,13 +164,31 @@ func TestAPIHandler_GetRunningCount_DatabaseErrors(t *testing.T) {
 			setupMocks: func(mockDB *MockDB) {
 				mockDB.On("GetHistoricalDataByPeriod", mock.Anything).
 					Return([]models.HistoricalEntry{}, nil)
-				mockDB.On("GetAverageQueueTime").
-					Return(time.Duration(5*time.Minute), nil)
+				mockDB.On("GetQueueTimeStats", mock.Anything).
+					Return(models.QueueTimeStats{AvgMs: 300000}, nil)
 				mockDB.On("CalculatePeakDemand", mock.Anything).
 					Return(10, "2025-03-24T12:00:00Z", nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"job1"}, nil)
 				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"job2"}, nil)
 				mockDB.On("CountQueuedJobs").Return(0, assert.AnError)
+				mockDB.On("CountWaitingJobs").Return(0, nil)
+				mockDB.On("GetAverageApprovalWaitTime", mock.Anything).Return(time.Duration(0), nil)
+			},
+		},
+		{
+			name: "CountWaitingJobs error",
+			setupMocks: func(mockDB *MockDB) {
+				mockDB.On("GetHistoricalDataByPeriod", mock.Anything).
+					Return([]models.HistoricalEntry{}, nil)
+				mockDB.On("GetQueueTimeStats", mock.Anything).
+					Return(models.QueueTimeStats{AvgMs: 300000}, nil)
+				mockDB.On("CalculatePeakDemand", mock.Anything).
+					Return(10, "2025-03-24T12:00:00Z", nil)
+				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"job1"}, nil)
+				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"job2"}, nil)
+				mockDB.On("CountQueuedJobs").Return(0, nil)
+				mockDB.On("CountWaitingJobs").Return(0, assert.AnError)
+				mockDB.On("GetAverageApprovalWaitTime", mock.Anything).Return(time.Duration(0), nil)
 			},
 		},
 	}
@@ -182,21 +223,414 @@ func TestAPIHandler_GetRunningCount_WithPeriod(t *testing.T) {
 		},
 	}
 
-	period := "24h"
+	period := "week"
 
 	// Setup mock expectations
 	mockDB.On("GetHistoricalDataByPeriod", period).Return(historicalData, nil)
-	mockDB.On("GetAverageQueueTime").Return(time.Duration(5*time.Minute), nil)
+	mockDB.On("GetQueueTimeStats", models.QueueTimeFilter{Period: period}).Return(models.QueueTimeStats{AvgMs: 300000}, nil)
 	mockDB.On("CalculatePeakDemand", period).Return(10, "2025-03-24T12:00:00Z", nil)
 	mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"job1"}, nil)
 	mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"job2", "job3"}, nil)
 	mockDB.On("CountQueuedJobs").Return(1, nil)
+	mockDB.On("CountWaitingJobs").Return(0, nil)
+	mockDB.On("GetAverageApprovalWaitTime", period).Return(time.Duration(0), nil)
+
+	req, _ := http.NewRequest("GET", "/running-count?period=week", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"period":"week"`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIHandler_GetRunningCount_InvalidPeriod(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	req, _ := http.NewRequest("GET", "/running-count?period=all", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockDB.AssertNotCalled(t, "GetHistoricalDataByPeriod", mock.Anything)
+}
+
+func TestAPIHandler_GetPools(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	mockDB.On("CountRunningJobsByPool").Return(map[string]int{"gpu": 2, "github-hosted": 1}, nil)
+	mockDB.On("CountQueuedJobsByPool").Return(map[string]int{"gpu": 3, "arm64": 1}, nil)
+	mockDB.On("CountWaitingJobsByPool").Return(map[string]int{"deploy": 2}, nil)
+	mockDB.On("GetAverageQueueTimeByPool", "day").Return(map[string]time.Duration{"gpu": 2 * time.Minute}, nil)
+	mockDB.On("GetAverageApprovalWaitTimeByPool", "day").Return(map[string]time.Duration{"deploy": 10 * time.Minute}, nil)
+
+	req, _ := http.NewRequest("GET", "/pools?period=day", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"period": "day", "pools": [
+		{"pool": "arm64", "current_running_count": 0, "current_queued_count": 1, "current_waiting_count": 0,
+			"avg_queue_time_ms": 0, "avg_approval_wait_time_ms": 0},
+		{"pool": "deploy", "current_running_count": 0, "current_queued_count": 0, "current_waiting_count": 2,
+			"avg_queue_time_ms": 0, "avg_approval_wait_time_ms": 600000},
+		{"pool": "github-hosted", "current_running_count": 1, "current_queued_count": 0, "current_waiting_count": 0,
+			"avg_queue_time_ms": 0, "avg_approval_wait_time_ms": 0},
+		{"pool": "gpu", "current_running_count": 2, "current_queued_count": 3, "current_waiting_count": 0,
+			"avg_queue_time_ms": 120000, "avg_approval_wait_time_ms": 0}
+	]}`, w.Body.String())
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIHandler_GetPools_InvalidPeriod(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	req, _ := http.NewRequest("GET", "/pools?period=all", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockDB.AssertNotCalled(t, "GetAverageQueueTimeByPool", mock.Anything)
+}
+
+func TestAPIHandler_GetPools_DatabaseError(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	mockDB.On("CountRunningJobsByPool").Return(map[string]int{}, nil)
+	mockDB.On("CountQueuedJobsByPool").Return(nil, assert.AnError)
+	mockDB.On("CountWaitingJobsByPool").Return(map[string]int{}, nil)
+	mockDB.On("GetAverageQueueTimeByPool", "hour").Return(map[string]time.Duration{}, nil)
+	mockDB.On("GetAverageApprovalWaitTimeByPool", "hour").Return(map[string]time.Duration{}, nil)
+
+	req, _ := http.NewRequest("GET", "/pools", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "Failed to retrieve data")
+}
+
+func TestAPIHandler_GetPoolHistory(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	mockDB.On("GetPoolHistoricalDataByPeriod", "day", "gpu").Return([]models.PoolHistoricalEntry{
+		{Timestamp: "2025-03-24T10:00:00Z", Pool: "gpu", CountRunning: 2, CountQueued: 1},
+	}, nil)
+	mockDB.On("CalculatePeakDemandByPool", "day", "gpu").Return(4, "2025-03-24T10:00:00Z", nil)
+
+	req, _ := http.NewRequest("GET", "/pools/gpu/history?period=day", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"pool":"gpu"`)
+	assert.Contains(t, w.Body.String(), `"peak_demand":4`)
+	assert.Contains(t, w.Body.String(), `"period":"day"`)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIHandler_GetPoolHistory_InvalidPeriod(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	req, _ := http.NewRequest("GET", "/pools/gpu/history?period=all", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockDB.AssertNotCalled(t, "GetPoolHistoricalDataByPeriod", mock.Anything, mock.Anything)
+}
+
+func TestAPIHandler_GetQueueTime(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	mockDB.On("GetQueueTimeStats", models.QueueTimeFilter{
+		Period:     "week",
+		Pool:       "gpu",
+		Repository: "octo-org/app",
+		Labels:     []string{"self-hosted", "gpu"},
+	}).Return(models.QueueTimeStats{Count: 10, AvgMs: 2000, P50Ms: 1000, P90Ms: 4000, P95Ms: 6000, P99Ms: 9000, MaxMs: 9500}, nil)
+
+	req, _ := http.NewRequest("GET", "/queue-time?period=week&pool=gpu&repo=octo-org/app&labels=self-hosted,%20gpu", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"period": "week", "queue_time": {
+		"count": 10, "avg_ms": 2000, "p50_ms": 1000, "p90_ms": 4000, "p95_ms": 6000, "p99_ms": 9000, "max_ms": 9500
+	}}`, w.Body.String())
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIHandler_GetQueueTime_InvalidPeriod(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	req, _ := http.NewRequest("GET", "/queue-time?period=year", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockDB.AssertNotCalled(t, "GetQueueTimeStats", mock.Anything)
+}
+
+func TestAPIHandler_GetQueueTimeHistogram(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		setupMocks     func(*MockDB)
+		expectedStatus int
+	}{
+		{
+			name:  "default bounds",
+			query: "",
+			setupMocks: func(mockDB *MockDB) {
+				mockDB.On("GetQueueTimeHistogram", models.QueueTimeFilter{Period: "day"}, defaultHistogramBounds).
+					Return([]models.HistogramBucket{{MinMs: 0, MaxMs: 10000, Count: 3}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "custom bounds",
+			query: "?period=hour&bounds=30s,5m",
+			setupMocks: func(mockDB *MockDB) {
+				mockDB.On("GetQueueTimeHistogram", models.QueueTimeFilter{Period: "hour"}, []time.Duration{30 * time.Second, 5 * time.Minute}).
+					Return([]models.HistogramBucket{{MinMs: 0, MaxMs: 30000, Count: 3}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unsorted bounds",
+			query:          "?bounds=5m,30s",
+			setupMocks:     func(*MockDB) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid bounds",
+			query:          "?bounds=soon",
+			setupMocks:     func(*MockDB) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "database error",
+			query: "",
+			setupMocks: func(mockDB *MockDB) {
+				mockDB.On("GetQueueTimeHistogram", mock.Anything, mock.Anything).Return(nil, assert.AnError)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, mockDB := setupAPITest(t)
+			tc.setupMocks(mockDB)
+
+			req, _ := http.NewRequest("GET", "/queue-time/histogram"+tc.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), `"buckets":[{"min_ms":0,`)
+			}
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAPIHandler_GetJobDurations(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		setupMocks     func(*MockDB)
+		expectedStatus int
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			setupMocks: func(mockDB *MockDB) {
+				mockDB.On("GetJobDurationStats", "workflow", models.JobDurationFilter{Period: "day"}, 20).
+					Return([]models.JobDurationStats{{Repository: "octo-org/app", Workflow: "CI", Count: 3, RunnerMinutes: 12.5}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "filtered",
+			query: "?period=month&group_by=job&pool=gpu&repo=octo-org/app&workflow=CI&limit=5",
+			setupMocks: func(mockDB *MockDB) {
+				mockDB.On("GetJobDurationStats", "job", models.JobDurationFilter{
+					Period: "month", Pool: "gpu", Repository: "octo-org/app", Workflow: "CI",
+				}, 5).Return([]models.JobDurationStats{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid group_by",
+			query:          "?group_by=runner",
+			setupMocks:     func(*MockDB) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid period",
+			query:          "?period=year",
+			setupMocks:     func(*MockDB) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid limit",
+			query:          "?limit=1000",
+			setupMocks:     func(*MockDB) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "database error",
+			query: "",
+			setupMocks: func(mockDB *MockDB) {
+				mockDB.On("GetJobDurationStats", mock.Anything, mock.Anything, mock.Anything).Return(nil, assert.AnError)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, mockDB := setupAPITest(t)
+			tc.setupMocks(mockDB)
+
+			req, _ := http.NewRequest("GET", "/job-durations"+tc.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
 
-	req, _ := http.NewRequest("GET", "/running-count?period=24h", nil)
+func TestAPIHandler_GetLongestJobs(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	startedAt := time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)
+	mockDB.On("GetLongestJobs", models.JobDurationFilter{Period: "hour", Job: "build"}, 20).Return([]models.JobDuration{
+		{ID: 42, Repository: "octo-org/app", Workflow: "CI", Job: "build", StartedAt: startedAt, CompletedAt: startedAt.Add(time.Hour), DurationMs: 3600000},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/job-durations/jobs?period=hour&job=build", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"duration_ms":3600000`)
+	assert.Contains(t, w.Body.String(), `"period":"hour"`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIHandler_GetHistory(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	from := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	to := from.Add(time.Hour)
+	mockDB.On("GetHistoricalDataByRange", models.TimeRange{From: from, To: to, Step: 5 * time.Minute}).Return([]models.HistoricalEntry{
+		{Timestamp: from.Format(time.RFC3339), CountSelfHosted: 2, PeakTotal: 4},
+		{Timestamp: from.Add(5 * time.Minute).Format(time.RFC3339), CountSelfHosted: 5, PeakTotal: 9},
+		{Timestamp: from.Add(10 * time.Minute).Format(time.RFC3339), CountSelfHosted: 1, PeakTotal: 3},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/history?from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339)+"&step=5m", nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), `"period":"24h"`)
+	assert.Contains(t, w.Body.String(), `"step":"5m0s"`)
+	assert.Contains(t, w.Body.String(), `"peak_demand":9`)
+	assert.Contains(t, w.Body.String(), `"peak_demand_timestamp":"`+from.Add(5*time.Minute).Format(time.RFC3339)+`"`)
 	mockDB.AssertExpectations(t)
 }
+
+func TestAPIHandler_GetHistory_InvalidRange(t *testing.T) {
+	from := time.Now().UTC().Add(-24 * time.Hour).Format(time.RFC3339)
+
+	testCases := []struct {
+		name  string
+		query string
+	}{
+		{name: "missing from", query: ""},
+		{name: "invalid from", query: "?from=yesterday"},
+		{name: "from after to", query: "?from=" + from + "&to=2025-03-24T10:00:00Z"},
+		{name: "invalid step", query: "?from=" + from + "&step=500ms"},
+		{name: "too many points", query: "?from=" + from + "&step=10s"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, mockDB := setupAPITest(t)
+
+			req, _ := http.NewRequest("GET", "/history"+tc.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockDB.AssertNotCalled(t, "GetHistoricalDataByRange", mock.Anything)
+		})
+	}
+}
+
+func TestAPIHandler_GetPoolHistory_Range(t *testing.T) {
+	router, mockDB := setupAPITest(t)
+
+	from := time.Now().UTC().Truncate(time.Hour).Add(-48 * time.Hour)
+	to := from.Add(24 * time.Hour)
+	mockDB.On("GetPoolHistoricalDataByRange", models.TimeRange{From: from, To: to, Step: 5 * time.Minute}, "gpu").
+		Return([]models.PoolHistoricalEntry{{Timestamp: from.Format(time.RFC3339), Pool: "gpu", CountRunning: 2, PeakTotal: 6}}, nil)
+
+	req, _ := http.NewRequest("GET", "/pools/gpu/history?from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"peak_demand":6`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestParseTimeRange(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name         string
+		from, to     string
+		step         string
+		expectedStep time.Duration
+		expectedTo   time.Time
+		wantErr      bool
+	}{
+		{name: "default step for an hour", from: "2025-06-01T11:00:00Z", expectedStep: 30 * time.Second, expectedTo: now},
+		{name: "default step for a week", from: "2025-05-25T12:00:00Z", expectedStep: time.Hour, expectedTo: now},
+		{name: "explicit step", from: "2025-06-01T11:00:00Z", to: "2025-06-01T11:30:00Z", step: "1m",
+			expectedStep: time.Minute, expectedTo: time.Date(2025, 6, 1, 11, 30, 0, 0, time.UTC)},
+		{name: "range past the raw retention defaults to minutes", from: "2025-04-20T00:00:00Z", to: "2025-04-20T01:00:00Z",
+			expectedStep: time.Minute, expectedTo: time.Date(2025, 4, 20, 1, 0, 0, 0, time.UTC)},
+		{name: "range past the raw retention with seconds step", from: "2025-04-20T00:00:00Z", to: "2025-04-20T01:00:00Z", step: "30s", wantErr: true},
+		{name: "old range defaults to quarter hours", from: "2025-03-01T00:00:00Z", to: "2025-03-01T06:00:00Z",
+			expectedStep: 15 * time.Minute, expectedTo: time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)},
+		{name: "old range with a step finer than the rollup", from: "2025-03-01T00:00:00Z", to: "2025-03-01T06:00:00Z", step: "5m", wantErr: true},
+		{name: "old range with a step of the rollup", from: "2025-03-01T00:00:00Z", to: "2025-03-01T06:00:00Z", step: "15m",
+			expectedStep: 15 * time.Minute, expectedTo: time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)},
+		{name: "a year in days", from: "2024-06-01T12:00:00Z", expectedStep: 2 * 24 * time.Hour, expectedTo: now},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := parseTimeRange(tc.from, tc.to, tc.step, now, database.NewDBWrapper(nil, 0).StepGranularity)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedStep, r.Step)
+			assert.Equal(t, tc.expectedTo, r.To)
+		})
+	}
+}
@@ -0,0 +1,642 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/jobstate"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/apiv1"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// APIV1Handler serves the versioned API. Its responses are the documents of package apiv1,
+// built from the models so that storage changes cannot alter them.
+type APIV1Handler struct {
+	db database.DatabaseInterface
+}
+
+func NewAPIV1Handler(db database.DatabaseInterface) *APIV1Handler {
+	return &APIV1Handler{db: db}
+}
+
+// GetCounts returns the current number of running, queued and waiting jobs, overall and per runner pool
+func (h *APIV1Handler) GetCounts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		now := time.Now()
+
+		selfHostedChan := make(chan dataResult)
+		githubHostedChan := make(chan dataResult)
+		queuedChan := make(chan dataResult)
+		waitingChan := make(chan dataResult)
+		poolRunningChan := make(chan dataResult)
+		poolQueuedChan := make(chan dataResult)
+		poolWaitingChan := make(chan dataResult)
+
+		go func() {
+			jobs, err := h.db.GetRunningJobs(ctx, models.RunnerTypeSelfHosted)
+			selfHostedChan <- dataResult{value: len(jobs), err: err}
+		}()
+
+		go func() {
+			jobs, err := h.db.GetRunningJobs(ctx, models.RunnerTypeGitHubHosted)
+			githubHostedChan <- dataResult{value: len(jobs), err: err}
+		}()
+
+		go func() {
+			count, err := h.db.CountQueuedJobs(ctx)
+			queuedChan <- dataResult{value: count, err: err}
+		}()
+
+		go func() {
+			count, err := h.db.CountWaitingJobs(ctx)
+			waitingChan <- dataResult{value: count, err: err}
+		}()
+
+		go func() {
+			counts, err := h.db.CountRunningJobsByPool(ctx)
+			poolRunningChan <- dataResult{value: counts, err: err}
+		}()
+
+		go func() {
+			counts, err := h.db.CountQueuedJobsByPool(ctx)
+			poolQueuedChan <- dataResult{value: counts, err: err}
+		}()
+
+		go func() {
+			counts, err := h.db.CountWaitingJobsByPool(ctx)
+			poolWaitingChan <- dataResult{value: counts, err: err}
+		}()
+
+		selfHosted := <-selfHostedChan
+		githubHosted := <-githubHostedChan
+		queued := <-queuedChan
+		waiting := <-waitingChan
+		poolRunning := <-poolRunningChan
+		poolQueued := <-poolQueuedChan
+		poolWaiting := <-poolWaitingChan
+
+		for _, result := range []dataResult{selfHosted, githubHosted, queued, waiting, poolRunning, poolQueued, poolWaiting} {
+			if result.err != nil {
+				logger.Logger.Error("Error retrieving counts", zap.Error(result.err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+				return
+			}
+		}
+
+		running := poolRunning.value.(map[string]int)
+		queuedByPool := poolQueued.value.(map[string]int)
+		waitingByPool := poolWaiting.value.(map[string]int)
+
+		names := map[string]bool{}
+		for _, counts := range []map[string]int{running, queuedByPool, waitingByPool} {
+			for pool := range counts {
+				names[pool] = true
+			}
+		}
+
+		pools := make([]apiv1.PoolCounts, 0, len(names))
+		for pool := range names {
+			pools = append(pools, apiv1.PoolCounts{
+				Pool:    pool,
+				Running: running[pool],
+				Queued:  queuedByPool[pool],
+				Waiting: waitingByPool[pool],
+			})
+		}
+		sort.Slice(pools, func(i, j int) bool { return pools[i].Pool < pools[j].Pool })
+
+		c.JSON(http.StatusOK, apiv1.Counts{
+			Time:                now.UTC(),
+			RunningSelfHosted:   selfHosted.value.(int),
+			RunningGitHubHosted: githubHosted.value.(int),
+			Queued:              queued.value.(int),
+			Waiting:             waiting.value.(int),
+			Pools:               pools,
+		})
+	}
+}
+
+// GetHistory returns the runner demand of the time range given by from, to and step
+func (h *APIV1Handler) GetHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := timeRange(c, h.db, time.Now())
+		if !ok {
+			return
+		}
+
+		entries, err := h.db.GetHistoricalDataByRange(c.Request.Context(), r)
+		if err != nil {
+			logger.Logger.Error("Error retrieving historical data", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		points := make([]apiv1.Point, 0, len(entries))
+		for _, entry := range entries {
+			t, err := parseEntryTime(entry.Timestamp)
+			if err != nil {
+				logger.Logger.Error("Invalid historical entry", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+				return
+			}
+			points = append(points, apiv1.Point{
+				Time:                t,
+				RunningSelfHosted:   entry.CountSelfHosted,
+				RunningGitHubHosted: entry.CountGitHubHosted,
+				Queued:              entry.CountQueued,
+				PeakTotal:           entry.PeakTotal,
+			})
+		}
+
+		c.JSON(http.StatusOK, apiv1.History{
+			From:        r.From.UTC(),
+			To:          r.To.UTC(),
+			StepSeconds: int64(r.Step / time.Second),
+			Points:      points,
+		})
+	}
+}
+
+// GetPoolHistory returns the demand of a runner pool over the time range given by from, to and step
+func (h *APIV1Handler) GetPoolHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pool := c.Param("pool")
+		r, ok := timeRange(c, h.db, time.Now())
+		if !ok {
+			return
+		}
+
+		entries, err := h.db.GetPoolHistoricalDataByRange(c.Request.Context(), r, pool)
+		if err != nil {
+			logger.Logger.Error("Error retrieving pool data", zap.Error(err), zap.String("pool", pool))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		points := make([]apiv1.PoolPoint, 0, len(entries))
+		for _, entry := range entries {
+			t, err := parseEntryTime(entry.Timestamp)
+			if err != nil {
+				logger.Logger.Error("Invalid pool historical entry", zap.Error(err), zap.String("pool", pool))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+				return
+			}
+			points = append(points, apiv1.PoolPoint{
+				Time:      t,
+				Running:   entry.CountRunning,
+				Queued:    entry.CountQueued,
+				PeakTotal: entry.PeakTotal,
+			})
+		}
+
+		c.JSON(http.StatusOK, apiv1.PoolHistory{
+			Pool:        pool,
+			From:        r.From.UTC(),
+			To:          r.To.UTC(),
+			StepSeconds: int64(r.Step / time.Second),
+			Points:      points,
+		})
+	}
+}
+
+// GetQueueTime returns the queue time percentiles for a period, optionally filtered by runner pool, repository and labels
+func (h *APIV1Handler) GetQueueTime() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := queueTimeFilter(c)
+		if !ok {
+			return
+		}
+
+		stats, err := h.db.GetQueueTimeStats(c.Request.Context(), filter)
+		if err != nil {
+			logger.Logger.Error("Error retrieving queue time stats", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, apiv1.QueueTime{
+			Period:     filter.Period,
+			Pool:       filter.Pool,
+			Repository: filter.Repository,
+			Labels:     filter.Labels,
+			Count:      stats.Count,
+			AvgMs:      stats.AvgMs,
+			P50Ms:      stats.P50Ms,
+			P90Ms:      stats.P90Ms,
+			P95Ms:      stats.P95Ms,
+			P99Ms:      stats.P99Ms,
+			MaxMs:      stats.MaxMs,
+		})
+	}
+}
+
+// GetJobDurations returns the run time of completed jobs grouped by pool, repository, workflow or job,
+// with the groups that used the most runner minutes first
+func (h *APIV1Handler) GetJobDurations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupBy := c.DefaultQuery("group_by", "workflow")
+		if !jobDurationGroupings[groupBy] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_by"})
+			return
+		}
+
+		filter, ok := jobDurationFilter(c)
+		if !ok {
+			return
+		}
+
+		limit, ok := queryLimit(c)
+		if !ok {
+			return
+		}
+
+		stats, err := h.db.GetJobDurationStats(c.Request.Context(), groupBy, filter, limit)
+		if err != nil {
+			logger.Logger.Error("Error retrieving job duration stats", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		groups := make([]apiv1.JobDurationGroup, 0, len(stats))
+		for _, s := range stats {
+			groups = append(groups, apiv1.JobDurationGroup{
+				Pool:          s.Pool,
+				Repository:    s.Repository,
+				Workflow:      s.Workflow,
+				Job:           s.Job,
+				Count:         s.Count,
+				AvgMs:         s.AvgMs,
+				P50Ms:         s.P50Ms,
+				P95Ms:         s.P95Ms,
+				RunnerMinutes: s.RunnerMinutes,
+			})
+		}
+
+		c.JSON(http.StatusOK, apiv1.JobDurations{
+			Period:  filter.Period,
+			GroupBy: groupBy,
+			Groups:  groups,
+		})
+	}
+}
+
+// GetLongestJobs returns the completed jobs that ran the longest, filtered like GetJobDurations
+func (h *APIV1Handler) GetLongestJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := jobDurationFilter(c)
+		if !ok {
+			return
+		}
+
+		limit, ok := queryLimit(c)
+		if !ok {
+			return
+		}
+
+		longest, err := h.db.GetLongestJobs(c.Request.Context(), filter, limit)
+		if err != nil {
+			logger.Logger.Error("Error retrieving longest jobs", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		jobs := make([]apiv1.CompletedJob, 0, len(longest))
+		for _, job := range longest {
+			jobs = append(jobs, apiv1.CompletedJob{
+				ID:          job.ID,
+				RunID:       job.RunID,
+				Repository:  job.Repository,
+				Workflow:    job.Workflow,
+				Job:         job.Job,
+				Pool:        job.Pool,
+				Conclusion:  job.Conclusion,
+				StartedAt:   job.StartedAt.UTC(),
+				CompletedAt: job.CompletedAt.UTC(),
+				DurationMs:  job.DurationMs,
+			})
+		}
+
+		c.JSON(http.StatusOK, apiv1.CompletedJobs{
+			Period: filter.Period,
+			Jobs:   jobs,
+		})
+	}
+}
+
+// jobStatuses are the statuses jobs can be listed by
+var jobStatuses = map[models.JobStatus]bool{
+	models.JobStatusWaiting:    true,
+	models.JobStatusQueued:     true,
+	models.JobStatusInProgress: true,
+	models.JobStatusCompleted:  true,
+	models.JobStatusAbandoned:  true,
+}
+
+// jobSorts are the orders jobs can be listed in
+var jobSorts = map[models.JobSort]bool{
+	models.JobSortCreated:   true,
+	models.JobSortQueueTime: true,
+	models.JobSortDuration:  true,
+}
+
+// GetJobs returns a page of the jobs matching the search given by the query, in the requested
+// order. The next page is requested with the cursor returned with the page.
+func (h *APIV1Handler) GetJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := jobFilter(c)
+		if !ok {
+			return
+		}
+
+		limit, ok := queryLimit(c)
+		if !ok {
+			return
+		}
+		// One more job than requested tells whether there is a next page
+		filter.Limit = limit + 1
+
+		jobs, err := h.db.ListJobs(c.Request.Context(), filter)
+		if err != nil {
+			logger.Logger.Error("Error listing jobs", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		var next string
+		if len(jobs) > limit {
+			jobs = jobs[:limit]
+			last := jobs[limit-1]
+			key, _ := jobstate.SortKey(last, filter.Sort)
+			next = encodeJobCursor(filter.Sort, models.JobCursor{Value: key, ID: last.ID})
+		}
+
+		documents := make([]apiv1.Job, 0, len(jobs))
+		for _, job := range jobs {
+			documents = append(documents, jobDocument(job))
+		}
+
+		c.JSON(http.StatusOK, apiv1.Jobs{
+			Sort:       string(filter.Sort),
+			Jobs:       documents,
+			NextCursor: next,
+		})
+	}
+}
+
+// GetJob returns a job with every event received for it, the phases it went through and the
+// runner that picked it up
+func (h *APIV1Handler) GetJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		job, found, err := h.db.GetJob(ctx, id)
+		if err != nil {
+			logger.Logger.Error("Error getting job", zap.Error(err), zap.Int64("ID", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+
+		events, err := h.db.GetJobEvents(ctx, job.ID, job.CreatedAt)
+		if err != nil {
+			logger.Logger.Error("Error getting job events", zap.Error(err), zap.Int64("ID", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, jobDetailDocument(job, events, time.Now()))
+	}
+}
+
+// jobFilter reads the job search from the query. It answers 400 and returns false when the
+// search is invalid.
+func jobFilter(c *gin.Context) (models.JobFilter, bool) {
+	filter := models.JobFilter{
+		Status:     models.JobStatus(c.Query("status")),
+		Pool:       c.Query("pool"),
+		Repository: c.Query("repo"),
+		Workflow:   c.Query("workflow"),
+		Labels:     queryLabels(c),
+		Sort:       models.JobSort(c.DefaultQuery("sort", string(models.JobSortCreated))),
+	}
+
+	if filter.Status != "" && !jobStatuses[filter.Status] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return models.JobFilter{}, false
+	}
+	if !jobSorts[filter.Sort] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort"})
+		return models.JobFilter{}, false
+	}
+
+	for _, r := range []struct {
+		name     string
+		from, to *time.Time
+	}{
+		{"created", &filter.CreatedFrom, &filter.CreatedTo},
+		{"started", &filter.StartedFrom, &filter.StartedTo},
+		{"completed", &filter.CompletedFrom, &filter.CompletedTo},
+	} {
+		if !queryTime(c, r.name+"_from", r.from) || !queryTime(c, r.name+"_to", r.to) {
+			return models.JobFilter{}, false
+		}
+		if !r.from.IsZero() && !r.to.IsZero() && !r.from.Before(*r.to) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + r.name + " range: " + r.name + "_from must be before " + r.name + "_to"})
+			return models.JobFilter{}, false
+		}
+	}
+
+	for _, minimum := range []struct {
+		param string
+		d     *time.Duration
+	}{
+		{"min_queue_time", &filter.MinQueueTime},
+		{"min_duration", &filter.MinDuration},
+	} {
+		value := c.Query(minimum.param)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + minimum.param + ": must be a positive duration such as 10m"})
+			return models.JobFilter{}, false
+		}
+		*minimum.d = d
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeJobCursor(value, filter.Sort)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return models.JobFilter{}, false
+		}
+		filter.After = &cursor
+	}
+
+	return filter, true
+}
+
+// queryTime reads an optional RFC3339 query parameter into t. It answers 400 and returns false
+// when the parameter is not a timestamp.
+func queryTime(c *gin.Context, param string, t *time.Time) bool {
+	value := c.Query(param)
+	if value == "" {
+		return true
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + ": must be an RFC3339 timestamp"})
+		return false
+	}
+	*t = parsed
+	return true
+}
+
+// encodeJobCursor encodes the cursor of a job listing in an order as an opaque string
+func encodeJobCursor(sort models.JobSort, cursor models.JobCursor) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%s:%d:%d", sort, cursor.Value, cursor.ID))
+}
+
+// decodeJobCursor decodes a cursor returned by encodeJobCursor. Cursors of a listing in
+// another order are rejected, since they do not identify a position in this one.
+func decodeJobCursor(value string, sort models.JobSort) (models.JobCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return models.JobCursor{}, err
+	}
+
+	fields := strings.Split(string(decoded), ":")
+	if len(fields) != 3 || fields[0] != string(sort) {
+		return models.JobCursor{}, errors.New("cursor of another listing")
+	}
+
+	var cursor models.JobCursor
+	if cursor.Value, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return models.JobCursor{}, err
+	}
+	if cursor.ID, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return models.JobCursor{}, err
+	}
+	return cursor, nil
+}
+
+// jobDocument describes a job with its queue time and duration
+func jobDocument(job models.WorkflowJob) apiv1.Job {
+	labels := job.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+
+	document := apiv1.Job{
+		ID:          job.ID,
+		RunID:       job.RunID,
+		RunAttempt:  job.RunAttempt,
+		Repository:  job.Repository.FullName,
+		Workflow:    job.WorkflowName,
+		Job:         job.Name,
+		Branch:      job.HeadBranch,
+		Status:      string(job.Status),
+		Conclusion:  job.Conclusion,
+		Labels:      labels,
+		Pool:        job.RunnerPool,
+		RunnerName:  job.RunnerName,
+		CreatedAt:   job.CreatedAt.UTC(),
+		WaitingAt:   optionalTime(job.WaitingAt),
+		QueuedAt:    optionalTime(job.QueuedAt),
+		StartedAt:   optionalTime(job.StartedAt),
+		CompletedAt: optionalTime(job.CompletedAt),
+	}
+	if queueTime, ok := jobstate.SortKey(job, models.JobSortQueueTime); ok {
+		document.QueueTimeMs = &queueTime
+	}
+	if duration, ok := jobstate.SortKey(job, models.JobSortDuration); ok {
+		document.DurationMs = &duration
+	}
+	return document
+}
+
+// jobDetailDocument describes a job with its events, and its phases as of now
+func jobDetailDocument(job models.WorkflowJob, events []models.JobEvent, now time.Time) apiv1.JobDetail {
+	document := apiv1.JobDetail{
+		Job:    jobDocument(job),
+		Phases: []apiv1.JobPhase{},
+		Events: make([]apiv1.JobEvent, 0, len(events)),
+	}
+
+	if job.RunnerID != 0 || job.RunnerName != "" {
+		document.Runner = &apiv1.Runner{
+			ID:        job.RunnerID,
+			Name:      job.RunnerName,
+			GroupID:   job.RunnerGroupID,
+			GroupName: job.RunnerGroupName,
+		}
+	}
+
+	// Only a job that can still move on is in its unfinished phase
+	active := jobstate.Rank(job.Status) < jobstate.Rank(models.JobStatusAbandoned)
+	for _, phase := range jobstate.Phases(job) {
+		p := apiv1.JobPhase{Name: string(phase.Name), StartedAt: phase.Start.UTC(), EndedAt: optionalTime(phase.End)}
+		end := phase.End
+		if end.IsZero() && active {
+			p.Ongoing = true
+			end = now
+		}
+		if !end.IsZero() {
+			duration := max(end.Sub(phase.Start), 0).Milliseconds()
+			p.DurationMs = &duration
+		}
+		document.Phases = append(document.Phases, p)
+	}
+
+	for _, event := range events {
+		document.Events = append(document.Events, apiv1.JobEvent{
+			Action:      event.Action,
+			DeliveryID:  event.DeliveryID,
+			ReceivedAt:  event.ReceivedAt.UTC(),
+			StartedAt:   optionalTime(event.StartedAt),
+			CompletedAt: optionalTime(event.CompletedAt),
+			Conclusion:  event.Conclusion,
+			RunnerName:  event.RunnerName,
+		})
+	}
+	return document
+}
+
+// optionalTime returns a time in UTC, or nil for the zero time
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// parseEntryTime parses the RFC3339 timestamp of a historical entry
+func parseEntryTime(timestamp string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", timestamp, err)
+	}
+	return t.UTC(), nil
+}
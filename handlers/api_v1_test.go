@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/apiv1"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupAPIV1Test(t *testing.T) (*gin.Engine, *MockDB) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = zaptest.NewLogger(t)
+
+	mockDB := new(MockDB)
+	router := gin.New()
+	apiHandler := NewAPIV1Handler(mockDB)
+	router.GET("/counts", apiHandler.GetCounts())
+	router.GET("/history", apiHandler.GetHistory())
+	router.GET("/pools/:pool/history", apiHandler.GetPoolHistory())
+	router.GET("/queue-time", apiHandler.GetQueueTime())
+	router.GET("/job-durations", apiHandler.GetJobDurations())
+	router.GET("/job-durations/jobs", apiHandler.GetLongestJobs())
+	router.GET("/jobs", apiHandler.GetJobs())
+	router.GET("/jobs/:id", apiHandler.GetJob())
+
+	return router, mockDB
+}
+
+func TestAPIV1Handler_GetCounts(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"job1", "job2"}, nil)
+	mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"job3"}, nil)
+	mockDB.On("CountQueuedJobs").Return(3, nil)
+	mockDB.On("CountWaitingJobs").Return(1, nil)
+	mockDB.On("CountRunningJobsByPool").Return(map[string]int{"linux": 2}, nil)
+	mockDB.On("CountQueuedJobsByPool").Return(map[string]int{"windows": 1, "linux": 2}, nil)
+	mockDB.On("CountWaitingJobsByPool").Return(map[string]int{"linux": 1}, nil)
+
+	req, _ := http.NewRequest("GET", "/counts", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"running_self_hosted":2,"running_github_hosted":1,"queued":3,"waiting":1`)
+	assert.Contains(t, w.Body.String(), `"pools":[{"pool":"linux","running":2,"queued":2,"waiting":1},{"pool":"windows","running":0,"queued":1,"waiting":0}]`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetCounts_DatabaseError(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{}, nil)
+	mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{}, nil)
+	mockDB.On("CountQueuedJobs").Return(0, errors.New("database error"))
+	mockDB.On("CountWaitingJobs").Return(0, nil)
+	mockDB.On("CountRunningJobsByPool").Return(map[string]int{}, nil)
+	mockDB.On("CountQueuedJobsByPool").Return(map[string]int{}, nil)
+	mockDB.On("CountWaitingJobsByPool").Return(map[string]int{}, nil)
+
+	req, _ := http.NewRequest("GET", "/counts", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to retrieve data"}`, w.Body.String())
+}
+
+func TestAPIV1Handler_GetHistory(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	from := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	to := from.Add(time.Hour)
+	mockDB.On("GetHistoricalDataByRange", models.TimeRange{From: from, To: to, Step: 5 * time.Minute}).Return([]models.HistoricalEntry{
+		{Timestamp: from.Format(time.RFC3339), CountSelfHosted: 2, CountQueued: 1, PeakTotal: 4},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/history?from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339)+"&step=5m", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"step_seconds":300`)
+	assert.Contains(t, w.Body.String(), `{"time":"`+from.Format(time.RFC3339)+`","running_self_hosted":2,"running_github_hosted":0,"queued":1,"peak_total":4}`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetHistory_MissingFrom(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	req, _ := http.NewRequest("GET", "/history", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockDB.AssertNotCalled(t, "GetHistoricalDataByRange")
+}
+
+func TestAPIV1Handler_GetPoolHistory(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	from := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	to := from.Add(time.Hour)
+	mockDB.On("GetPoolHistoricalDataByRange", models.TimeRange{From: from, To: to, Step: 5 * time.Minute}, "linux").Return([]models.PoolHistoricalEntry{
+		{Timestamp: from.Format(time.RFC3339), CountRunning: 3, CountQueued: 2, PeakTotal: 6},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/pools/linux/history?from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339)+"&step=5m", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"pool":"linux"`)
+	assert.Contains(t, w.Body.String(), `"running":3,"queued":2,"peak_total":6`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetQueueTime(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	mockDB.On("GetQueueTimeStats", models.QueueTimeFilter{Period: "day", Pool: "linux"}).Return(models.QueueTimeStats{Count: 4, AvgMs: 1500, P95Ms: 3000}, nil)
+
+	req, _ := http.NewRequest("GET", "/queue-time?period=day&pool=linux", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"period":"day","pool":"linux"`)
+	assert.Contains(t, w.Body.String(), `"count":4,"avg_ms":1500`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetJobDurations(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	mockDB.On("GetJobDurationStats", "repository", models.JobDurationFilter{Period: "week"}, 20).Return([]models.JobDurationStats{
+		{Repository: "octo-org/app", Count: 2, AvgMs: 60000, RunnerMinutes: 2},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/job-durations?group_by=repository&period=week", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"group_by":"repository"`)
+	assert.Contains(t, w.Body.String(), `"repository":"octo-org/app"`)
+	assert.Contains(t, w.Body.String(), `"runner_minutes":2`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetLongestJobs(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	startedAt := time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)
+	mockDB.On("GetLongestJobs", models.JobDurationFilter{Period: "day"}, 5).Return([]models.JobDuration{
+		{ID: 42, Repository: "octo-org/app", Job: "build", StartedAt: startedAt, CompletedAt: startedAt.Add(time.Hour), DurationMs: 3600000},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/job-durations/jobs?limit=5", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":42`)
+	assert.Contains(t, w.Body.String(), `"started_at":"2025-03-24T10:00:00Z","completed_at":"2025-03-24T11:00:00Z","duration_ms":3600000`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetJobs(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	createdAt := time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)
+	startedAt := createdAt.Add(15 * time.Minute)
+	from := createdAt.Add(-24 * time.Hour)
+	to := createdAt.Add(time.Hour)
+	jobs := []models.WorkflowJob{
+		{ID: 3, Status: models.JobStatusCompleted, RunnerPool: "gpu", Labels: []string{"gpu"}, Repository: models.Repository{FullName: "octo-org/app"}, CreatedAt: createdAt, StartedAt: startedAt, CompletedAt: startedAt.Add(time.Hour)},
+		{ID: 2, Status: models.JobStatusInProgress, RunnerPool: "gpu", CreatedAt: createdAt, StartedAt: createdAt.Add(12 * time.Minute)},
+		{ID: 1, Status: models.JobStatusInProgress, RunnerPool: "gpu", CreatedAt: createdAt, StartedAt: createdAt.Add(11 * time.Minute)},
+	}
+
+	filter := models.JobFilter{
+		Pool:         "gpu",
+		Labels:       []string{"gpu", "linux"},
+		StartedFrom:  from,
+		StartedTo:    to,
+		MinQueueTime: 10 * time.Minute,
+		Sort:         models.JobSortQueueTime,
+		Limit:        3,
+	}
+	mockDB.On("ListJobs", filter).Return(jobs, nil)
+
+	query := "/jobs?pool=gpu&labels=gpu,linux&started_from=" + from.Format(time.RFC3339) + "&started_to=" + to.Format(time.RFC3339) + "&min_queue_time=10m&sort=queue_time&limit=2"
+	req, _ := http.NewRequest("GET", query, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page apiv1.Jobs
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, "queue_time", page.Sort)
+	assert.Len(t, page.Jobs, 2)
+	assert.Equal(t, int64(900000), *page.Jobs[0].QueueTimeMs)
+	assert.Equal(t, int64(3600000), *page.Jobs[0].DurationMs)
+	assert.Nil(t, page.Jobs[1].DurationMs)
+	assert.Nil(t, page.Jobs[1].CompletedAt)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// The next page continues after the last job of this one
+	next := filter
+	next.After = &models.JobCursor{Value: 720000, ID: 2}
+	mockDB.On("ListJobs", next).Return(jobs[2:], nil)
+
+	req, _ = http.NewRequest("GET", query+"&cursor="+page.NextCursor, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":1`)
+	assert.NotContains(t, w.Body.String(), "next_cursor")
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetJobs_Invalid(t *testing.T) {
+	createdCursor := encodeJobCursor(models.JobSortCreated, models.JobCursor{Value: 1, ID: 1})
+
+	testCases := []struct {
+		name  string
+		query string
+	}{
+		{name: "status", query: "status=running"},
+		{name: "sort", query: "sort=name"},
+		{name: "time", query: "created_from=yesterday"},
+		{name: "range", query: "completed_from=2025-03-24T10:00:00Z&completed_to=2025-03-24T09:00:00Z"},
+		{name: "minimum", query: "min_duration=-5m"},
+		{name: "malformed cursor", query: "cursor=abc"},
+		{name: "cursor of another order", query: "sort=duration&cursor=" + createdCursor},
+		{name: "limit", query: "limit=0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, mockDB := setupAPIV1Test(t)
+
+			req, _ := http.NewRequest("GET", "/jobs?"+tc.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockDB.AssertNotCalled(t, "ListJobs", mock.Anything)
+		})
+	}
+}
+
+func TestAPIV1Handler_GetJob(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	createdAt := time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)
+	approvedAt := createdAt.Add(3 * time.Minute)
+	startedAt := createdAt.Add(15 * time.Minute)
+	job := models.WorkflowJob{
+		ID:              42,
+		Status:          models.JobStatusInProgress,
+		RunnerPool:      "gpu",
+		RunnerID:        7,
+		RunnerName:      "gpu-runner-7",
+		RunnerGroupName: "GPU",
+		CreatedAt:       createdAt,
+		WaitingAt:       createdAt,
+		QueuedAt:        approvedAt,
+		StartedAt:       startedAt,
+	}
+	events := []models.JobEvent{
+		{JobID: 42, JobCreatedAt: createdAt, DeliveryID: "d1", Action: "waiting", ReceivedAt: createdAt},
+		{JobID: 42, JobCreatedAt: createdAt, DeliveryID: "d2", Action: "queued", ReceivedAt: approvedAt},
+		{JobID: 42, JobCreatedAt: createdAt, DeliveryID: "d3", Action: "in_progress", ReceivedAt: startedAt, StartedAt: startedAt, RunnerName: "gpu-runner-7"},
+	}
+	mockDB.On("GetJob", int64(42)).Return(job, true, nil)
+	mockDB.On("GetJobEvents", int64(42), createdAt).Return(events, nil)
+
+	req, _ := http.NewRequest("GET", "/jobs/42", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var detail apiv1.JobDetail
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	assert.Equal(t, int64(42), detail.ID)
+	assert.Equal(t, int64(720000), *detail.QueueTimeMs)
+	assert.Equal(t, &apiv1.Runner{ID: 7, Name: "gpu-runner-7", GroupName: "GPU"}, detail.Runner)
+
+	assert.Len(t, detail.Phases, 3)
+	assert.Equal(t, "waiting", detail.Phases[0].Name)
+	assert.Equal(t, int64(180000), *detail.Phases[0].DurationMs)
+	assert.Equal(t, "queued", detail.Phases[1].Name)
+	assert.Equal(t, int64(720000), *detail.Phases[1].DurationMs)
+	assert.True(t, detail.Phases[1].EndedAt.Equal(startedAt))
+	assert.Equal(t, "running", detail.Phases[2].Name)
+	assert.True(t, detail.Phases[2].Ongoing)
+	assert.Nil(t, detail.Phases[2].EndedAt)
+	assert.NotNil(t, detail.Phases[2].DurationMs)
+
+	assert.Len(t, detail.Events, 3)
+	assert.Equal(t, "waiting", detail.Events[0].Action)
+	assert.Nil(t, detail.Events[0].StartedAt)
+	assert.Equal(t, "in_progress", detail.Events[2].Action)
+	assert.Equal(t, "d3", detail.Events[2].DeliveryID)
+	assert.True(t, detail.Events[2].StartedAt.Equal(startedAt))
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetJob_Abandoned(t *testing.T) {
+	router, mockDB := setupAPIV1Test(t)
+
+	createdAt := time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)
+	job := models.WorkflowJob{ID: 42, Status: models.JobStatusAbandoned, CreatedAt: createdAt, QueuedAt: createdAt}
+	mockDB.On("GetJob", int64(42)).Return(job, true, nil)
+	mockDB.On("GetJobEvents", int64(42), createdAt).Return([]models.JobEvent{}, nil)
+
+	req, _ := http.NewRequest("GET", "/jobs/42", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// The job was left in the queue, so the phase has no end and no duration
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"phases":[{"name":"queued","started_at":"2025-03-24T10:00:00Z","ongoing":false}]`)
+	assert.Contains(t, w.Body.String(), `"events":[]`)
+	assert.NotContains(t, w.Body.String(), `"runner"`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAPIV1Handler_GetJob_Errors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		path           string
+		setupMocks     func(*MockDB)
+		expectedStatus int
+	}{
+		{name: "invalid ID", path: "/jobs/abc", expectedStatus: http.StatusBadRequest},
+		{name: "negative ID", path: "/jobs/-1", expectedStatus: http.StatusBadRequest},
+		{
+			name: "unknown job",
+			path: "/jobs/42",
+			setupMocks: func(m *MockDB) {
+				m.On("GetJob", int64(42)).Return(models.WorkflowJob{}, false, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "job error",
+			path: "/jobs/42",
+			setupMocks: func(m *MockDB) {
+				m.On("GetJob", int64(42)).Return(models.WorkflowJob{}, false, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "events error",
+			path: "/jobs/42",
+			setupMocks: func(m *MockDB) {
+				m.On("GetJob", int64(42)).Return(models.WorkflowJob{ID: 42}, true, nil)
+				m.On("GetJobEvents", int64(42), time.Time{}).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, mockDB := setupAPIV1Test(t)
+			if tc.setupMocks != nil {
+				tc.setupMocks(mockDB)
+			}
+
+			req, _ := http.NewRequest("GET", tc.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/apitoken"
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequireAPIToken middleware authenticates requests with a bearer API token that grants scope.
+// Unknown, expired and revoked tokens are answered with 401 and tokens without the scope with 403.
+func RequireAPIToken(db database.DatabaseInterface, scope models.TokenScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			rejectToken(c, http.StatusUnauthorized, "", "Missing bearer token")
+			return
+		}
+
+		token, found, err := db.GetAPIToken(c.Request.Context(), apitoken.Hash(secret))
+		if err != nil {
+			logger.Logger.Error("Failed to look up API token", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+			c.Abort()
+			return
+		}
+		if !found {
+			rejectToken(c, http.StatusUnauthorized, "invalid_token", "Invalid token")
+			return
+		}
+
+		if err := apitoken.Check(token, scope, time.Now()); err != nil {
+			logger.Logger.Debug("Rejected API token", zap.String("tokenID", token.ID), zap.Error(err))
+			switch {
+			case errors.Is(err, apitoken.ErrInsufficientScope):
+				rejectToken(c, http.StatusForbidden, "insufficient_scope", "Token does not grant the "+string(scope)+" scope")
+			case errors.Is(err, apitoken.ErrExpired):
+				rejectToken(c, http.StatusUnauthorized, "invalid_token", "Token has expired")
+			default:
+				rejectToken(c, http.StatusUnauthorized, "invalid_token", "Token has been revoked")
+			}
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of an Authorization header using the Bearer scheme
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// rejectToken answers a request that is not authorized, describing the error in the
+// WWW-Authenticate header as bearer token authentication specifies
+func rejectToken(c *gin.Context, status int, code, message string) {
+	challenge := `Bearer realm="rpulse"`
+	if code != "" {
+		challenge += `, error="` + code + `"`
+	}
+	c.Header("WWW-Authenticate", challenge)
+	c.JSON(status, gin.H{"error": message})
+	c.Abort()
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/apitoken"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRequireAPIToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = zaptest.NewLogger(t)
+
+	now := time.Now()
+	tokens := map[string]models.APIToken{
+		"read":    {ID: "r", Scope: models.TokenScopeRead},
+		"admin":   {ID: "a", Scope: models.TokenScopeAdmin},
+		"expired": {ID: "e", Scope: models.TokenScopeAdmin, ExpiresAt: now.Add(-time.Minute)},
+		"revoked": {ID: "v", Scope: models.TokenScopeAdmin, RevokedAt: now.Add(-time.Minute)},
+	}
+
+	testCases := []struct {
+		name           string
+		header         string
+		scope          models.TokenScope
+		expectedStatus int
+		expectedError  string
+		challenge      string
+	}{
+		{name: "missing token", header: "", scope: models.TokenScopeRead, expectedStatus: http.StatusUnauthorized, expectedError: "Missing bearer token", challenge: `Bearer realm="rpulse"`},
+		{name: "other scheme", header: "Basic read", scope: models.TokenScopeRead, expectedStatus: http.StatusUnauthorized, expectedError: "Missing bearer token", challenge: `Bearer realm="rpulse"`},
+		{name: "unknown token", header: "Bearer unknown", scope: models.TokenScopeRead, expectedStatus: http.StatusUnauthorized, expectedError: "Invalid token", challenge: `Bearer realm="rpulse", error="invalid_token"`},
+		{name: "expired token", header: "Bearer expired", scope: models.TokenScopeRead, expectedStatus: http.StatusUnauthorized, expectedError: "Token has expired", challenge: `Bearer realm="rpulse", error="invalid_token"`},
+		{name: "revoked token", header: "Bearer revoked", scope: models.TokenScopeRead, expectedStatus: http.StatusUnauthorized, expectedError: "Token has been revoked", challenge: `Bearer realm="rpulse", error="invalid_token"`},
+		{name: "insufficient scope", header: "Bearer read", scope: models.TokenScopeAdmin, expectedStatus: http.StatusForbidden, expectedError: "Token does not grant the admin scope", challenge: `Bearer realm="rpulse", error="insufficient_scope"`},
+		{name: "read token", header: "Bearer read", scope: models.TokenScopeRead, expectedStatus: http.StatusOK},
+		{name: "admin token reads", header: "bearer admin", scope: models.TokenScopeRead, expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			for secret, token := range tokens {
+				mockDB.On("GetAPIToken", apitoken.Hash(secret)).Return(token, true, nil).Maybe()
+			}
+			mockDB.On("GetAPIToken", apitoken.Hash("unknown")).Return(models.APIToken{}, false, nil).Maybe()
+
+			router := gin.New()
+			router.GET("/protected", RequireAPIToken(mockDB, tc.scope), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/protected", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.challenge, w.Header().Get("WWW-Authenticate"))
+			if tc.expectedError != "" {
+				assert.JSONEq(t, `{"error":"`+tc.expectedError+`"}`, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireAPIToken_DatabaseError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = zaptest.NewLogger(t)
+
+	mockDB := new(MockDB)
+	mockDB.On("GetAPIToken", apitoken.Hash("secret")).Return(models.APIToken{}, false, errors.New("database error"))
+
+	router := gin.New()
+	router.GET("/protected", RequireAPIToken(mockDB, models.TokenScopeRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockDB.AssertExpectations(t)
+}
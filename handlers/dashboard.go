@@ -20,6 +20,18 @@ func NewDashboardHandler() *DashboardHandler {
 
 // ValidateDashboardOrigin middleware ensures requests come from the dashboard UI
 func ValidateDashboardOrigin() gin.HandlerFunc {
+	return validateDashboardOrigin(false)
+}
+
+// ValidateDashboardStream middleware ensures event streams are opened by the dashboard UI.
+// EventSource cannot set headers, so the CSRF token may be passed in the query instead.
+func ValidateDashboardStream() gin.HandlerFunc {
+	return validateDashboardOrigin(true)
+}
+
+// validateDashboardOrigin checks the referer and the CSRF token, which is only read from the
+// query when queryToken is set so it does not end up in the URLs of the other endpoints
+func validateDashboardOrigin(queryToken bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		referer := c.Request.Header.Get("Referer")
 		if referer == "" {
@@ -63,6 +75,9 @@ func ValidateDashboardOrigin() gin.HandlerFunc {
 		}
 
 		csrfHeader := c.GetHeader(utils.HeaderName)
+		if csrfHeader == "" && queryToken {
+			csrfHeader = c.Query(utils.QueryParam)
+		}
 		if csrfHeader == "" || csrfHeader != csrfCookie {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error": "Invalid CSRF token",
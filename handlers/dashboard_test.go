@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/gateixeira/rpulse/internal/utils"
+	"github.com/gateixeira/rpulse/templates"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -14,8 +17,7 @@ func setupDashboardTest() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
 
-	// Set the correct template path relative to the test file
-	router.LoadHTMLGlob("../templates/*.html")
+	router.SetHTMLTemplate(template.Must(template.ParseFS(templates.FS, "*.html")))
 
 	handler := NewDashboardHandler()
 	router.GET("/dashboard", handler.Dashboard())
@@ -53,6 +55,7 @@ func TestValidateDashboardOrigin(t *testing.T) {
 		host           string
 		csrfCookie     string
 		csrfHeader     string
+		csrfQuery      string
 		expectedStatus int
 	}{
 		{
@@ -103,6 +106,14 @@ func TestValidateDashboardOrigin(t *testing.T) {
 			csrfHeader:     "",
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name:           "CSRF token in query",
+			referer:        "http://localhost:8080/dashboard",
+			host:           "localhost:8080",
+			csrfCookie:     "validtoken",
+			csrfQuery:      "validtoken",
+			expectedStatus: http.StatusForbidden,
+		},
 		{
 			name:           "mismatched CSRF token",
 			referer:        "http://localhost:8080/dashboard",
@@ -116,7 +127,7 @@ func TestValidateDashboardOrigin(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/test", nil)
+			req, _ := http.NewRequest("GET", "/test?"+url.Values{utils.QueryParam: {tt.csrfQuery}}.Encode(), nil)
 			req.Host = tt.host
 			if tt.referer != "" {
 				req.Header.Set("Referer", tt.referer)
@@ -136,3 +147,64 @@ func TestValidateDashboardOrigin(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateDashboardStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ValidateDashboardStream())
+	router.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		referer        string
+		csrfHeader     string
+		csrfQuery      string
+		expectedStatus int
+	}{
+		{
+			name:           "CSRF token in header",
+			referer:        "http://localhost:8080/dashboard",
+			csrfHeader:     "validtoken",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "CSRF token in query",
+			referer:        "http://localhost:8080/dashboard",
+			csrfQuery:      "validtoken",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "mismatched CSRF query",
+			referer:        "http://localhost:8080/dashboard",
+			csrfQuery:      "invalidtoken",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "invalid referer",
+			referer:        "http://malicious.com/dashboard",
+			csrfQuery:      "validtoken",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/test?"+url.Values{utils.QueryParam: {tt.csrfQuery}}.Encode(), nil)
+			req.Host = "localhost:8080"
+			req.Header.Set("Referer", tt.referer)
+			if tt.csrfHeader != "" {
+				req.Header.Set(utils.HeaderName, tt.csrfHeader)
+			}
+			req.AddCookie(&http.Cookie{
+				Name:  utils.CookieName,
+				Value: "validtoken",
+			})
+
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code, "Test case: %s", tt.name)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/live"
+	"github.com/gin-gonic/gin"
+)
+
+// liveKeepAlive is how often an idle stream sends a comment, so that proxies do not close it
+const liveKeepAlive = 15 * time.Second
+
+type LiveHandler struct {
+	broadcaster *live.Broadcaster
+}
+
+func NewLiveHandler(broadcaster *live.Broadcaster) *LiveHandler {
+	return &LiveHandler{broadcaster: broadcaster}
+}
+
+// Stream sends the dashboard the count changes and new samples as Server-Sent Events. The stream
+// ends when the client falls behind or the server shuts down, and the browser reconnects.
+func (h *LiveHandler) Stream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, unsubscribe := h.broadcaster.Subscribe()
+		defer unsubscribe()
+
+		keepAlive := time.NewTicker(liveKeepAlive)
+		defer keepAlive.Stop()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Accel-Buffering", "no")
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return false
+				}
+				c.SSEvent(event.Name, event.Data)
+				return true
+			case <-keepAlive.C:
+				_, err := io.WriteString(w, ": ping\n\n")
+				return err == nil
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/live"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveHandler_Stream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	broadcaster := live.NewBroadcaster()
+	broadcaster.PublishCounts(live.Counts{GitHubHosted: 1, SelfHosted: 2, Queued: 3, Waiting: 4})
+	router.GET("/live", NewLiveHandler(broadcaster).Stream())
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/live")
+	if err != nil {
+		t.Fatalf("GET /live error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading the stream error = %v", err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	// The current counts are sent on connect
+	assert.Equal(t, "event:counts\ndata:{\"current_count_github_hosted\":1,\"current_count_self_hosted\":2,\"current_queued_count\":3,\"current_waiting_count\":4}\n", readEvent())
+
+	broadcaster.PublishSample(models.HistoricalEntry{Timestamp: "2025-03-24T10:00:00Z", CountQueued: 3, PeakTotal: 6})
+	assert.Contains(t, readEvent(), "event:sample\ndata:{\"timestamp\":\"2025-03-24T10:00:00Z\"")
+
+	// Closing the broadcaster ends the stream
+	broadcaster.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = reader.ReadString(0)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the stream to end when the broadcaster closes")
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gateixeira/rpulse/internal/ingest"
+	"github.com/gateixeira/rpulse/internal/reaper"
+	"github.com/gin-gonic/gin"
+)
+
+type StatusHandler struct {
+	pipeline *ingest.Pipeline
+	reaper   *reaper.Reaper
+}
+
+func NewStatusHandler(pipeline *ingest.Pipeline, reaper *reaper.Reaper) *StatusHandler {
+	return &StatusHandler{pipeline: pipeline, reaper: reaper}
+}
+
+// Status reports the state of the background ingestion and of the job reaper
+func (h *StatusHandler) Status() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"ingest": h.pipeline.Stats(),
+			"reaper": h.reaper.Stats(),
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/ingest"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/internal/reaper"
+	"github.com/gateixeira/rpulse/internal/sampler"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	mockDB := new(MockDB)
+	pipeline := ingest.NewPipeline(ingest.NewProcessor(mockDB, pools.Default(), sampler.NewSampler(mockDB, pools.Default(), time.Minute, nil)), 2, 5)
+	jobReaper := reaper.NewReaper(mockDB, map[models.JobStatus]time.Duration{
+		models.JobStatusQueued: time.Hour,
+	}, time.Minute)
+	router.GET("/status", NewStatusHandler(pipeline, jobReaper).Status())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/status", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"queue_capacity":5`)
+	assert.Contains(t, w.Body.String(), `"workers":2`)
+	assert.Contains(t, w.Body.String(), `"max_ages_ms":{"queued":3600000}`)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/apitoken"
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/apiv1"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// TokenHandler manages the API tokens
+type TokenHandler struct {
+	db database.DatabaseInterface
+}
+
+func NewTokenHandler(db database.DatabaseInterface) *TokenHandler {
+	return &TokenHandler{db: db}
+}
+
+// ListTokens returns every API token, revoked and expired ones included, without their secrets
+func (h *TokenHandler) ListTokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokens, err := h.db.ListAPITokens(c.Request.Context())
+		if err != nil {
+			logger.Logger.Error("Failed to list API tokens", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data"})
+			return
+		}
+
+		now := time.Now()
+		documents := make([]apiv1.Token, 0, len(tokens))
+		for _, token := range tokens {
+			documents = append(documents, tokenDocument(token, now))
+		}
+
+		c.JSON(http.StatusOK, apiv1.Tokens{Tokens: documents})
+	}
+}
+
+// CreateToken creates an API token and returns it with its secret, which is never shown again
+func (h *TokenHandler) CreateToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request apiv1.CreateTokenRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		scope := models.TokenScopeRead
+		if request.Scope != "" {
+			scope = models.TokenScope(request.Scope)
+		}
+
+		var expiresAt time.Time
+		if request.ExpiresAt != nil {
+			expiresAt = *request.ExpiresAt
+		}
+
+		now := time.Now()
+		token, secret, err := apitoken.New(request.Name, scope, now, expiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token: " + err.Error()})
+			return
+		}
+
+		if err := h.db.CreateAPIToken(c.Request.Context(), token); err != nil {
+			logger.Logger.Error("Failed to create API token", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+			return
+		}
+
+		logger.Logger.Info("API token created", zap.String("tokenID", token.ID), zap.String("name", token.Name), zap.String("scope", string(token.Scope)))
+		c.JSON(http.StatusCreated, apiv1.CreatedToken{Token: tokenDocument(token, now), Secret: secret})
+	}
+}
+
+// RevokeToken revokes an API token, which is rejected from then on
+func (h *TokenHandler) RevokeToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		found, err := h.db.RevokeAPIToken(c.Request.Context(), id, time.Now())
+		if err != nil {
+			logger.Logger.Error("Failed to revoke API token", zap.Error(err), zap.String("tokenID", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+
+		logger.Logger.Info("API token revoked", zap.String("tokenID", id))
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// tokenDocument describes a token without its secret
+func tokenDocument(token models.APIToken, now time.Time) apiv1.Token {
+	return apiv1.Token{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scope:     string(token.Scope),
+		Status:    apitoken.Status(token, now),
+		CreatedAt: token.CreatedAt.UTC(),
+		ExpiresAt: optionalTime(token.ExpiresAt),
+		RevokedAt: optionalTime(token.RevokedAt),
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/apitoken"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/apiv1"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupTokenTest(t *testing.T) (*gin.Engine, *MockDB) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = zaptest.NewLogger(t)
+
+	mockDB := new(MockDB)
+	router := gin.New()
+	tokenHandler := NewTokenHandler(mockDB)
+	router.GET("/tokens", tokenHandler.ListTokens())
+	router.POST("/tokens", tokenHandler.CreateToken())
+	router.DELETE("/tokens/:id", tokenHandler.RevokeToken())
+
+	return router, mockDB
+}
+
+func TestTokenHandler_ListTokens(t *testing.T) {
+	router, mockDB := setupTokenTest(t)
+
+	createdAt := time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)
+	mockDB.On("ListAPITokens").Return([]models.APIToken{
+		{ID: "a1", Name: "grafana", Hash: "secret-hash", Scope: models.TokenScopeRead, CreatedAt: createdAt},
+		{ID: "b2", Name: "ops", Hash: "other-hash", Scope: models.TokenScopeAdmin, CreatedAt: createdAt, RevokedAt: createdAt.Add(time.Hour)},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/tokens", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `{"id":"a1","name":"grafana","scope":"read","status":"active","created_at":"2025-03-24T10:00:00Z"}`)
+	assert.Contains(t, w.Body.String(), `"status":"revoked","created_at":"2025-03-24T10:00:00Z","revoked_at":"2025-03-24T11:00:00Z"`)
+	assert.NotContains(t, w.Body.String(), "hash")
+	mockDB.AssertExpectations(t)
+}
+
+func TestTokenHandler_CreateToken(t *testing.T) {
+	router, mockDB := setupTokenTest(t)
+
+	mockDB.On("CreateAPIToken", mock.MatchedBy(func(token models.APIToken) bool {
+		return token.Name == "grafana" && token.Scope == models.TokenScopeRead && token.ExpiresAt.IsZero()
+	})).Return(nil)
+
+	req, _ := http.NewRequest("POST", "/tokens", strings.NewReader(`{"name":"grafana"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created apiv1.CreatedToken
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, strings.HasPrefix(created.Secret, apitoken.Prefix))
+	assert.Equal(t, "read", created.Scope)
+	assert.Equal(t, "active", created.Status)
+
+	stored := mockDB.Calls[0].Arguments.Get(0).(models.APIToken)
+	assert.Equal(t, stored.ID, created.ID)
+	assert.Equal(t, apitoken.Hash(created.Secret), stored.Hash)
+	mockDB.AssertExpectations(t)
+}
+
+func TestTokenHandler_CreateToken_Invalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{name: "malformed body", body: `{"name":`},
+		{name: "missing name", body: `{"scope":"read"}`},
+		{name: "unknown scope", body: `{"name":"ci","scope":"write"}`},
+		{name: "past expiry", body: `{"name":"ci","expires_at":"2020-01-01T00:00:00Z"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, mockDB := setupTokenTest(t)
+
+			req, _ := http.NewRequest("POST", "/tokens", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockDB.AssertNotCalled(t, "CreateAPIToken", mock.Anything)
+		})
+	}
+}
+
+func TestTokenHandler_RevokeToken(t *testing.T) {
+	testCases := []struct {
+		name           string
+		found          bool
+		err            error
+		expectedStatus int
+	}{
+		{name: "revoked", found: true, expectedStatus: http.StatusNoContent},
+		{name: "not found", found: false, expectedStatus: http.StatusNotFound},
+		{name: "database error", err: errors.New("database error"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, mockDB := setupTokenTest(t)
+			mockDB.On("RevokeAPIToken", "a1").Return(tc.found, tc.err)
+
+			req, _ := http.NewRequest("DELETE", "/tokens/a1", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
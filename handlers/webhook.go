@@ -6,40 +6,58 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/gateixeira/rpulse/internal/config"
 	"github.com/gateixeira/rpulse/internal/database"
-	"github.com/gateixeira/rpulse/internal/utils"
+	"github.com/gateixeira/rpulse/internal/ingest"
+	"github.com/gateixeira/rpulse/internal/metrics"
 	"github.com/gateixeira/rpulse/models"
 	"github.com/gateixeira/rpulse/pkg/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+const (
+	// EventHeader is the header GitHub uses to name the event type of a delivery
+	EventHeader = "X-GitHub-Event"
+	// DeliveryHeader is the header carrying the GUID GitHub assigns to each delivery
+	DeliveryHeader = "X-GitHub-Delivery"
+)
+
 type WebhookHandler struct {
-	db database.DatabaseInterface
+	db       database.DatabaseInterface
+	pipeline *ingest.Pipeline
 }
 
-func NewWebhookHandler(db database.DatabaseInterface) *WebhookHandler {
-	return &WebhookHandler{db: db}
+func NewWebhookHandler(db database.DatabaseInterface, pipeline *ingest.Pipeline) *WebhookHandler {
+	return &WebhookHandler{db: db, pipeline: pipeline}
 }
 
-func (h *WebhookHandler) handleInProgressJob(job models.WorkflowJob) {
-	logger.Logger.Debug("Job is running", zap.Int64("ID", job.ID))
-
-	queueTime := job.StartedAt.Sub(job.CreatedAt)
-
-	if err := h.db.AddQueueTimeDuration(job.ID, job.CreatedAt, queueTime); err != nil {
-		logger.Logger.Error("Error adding queue time duration", zap.Error(err))
-		// Continue execution even if we fail to add queue time
+// extractPayload returns the JSON document carried by a webhook delivery. GitHub
+// sends either the raw JSON document (application/json) or a form with the JSON
+// document in its "payload" field (application/x-www-form-urlencoded).
+func extractPayload(contentType string, body []byte) ([]byte, int, error) {
+	switch contentType {
+	case "application/json":
+		return body, http.StatusOK, nil
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("invalid URL-encoded payload")
+		}
+		if !values.Has("payload") {
+			return nil, http.StatusBadRequest, errors.New("missing payload parameter")
+		}
+		return []byte(values.Get("payload")), http.StatusOK, nil
+	default:
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q", contentType)
 	}
-
-	logger.Logger.Debug("Job was in queue for", zap.Int64("ID", job.ID), zap.Duration("queueTime", queueTime))
 }
 
 // ValidateGitHubWebhook middleware validates the GitHub webhook signature
@@ -55,8 +73,7 @@ func ValidateGitHubWebhook(config *config.Config) gin.HandlerFunc {
 		signature := c.GetHeader("X-Hub-Signature-256")
 		if signature == "" {
 			logger.Logger.Error("Webhook validation failed: Missing X-Hub-Signature-256 header")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing signature header"})
-			c.Abort()
+			rejectUnverified(c, "Missing signature header")
 			return
 		}
 
@@ -90,15 +107,13 @@ func ValidateGitHubWebhook(config *config.Config) gin.HandlerFunc {
 		receivedBytes, err := hex.DecodeString(signatureHash)
 		if err != nil {
 			logger.Logger.Error("Error decoding received signature", zap.Error(err))
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature format"})
-			c.Abort()
+			rejectUnverified(c, "Invalid signature format")
 			return
 		}
 
 		if !hmac.Equal(expectedBytes, receivedBytes) {
 			logger.Logger.Error("Webhook validation failed: Invalid signature")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
-			c.Abort()
+			rejectUnverified(c, "Invalid signature")
 			return
 		}
 
@@ -106,9 +121,30 @@ func ValidateGitHubWebhook(config *config.Config) gin.HandlerFunc {
 	}
 }
 
-// Handle processes incoming webhook events
+// rejectUnverified answers a delivery whose signature does not match. It is counted without
+// its event, since anyone can set the event header.
+func rejectUnverified(c *gin.Context, message string) {
+	metrics.WebhookDeliveries.WithLabelValues("", "", metrics.OutcomeUnauthorized).Inc()
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	c.Abort()
+}
+
+// Handle validates incoming webhook events and enqueues them for processing,
+// dispatching on the X-GitHub-Event header
 func (h *WebhookHandler) Handle() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		receivedAt := time.Now()
+		eventType := c.GetHeader(EventHeader)
+
+		// Every delivery is counted once with the outcome it ends with
+		var action string
+		outcome := metrics.OutcomeInvalid
+		defer func() {
+			eventLabel, actionLabel := metrics.WebhookLabels(eventType, action)
+			metrics.WebhookDeliveries.WithLabelValues(eventLabel, actionLabel, outcome).Inc()
+		}()
+
 		body, err := io.ReadAll(c.Request.Body)
 		if err != nil {
 			logger.Logger.Error("Failed to read request body", zap.Error(err))
@@ -116,85 +152,122 @@ func (h *WebhookHandler) Handle() gin.HandlerFunc {
 			return
 		}
 
-		decodedBody, err := url.QueryUnescape(string(body))
+		jsonData, status, err := extractPayload(c.ContentType(), body)
 		if err != nil {
-			logger.Logger.Error("Failed to decode URL-encoded payload", zap.Error(err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL-encoded payload"})
+			logger.Logger.Error("Failed to extract webhook payload",
+				zap.Error(err),
+				zap.String("contentType", c.ContentType()),
+			)
+			c.JSON(status, gin.H{"error": err.Error()})
 			return
 		}
 
-		const prefix = "payload="
-		if !strings.HasPrefix(decodedBody, prefix) {
-			logger.Logger.Error("Missing payload parameter")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing payload parameter"})
+		if !json.Valid(jsonData) {
+			logger.Logger.Error("Invalid JSON payload", zap.ByteString("jsonData", jsonData))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
 			return
 		}
-		jsonData := decodedBody[len(prefix):]
+		action = payloadAction(jsonData)
 
-		var event models.WebhookEvent
-		if err := json.Unmarshal([]byte(jsonData), &event); err != nil {
-			logger.Logger.Error("Failed to parse JSON payload",
-				zap.Error(err),
-				zap.String("jsonData", jsonData),
-			)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if eventType == "" {
+			logger.Logger.Error("Missing event header")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing " + EventHeader + " header"})
 			return
 		}
 
-		job := models.WorkflowJob{
-			ID:          event.WorkflowJob.ID,
-			Status:      models.JobStatus(event.Action),
-			RunnerType:  utils.GetRunnerType(event.WorkflowJob.Labels),
-			CreatedAt:   event.WorkflowJob.CreatedAt,
-			StartedAt:   event.WorkflowJob.StartedAt,
-			CompletedAt: event.WorkflowJob.CompletedAt,
+		deliveryID := c.GetHeader(DeliveryHeader)
+		if deliveryID == "" {
+			logger.Logger.Debug("Missing delivery header, skipping duplicate detection")
+		} else {
+			// Payloads of the events that are processed are kept so the delivery can be replayed
+			var payload []byte
+			if h.pipeline.Handles(eventType) {
+				payload = jsonData
+			}
+
+			isNew, err := h.db.RecordDelivery(ctx, deliveryID, eventType, payload, receivedAt)
+			if err != nil {
+				logger.Logger.Error("Error recording delivery", zap.Error(err), zap.String("deliveryID", deliveryID))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record delivery"})
+				outcome = metrics.OutcomeError
+				return
+			}
+			if !isNew {
+				logger.Logger.Info("Skipping duplicate delivery", zap.String("deliveryID", deliveryID))
+				c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+				outcome = metrics.OutcomeDuplicate
+				return
+			}
 		}
 
-		if err := h.db.AddOrUpdateJob(job.ID, job.Status,
-			job.RunnerType, job.CreatedAt, job.StartedAt, job.CompletedAt); err != nil {
-			logger.Logger.Error("Error saving job to database", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save job"})
+		switch {
+		case eventType == "ping":
+			outcome = h.handlePing(c, jsonData)
+		case !h.pipeline.Handles(eventType):
+			logger.Logger.Debug("Skipping unsupported event", zap.String("event", eventType))
+			c.JSON(http.StatusAccepted, gin.H{"status": "ignored"})
+			outcome = metrics.OutcomeIgnored
+		default:
+			outcome = h.enqueue(c, ingest.Delivery{
+				ID:         deliveryID,
+				Event:      eventType,
+				Payload:    jsonData,
+				ReceivedAt: receivedAt,
+			})
+			// Queued deliveries are marked as processed by the pipeline
 			return
 		}
 
-		if job.Status == models.JobStatusInProgress {
-			h.handleInProgressJob(job)
+		if deliveryID != "" {
+			if err := h.db.MarkDeliveryProcessed(ctx, deliveryID); err != nil {
+				logger.Logger.Error("Error marking delivery as processed", zap.Error(err), zap.String("deliveryID", deliveryID))
+			}
 		}
+	}
+}
 
-		selfHostedCount, err := h.db.GetRunningJobs(models.RunnerTypeSelfHosted)
-		if err != nil {
-			logger.Logger.Error("Error getting self-hosted count", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get counts"})
-			return
-		}
+// handlePing answers the ping event GitHub sends when a webhook is created and returns the outcome
+func (h *WebhookHandler) handlePing(c *gin.Context, payload []byte) string {
+	var event models.WebhookPingEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		logger.Logger.Error("Failed to parse JSON payload", zap.Error(err), zap.ByteString("jsonData", payload))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return metrics.OutcomeInvalid
+	}
 
-		githubHostedCount, err := h.db.GetRunningJobs(models.RunnerTypeGitHubHosted)
-		if err != nil {
-			logger.Logger.Error("Error getting github-hosted count", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get counts"})
-			return
-		}
+	logger.Logger.Info("Received ping", zap.Int64("hookID", event.HookID), zap.String("zen", event.Zen))
+	c.JSON(http.StatusOK, gin.H{"status": "pong"})
+	return metrics.OutcomeProcessed
+}
 
-		queuedCount, err := h.db.CountQueuedJobs()
-		if err != nil {
-			logger.Logger.Error("Error getting queued count", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get counts"})
-			return
-		}
+// enqueue hands a delivery to the ingest pipeline, applying backpressure when it is full,
+// and returns the outcome
+func (h *WebhookHandler) enqueue(c *gin.Context, delivery ingest.Delivery) string {
+	if err := h.pipeline.Enqueue(delivery); err != nil {
+		logger.Logger.Warn("Rejecting delivery", zap.Error(err), zap.String("deliveryID", delivery.ID))
 
-		historicalEntry := models.HistoricalEntry{
-			Timestamp:         time.Now().Format(time.RFC3339),
-			CountSelfHosted:   len(selfHostedCount),
-			CountGitHubHosted: len(githubHostedCount),
-			CountQueued:       queuedCount,
+		// The claim is given up so a redelivery of the rejected delivery is processed
+		if delivery.ID != "" {
+			if err := h.db.ReleaseDelivery(c.Request.Context(), delivery.ID); err != nil {
+				logger.Logger.Error("Error releasing delivery", zap.Error(err), zap.String("deliveryID", delivery.ID))
+			}
 		}
+		c.Header("Retry-After", "10")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server busy, retry later"})
+		return metrics.OutcomeRejected
+	}
 
-		if err := h.db.AddHistoricalEntry(historicalEntry); err != nil {
-			logger.Logger.Error("Error adding historical entry", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add historical entry"})
-			return
-		}
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued"})
+	return metrics.OutcomeQueued
+}
 
-		c.JSON(http.StatusOK, gin.H{"status": "success"})
+// payloadAction returns the action of a webhook payload, which is empty for events without actions
+func payloadAction(payload []byte) string {
+	var envelope struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return ""
 	}
+	return envelope.Action
 }
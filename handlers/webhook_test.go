@@ -2,21 +2,27 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/gateixeira/rpulse/internal/config"
+	"github.com/gateixeira/rpulse/internal/ingest"
+	"github.com/gateixeira/rpulse/internal/metrics"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/internal/sampler"
 	"github.com/gateixeira/rpulse/models"
 	"github.com/gateixeira/rpulse/pkg/logger"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap/zaptest"
@@ -27,13 +33,12 @@ type MockDB struct {
 	mock.Mock
 }
 
-func (m *MockDB) AddOrUpdateJob(jobID int64, status models.JobStatus, runnerType models.RunnerType,
-	createdAt, startedAt, completedAt time.Time) error {
-	args := m.Called(jobID, status, runnerType, createdAt, startedAt, completedAt)
-	return args.Error(0)
+func (m *MockDB) AddOrUpdateJob(ctx context.Context, job models.WorkflowJob) (models.WorkflowJob, bool, error) {
+	args := m.Called(job)
+	return args.Get(0).(models.WorkflowJob), args.Bool(1), args.Error(2)
 }
 
-func (m *MockDB) GetRunningJobs(runnerType models.RunnerType) ([]string, error) {
+func (m *MockDB) GetRunningJobs(ctx context.Context, runnerType models.RunnerType) ([]string, error) {
 	args := m.Called(runnerType)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -41,43 +46,255 @@ func (m *MockDB) GetRunningJobs(runnerType models.RunnerType) ([]string, error)
 	return args.Get(0).([]string), args.Error(1)
 }
 
-func (m *MockDB) CountQueuedJobs() (int, error) {
+func (m *MockDB) CountQueuedJobs(ctx context.Context) (int, error) {
 	args := m.Called()
 	return args.Int(0), args.Error(1)
 }
 
-func (m *MockDB) AddHistoricalEntry(entry models.HistoricalEntry) error {
+func (m *MockDB) CountWaitingJobs(ctx context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDB) AddHistoricalEntry(ctx context.Context, entry models.HistoricalEntry) error {
 	args := m.Called(entry)
 	return args.Error(0)
 }
 
-func (m *MockDB) GetHistoricalDataByPeriod(period string) ([]models.HistoricalEntry, error) {
+func (m *MockDB) GetHistoricalDataByPeriod(ctx context.Context, period string) ([]models.HistoricalEntry, error) {
 	args := m.Called(period)
 	return args.Get(0).([]models.HistoricalEntry), args.Error(1)
 }
 
-func (m *MockDB) CalculatePeakDemand(period string) (int, string, error) {
+func (m *MockDB) CalculatePeakDemand(ctx context.Context, period string) (int, string, error) {
 	args := m.Called(period)
 	return args.Int(0), args.String(1), args.Error(2)
 }
 
-func (m *MockDB) AddQueueTimeDuration(jobID int64, createdAt time.Time, duration time.Duration) error {
-	args := m.Called(jobID, createdAt, duration)
+func (m *MockDB) AddApprovalWaitDuration(ctx context.Context, jobID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	args := m.Called(jobID, createdAt, pool, duration, recordedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDB) AddQueueTimeDuration(ctx context.Context, jobID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	args := m.Called(jobID, createdAt, pool, duration, recordedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDB) CountQueuedJobsByPool(ctx context.Context) (map[string]int, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *MockDB) CountRunningJobsByPool(ctx context.Context) (map[string]int, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *MockDB) CountWaitingJobsByPool(ctx context.Context) (map[string]int, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *MockDB) GetAverageApprovalWaitTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	args := m.Called(period)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]time.Duration), args.Error(1)
+}
+
+func (m *MockDB) GetAverageQueueTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	args := m.Called(period)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]time.Duration), args.Error(1)
+}
+
+func (m *MockDB) AddPoolHistoricalEntries(ctx context.Context, entries []models.PoolHistoricalEntry) error {
+	args := m.Called(entries)
 	return args.Error(0)
 }
 
-func (m *MockDB) GetAverageQueueTime() (time.Duration, error) {
+func (m *MockDB) GetPoolHistoricalDataByPeriod(ctx context.Context, period, pool string) ([]models.PoolHistoricalEntry, error) {
+	args := m.Called(period, pool)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.PoolHistoricalEntry), args.Error(1)
+}
+
+func (m *MockDB) GetHistoricalDataByRange(ctx context.Context, r models.TimeRange) ([]models.HistoricalEntry, error) {
+	args := m.Called(r)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.HistoricalEntry), args.Error(1)
+}
+
+func (m *MockDB) GetPoolHistoricalDataByRange(ctx context.Context, r models.TimeRange, pool string) ([]models.PoolHistoricalEntry, error) {
+	args := m.Called(r, pool)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.PoolHistoricalEntry), args.Error(1)
+}
+
+func (m *MockDB) CalculatePeakDemandByPool(ctx context.Context, period, pool string) (int, string, error) {
+	args := m.Called(period, pool)
+	return args.Int(0), args.String(1), args.Error(2)
+}
+
+func (m *MockDB) ReapStaleJobs(ctx context.Context, status models.JobStatus, maxAge time.Duration) (int, error) {
+	args := m.Called(status, maxAge)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDB) ApplyRetentionPolicies(ctx context.Context, policies models.RetentionPolicies) error {
+	args := m.Called(policies)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
 	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.RetentionPolicy), args.Error(1)
+}
+
+func (m *MockDB) StepGranularity(from, now time.Time) time.Duration {
+	return time.Second
+}
+
+func (m *MockDB) GetQueueTimeStats(ctx context.Context, filter models.QueueTimeFilter) (models.QueueTimeStats, error) {
+	args := m.Called(filter)
+	return args.Get(0).(models.QueueTimeStats), args.Error(1)
+}
+
+func (m *MockDB) GetQueueTimeHistogram(ctx context.Context, filter models.QueueTimeFilter, bounds []time.Duration) ([]models.HistogramBucket, error) {
+	args := m.Called(filter, bounds)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.HistogramBucket), args.Error(1)
+}
+
+func (m *MockDB) GetJobDurationStats(ctx context.Context, groupBy string, filter models.JobDurationFilter, limit int) ([]models.JobDurationStats, error) {
+	args := m.Called(groupBy, filter, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.JobDurationStats), args.Error(1)
+}
+
+func (m *MockDB) GetLongestJobs(ctx context.Context, filter models.JobDurationFilter, limit int) ([]models.JobDuration, error) {
+	args := m.Called(filter, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.JobDuration), args.Error(1)
+}
+
+func (m *MockDB) ListJobs(ctx context.Context, filter models.JobFilter) ([]models.WorkflowJob, error) {
+	args := m.Called(filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.WorkflowJob), args.Error(1)
+}
+
+func (m *MockDB) GetJob(ctx context.Context, id int64) (models.WorkflowJob, bool, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.WorkflowJob), args.Bool(1), args.Error(2)
+}
+
+func (m *MockDB) AddJobEvent(ctx context.Context, event models.JobEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetJobEvents(ctx context.Context, id int64, createdAt time.Time) ([]models.JobEvent, error) {
+	args := m.Called(id, createdAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.JobEvent), args.Error(1)
+}
+
+func (m *MockDB) GetAverageApprovalWaitTime(ctx context.Context, period string) (time.Duration, error) {
+	args := m.Called(period)
 	return args.Get(0).(time.Duration), args.Error(1)
 }
 
-func setupWebhookTest(t *testing.T) (*gin.Engine, *MockDB, *config.Config) {
+func (m *MockDB) AddOrUpdateWorkflowRun(ctx context.Context, run models.WorkflowRun) error {
+	args := m.Called(run)
+	return args.Error(0)
+}
+
+func (m *MockDB) RecordDelivery(ctx context.Context, deliveryID, event string, payload []byte, receivedAt time.Time) (bool, error) {
+	args := m.Called(deliveryID, event, payload, receivedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDB) MarkDeliveryProcessed(ctx context.Context, deliveryID string) error {
+	args := m.Called(deliveryID)
+	return args.Error(0)
+}
+
+func (m *MockDB) ReleaseDelivery(ctx context.Context, deliveryID string) error {
+	args := m.Called(deliveryID)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockDB) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetAPIToken(ctx context.Context, hash string) (models.APIToken, bool, error) {
+	args := m.Called(hash)
+	return args.Get(0).(models.APIToken), args.Bool(1), args.Error(2)
+}
+
+func (m *MockDB) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.APIToken), args.Error(1)
+}
+
+func (m *MockDB) RevokeAPIToken(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+func setupWebhookTest(t *testing.T, queueSize int) (*gin.Engine, *MockDB, *ingest.Pipeline, *config.Config) {
 	gin.SetMode(gin.TestMode)
 	logger.Logger = zaptest.NewLogger(t)
 
 	mockDB := new(MockDB)
 	router := gin.New()
-	handler := NewWebhookHandler(mockDB)
+
+	// The pipeline is not started so enqueued deliveries stay in the queue
+	pipeline := ingest.NewPipeline(ingest.NewProcessor(mockDB, pools.Default(), sampler.NewSampler(mockDB, pools.Default(), time.Minute, nil)), 1, queueSize)
+	handler := NewWebhookHandler(mockDB, pipeline)
 
 	cfg := &config.Config{
 		Vars: config.Vars{
@@ -86,7 +303,7 @@ func setupWebhookTest(t *testing.T) (*gin.Engine, *MockDB, *config.Config) {
 	}
 
 	router.POST("/webhook", ValidateGitHubWebhook(cfg), handler.Handle())
-	return router, mockDB, cfg
+	return router, mockDB, pipeline, cfg
 }
 
 func generateWebhookSignature(payload []byte, secret string) string {
@@ -95,83 +312,53 @@ func generateWebhookSignature(payload []byte, secret string) string {
 	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
 }
 
-func TestWebhookHandler_Handle_Success(t *testing.T) {
-	router, mockDB, cfg := setupWebhookTest(t)
-
-	// Create raw JSON with properly formatted RFC3339 timestamps
-	rawJSON := `{
-		"action": "in_progress",
-		"workflow_job": {
-			"id": 123,
-			"labels": ["self-hosted"],
-			"created_at": "2025-03-24T17:25:36Z",
-			"started_at": "2025-03-24T17:30:36Z",
-			"completed_at": "0001-01-01T00:00:00Z"
-		}
-	}`
-
-	// Parse the timestamps for mock expectations
-	var event models.WebhookEvent
-	if err := json.Unmarshal([]byte(rawJSON), &event); err != nil {
-		t.Fatal("Failed to parse test JSON:", err)
+func newWebhookRequest(body []byte, contentType, event, secret string) *http.Request {
+	req, _ := http.NewRequest("POST", "/webhook", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", contentType)
+	if event != "" {
+		req.Header.Set(EventHeader, event)
 	}
+	req.Header.Set("X-Hub-Signature-256", generateWebhookSignature(body, secret))
+	return req
+}
 
-	// Setup mock expectations
-	mockDB.On("AddOrUpdateJob",
-		event.WorkflowJob.ID,
-		models.JobStatus(event.Action),
-		models.RunnerTypeSelfHosted,
-		event.WorkflowJob.CreatedAt,
-		event.WorkflowJob.StartedAt,
-		event.WorkflowJob.CompletedAt).
-		Return(nil)
-
-	mockDB.On("AddQueueTimeDuration",
-		event.WorkflowJob.ID,
-		event.WorkflowJob.CreatedAt,
-		5*time.Minute).
-		Return(nil)
-
-	mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).
-		Return([]string{"123", "456"}, nil)
-
-	mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).
-		Return([]string{"789"}, nil)
-
-	mockDB.On("CountQueuedJobs").Return(3, nil)
+const workflowJobJSON = `{
+	"action": "in_progress",
+	"workflow_job": {
+		"id": 123,
+		"labels": ["self-hosted"],
+		"created_at": "2025-03-24T17:25:36Z",
+		"started_at": "2025-03-24T17:30:36Z",
+		"completed_at": "0001-01-01T00:00:00Z"
+	}
+}`
 
-	mockDB.On("AddHistoricalEntry", mock.MatchedBy(func(entry models.HistoricalEntry) bool {
-		return entry.CountSelfHosted == 2 &&
-			entry.CountGitHubHosted == 1 &&
-			entry.CountQueued == 3
-	})).Return(nil)
+func TestWebhookHandler_Handle_Success(t *testing.T) {
+	router, mockDB, pipeline, cfg := setupWebhookTest(t, 10)
 
 	// Create request with signature and payload parameter
-	payloadBody := []byte("payload=" + rawJSON)
-	req, _ := http.NewRequest("POST", "/webhook", bytes.NewBuffer(payloadBody))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("X-Hub-Signature-256", generateWebhookSignature(payloadBody, cfg.Vars.WebhookSecret))
+	payloadBody := []byte("payload=" + workflowJobJSON)
+	req := newWebhookRequest(payloadBody, "application/x-www-form-urlencoded", "workflow_job", cfg.Vars.WebhookSecret)
 
 	// Perform request
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	// Assert response
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "success")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), "queued")
+	assert.Equal(t, 1, pipeline.Stats().QueueDepth)
 
-	// Verify mock expectations
+	// The database work is left to the pipeline workers
 	mockDB.AssertExpectations(t)
 }
 
 func TestWebhookHandler_Handle_InvalidJSON(t *testing.T) {
-	router, _, cfg := setupWebhookTest(t)
+	router, _, pipeline, cfg := setupWebhookTest(t, 10)
 
 	// Create invalid JSON request with payload parameter
 	body := []byte("payload=invalid json")
-	req, _ := http.NewRequest("POST", "/webhook", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("X-Hub-Signature-256", generateWebhookSignature(body, cfg.Vars.WebhookSecret))
+	req := newWebhookRequest(body, "application/x-www-form-urlencoded", "workflow_job", cfg.Vars.WebhookSecret)
 
 	// Perform request
 	w := httptest.NewRecorder()
@@ -179,152 +366,264 @@ func TestWebhookHandler_Handle_InvalidJSON(t *testing.T) {
 
 	// Assert response
 	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 0, pipeline.Stats().QueueDepth)
+}
+
+func TestWebhookHandler_Handle_ContentTypes(t *testing.T) {
+	// The job name contains characters that a query-unescape step would mangle
+	rawJSON := `{
+		"action": "queued",
+		"workflow_job": {
+			"id": 456,
+			"name": "build 100% c++",
+			"labels": ["ubuntu-latest"],
+			"created_at": "2025-03-24T17:25:36Z"
+		}
+	}`
+
+	testCases := []struct {
+		name         string
+		contentType  string
+		body         []byte
+		expectedCode int
+	}{
+		{
+			name:         "JSON payload",
+			contentType:  "application/json",
+			body:         []byte(rawJSON),
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "JSON payload with charset",
+			contentType:  "application/json; charset=utf-8",
+			body:         []byte(rawJSON),
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "form-encoded payload",
+			contentType:  "application/x-www-form-urlencoded",
+			body:         []byte("payload=" + url.QueryEscape(rawJSON)),
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "form-encoded without payload parameter",
+			contentType:  "application/x-www-form-urlencoded",
+			body:         []byte("data=" + url.QueryEscape(rawJSON)),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unsupported content type",
+			contentType:  "text/plain",
+			body:         []byte(rawJSON),
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, _, pipeline, cfg := setupWebhookTest(t, 10)
+
+			req := newWebhookRequest(tc.body, tc.contentType, "workflow_job", cfg.Vars.WebhookSecret)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedCode == http.StatusAccepted, pipeline.Stats().QueueDepth == 1)
+		})
+	}
+}
+
+func TestWebhookHandler_Handle_EventRouting(t *testing.T) {
+	testCases := []struct {
+		name            string
+		event           string
+		body            string
+		expectedCode    int
+		expectedBody    string
+		expectQueued    bool
+		expectedEvent   string
+		expectedAction  string
+		expectedOutcome string
+	}{
+		{
+			name:            "ping",
+			event:           "ping",
+			body:            `{"zen": "Design for failure.", "hook_id": 42}`,
+			expectedCode:    http.StatusOK,
+			expectedBody:    "pong",
+			expectedOutcome: metrics.OutcomeProcessed,
+		},
+		{
+			name:            "workflow_run",
+			event:           "workflow_run",
+			body:            `{"action": "requested", "workflow_run": {"id": 1}}`,
+			expectedCode:    http.StatusAccepted,
+			expectedBody:    "queued",
+			expectQueued:    true,
+			expectedAction:  "requested",
+			expectedOutcome: metrics.OutcomeQueued,
+		},
+		{
+			name:            "unsupported event",
+			event:           "push",
+			body:            `{"ref": "refs/heads/main"}`,
+			expectedCode:    http.StatusAccepted,
+			expectedBody:    "ignored",
+			expectedEvent:   metrics.LabelOther,
+			expectedOutcome: metrics.OutcomeIgnored,
+		},
+		{
+			name:            "unsupported event with action",
+			event:           "issues",
+			body:            `{"action": "opened"}`,
+			expectedCode:    http.StatusAccepted,
+			expectedBody:    "ignored",
+			expectedEvent:   metrics.LabelOther,
+			expectedAction:  metrics.LabelOther,
+			expectedOutcome: metrics.OutcomeIgnored,
+		},
+		{
+			name:            "missing event header",
+			event:           "",
+			body:            `{}`,
+			expectedCode:    http.StatusBadRequest,
+			expectedBody:    "Missing " + EventHeader + " header",
+			expectedOutcome: metrics.OutcomeInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, mockDB, pipeline, cfg := setupWebhookTest(t, 10)
+
+			req := newWebhookRequest([]byte(tc.body), "application/json", tc.event, cfg.Vars.WebhookSecret)
+			expectedEvent := tc.event
+			if tc.expectedEvent != "" {
+				expectedEvent = tc.expectedEvent
+			}
+			deliveries := metrics.WebhookDeliveries.WithLabelValues(expectedEvent, tc.expectedAction, tc.expectedOutcome)
+			before := testutil.ToFloat64(deliveries)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedBody)
+			assert.Equal(t, tc.expectQueued, pipeline.Stats().QueueDepth == 1)
+			assert.Equal(t, before+1, testutil.ToFloat64(deliveries))
+
+			// None of these events may touch the database from the request
+			mockDB.AssertExpectations(t)
+		})
+	}
 }
 
-func TestWebhookHandler_Handle_DatabaseErrors(t *testing.T) {
+func TestWebhookHandler_Handle_Deliveries(t *testing.T) {
+	rawJSON := `{"action": "completed", "workflow_run": {"id": 987}}`
+
 	testCases := []struct {
-		name          string
-		setupMocks    func(*MockDB)
-		expectedCode  int
-		expectedError string
+		name         string
+		event        string
+		queueSize    int
+		setupMocks   func(*MockDB)
+		expectedCode int
+		expectedBody string
 	}{
 		{
-			name: "AddOrUpdateJob error",
+			name:      "new delivery is queued",
+			event:     "workflow_run",
+			queueSize: 10,
 			setupMocks: func(mockDB *MockDB) {
-				mockDB.On("AddOrUpdateJob",
-					mock.AnythingOfType("int64"),
-					mock.AnythingOfType("models.JobStatus"),
-					mock.AnythingOfType("models.RunnerType"),
-					mock.Anything,
-					mock.Anything,
-					mock.Anything).
-					Return(errors.New("database error"))
+				mockDB.On("RecordDelivery", "guid-1", "workflow_run", []byte(rawJSON), mock.Anything).Return(true, nil)
 			},
-			expectedCode:  http.StatusInternalServerError,
-			expectedError: "Failed to save job",
+			expectedCode: http.StatusAccepted,
+			expectedBody: "queued",
 		},
 		{
-			name: "GetRunningJobs self-hosted error",
+			name:      "duplicate delivery is acknowledged without processing",
+			event:     "workflow_run",
+			queueSize: 10,
 			setupMocks: func(mockDB *MockDB) {
-				mockDB.On("AddOrUpdateJob",
-					mock.Anything, mock.Anything, mock.Anything,
-					mock.Anything, mock.Anything, mock.Anything).
-					Return(nil)
-				mockDB.On("AddQueueTimeDuration",
-					mock.Anything, mock.Anything, mock.Anything).
-					Return(nil)
-				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).
-					Return(nil, errors.New("database error"))
+				mockDB.On("RecordDelivery", "guid-1", "workflow_run", []byte(rawJSON), mock.Anything).Return(false, nil)
 			},
-			expectedCode:  http.StatusInternalServerError,
-			expectedError: "Failed to get counts",
+			expectedCode: http.StatusOK,
+			expectedBody: "duplicate",
 		},
 		{
-			name: "GetRunningJobs github-hosted error",
+			name:      "unsupported delivery is marked as processed",
+			event:     "push",
+			queueSize: 10,
 			setupMocks: func(mockDB *MockDB) {
-				mockDB.On("AddOrUpdateJob",
-					mock.Anything, mock.Anything, mock.Anything,
-					mock.Anything, mock.Anything, mock.Anything).
-					Return(nil)
-				mockDB.On("AddQueueTimeDuration",
-					mock.Anything, mock.Anything, mock.Anything).
-					Return(nil)
-				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).
-					Return([]string{}, nil)
-				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).
-					Return(nil, errors.New("database error"))
+				mockDB.On("RecordDelivery", "guid-1", "push", []byte(nil), mock.Anything).Return(true, nil)
+				mockDB.On("MarkDeliveryProcessed", "guid-1").Return(nil)
 			},
-			expectedCode:  http.StatusInternalServerError,
-			expectedError: "Failed to get counts",
+			expectedCode: http.StatusAccepted,
+			expectedBody: "ignored",
 		},
 		{
-			name: "CountQueuedJobs error",
+			name:      "rejected delivery is released instead of marked as processed",
+			event:     "workflow_run",
+			queueSize: 0,
 			setupMocks: func(mockDB *MockDB) {
-				mockDB.On("AddOrUpdateJob",
-					mock.Anything, mock.Anything, mock.Anything,
-					mock.Anything, mock.Anything, mock.Anything).
-					Return(nil)
-				mockDB.On("AddQueueTimeDuration",
-					mock.Anything, mock.Anything, mock.Anything).
-					Return(nil)
-				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).
-					Return([]string{}, nil)
-				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).
-					Return([]string{}, nil)
-				mockDB.On("CountQueuedJobs").
-					Return(0, errors.New("database error"))
+				mockDB.On("RecordDelivery", "guid-1", "workflow_run", []byte(rawJSON), mock.Anything).Return(true, nil)
+				mockDB.On("ReleaseDelivery", "guid-1").Return(nil)
 			},
-			expectedCode:  http.StatusInternalServerError,
-			expectedError: "Failed to get counts",
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: "Server busy",
 		},
 		{
-			name: "AddHistoricalEntry error",
+			name:      "delivery log error",
+			event:     "workflow_run",
+			queueSize: 10,
 			setupMocks: func(mockDB *MockDB) {
-				mockDB.On("AddOrUpdateJob",
-					mock.Anything, mock.Anything, mock.Anything,
-					mock.Anything, mock.Anything, mock.Anything).
-					Return(nil)
-				mockDB.On("AddQueueTimeDuration",
-					mock.Anything, mock.Anything, mock.Anything).
-					Return(nil)
-				mockDB.On("GetRunningJobs", models.RunnerTypeSelfHosted).
-					Return([]string{}, nil)
-				mockDB.On("GetRunningJobs", models.RunnerTypeGitHubHosted).
-					Return([]string{}, nil)
-				mockDB.On("CountQueuedJobs").Return(0, nil)
-				mockDB.On("AddHistoricalEntry", mock.Anything).
-					Return(errors.New("database error"))
+				mockDB.On("RecordDelivery", "guid-1", "workflow_run", []byte(rawJSON), mock.Anything).Return(false, errors.New("database error"))
 			},
-			expectedCode:  http.StatusInternalServerError,
-			expectedError: "Failed to add historical entry",
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: "Failed to record delivery",
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			router, mockDB, cfg := setupWebhookTest(t)
-
-			// Create raw JSON with properly formatted RFC3339 timestamps
-			rawJSON := `{
-					"action": "in_progress",
-					"workflow_job": {
-						"id": 123,
-						"labels": ["self-hosted"],
-						"created_at": "2025-03-24T17:25:36Z",
-						"started_at": "2025-03-24T17:30:36Z",
-						"completed_at": "0001-01-01T00:00:00Z"
-					}
-				}`
-
-			// Parse the timestamps for mock setup
-			var event models.WebhookEvent
-			if err := json.Unmarshal([]byte(rawJSON), &event); err != nil {
-				t.Fatal("Failed to parse test JSON:", err)
-			}
-
-			// Setup mocks
+			router, mockDB, _, cfg := setupWebhookTest(t, tc.queueSize)
 			tc.setupMocks(mockDB)
 
-			// Create request with payload parameter
-			payloadBody := []byte("payload=" + rawJSON)
-			req, _ := http.NewRequest("POST", "/webhook", bytes.NewBuffer(payloadBody))
-			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-			req.Header.Set("X-Hub-Signature-256", generateWebhookSignature(payloadBody, cfg.Vars.WebhookSecret))
+			req := newWebhookRequest([]byte(rawJSON), "application/json", tc.event, cfg.Vars.WebhookSecret)
+			req.Header.Set(DeliveryHeader, "guid-1")
 
-			// Perform request
 			w := httptest.NewRecorder()
 			router.ServeHTTP(w, req)
 
-			// Assert response
 			assert.Equal(t, tc.expectedCode, w.Code)
-			assert.Contains(t, w.Body.String(), tc.expectedError)
-
-			// Verify mock expectations
+			assert.Contains(t, w.Body.String(), tc.expectedBody)
 			mockDB.AssertExpectations(t)
 		})
 	}
 }
 
+func TestWebhookHandler_Handle_Backpressure(t *testing.T) {
+	router, _, pipeline, cfg := setupWebhookTest(t, 1)
+
+	body := []byte(workflowJobJSON)
+	rejected := metrics.WebhookDeliveries.WithLabelValues("workflow_job", "in_progress", metrics.OutcomeRejected)
+	before := testutil.ToFloat64(rejected)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newWebhookRequest(body, "application/json", "workflow_job", cfg.Vars.WebhookSecret))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newWebhookRequest(body, "application/json", "workflow_job", cfg.Vars.WebhookSecret))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	stats := pipeline.Stats()
+	assert.Equal(t, 1, stats.QueueDepth)
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Equal(t, before+1, testutil.ToFloat64(rejected))
+}
+
 func TestValidateGitHubWebhook(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -389,11 +688,16 @@ func TestValidateGitHubWebhook(t *testing.T) {
 
 			req, _ := http.NewRequest("POST", "/webhook", nil)
 			tc.setupRequest(req, tc.webhookSecret)
+			unauthorized := metrics.WebhookDeliveries.WithLabelValues("", "", metrics.OutcomeUnauthorized)
+			before := testutil.ToFloat64(unauthorized)
 
 			w := httptest.NewRecorder()
 			router.ServeHTTP(w, req)
 
 			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, before+1, testutil.ToFloat64(unauthorized))
+			}
 			if tc.expectedBody != "" {
 				assert.Contains(t, w.Body.String(), tc.expectedBody)
 			}
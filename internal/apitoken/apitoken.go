@@ -0,0 +1,112 @@
+// Package apitoken issues and checks the bearer tokens of the API.
+//
+// The secret of a token is only shown when the token is created. The storage
+// keeps its SHA-256 hash, which is enough to find the token a request was
+// made with, so a leaked database holds nothing that authenticates. Secrets
+// are random, so a plain hash is as strong as a slow one here.
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// Prefix starts every secret, so leaked tokens are easy to recognize
+const Prefix = "rpulse_"
+
+var (
+	// ErrExpired is returned by Check for a token past its expiry
+	ErrExpired = errors.New("token has expired")
+	// ErrRevoked is returned by Check for a revoked token
+	ErrRevoked = errors.New("token has been revoked")
+	// ErrInsufficientScope is returned by Check for a token that does not grant the required scope
+	ErrInsufficientScope = errors.New("token does not grant the required scope")
+)
+
+// New creates a token for name with the given scope, expiring at expiresAt or never when it
+// is zero. It returns the token to store and its secret.
+func New(name string, scope models.TokenScope, now, expiresAt time.Time) (models.APIToken, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return models.APIToken{}, "", errors.New("name is required")
+	}
+	if _, err := ParseScope(string(scope)); err != nil {
+		return models.APIToken{}, "", err
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		return models.APIToken{}, "", errors.New("expiry must be in the future")
+	}
+
+	id := make([]byte, 8)
+	random := make([]byte, 32)
+	for _, b := range [][]byte{id, random} {
+		if _, err := rand.Read(b); err != nil {
+			return models.APIToken{}, "", fmt.Errorf("failed to generate token: %w", err)
+		}
+	}
+
+	secret := Prefix + base64.RawURLEncoding.EncodeToString(random)
+	token := models.APIToken{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Hash:      Hash(secret),
+		Scope:     scope,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	return token, secret, nil
+}
+
+// Hash returns the hash a token is stored and looked up by
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseScope validates the name of a scope
+func ParseScope(s string) (models.TokenScope, error) {
+	switch scope := models.TokenScope(s); scope {
+	case models.TokenScopeRead, models.TokenScopeAdmin:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown scope %q", s)
+	}
+}
+
+// Grants reports whether a scope includes the required one. The admin scope includes read.
+func Grants(scope, required models.TokenScope) bool {
+	return scope == required || scope == models.TokenScopeAdmin
+}
+
+// Check returns an error when a token cannot be used at now for the required scope
+func Check(token models.APIToken, required models.TokenScope, now time.Time) error {
+	switch {
+	case !token.RevokedAt.IsZero():
+		return ErrRevoked
+	case !token.ExpiresAt.IsZero() && !now.Before(token.ExpiresAt):
+		return ErrExpired
+	case !Grants(token.Scope, required):
+		return ErrInsufficientScope
+	}
+	return nil
+}
+
+// Status describes whether a token can be used at now: active, expired or revoked
+func Status(token models.APIToken, now time.Time) string {
+	switch err := Check(token, token.Scope, now); err {
+	case ErrRevoked:
+		return "revoked"
+	case ErrExpired:
+		return "expired"
+	default:
+		return "active"
+	}
+}
@@ -0,0 +1,77 @@
+package apitoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestNew(t *testing.T) {
+	now := time.Now()
+	token, secret, err := New("grafana", models.TokenScopeRead, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(secret, Prefix) {
+		t.Errorf("Expected the secret to start with %q, got %q", Prefix, secret)
+	}
+	if token.Hash != Hash(secret) || strings.Contains(token.Hash, secret) {
+		t.Errorf("Expected the token to hold the hash of its secret, got %q", token.Hash)
+	}
+	if token.ID == "" || token.Name != "grafana" || !token.CreatedAt.Equal(now) || !token.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected token %+v", token)
+	}
+
+	other, otherSecret, err := New("grafana", models.TokenScopeRead, now, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if other.ID == token.ID || otherSecret == secret {
+		t.Error("Expected every token to get a new ID and secret")
+	}
+
+	for name, args := range map[string]struct {
+		name      string
+		scope     models.TokenScope
+		expiresAt time.Time
+	}{
+		"empty name":    {name: " ", scope: models.TokenScopeRead},
+		"unknown scope": {name: "ci", scope: "write"},
+		"expired":       {name: "ci", scope: models.TokenScopeRead, expiresAt: now},
+	} {
+		if _, _, err := New(args.name, args.scope, now, args.expiresAt); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name     string
+		token    models.APIToken
+		required models.TokenScope
+		expected error
+		status   string
+	}{
+		{name: "read", token: models.APIToken{Scope: models.TokenScopeRead}, required: models.TokenScopeRead, status: "active"},
+		{name: "admin includes read", token: models.APIToken{Scope: models.TokenScopeAdmin}, required: models.TokenScopeRead, status: "active"},
+		{name: "read is not admin", token: models.APIToken{Scope: models.TokenScopeRead}, required: models.TokenScopeAdmin, expected: ErrInsufficientScope, status: "active"},
+		{name: "not expired yet", token: models.APIToken{Scope: models.TokenScopeRead, ExpiresAt: now.Add(time.Second)}, required: models.TokenScopeRead, status: "active"},
+		{name: "expired", token: models.APIToken{Scope: models.TokenScopeRead, ExpiresAt: now}, required: models.TokenScopeRead, expected: ErrExpired, status: "expired"},
+		{name: "revoked", token: models.APIToken{Scope: models.TokenScopeAdmin, ExpiresAt: now, RevokedAt: now}, required: models.TokenScopeRead, expected: ErrRevoked, status: "revoked"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := Check(tc.token, tc.required, now); err != tc.expected {
+				t.Errorf("Check() = %v, want %v", err, tc.expected)
+			}
+			if status := Status(tc.token, now); status != tc.status {
+				t.Errorf("Status() = %q, want %q", status, tc.status)
+			}
+		})
+	}
+}
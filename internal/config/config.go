@@ -2,19 +2,46 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Vars struct {
-	WebhookSecret string
-	Port          string
-	DbHost        string
-	DbPort        string
-	DbUser        string
-	DbPassword    string
-	DbName        string
-	LogLevel      string
+	WebhookSecret  string
+	Port           string
+	StorageBackend string
+	SQLitePath     string
+	DbHost         string
+	DbPort         string
+	DbUser         string
+	DbPassword     string
+	DbName         string
+	DbMaxOpenConns int
+	DbMaxIdleConns int
+	DbQueryTimeout time.Duration
+	LogLevel       string
+
+	RunnerPoolsFile string
+
+	IngestWorkers   int
+	IngestQueueSize int
+	ShutdownTimeout time.Duration
+	SampleInterval  time.Duration
+
+	ReaperInterval         time.Duration
+	ReaperWaitingMaxAge    time.Duration
+	ReaperQueuedMaxAge     time.Duration
+	ReaperInProgressMaxAge time.Duration
+
+	RetentionRaw       time.Duration
+	RetentionJobs      time.Duration
+	RetentionDurations time.Duration
+	RetentionRollup1m  time.Duration
+	RetentionRollup15m time.Duration
+	RetentionRollup1h  time.Duration
 }
 
 type Config struct {
@@ -22,20 +49,53 @@ type Config struct {
 	SimulationCancel context.CancelFunc
 }
 
-// NewAppState creates and initializes a new application state
-func NewConfig() *Config {
+// NewConfig reads the configuration from the environment. Unset variables take their default,
+// and every variable set to an invalid value is reported in the error.
+func NewConfig() (*Config, error) {
+	env := &envReader{}
 	vars := Vars{
 		WebhookSecret: os.Getenv("WEBHOOK_SECRET"),
 		Port:          getEnvOrDefault("PORT", "8080"),
-		DbHost:        getEnvOrDefault("DB_HOST", "localhost"),
-		DbPort:        getEnvOrDefault("DB_PORT", "5432"),
-		DbUser:        getEnvOrDefault("DB_USER", "postgres"),
-		DbPassword:    os.Getenv("DB_PASSWORD"),
-		DbName:        getEnvOrDefault("DB_NAME", "rpulse"),
-		LogLevel:      getEnvOrDefault("LOG_LEVEL", "info"),
+
+		StorageBackend: getEnvOrDefault("STORAGE_BACKEND", "postgres"),
+		SQLitePath:     getEnvOrDefault("SQLITE_PATH", "rpulse.db"),
+
+		DbHost:     getEnvOrDefault("DB_HOST", "localhost"),
+		DbPort:     getEnvOrDefault("DB_PORT", "5432"),
+		DbUser:     getEnvOrDefault("DB_USER", "postgres"),
+		DbPassword: os.Getenv("DB_PASSWORD"),
+		DbName:     getEnvOrDefault("DB_NAME", "rpulse"),
+		LogLevel:   getEnvOrDefault("LOG_LEVEL", "info"),
+
+		DbMaxOpenConns: env.intOrDefault("DB_MAX_OPEN_CONNS", 25),
+		DbMaxIdleConns: env.intOrDefault("DB_MAX_IDLE_CONNS", 5),
+		DbQueryTimeout: env.durationOrDefault("DB_QUERY_TIMEOUT", 10*time.Second),
+
+		RunnerPoolsFile: os.Getenv("RUNNER_POOLS_FILE"),
+
+		IngestWorkers:   env.intOrDefault("INGEST_WORKERS", 4),
+		IngestQueueSize: env.intOrDefault("INGEST_QUEUE_SIZE", 1000),
+		ShutdownTimeout: env.durationOrDefault("SHUTDOWN_TIMEOUT", 30*time.Second),
+		SampleInterval:  env.durationOrDefault("SAMPLE_INTERVAL", 10*time.Second),
+
+		ReaperInterval:         env.durationOrDefault("REAPER_INTERVAL", 5*time.Minute),
+		ReaperWaitingMaxAge:    env.durationOrDefault("REAPER_WAITING_MAX_AGE", 30*24*time.Hour),
+		ReaperQueuedMaxAge:     env.durationOrDefault("REAPER_QUEUED_MAX_AGE", 24*time.Hour),
+		ReaperInProgressMaxAge: env.durationOrDefault("REAPER_IN_PROGRESS_MAX_AGE", 5*24*time.Hour),
+
+		RetentionRaw:       env.durationOrDefault("RETENTION_RAW", 30*24*time.Hour),
+		RetentionJobs:      env.durationOrDefault("RETENTION_JOBS", 30*24*time.Hour),
+		RetentionDurations: env.durationOrDefault("RETENTION_DURATIONS", 30*24*time.Hour),
+		RetentionRollup1m:  env.durationOrDefault("RETENTION_ROLLUP_1M", 90*24*time.Hour),
+		RetentionRollup15m: env.durationOrDefault("RETENTION_ROLLUP_15M", 365*24*time.Hour),
+		RetentionRollup1h:  env.durationOrDefault("RETENTION_ROLLUP_1H", 2*365*24*time.Hour),
 	}
 
-	return &Config{Vars: vars}
+	if err := errors.Join(env.errs...); err != nil {
+		return nil, err
+	}
+
+	return &Config{Vars: vars}, nil
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -45,6 +105,39 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// envReader reads typed environment variables and collects the ones with an invalid value
+type envReader struct {
+	errs []error
+}
+
+// intOrDefault reads a positive integer, falling back to the default when unset
+func (e *envReader) intOrDefault(key string, defaultValue int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a positive integer, got %q", key, raw))
+		return defaultValue
+	}
+	return value
+}
+
+// durationOrDefault reads a positive duration such as "30s", falling back to the default when unset
+func (e *envReader) durationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a positive duration such as 30s or 720h, got %q", key, raw))
+		return defaultValue
+	}
+	return value
+}
+
 func (c *Config) GetDSN() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		c.Vars.DbHost,
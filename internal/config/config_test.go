@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -10,11 +12,20 @@ func TestNewConfig(t *testing.T) {
 	os.Clearenv()
 
 	t.Run("with default values", func(t *testing.T) {
-		config := NewConfig()
+		config, err := NewConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
 
 		if config.Vars.Port != "8080" {
 			t.Errorf("Expected Port to be 8080, got %s", config.Vars.Port)
 		}
+		if config.Vars.StorageBackend != "postgres" {
+			t.Errorf("Expected StorageBackend to be postgres, got %s", config.Vars.StorageBackend)
+		}
+		if config.Vars.SQLitePath != "rpulse.db" {
+			t.Errorf("Expected SQLitePath to be rpulse.db, got %s", config.Vars.SQLitePath)
+		}
 		if config.Vars.DbHost != "localhost" {
 			t.Errorf("Expected DbHost to be localhost, got %s", config.Vars.DbHost)
 		}
@@ -27,23 +38,86 @@ func TestNewConfig(t *testing.T) {
 		if config.Vars.DbName != "rpulse" {
 			t.Errorf("Expected DbName to be rpulse, got %s", config.Vars.DbName)
 		}
+		if config.Vars.DbMaxOpenConns != 25 {
+			t.Errorf("Expected DbMaxOpenConns to be 25, got %d", config.Vars.DbMaxOpenConns)
+		}
+		if config.Vars.DbMaxIdleConns != 5 {
+			t.Errorf("Expected DbMaxIdleConns to be 5, got %d", config.Vars.DbMaxIdleConns)
+		}
+		if config.Vars.DbQueryTimeout != 10*time.Second {
+			t.Errorf("Expected DbQueryTimeout to be 10s, got %s", config.Vars.DbQueryTimeout)
+		}
 		if config.Vars.LogLevel != "info" {
 			t.Errorf("Expected LogLevel to be info, got %s", config.Vars.LogLevel)
 		}
+		if config.Vars.IngestWorkers != 4 {
+			t.Errorf("Expected IngestWorkers to be 4, got %d", config.Vars.IngestWorkers)
+		}
+		if config.Vars.IngestQueueSize != 1000 {
+			t.Errorf("Expected IngestQueueSize to be 1000, got %d", config.Vars.IngestQueueSize)
+		}
+		if config.Vars.ShutdownTimeout != 30*time.Second {
+			t.Errorf("Expected ShutdownTimeout to be 30s, got %s", config.Vars.ShutdownTimeout)
+		}
+		if config.Vars.RunnerPoolsFile != "" {
+			t.Errorf("Expected RunnerPoolsFile to be empty, got %s", config.Vars.RunnerPoolsFile)
+		}
+		if config.Vars.SampleInterval != 10*time.Second {
+			t.Errorf("Expected SampleInterval to be 10s, got %s", config.Vars.SampleInterval)
+		}
+		if config.Vars.ReaperInterval != 5*time.Minute {
+			t.Errorf("Expected ReaperInterval to be 5m, got %s", config.Vars.ReaperInterval)
+		}
+		if config.Vars.ReaperWaitingMaxAge != 30*24*time.Hour {
+			t.Errorf("Expected ReaperWaitingMaxAge to be 720h, got %s", config.Vars.ReaperWaitingMaxAge)
+		}
+		if config.Vars.ReaperQueuedMaxAge != 24*time.Hour {
+			t.Errorf("Expected ReaperQueuedMaxAge to be 24h, got %s", config.Vars.ReaperQueuedMaxAge)
+		}
+		if config.Vars.ReaperInProgressMaxAge != 5*24*time.Hour {
+			t.Errorf("Expected ReaperInProgressMaxAge to be 120h, got %s", config.Vars.ReaperInProgressMaxAge)
+		}
+		if config.Vars.RetentionRaw != 30*24*time.Hour {
+			t.Errorf("Expected RetentionRaw to be 720h, got %s", config.Vars.RetentionRaw)
+		}
+		if config.Vars.RetentionRollup1m != 90*24*time.Hour {
+			t.Errorf("Expected RetentionRollup1m to be 2160h, got %s", config.Vars.RetentionRollup1m)
+		}
+		if config.Vars.RetentionRollup1h != 2*365*24*time.Hour {
+			t.Errorf("Expected RetentionRollup1h to be 17520h, got %s", config.Vars.RetentionRollup1h)
+		}
 	})
 
 	t.Run("with custom environment values", func(t *testing.T) {
 		// Set custom environment variables
 		os.Setenv("WEBHOOK_SECRET", "test-secret")
 		os.Setenv("PORT", "3000")
+		os.Setenv("STORAGE_BACKEND", "sqlite")
+		os.Setenv("SQLITE_PATH", "/var/lib/rpulse/rpulse.db")
 		os.Setenv("DB_HOST", "test-host")
 		os.Setenv("DB_PORT", "5433")
 		os.Setenv("DB_USER", "test-user")
 		os.Setenv("DB_PASSWORD", "test-password")
 		os.Setenv("DB_NAME", "test-db")
+		os.Setenv("DB_MAX_OPEN_CONNS", "50")
+		os.Setenv("DB_MAX_IDLE_CONNS", "10")
+		os.Setenv("DB_QUERY_TIMEOUT", "2s")
 		os.Setenv("LOG_LEVEL", "debug")
+		os.Setenv("INGEST_WORKERS", "8")
+		os.Setenv("INGEST_QUEUE_SIZE", "50")
+		os.Setenv("SHUTDOWN_TIMEOUT", "5s")
+		os.Setenv("RUNNER_POOLS_FILE", "/etc/rpulse/pools.json")
+		os.Setenv("REAPER_INTERVAL", "1m")
+		os.Setenv("SAMPLE_INTERVAL", "30s")
+		os.Setenv("REAPER_QUEUED_MAX_AGE", "2h")
+		os.Setenv("REAPER_IN_PROGRESS_MAX_AGE", "8h")
+		os.Setenv("RETENTION_RAW", "1440h")
+		os.Setenv("RETENTION_JOBS", "2160h")
 
-		config := NewConfig()
+		config, err := NewConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
 
 		if config.Vars.WebhookSecret != "test-secret" {
 			t.Errorf("Expected WebhookSecret to be test-secret, got %s", config.Vars.WebhookSecret)
@@ -51,6 +125,12 @@ func TestNewConfig(t *testing.T) {
 		if config.Vars.Port != "3000" {
 			t.Errorf("Expected Port to be 3000, got %s", config.Vars.Port)
 		}
+		if config.Vars.StorageBackend != "sqlite" {
+			t.Errorf("Expected StorageBackend to be sqlite, got %s", config.Vars.StorageBackend)
+		}
+		if config.Vars.SQLitePath != "/var/lib/rpulse/rpulse.db" {
+			t.Errorf("Expected SQLitePath to be /var/lib/rpulse/rpulse.db, got %s", config.Vars.SQLitePath)
+		}
 		if config.Vars.DbHost != "test-host" {
 			t.Errorf("Expected DbHost to be test-host, got %s", config.Vars.DbHost)
 		}
@@ -66,9 +146,48 @@ func TestNewConfig(t *testing.T) {
 		if config.Vars.DbName != "test-db" {
 			t.Errorf("Expected DbName to be test-db, got %s", config.Vars.DbName)
 		}
+		if config.Vars.DbMaxOpenConns != 50 {
+			t.Errorf("Expected DbMaxOpenConns to be 50, got %d", config.Vars.DbMaxOpenConns)
+		}
+		if config.Vars.DbMaxIdleConns != 10 {
+			t.Errorf("Expected DbMaxIdleConns to be 10, got %d", config.Vars.DbMaxIdleConns)
+		}
+		if config.Vars.DbQueryTimeout != 2*time.Second {
+			t.Errorf("Expected DbQueryTimeout to be 2s, got %s", config.Vars.DbQueryTimeout)
+		}
 		if config.Vars.LogLevel != "debug" {
 			t.Errorf("Expected LogLevel to be debug, got %s", config.Vars.LogLevel)
 		}
+		if config.Vars.IngestWorkers != 8 {
+			t.Errorf("Expected IngestWorkers to be 8, got %d", config.Vars.IngestWorkers)
+		}
+		if config.Vars.IngestQueueSize != 50 {
+			t.Errorf("Expected IngestQueueSize to be 50, got %d", config.Vars.IngestQueueSize)
+		}
+		if config.Vars.ShutdownTimeout != 5*time.Second {
+			t.Errorf("Expected ShutdownTimeout to be 5s, got %s", config.Vars.ShutdownTimeout)
+		}
+		if config.Vars.RunnerPoolsFile != "/etc/rpulse/pools.json" {
+			t.Errorf("Expected RunnerPoolsFile to be /etc/rpulse/pools.json, got %s", config.Vars.RunnerPoolsFile)
+		}
+		if config.Vars.SampleInterval != 30*time.Second {
+			t.Errorf("Expected SampleInterval to be 30s, got %s", config.Vars.SampleInterval)
+		}
+		if config.Vars.ReaperInterval != time.Minute {
+			t.Errorf("Expected ReaperInterval to be 1m, got %s", config.Vars.ReaperInterval)
+		}
+		if config.Vars.ReaperQueuedMaxAge != 2*time.Hour {
+			t.Errorf("Expected ReaperQueuedMaxAge to be 2h, got %s", config.Vars.ReaperQueuedMaxAge)
+		}
+		if config.Vars.ReaperInProgressMaxAge != 8*time.Hour {
+			t.Errorf("Expected ReaperInProgressMaxAge to be 8h, got %s", config.Vars.ReaperInProgressMaxAge)
+		}
+		if config.Vars.RetentionRaw != 60*24*time.Hour {
+			t.Errorf("Expected RetentionRaw to be 1440h, got %s", config.Vars.RetentionRaw)
+		}
+		if config.Vars.RetentionJobs != 90*24*time.Hour {
+			t.Errorf("Expected RetentionJobs to be 2160h, got %s", config.Vars.RetentionJobs)
+		}
 	})
 }
 
@@ -76,7 +195,10 @@ func TestGetDSN(t *testing.T) {
 	os.Clearenv()
 
 	t.Run("with default values", func(t *testing.T) {
-		config := NewConfig()
+		config, err := NewConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
 		expected := "host=localhost port=5432 user=postgres password= dbname=rpulse sslmode=disable"
 		if dsn := config.GetDSN(); dsn != expected {
 			t.Errorf("Expected DSN %s, got %s", expected, dsn)
@@ -90,7 +212,10 @@ func TestGetDSN(t *testing.T) {
 		os.Setenv("DB_PASSWORD", "test-password")
 		os.Setenv("DB_NAME", "test-db")
 
-		config := NewConfig()
+		config, err := NewConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
 		expected := "host=test-host port=5433 user=test-user password=test-password dbname=test-db sslmode=disable"
 		if dsn := config.GetDSN(); dsn != expected {
 			t.Errorf("Expected DSN %s, got %s", expected, dsn)
@@ -149,3 +274,44 @@ func TestGetEnvOrDefault(t *testing.T) {
 		})
 	}
 }
+
+func TestNewConfig_Invalid(t *testing.T) {
+	os.Clearenv()
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{name: "duration in years", key: "RETENTION_RAW", value: "1y"},
+		{name: "negative duration", key: "SAMPLE_INTERVAL", value: "-10s"},
+		{name: "not a number", key: "INGEST_WORKERS", value: "many"},
+		{name: "not positive", key: "DB_MAX_OPEN_CONNS", value: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(tt.key, tt.value)
+			defer os.Unsetenv(tt.key)
+
+			_, err := NewConfig()
+			if err == nil {
+				t.Fatalf("Expected an error for %s=%s", tt.key, tt.value)
+			}
+			if !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("Expected the error to name %s, got %v", tt.key, err)
+			}
+		})
+	}
+
+	t.Run("every invalid variable is reported", func(t *testing.T) {
+		os.Setenv("RETENTION_RAW", "1y")
+		os.Setenv("RETENTION_JOBS", "forever")
+		defer os.Clearenv()
+
+		_, err := NewConfig()
+		if err == nil || !strings.Contains(err.Error(), "RETENTION_RAW") || !strings.Contains(err.Error(), "RETENTION_JOBS") {
+			t.Errorf("Expected both variables to be reported, got %v", err)
+		}
+	})
+}
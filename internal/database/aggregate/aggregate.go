@@ -0,0 +1,483 @@
+// Package aggregate computes the analytics the PostgreSQL backend leaves to TimescaleDB,
+// such as time buckets, peaks and percentiles, for the storage backends that keep their
+// data in Go or in a plain SQL database.
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/jobstate"
+	"github.com/gateixeira/rpulse/models"
+)
+
+// periodSteps are the bucket widths of the periods longer than an hour. The last hour is
+// returned as raw entries.
+var periodSteps = map[string]time.Duration{
+	"day":   3 * time.Minute,
+	"week":  30 * time.Minute,
+	"month": 2 * time.Hour,
+}
+
+// Sample is a runner demand sample with its parsed timestamp
+type Sample struct {
+	Time  time.Time
+	Entry models.HistoricalEntry
+}
+
+// PoolSample is a runner pool demand sample with its parsed timestamp
+type PoolSample struct {
+	Time  time.Time
+	Entry models.PoolHistoricalEntry
+}
+
+// DurationRecord is a recorded queue or approval wait duration of a job
+type DurationRecord struct {
+	JobID        int64
+	JobCreatedAt time.Time
+	Pool         string
+	Duration     time.Duration
+	RecordedAt   time.Time
+}
+
+// PeriodStart returns when a period ending at now begins
+func PeriodStart(period string, now time.Time) (time.Time, error) {
+	switch period {
+	case "hour":
+		return now.Add(-time.Hour), nil
+	case "day":
+		return now.AddDate(0, 0, -1), nil
+	case "week":
+		return now.AddDate(0, 0, -7), nil
+	case "month":
+		return now.AddDate(0, -1, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid period %q", period)
+}
+
+// PeriodRange returns the time range and bucket width of a period longer than an hour
+func PeriodRange(period string, now time.Time) (models.TimeRange, error) {
+	step, ok := periodSteps[period]
+	if !ok {
+		return models.TimeRange{}, fmt.Errorf("invalid period %q", period)
+	}
+
+	from, err := PeriodStart(period, now)
+	if err != nil {
+		return models.TimeRange{}, err
+	}
+
+	return models.TimeRange{From: from, To: now, Step: step}, nil
+}
+
+// History averages the samples of a time range in buckets of its step, keeping the highest peak of each
+func History(samples []Sample, r models.TimeRange) []models.HistoricalEntry {
+	type bucket struct {
+		count                            int
+		selfHosted, githubHosted, queued int
+		peak                             int
+	}
+
+	buckets := make(map[time.Time]*bucket)
+	for _, sample := range samples {
+		if sample.Time.Before(r.From) || !sample.Time.Before(r.To) {
+			continue
+		}
+		start := sample.Time.Truncate(r.Step)
+		b, ok := buckets[start]
+		if !ok {
+			b = &bucket{}
+			buckets[start] = b
+		}
+		b.count++
+		b.selfHosted += sample.Entry.CountSelfHosted
+		b.githubHosted += sample.Entry.CountGitHubHosted
+		b.queued += sample.Entry.CountQueued
+		b.peak = max(b.peak, sample.Entry.PeakTotal)
+	}
+
+	entries := []models.HistoricalEntry{}
+	for _, start := range sortedKeys(buckets) {
+		b := buckets[start]
+		entries = append(entries, models.HistoricalEntry{
+			Timestamp:         Timestamp(start),
+			CountSelfHosted:   average(b.selfHosted, b.count),
+			CountGitHubHosted: average(b.githubHosted, b.count),
+			CountQueued:       average(b.queued, b.count),
+			PeakTotal:         b.peak,
+		})
+	}
+	return entries
+}
+
+// PoolHistory averages the samples of a runner pool in a time range in buckets of its step,
+// keeping the highest peak of each
+func PoolHistory(samples []PoolSample, pool string, r models.TimeRange) []models.PoolHistoricalEntry {
+	type bucket struct {
+		count           int
+		running, queued int
+		peak            int
+	}
+
+	buckets := make(map[time.Time]*bucket)
+	for _, sample := range samples {
+		if sample.Entry.Pool != pool || sample.Time.Before(r.From) || !sample.Time.Before(r.To) {
+			continue
+		}
+		start := sample.Time.Truncate(r.Step)
+		b, ok := buckets[start]
+		if !ok {
+			b = &bucket{}
+			buckets[start] = b
+		}
+		b.count++
+		b.running += sample.Entry.CountRunning
+		b.queued += sample.Entry.CountQueued
+		b.peak = max(b.peak, sample.Entry.PeakTotal)
+	}
+
+	entries := []models.PoolHistoricalEntry{}
+	for _, start := range sortedKeys(buckets) {
+		b := buckets[start]
+		entries = append(entries, models.PoolHistoricalEntry{
+			Timestamp:    Timestamp(start),
+			Pool:         pool,
+			CountRunning: average(b.running, b.count),
+			CountQueued:  average(b.queued, b.count),
+			PeakTotal:    b.peak,
+		})
+	}
+	return entries
+}
+
+// Peak returns the highest peak of the samples since a time and when it was sampled.
+// Without samples the peak is zero and the timestamp empty.
+func Peak(samples []Sample, since time.Time) (int, string) {
+	var peak int
+	var at time.Time
+	for _, sample := range samples {
+		if !sample.Time.Before(since) && (at.IsZero() || sample.Entry.PeakTotal > peak) {
+			peak, at = sample.Entry.PeakTotal, sample.Time
+		}
+	}
+
+	if at.IsZero() {
+		return 0, ""
+	}
+	return peak, Timestamp(at)
+}
+
+// PoolPeak returns the highest peak of a runner pool since a time and when it was sampled
+func PoolPeak(samples []PoolSample, pool string, since time.Time) (int, string) {
+	var peak int
+	var at time.Time
+	for _, sample := range samples {
+		if sample.Entry.Pool == pool && !sample.Time.Before(since) && (at.IsZero() || sample.Entry.PeakTotal > peak) {
+			peak, at = sample.Entry.PeakTotal, sample.Time
+		}
+	}
+
+	if at.IsZero() {
+		return 0, ""
+	}
+	return peak, Timestamp(at)
+}
+
+// Timestamp formats the time of a sample or bucket as it is returned by the API
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// QueueTimeMatches reports whether a queue time recorded at recordedAt for a job of a pool
+// matches the filter. job is the zero job when the job is no longer stored.
+func QueueTimeMatches(filter models.QueueTimeFilter, since time.Time, recordedAt time.Time, pool string, job models.WorkflowJob) bool {
+	if filter.Period != "" && recordedAt.Before(since) {
+		return false
+	}
+	if filter.Pool != "" && pool != filter.Pool {
+		return false
+	}
+	if filter.Repository != "" && job.Repository.FullName != filter.Repository {
+		return false
+	}
+	return hasLabels(job, filter.Labels)
+}
+
+// QueueTimeStats returns the count, average, percentiles and maximum of durations
+func QueueTimeStats(durations []time.Duration) models.QueueTimeStats {
+	if len(durations) == 0 {
+		return models.QueueTimeStats{}
+	}
+
+	ms := sortedMilliseconds(durations)
+	var sum float64
+	for _, d := range ms {
+		sum += d
+	}
+
+	return models.QueueTimeStats{
+		Count: int64(len(ms)),
+		AvgMs: int64(sum / float64(len(ms))),
+		P50Ms: int64(Percentile(ms, 0.5)),
+		P90Ms: int64(Percentile(ms, 0.9)),
+		P95Ms: int64(Percentile(ms, 0.95)),
+		P99Ms: int64(Percentile(ms, 0.99)),
+		MaxMs: int64(ms[len(ms)-1]),
+	}
+}
+
+// Histogram counts durations in buckets split at the given ascending bounds. It returns one
+// bucket more than there are bounds, including empty buckets.
+func Histogram(durations []time.Duration, bounds []time.Duration) []models.HistogramBucket {
+	boundsMs := make([]int64, len(bounds))
+	for i, bound := range bounds {
+		boundsMs[i] = bound.Milliseconds()
+	}
+
+	buckets := make([]models.HistogramBucket, len(boundsMs)+1)
+	for i := range buckets {
+		if i > 0 {
+			buckets[i].MinMs = boundsMs[i-1]
+		}
+		if i < len(boundsMs) {
+			buckets[i].MaxMs = boundsMs[i]
+		}
+	}
+
+	for _, d := range durations {
+		ms := d.Milliseconds()
+		// The first bound above the duration, as counted by width_bucket
+		i := sort.Search(len(boundsMs), func(i int) bool { return boundsMs[i] > ms })
+		buckets[i].Count++
+	}
+
+	return buckets
+}
+
+// Percentile interpolates the p-th percentile of ascending values like percentile_cont
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// CompletedJob returns how long a completed job ran, and false when the job is not completed
+// or lacks its start or completion time
+func CompletedJob(job models.WorkflowJob) (models.JobDuration, bool) {
+	if job.Status != models.JobStatusCompleted || job.StartedAt.IsZero() || job.CompletedAt.IsZero() {
+		return models.JobDuration{}, false
+	}
+
+	return models.JobDuration{
+		ID:          job.ID,
+		RunID:       job.RunID,
+		Repository:  job.Repository.FullName,
+		Workflow:    job.WorkflowName,
+		Job:         job.Name,
+		Pool:        job.RunnerPool,
+		Conclusion:  job.Conclusion,
+		StartedAt:   job.StartedAt,
+		CompletedAt: job.CompletedAt,
+		DurationMs:  job.CompletedAt.Sub(job.StartedAt).Milliseconds(),
+	}, true
+}
+
+// JobDurationMatches reports whether a completed job matches the filter
+func JobDurationMatches(filter models.JobDurationFilter, since time.Time, job models.JobDuration) bool {
+	return (filter.Period == "" || !job.CompletedAt.Before(since)) &&
+		(filter.Pool == "" || job.Pool == filter.Pool) &&
+		(filter.Repository == "" || job.Repository == filter.Repository) &&
+		(filter.Workflow == "" || job.Workflow == filter.Workflow) &&
+		(filter.Job == "" || job.Job == filter.Job)
+}
+
+// JobDurationStats groups completed jobs by pool, repository, workflow or job and returns the
+// run duration aggregates of the limit groups that used the most runner minutes
+func JobDurationStats(jobs []models.JobDuration, groupBy string, limit int) ([]models.JobDurationStats, error) {
+	var key func(models.JobDuration) models.JobDurationStats
+	switch groupBy {
+	case "pool":
+		key = func(j models.JobDuration) models.JobDurationStats { return models.JobDurationStats{Pool: j.Pool} }
+	case "repository":
+		key = func(j models.JobDuration) models.JobDurationStats {
+			return models.JobDurationStats{Repository: j.Repository}
+		}
+	case "workflow":
+		// Workflow and job names are only unique within a repository
+		key = func(j models.JobDuration) models.JobDurationStats {
+			return models.JobDurationStats{Repository: j.Repository, Workflow: j.Workflow}
+		}
+	case "job":
+		key = func(j models.JobDuration) models.JobDurationStats {
+			return models.JobDurationStats{Repository: j.Repository, Workflow: j.Workflow, Job: j.Job}
+		}
+	default:
+		return nil, fmt.Errorf("invalid grouping %q", groupBy)
+	}
+
+	groups := make(map[models.JobDurationStats][]time.Duration)
+	for _, job := range jobs {
+		k := key(job)
+		groups[k] = append(groups[k], time.Duration(job.DurationMs)*time.Millisecond)
+	}
+
+	stats := make([]models.JobDurationStats, 0, len(groups))
+	for group, durations := range groups {
+		ms := sortedMilliseconds(durations)
+		var sum float64
+		for _, d := range ms {
+			sum += d
+		}
+
+		group.Count = int64(len(ms))
+		group.AvgMs = int64(sum / float64(len(ms)))
+		group.P50Ms = int64(Percentile(ms, 0.5))
+		group.P95Ms = int64(Percentile(ms, 0.95))
+		group.RunnerMinutes = sum / 60000
+		stats = append(stats, group)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].RunnerMinutes > stats[j].RunnerMinutes })
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// LongestJobs returns the limit completed jobs that ran the longest
+func LongestJobs(jobs []models.JobDuration, limit int) []models.JobDuration {
+	longest := append([]models.JobDuration{}, jobs...)
+	sort.SliceStable(longest, func(i, j int) bool { return longest[i].DurationMs > longest[j].DurationMs })
+	if len(longest) > limit {
+		longest = longest[:limit]
+	}
+	return longest
+}
+
+// JobMatches reports whether a job matches the filter, ignoring its cursor
+func JobMatches(filter models.JobFilter, job models.WorkflowJob) bool {
+	if (filter.Status != "" && job.Status != filter.Status) ||
+		(filter.Pool != "" && job.RunnerPool != filter.Pool) ||
+		(filter.Repository != "" && job.Repository.FullName != filter.Repository) ||
+		(filter.Workflow != "" && job.WorkflowName != filter.Workflow) {
+		return false
+	}
+
+	if !inRange(job.CreatedAt, filter.CreatedFrom, filter.CreatedTo) ||
+		!inRange(job.StartedAt, filter.StartedFrom, filter.StartedTo) ||
+		!inRange(job.CompletedAt, filter.CompletedFrom, filter.CompletedTo) {
+		return false
+	}
+
+	if _, ok := jobstate.SortKey(job, filter.Sort); !ok {
+		return false
+	}
+	if filter.MinQueueTime > 0 {
+		if queueTime, ok := jobstate.SortKey(job, models.JobSortQueueTime); !ok || queueTime < filter.MinQueueTime.Milliseconds() {
+			return false
+		}
+	}
+	if filter.MinDuration > 0 {
+		if duration, ok := jobstate.SortKey(job, models.JobSortDuration); !ok || duration < filter.MinDuration.Milliseconds() {
+			return false
+		}
+	}
+
+	return hasLabels(job, filter.Labels)
+}
+
+// ListJobs returns a page of the jobs matching the filter: the first filter.Limit jobs after
+// its cursor, in the order of filter.Sort. Jobs with the same sort key are ordered by ID.
+func ListJobs(jobs []models.WorkflowJob, filter models.JobFilter) []models.WorkflowJob {
+	type keyed struct {
+		key int64
+		job models.WorkflowJob
+	}
+
+	var matching []keyed
+	for _, job := range jobs {
+		if !JobMatches(filter, job) {
+			continue
+		}
+		key, _ := jobstate.SortKey(job, filter.Sort)
+		if filter.After != nil && !listedAfter(key, job.ID, *filter.After) {
+			continue
+		}
+		matching = append(matching, keyed{key: key, job: job})
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return listedAfter(matching[j].key, matching[j].job.ID, models.JobCursor{Value: matching[i].key, ID: matching[i].job.ID})
+	})
+	if filter.Limit > 0 && len(matching) > filter.Limit {
+		matching = matching[:filter.Limit]
+	}
+
+	page := make([]models.WorkflowJob, len(matching))
+	for i, m := range matching {
+		page[i] = m.job
+	}
+	return page
+}
+
+// listedAfter reports whether the job with the given sort key and ID is listed after the cursor,
+// with larger keys first and IDs breaking ties
+func listedAfter(key, id int64, cursor models.JobCursor) bool {
+	return key < cursor.Value || (key == cursor.Value && id < cursor.ID)
+}
+
+// hasLabels reports whether a job requested every wanted label, ignoring case
+func hasLabels(job models.WorkflowJob, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, label := range job.Labels {
+			if strings.EqualFold(label, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// inRange reports whether t is within [from, to). Zero bounds are open, but a zero t is
+// never within a range with a bound.
+func inRange(t, from, to time.Time) bool {
+	if from.IsZero() && to.IsZero() {
+		return true
+	}
+	return !t.IsZero() && !t.Before(from) && (to.IsZero() || t.Before(to))
+}
+
+func average(sum, count int) int {
+	return int(math.Round(float64(sum) / float64(count)))
+}
+
+func sortedMilliseconds(durations []time.Duration) []float64 {
+	ms := make([]float64, len(durations))
+	for i, d := range durations {
+		ms[i] = float64(d.Milliseconds())
+	}
+	sort.Float64s(ms)
+	return ms
+}
+
+func sortedKeys[V any](buckets map[time.Time]V) []time.Time {
+	keys := make([]time.Time, 0, len(buckets))
+	for k := range buckets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Before(keys[j]) })
+	return keys
+}
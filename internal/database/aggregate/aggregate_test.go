@@ -0,0 +1,138 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestPeriodRange(t *testing.T) {
+	now := time.Date(2025, 3, 24, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		period string
+		from   time.Time
+		step   time.Duration
+	}{
+		{period: "day", from: now.AddDate(0, 0, -1), step: 3 * time.Minute},
+		{period: "week", from: now.AddDate(0, 0, -7), step: 30 * time.Minute},
+		{period: "month", from: now.AddDate(0, -1, 0), step: 2 * time.Hour},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.period, func(t *testing.T) {
+			r, err := PeriodRange(tc.period, now)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !r.From.Equal(tc.from) || !r.To.Equal(now) || r.Step != tc.step {
+				t.Errorf("Expected %s to %s by %s, got %+v", tc.from, now, tc.step, r)
+			}
+		})
+	}
+
+	if _, err := PeriodRange("hour", now); err == nil {
+		t.Error("Expected an error for a period without buckets")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	from := time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)
+	samples := []Sample{
+		{Time: from.Add(-time.Minute), Entry: models.HistoricalEntry{CountSelfHosted: 100, PeakTotal: 100}},
+		{Time: from.Add(10 * time.Minute), Entry: models.HistoricalEntry{CountSelfHosted: 1, CountGitHubHosted: 2, CountQueued: 1, PeakTotal: 4}},
+		{Time: from.Add(20 * time.Minute), Entry: models.HistoricalEntry{CountSelfHosted: 2, CountGitHubHosted: 2, CountQueued: 0, PeakTotal: 6}},
+		{Time: from.Add(70 * time.Minute), Entry: models.HistoricalEntry{CountSelfHosted: 5, PeakTotal: 5}},
+		{Time: from.Add(2 * time.Hour), Entry: models.HistoricalEntry{CountSelfHosted: 100, PeakTotal: 100}},
+	}
+
+	entries := History(samples, models.TimeRange{From: from, To: from.Add(2 * time.Hour), Step: time.Hour})
+
+	expected := []models.HistoricalEntry{
+		{Timestamp: "2025-03-24T00:00:00Z", CountSelfHosted: 2, CountGitHubHosted: 2, CountQueued: 1, PeakTotal: 6},
+		{Timestamp: "2025-03-24T01:00:00Z", CountSelfHosted: 5, PeakTotal: 5},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %+v", len(expected), entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Expected entry %d to be %+v, got %+v", i, expected[i], entries[i])
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{10, 20, 30, 40}
+
+	testCases := []struct {
+		p        float64
+		expected float64
+	}{
+		{p: 0, expected: 10},
+		{p: 0.5, expected: 25},
+		{p: 0.9, expected: 37},
+		{p: 1, expected: 40},
+	}
+
+	for _, tc := range testCases {
+		if got := Percentile(values, tc.p); got != tc.expected {
+			t.Errorf("Expected percentile %v to be %v, got %v", tc.p, tc.expected, got)
+		}
+	}
+
+	if got := Percentile(nil, 0.5); got != 0 {
+		t.Errorf("Expected 0 without values, got %v", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	durations := []time.Duration{0, 29 * time.Second, 30 * time.Second, 59 * time.Second, 5 * time.Minute}
+
+	buckets := Histogram(durations, []time.Duration{30 * time.Second, time.Minute})
+
+	expected := []models.HistogramBucket{
+		{MinMs: 0, MaxMs: 30000, Count: 2},
+		{MinMs: 30000, MaxMs: 60000, Count: 2},
+		{MinMs: 60000, MaxMs: 0, Count: 1},
+	}
+	if len(buckets) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %+v", len(expected), buckets)
+	}
+	for i := range expected {
+		if buckets[i] != expected[i] {
+			t.Errorf("Expected bucket %d to be %+v, got %+v", i, expected[i], buckets[i])
+		}
+	}
+}
+
+func TestJobDurationStats(t *testing.T) {
+	jobs := []models.JobDuration{
+		{Repository: "octo/app", Workflow: "CI", Job: "build", DurationMs: 60000},
+		{Repository: "octo/app", Workflow: "CI", Job: "test", DurationMs: 180000},
+		{Repository: "octo/lib", Workflow: "CI", Job: "build", DurationMs: 600000},
+	}
+
+	stats, err := JobDurationStats(jobs, "workflow", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 workflows, got %+v", stats)
+	}
+	if stats[0].Repository != "octo/lib" || stats[0].RunnerMinutes != 10 {
+		t.Errorf("Expected octo/lib first with 10 runner minutes, got %+v", stats[0])
+	}
+	if stats[1].Count != 2 || stats[1].AvgMs != 120000 || stats[1].RunnerMinutes != 4 {
+		t.Errorf("Expected octo/app with 2 jobs averaging 2m, got %+v", stats[1])
+	}
+
+	if stats, _ := JobDurationStats(jobs, "job", 1); len(stats) != 1 {
+		t.Errorf("Expected the limit to apply, got %+v", stats)
+	}
+
+	if _, err := JobDurationStats(jobs, "branch", 10); err == nil {
+		t.Error("Expected an error for an invalid grouping")
+	}
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// apiTokenColumns lists the api_tokens columns in the order of scanAPIToken
+const apiTokenColumns = "id, name, token_hash, scope, created_at, expires_at, revoked_at"
+
+// CreateAPIToken stores a new API token
+func (db *DBWrapper) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx,
+		"INSERT INTO api_tokens ("+apiTokenColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		token.ID, token.Name, token.Hash, token.Scope, token.CreatedAt, nullTime(token.ExpiresAt), nullTime(token.RevokedAt),
+	)
+	return err
+}
+
+// GetAPIToken returns the API token with the given secret hash and reports whether it exists
+func (db *DBWrapper) GetAPIToken(ctx context.Context, hash string) (models.APIToken, bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	token, err := scanAPIToken(db.pool.QueryRowContext(ctx,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = $1", hash,
+	))
+	if err == sql.ErrNoRows {
+		return models.APIToken{}, false, nil
+	}
+	if err != nil {
+		return models.APIToken{}, false, err
+	}
+
+	return token, true, nil
+}
+
+// ListAPITokens returns every API token, revoked and expired ones included, oldest first
+func (db *DBWrapper) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes an API token and reports whether it exists. Revoking a token again
+// keeps the time it was first revoked.
+func (db *DBWrapper) RevokeAPIToken(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx,
+		"UPDATE api_tokens SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1",
+		id, revokedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// scanAPIToken reads a token selected with apiTokenColumns
+func scanAPIToken(row rowScanner) (models.APIToken, error) {
+	var token models.APIToken
+	var expiresAt, revokedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.Name, &token.Hash, &token.Scope, &token.CreatedAt, &expiresAt, &revokedAt); err != nil {
+		return models.APIToken{}, err
+	}
+	token.ExpiresAt = expiresAt.Time
+	token.RevokedAt = revokedAt.Time
+	return token, nil
+}
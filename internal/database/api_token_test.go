@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestGetAPIToken(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+	createdAt := time.Now()
+	columns := []string{"id", "name", "token_hash", "scope", "created_at", "expires_at", "revoked_at"}
+
+	mock.ExpectQuery("SELECT (.+) FROM api_tokens WHERE token_hash = \\$1").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("a1", "grafana", "hash", "read", createdAt, nil, createdAt))
+
+	token, found, err := dbWrapper.GetAPIToken(ctx, "hash")
+	if err != nil || !found {
+		t.Fatalf("Expected the token to be found, got %v (%v)", found, err)
+	}
+	if token.ID != "a1" || token.Scope != models.TokenScopeRead || !token.ExpiresAt.IsZero() || !token.RevokedAt.Equal(createdAt) {
+		t.Errorf("Unexpected token %+v", token)
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM api_tokens WHERE token_hash = \\$1").
+		WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	if _, found, err := dbWrapper.GetAPIToken(ctx, "unknown"); err != nil || found {
+		t.Errorf("Expected an unknown token not to be found, got %v (%v)", found, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRevokeAPIToken(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+	revokedAt := time.Now()
+
+	testCases := []struct {
+		name     string
+		affected int64
+		expected bool
+	}{
+		{name: "existing token", affected: 1, expected: true},
+		{name: "unknown token", affected: 0, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock.ExpectExec("UPDATE api_tokens SET revoked_at = COALESCE\\(revoked_at, \\$2\\) WHERE id = \\$1").
+				WithArgs("a1", revokedAt).
+				WillReturnResult(sqlmock.NewResult(0, tc.affected))
+
+			found, err := dbWrapper.RevokeAPIToken(ctx, "a1", revokedAt)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if found != tc.expected {
+				t.Errorf("RevokeAPIToken() = %v, want %v", found, tc.expected)
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,52 @@
+package database_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/database/storetest"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap/zaptest"
+)
+
+// conformanceTables are emptied before every test, rollups included, since their buckets
+// are not invalidated when the tables they are built from are emptied
+var conformanceTables = []string{
+	"workflow_jobs", "workflow_job_events", "workflow_runs", "webhook_deliveries", "reaped_jobs", "api_tokens",
+	"historical_entries", "pool_historical_entries",
+	"queue_time_durations", "approval_wait_durations",
+	"runner_stats_1m", "runner_stats_15m", "runner_stats_1h",
+	"pool_stats_1m", "pool_stats_15m", "pool_stats_1h",
+}
+
+// TestConformance runs the conformance suite against the TimescaleDB database at
+// TEST_DATABASE_DSN, and is skipped when it is not set
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	logger.Logger = zaptest.NewLogger(t)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Error running migrations: %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) database.DatabaseInterface {
+		for _, table := range conformanceTables {
+			if _, err := db.Exec("TRUNCATE " + table); err != nil {
+				t.Fatalf("Error emptying %s: %v", table, err)
+			}
+		}
+		return database.NewDBWrapper(db, 10*time.Second)
+	})
+}
@@ -1,87 +1,76 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
-	"path/filepath"
+	"time"
 
 	"github.com/gateixeira/rpulse/pkg/logger"
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
-var DB *sql.DB
+// Options configure the PostgreSQL connection pool
+type Options struct {
+	MaxOpenConns int
+	MaxIdleConns int
+	// QueryTimeout bounds every operation; zero leaves them bounded by their context only
+	QueryTimeout time.Duration
+}
 
-// InitDB initializes the PostgreSQL database connection and runs migrations
-func InitDB(dsn string) error {
-	var err error
-	DB, err = sql.Open("postgres", dsn)
+// Connect opens a PostgreSQL connection pool and checks that the database is reachable
+func Connect(ctx context.Context, dsn string, opts Options) (*sql.DB, error) {
+	pool, err := sql.Open("postgres", dsn)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err = DB.Ping(); err != nil {
-		return err
+	pool.SetMaxOpenConns(opts.MaxOpenConns)
+	pool.SetMaxIdleConns(opts.MaxIdleConns)
+
+	if err = pool.PingContext(ctx); err != nil {
+		_ = pool.Close()
+		return nil, err
 	}
 
-	// Set connection pool parameters
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(5)
+	return pool, nil
+}
 
-	migrationsPath := filepath.Join(".", "migrations")
+// Open connects to PostgreSQL, runs the migrations and returns the database
+func Open(ctx context.Context, dsn string, opts Options) (*DBWrapper, error) {
+	pool, err := Connect(ctx, dsn, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	if err = RunMigrations(DB, migrationsPath); err != nil {
+	if err = RunMigrations(pool); err != nil {
 		logger.Logger.Error("Failed to run database migrations", zap.Error(err))
-		return err
+		_ = pool.Close()
+		return nil, err
 	}
 
 	logger.Logger.Info("Database initialized successfully")
-	return nil
+	return NewDBWrapper(pool, opts.QueryTimeout), nil
 }
 
-// CloseDB closes the database connection
-func CloseDB() error {
-	if DB != nil {
-		return DB.Close()
-	}
-	return nil
-}
-
-// RunMigrations performs all necessary database migrations
-func RunMigrations(db *sql.DB, migrationsPath string) error {
+// RunMigrations applies the embedded migrations that have not been applied yet
+func RunMigrations(db *sql.DB) error {
 	logger.Logger.Info("Running database migrations...")
 
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
-	if err != nil {
-		return fmt.Errorf("could not create database driver: %v", err)
-	}
-
-	absPath, err := filepath.Abs(migrationsPath)
-	if err != nil {
-		return fmt.Errorf("could not get absolute path: %v", err)
-	}
-
-	m, err := migrate.NewWithDatabaseInstance(
-		fmt.Sprintf("file://%s", absPath),
-		"postgres",
-		driver,
-	)
+	m, err := NewMigrator(db)
 	if err != nil {
 		logger.Logger.Error("could not create migration instance", zap.Error(err))
 		return err
 	}
+	defer m.Close()
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+	if err := m.Up(); err != nil {
 		logger.Logger.Error("could not run migrations", zap.Error(err))
 		return err
 	}
 
 	version, dirty, err := m.Version()
-	if err != nil && err != migrate.ErrNilVersion {
+	if err != nil {
 		logger.Logger.Error("could not get migration version", zap.Error(err))
 		return err
 	}
@@ -92,3 +81,23 @@ func RunMigrations(db *sql.DB, migrationsPath string) error {
 
 	return nil
 }
+
+// nullString maps an empty string to SQL NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt64 maps zero to SQL NULL
+func nullInt64(i int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: i, Valid: i != 0}
+}
+
+// nullTime maps the zero time to SQL NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// nullDurationMs maps a duration to milliseconds, with zero mapped to SQL NULL
+func nullDurationMs(d time.Duration) sql.NullInt64 {
+	return sql.NullInt64{Int64: d.Milliseconds(), Valid: d != 0}
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// DeliveryClaimTimeout is how long a claimed delivery is considered in flight. A redelivery
+// received later than that reclaims it, so a delivery whose processing never finished, for
+// example because the server stopped, is not lost.
+const DeliveryClaimTimeout = 10 * time.Minute
+
+// RecordDelivery logs a webhook delivery by its GUID with its payload and reports whether the
+// caller claimed it for processing. The first delivery is claimed when it is inserted. A
+// redelivery only claims it when it is not processed and not claimed by another caller within
+// DeliveryClaimTimeout, otherwise it only bumps the attempt counter. The claim is taken in the
+// same statement, so concurrent copies of a delivery are processed once.
+func (db *DBWrapper) RecordDelivery(ctx context.Context, deliveryID, event string, payload []byte, receivedAt time.Time) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := db.pool.QueryRowContext(ctx,
+		`INSERT INTO webhook_deliveries (delivery_id, event, received_at, last_received_at, payload, claimed_at)
+		VALUES ($1, $2, $3, $3, $4, $3)
+		ON CONFLICT (delivery_id) DO UPDATE SET
+			attempts = webhook_deliveries.attempts + 1,
+			last_received_at = EXCLUDED.last_received_at,
+			payload = COALESCE(webhook_deliveries.payload, EXCLUDED.payload),
+			claimed_at = EXCLUDED.claimed_at
+		WHERE NOT webhook_deliveries.processed
+			AND (webhook_deliveries.claimed_at IS NULL OR webhook_deliveries.claimed_at < $5)
+		RETURNING delivery_id`,
+		deliveryID, event, receivedAt, payload, receivedAt.Add(-DeliveryClaimTimeout),
+	).Scan(&deliveryID)
+	if err == nil {
+		return true, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	// The delivery is processed or in flight, the redelivery is only counted
+	_, err = db.pool.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET
+			attempts = attempts + 1,
+			last_received_at = $2,
+			payload = COALESCE(payload, $3)
+		WHERE delivery_id = $1`,
+		deliveryID, receivedAt, payload,
+	)
+	return false, err
+}
+
+// ReleaseDelivery gives up the claim on a delivery that could not be processed, so a redelivery
+// processes it again
+func (db *DBWrapper) ReleaseDelivery(ctx context.Context, deliveryID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET claimed_at = NULL WHERE delivery_id = $1 AND NOT processed",
+		deliveryID,
+	)
+	return err
+}
+
+// MarkDeliveryProcessed flags a webhook delivery as successfully processed
+func (db *DBWrapper) MarkDeliveryProcessed(ctx context.Context, deliveryID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET processed = TRUE, processed_at = $2 WHERE delivery_id = $1",
+		deliveryID, time.Now(),
+	)
+	return err
+}
+
+// GetDeliveries lists the deliveries stored with a payload that match the filter
+func (db *DBWrapper) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	conditions := []string{"payload IS NOT NULL"}
+	var args []any
+
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("received_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("received_at < $%d", len(args)))
+	}
+	if filter.Unprocessed {
+		conditions = append(conditions, "NOT processed")
+	}
+	if filter.AfterID != "" {
+		args = append(args, filter.AfterReceivedAt, filter.AfterID)
+		conditions = append(conditions, fmt.Sprintf("(received_at, delivery_id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `SELECT delivery_id, event, payload, received_at, attempts, processed
+		FROM webhook_deliveries
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY received_at, delivery_id`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := db.pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.Event, &d.Payload, &d.ReceivedAt, &d.Attempts, &d.Processed); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
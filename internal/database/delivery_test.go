@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestRecordDelivery(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+
+	receivedAt := time.Now()
+	payload := []byte(`{"action":"queued"}`)
+
+	testCases := []struct {
+		name       string
+		claimed    bool
+		wantRecord bool
+	}{
+		{
+			name:       "claimed delivery",
+			claimed:    true,
+			wantRecord: true,
+		},
+		{
+			name:       "processed or in-flight delivery",
+			claimed:    false,
+			wantRecord: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"delivery_id"})
+			if tc.claimed {
+				rows.AddRow("delivery-guid")
+			}
+			mock.ExpectQuery("INSERT INTO webhook_deliveries").
+				WithArgs("delivery-guid", "workflow_job", receivedAt, payload, receivedAt.Add(-DeliveryClaimTimeout)).
+				WillReturnRows(rows)
+			if !tc.claimed {
+				mock.ExpectExec("UPDATE webhook_deliveries SET").
+					WithArgs("delivery-guid", receivedAt, payload).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			isNew, err := dbWrapper.RecordDelivery(ctx, "delivery-guid", "workflow_job", payload, receivedAt)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if isNew != tc.wantRecord {
+				t.Errorf("RecordDelivery() = %v, want %v", isNew, tc.wantRecord)
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMarkDeliveryProcessed(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+
+	mock.ExpectExec("UPDATE webhook_deliveries SET processed = TRUE").
+		WithArgs("delivery-guid", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := dbWrapper.MarkDeliveryProcessed(ctx, "delivery-guid"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReleaseDelivery(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+
+	mock.ExpectExec("UPDATE webhook_deliveries SET claimed_at = NULL").
+		WithArgs("delivery-guid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := dbWrapper.ReleaseDelivery(ctx, "delivery-guid"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetDeliveries(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+
+	from := time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)
+	after := from.Add(time.Hour)
+	payload := []byte(`{"action":"queued"}`)
+
+	mock.ExpectQuery(`SELECT delivery_id, event, payload, received_at, attempts, processed
+		FROM webhook_deliveries
+		WHERE payload IS NOT NULL AND received_at >= \$1 AND NOT processed AND \(received_at, delivery_id\) > \(\$2, \$3\)
+		ORDER BY received_at, delivery_id LIMIT \$4`).
+		WithArgs(from, after, "guid-1", 100).
+		WillReturnRows(sqlmock.NewRows([]string{"delivery_id", "event", "payload", "received_at", "attempts", "processed"}).
+			AddRow("guid-2", "workflow_job", payload, after.Add(time.Minute), 2, false))
+
+	deliveries, err := dbWrapper.GetDeliveries(ctx, models.DeliveryFilter{
+		From:            from,
+		Unprocessed:     true,
+		AfterReceivedAt: after,
+		AfterID:         "guid-1",
+		Limit:           100,
+	})
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].ID != "guid-2" || string(deliveries[0].Payload) != string(payload) || deliveries[0].Attempts != 2 {
+		t.Errorf("Expected the stored delivery, got %+v", deliveries)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,76 +1,73 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/gateixeira/rpulse/internal/database/aggregate"
 	"github.com/gateixeira/rpulse/models"
 )
 
 var (
-	hourlyQuery = `SELECT 
-        timestamp::text,
+	hourlyQuery = `SELECT
+        timestamp,
         count_self_hosted,
         count_github_hosted,
-        count_queued
+        count_queued,
+        peak_total
     FROM historical_entries
     WHERE timestamp >= NOW() - INTERVAL '1 hour'
     ORDER BY timestamp`
 
-	aggregatedQuery = `SELECT 
-        bucket as timestamp,
-        ROUND(avg_self_hosted) as count_self_hosted,
-        ROUND(avg_github_hosted) as count_github_hosted,
-        ROUND(avg_queued) as count_queued
-    FROM %s
-    WHERE bucket >= NOW() - INTERVAL '1 %s'
-    ORDER BY bucket`
-
-	peakHourlyQuery = `SELECT 
-        (count_self_hosted + count_github_hosted + count_queued) as peak,
-        timestamp::text
+	peakHourlyQuery = `SELECT
+        peak_total as peak,
+        timestamp
     FROM historical_entries
     WHERE timestamp >= NOW() - INTERVAL '1 hour'
     ORDER BY peak DESC
     LIMIT 1`
 
-	peakAggregatedQuery = `SELECT 
-        peak_total, 
-        bucket::text
+	peakRollupQuery = `SELECT
+        peak_total,
+        bucket
     FROM %s
-    WHERE bucket >= NOW() - INTERVAL '1 %s'
+    WHERE bucket >= $1
     ORDER BY peak_total DESC
     LIMIT 1`
-
-	validPeriods = map[string]string{
-		"hour":  "historical_entries",
-		"day":   "daily_runner_stats",
-		"week":  "weekly_runner_stats",
-		"month": "monthly_runner_stats",
-	}
 )
 
 // AddHistoricalEntry adds a new historical data entry to the database
-func (db *DBWrapper) AddHistoricalEntry(entry models.HistoricalEntry) error {
-	_, err := DB.Exec(
-		"INSERT INTO historical_entries (timestamp, count_self_hosted, count_github_hosted, count_queued) VALUES ($1, $2, $3, $4)",
-		entry.Timestamp, entry.CountSelfHosted, entry.CountGitHubHosted, entry.CountQueued,
+func (db *DBWrapper) AddHistoricalEntry(ctx context.Context, entry models.HistoricalEntry) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx,
+		"INSERT INTO historical_entries (timestamp, count_self_hosted, count_github_hosted, count_queued, peak_total) VALUES ($1, $2, $3, $4, $5)",
+		entry.Timestamp, entry.CountSelfHosted, entry.CountGitHubHosted, entry.CountQueued, entry.PeakTotal,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return db.pruneIfDue(ctx, time.Now())
 }
 
 // GetHistoricalDataByPeriod retrieves historical data entries filtered by time period
-func (db *DBWrapper) GetHistoricalDataByPeriod(period string) ([]models.HistoricalEntry, error) {
-	tableName := validPeriods[period]
-
-	var query string
-	if period == "hour" {
-		query = hourlyQuery
-	} else {
-		query = fmt.Sprintf(aggregatedQuery, tableName, period)
+func (db *DBWrapper) GetHistoricalDataByPeriod(ctx context.Context, period string) ([]models.HistoricalEntry, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if period != "hour" {
+		r, err := aggregate.PeriodRange(period, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return db.GetHistoricalDataByRange(ctx, r)
 	}
 
-	rows, err := DB.Query(query)
+	rows, err := db.pool.QueryContext(ctx, hourlyQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query historical data: %w", err)
 	}
@@ -79,9 +76,11 @@ func (db *DBWrapper) GetHistoricalDataByPeriod(period string) ([]models.Historic
 	var entries []models.HistoricalEntry
 	for rows.Next() {
 		var entry models.HistoricalEntry
-		if err := rows.Scan(&entry.Timestamp, &entry.CountSelfHosted, &entry.CountGitHubHosted, &entry.CountQueued); err != nil {
+		var timestamp time.Time
+		if err := rows.Scan(&timestamp, &entry.CountSelfHosted, &entry.CountGitHubHosted, &entry.CountQueued, &entry.PeakTotal); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
+		entry.Timestamp = aggregate.Timestamp(timestamp)
 		entries = append(entries, entry)
 	}
 
@@ -93,19 +92,30 @@ func (db *DBWrapper) GetHistoricalDataByPeriod(period string) ([]models.Historic
 }
 
 // CalculatePeakDemand returns the peak number of concurrent workflows and its timestamp for the given period
-func (db *DBWrapper) CalculatePeakDemand(period string) (int, string, error) {
-	tableName := validPeriods[period]
-
-	var query string
-	if period == "hour" {
-		query = peakHourlyQuery
-	} else {
-		query = fmt.Sprintf(peakAggregatedQuery, tableName, period)
+func (db *DBWrapper) CalculatePeakDemand(ctx context.Context, period string) (int, string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query, args := peakHourlyQuery, []any{}
+	if period != "hour" {
+		r, err := aggregate.PeriodRange(period, time.Now())
+		if err != nil {
+			return 0, "", err
+		}
+		query, args = fmt.Sprintf(peakRollupQuery, rollupFor(r.Step).runners), []any{r.From}
 	}
 
+	return scanPeak(db.pool.QueryRowContext(ctx, query, args...))
+}
+
+// scanPeak reads a peak and its timestamp, treating no data as a peak of zero
+func scanPeak(row *sql.Row) (int, string, error) {
 	var peak sql.NullInt64
-	var timestamp sql.NullString
-	err := DB.QueryRow(query).Scan(&peak, &timestamp)
+	var timestamp sql.NullTime
+	err := row.Scan(&peak, &timestamp)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
 	if err != nil {
 		return 0, "", err
 	}
@@ -114,5 +124,5 @@ func (db *DBWrapper) CalculatePeakDemand(period string) (int, string, error) {
 		return 0, "", nil
 	}
 
-	return int(peak.Int64), timestamp.String, nil
+	return int(peak.Int64), aggregate.Timestamp(timestamp.Time), nil
 }
@@ -1,33 +1,36 @@
 package database
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gateixeira/rpulse/models"
 )
 
 func TestAddHistoricalEntry(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 	defer db.Close()
-	DB = db
-	dbWrapper := &DBWrapper{}
+	dbWrapper := NewDBWrapper(db, 0)
 
 	entry := models.HistoricalEntry{
 		Timestamp:         "2025-03-24 10:00:00",
 		CountSelfHosted:   5,
 		CountGitHubHosted: 10,
 		CountQueued:       2,
+		PeakTotal:         21,
 	}
 
 	mock.ExpectExec("INSERT INTO historical_entries").
-		WithArgs(entry.Timestamp, entry.CountSelfHosted, entry.CountGitHubHosted, entry.CountQueued).
+		WithArgs(entry.Timestamp, entry.CountSelfHosted, entry.CountGitHubHosted, entry.CountQueued, entry.PeakTotal).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = dbWrapper.AddHistoricalEntry(entry)
+	err = dbWrapper.AddHistoricalEntry(ctx, entry)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -38,13 +41,13 @@ func TestAddHistoricalEntry(t *testing.T) {
 }
 
 func TestGetHistoricalDataByPeriod(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 	defer db.Close()
-	DB = db
-	dbWrapper := &DBWrapper{}
+	dbWrapper := NewDBWrapper(db, 0)
 
 	testCases := []struct {
 		name     string
@@ -56,17 +59,17 @@ func TestGetHistoricalDataByPeriod(t *testing.T) {
 		{
 			name:   "hourly data",
 			period: "hour",
-			mockRows: sqlmock.NewRows([]string{"timestamp", "count_self_hosted", "count_github_hosted", "count_queued"}).
-				AddRow("2025-03-24 10:00:00", 5, 10, 2).
-				AddRow("2025-03-24 10:15:00", 6, 11, 3),
+			mockRows: sqlmock.NewRows([]string{"timestamp", "count_self_hosted", "count_github_hosted", "count_queued", "peak_total"}).
+				AddRow(time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC), 5, 10, 2, 17).
+				AddRow(time.Date(2025, 3, 24, 10, 15, 0, 0, time.UTC), 6, 11, 3, 20),
 			wantLen: 2,
 			wantErr: false,
 		},
 		{
 			name:   "daily data",
 			period: "day",
-			mockRows: sqlmock.NewRows([]string{"timestamp", "count_self_hosted", "count_github_hosted", "count_queued"}).
-				AddRow("2025-03-24", 15, 30, 5),
+			mockRows: sqlmock.NewRows([]string{"step_bucket", "count_self_hosted", "count_github_hosted", "count_queued", "peak_total"}).
+				AddRow(time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC), 15, 30, 5, 52),
 			wantLen: 1,
 			wantErr: false,
 		},
@@ -84,7 +87,7 @@ func TestGetHistoricalDataByPeriod(t *testing.T) {
 				mock.ExpectQuery("SELECT").WillReturnRows(tc.mockRows)
 			}
 
-			entries, err := dbWrapper.GetHistoricalDataByPeriod(tc.period)
+			entries, err := dbWrapper.GetHistoricalDataByPeriod(ctx, tc.period)
 			if (err != nil) != tc.wantErr {
 				t.Errorf("GetHistoricalDataByPeriod() error = %v, wantErr %v", err, tc.wantErr)
 				return
@@ -102,13 +105,13 @@ func TestGetHistoricalDataByPeriod(t *testing.T) {
 }
 
 func TestCalculatePeakDemand(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 	defer db.Close()
-	DB = db
-	dbWrapper := &DBWrapper{}
+	dbWrapper := NewDBWrapper(db, 0)
 
 	testCases := []struct {
 		name         string
@@ -122,18 +125,18 @@ func TestCalculatePeakDemand(t *testing.T) {
 			name:   "hourly peak",
 			period: "hour",
 			mockRows: sqlmock.NewRows([]string{"peak", "timestamp"}).
-				AddRow(25, "2025-03-24 10:00:00"),
+				AddRow(25, time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)),
 			expectedPeak: 25,
-			expectedTime: "2025-03-24 10:00:00",
+			expectedTime: "2025-03-24T10:00:00Z",
 			expectError:  false,
 		},
 		{
 			name:   "daily peak",
 			period: "day",
 			mockRows: sqlmock.NewRows([]string{"peak_total", "bucket"}).
-				AddRow(50, "2025-03-24"),
+				AddRow(50, time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)),
 			expectedPeak: 50,
-			expectedTime: "2025-03-24",
+			expectedTime: "2025-03-24T00:00:00Z",
 			expectError:  false,
 		},
 		{
@@ -151,7 +154,7 @@ func TestCalculatePeakDemand(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			mock.ExpectQuery("SELECT").WillReturnRows(tc.mockRows)
 
-			peak, timestamp, err := dbWrapper.CalculatePeakDemand(tc.period)
+			peak, timestamp, err := dbWrapper.CalculatePeakDemand(ctx, tc.period)
 			if (err != nil) != tc.expectError {
 				t.Errorf("CalculatePeakDemand() error = %v, expectError %v", err, tc.expectError)
 				return
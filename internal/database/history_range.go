@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// rollup is a source of historical data: the raw entries or one level of the continuous aggregates
+type rollup struct {
+	step      time.Duration // bucket width, zero for the raw entries
+	retention func(models.RetentionPolicies) time.Duration
+	runners   string
+	pools     string
+}
+
+// rollups lists the sources from the finest to the coarsest. Each aggregate rolls up the one before it.
+var rollups = []rollup{
+	{step: 0, retention: func(p models.RetentionPolicies) time.Duration { return p.Raw }, runners: "historical_entries", pools: "pool_historical_entries"},
+	{step: time.Minute, retention: func(p models.RetentionPolicies) time.Duration { return p.Rollup1m }, runners: "runner_stats_1m", pools: "pool_stats_1m"},
+	{step: 15 * time.Minute, retention: func(p models.RetentionPolicies) time.Duration { return p.Rollup15m }, runners: "runner_stats_15m", pools: "pool_stats_15m"},
+	{step: time.Hour, retention: func(p models.RetentionPolicies) time.Duration { return p.Rollup1h }, runners: "runner_stats_1h", pools: "pool_stats_1h"},
+}
+
+// defaultRetention is the retention of the migrations, in effect until ApplyRetentionPolicies sets the configured one
+var defaultRetention = models.RetentionPolicies{
+	Raw:       30 * 24 * time.Hour,
+	Jobs:      30 * 24 * time.Hour,
+	Durations: 30 * 24 * time.Hour,
+	Rollup1m:  90 * 24 * time.Hour,
+	Rollup15m: 365 * 24 * time.Hour,
+	Rollup1h:  2 * 365 * 24 * time.Hour,
+}
+
+var (
+	rangeQuery = `SELECT
+        time_bucket($1::interval, timestamp) AS step_bucket,
+        ROUND(AVG(count_self_hosted)) AS count_self_hosted,
+        ROUND(AVG(count_github_hosted)) AS count_github_hosted,
+        ROUND(AVG(count_queued)) AS count_queued,
+        MAX(peak_total) AS peak_total
+    FROM historical_entries
+    WHERE timestamp >= $2 AND timestamp < $3
+    GROUP BY step_bucket
+    ORDER BY step_bucket`
+
+	rangeRollupQuery = `SELECT
+        time_bucket($1::interval, bucket) AS step_bucket,
+        ROUND(SUM(sum_self_hosted)::numeric / SUM(samples)) AS count_self_hosted,
+        ROUND(SUM(sum_github_hosted)::numeric / SUM(samples)) AS count_github_hosted,
+        ROUND(SUM(sum_queued)::numeric / SUM(samples)) AS count_queued,
+        MAX(peak_total) AS peak_total
+    FROM %s
+    WHERE bucket >= $2 AND bucket < $3
+    GROUP BY step_bucket
+    ORDER BY step_bucket`
+
+	poolRangeQuery = `SELECT
+        time_bucket($1::interval, timestamp) AS step_bucket,
+        ROUND(AVG(count_running)) AS count_running,
+        ROUND(AVG(count_queued)) AS count_queued,
+        MAX(peak_total) AS peak_total
+    FROM pool_historical_entries
+    WHERE runner_pool = $4 AND timestamp >= $2 AND timestamp < $3
+    GROUP BY step_bucket
+    ORDER BY step_bucket`
+
+	poolRangeRollupQuery = `SELECT
+        time_bucket($1::interval, bucket) AS step_bucket,
+        ROUND(SUM(sum_running)::numeric / SUM(samples)) AS count_running,
+        ROUND(SUM(sum_queued)::numeric / SUM(samples)) AS count_queued,
+        MAX(peak_total) AS peak_total
+    FROM %s
+    WHERE runner_pool = $4 AND bucket >= $2 AND bucket < $3
+    GROUP BY step_bucket
+    ORDER BY step_bucket`
+)
+
+// StepGranularity returns what the step of a range starting at from must be a multiple of.
+// Ranges within the raw retention can use any whole number of seconds; older ranges are
+// only kept by the coarser rollups.
+func (db *DBWrapper) StepGranularity(from, now time.Time) time.Duration {
+	retention := db.retentionPolicies()
+	for _, source := range rollups {
+		if !from.Before(now.Add(-source.retention(retention))) {
+			return max(source.step, time.Second)
+		}
+	}
+	return rollups[len(rollups)-1].step
+}
+
+// rollupFor returns the coarsest source whose buckets evenly divide the step
+func rollupFor(step time.Duration) rollup {
+	source := rollups[0]
+	for _, candidate := range rollups[1:] {
+		if step%candidate.step == 0 {
+			source = candidate
+		}
+	}
+	return source
+}
+
+// GetHistoricalDataByRange retrieves the historical data of a time range in buckets of its step
+func (db *DBWrapper) GetHistoricalDataByRange(ctx context.Context, r models.TimeRange) ([]models.HistoricalEntry, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := rangeQuery
+	if source := rollupFor(r.Step); source.step > 0 {
+		query = fmt.Sprintf(rangeRollupQuery, source.runners)
+	}
+
+	rows, err := db.pool.QueryContext(ctx, query, rangeArgs(r)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query historical data: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.HistoricalEntry{}
+	for rows.Next() {
+		var bucket time.Time
+		var entry models.HistoricalEntry
+		if err := rows.Scan(&bucket, &entry.CountSelfHosted, &entry.CountGitHubHosted, &entry.CountQueued, &entry.PeakTotal); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entry.Timestamp = bucket.UTC().Format(time.RFC3339)
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// GetPoolHistoricalDataByRange retrieves the historical data of a runner pool for a time range in buckets of its step
+func (db *DBWrapper) GetPoolHistoricalDataByRange(ctx context.Context, r models.TimeRange, pool string) ([]models.PoolHistoricalEntry, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := poolRangeQuery
+	if source := rollupFor(r.Step); source.step > 0 {
+		query = fmt.Sprintf(poolRangeRollupQuery, source.pools)
+	}
+
+	rows, err := db.pool.QueryContext(ctx, query, append(rangeArgs(r), pool)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool historical data: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.PoolHistoricalEntry{}
+	for rows.Next() {
+		var bucket time.Time
+		entry := models.PoolHistoricalEntry{Pool: pool}
+		if err := rows.Scan(&bucket, &entry.CountRunning, &entry.CountQueued, &entry.PeakTotal); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entry.Timestamp = bucket.UTC().Format(time.RFC3339)
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+func rangeArgs(r models.TimeRange) []any {
+	return []any{fmt.Sprintf("%d seconds", int64(r.Step/time.Second)), r.From, r.To}
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestGetHistoricalDataByRange(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	from := time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)
+	columns := []string{"step_bucket", "count_self_hosted", "count_github_hosted", "count_queued", "peak_total"}
+
+	testCases := []struct {
+		name   string
+		step   time.Duration
+		source string
+		arg    string
+	}{
+		{name: "raw entries for sub-minute steps", step: 30 * time.Second, source: "FROM historical_entries", arg: "30 seconds"},
+		{name: "raw entries for uneven steps", step: 90 * time.Second, source: "FROM historical_entries", arg: "90 seconds"},
+		{name: "minute rollup for whole minutes", step: 5 * time.Minute, source: "FROM runner_stats_1m", arg: "300 seconds"},
+		{name: "quarter hour rollup for whole quarters", step: 90 * time.Minute, source: "FROM runner_stats_15m", arg: "5400 seconds"},
+		{name: "hourly rollup for whole hours", step: 2 * time.Hour, source: "FROM runner_stats_1h", arg: "7200 seconds"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := models.TimeRange{From: from, To: from.Add(24 * time.Hour), Step: tc.step}
+			mock.ExpectQuery(tc.source).
+				WithArgs(tc.arg, r.From, r.To).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(from, 2, 3, 1, 8).
+					AddRow(from.Add(tc.step), 1, 0, 0, 2))
+
+			entries, err := dbWrapper.GetHistoricalDataByRange(ctx, r)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if len(entries) != 2 {
+				t.Fatalf("Expected 2 entries, got %d", len(entries))
+			}
+			expected := models.HistoricalEntry{Timestamp: "2025-03-24T00:00:00Z", CountSelfHosted: 2, CountGitHubHosted: 3, CountQueued: 1, PeakTotal: 8}
+			if entries[0] != expected {
+				t.Errorf("Expected %+v, got %+v", expected, entries[0])
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetPoolHistoricalDataByRange(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	r := models.TimeRange{From: from, To: from.Add(7 * 24 * time.Hour), Step: time.Hour}
+
+	mock.ExpectQuery("FROM pool_stats_1h").
+		WithArgs("3600 seconds", r.From, r.To, "gpu").
+		WillReturnRows(sqlmock.NewRows([]string{"step_bucket", "count_running", "count_queued", "peak_total"}).
+			AddRow(from, 4, 2, 9))
+
+	entries, err := dbWrapper.GetPoolHistoricalDataByRange(ctx, r, "gpu")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []models.PoolHistoricalEntry{{Timestamp: "2025-03-01T00:00:00Z", Pool: "gpu", CountRunning: 4, CountQueued: 2, PeakTotal: 9}}
+	if len(entries) != 1 || entries[0] != expected[0] {
+		t.Errorf("Expected %+v, got %+v", expected, entries)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStepGranularity(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	dbWrapper := NewDBWrapper(nil, 0)
+
+	testCases := []struct {
+		name     string
+		from     time.Time
+		expected time.Duration
+	}{
+		{name: "raw retention", from: now.AddDate(0, 0, -7), expected: time.Second},
+		{name: "minute rollup", from: now.AddDate(0, 0, -60), expected: time.Minute},
+		{name: "quarter hour rollup", from: now.AddDate(0, -6, 0), expected: 15 * time.Minute},
+		{name: "hourly rollup", from: now.AddDate(-1, -6, 0), expected: time.Hour},
+		{name: "past every retention", from: now.AddDate(-5, 0, 0), expected: time.Hour},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := dbWrapper.StepGranularity(tc.from, now); got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
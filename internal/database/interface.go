@@ -1,27 +1,85 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"sync"
 	"time"
 
 	"github.com/gateixeira/rpulse/models"
 )
 
-// DatabaseInterface defines the contract for database operations
+// DatabaseInterface defines the contract for database operations. Every operation is
+// cancelled with its context.
 type DatabaseInterface interface {
-	AddOrUpdateJob(ID int64, status models.JobStatus, runnerType models.RunnerType, createdAt, startedAt, completedAt time.Time) error
-	CountQueuedJobs() (int, error)
-	GetRunningJobs(runnerType models.RunnerType) ([]string, error)
-	AddHistoricalEntry(entry models.HistoricalEntry) error
-	GetAverageQueueTime() (time.Duration, error)
-	AddQueueTimeDuration(ID int64, createdAt time.Time, duration time.Duration) error
-	GetHistoricalDataByPeriod(period string) ([]models.HistoricalEntry, error)
-	CalculatePeakDemand(period string) (int, string, error)
+	AddOrUpdateJob(ctx context.Context, job models.WorkflowJob) (models.WorkflowJob, bool, error)
+	CountQueuedJobs(ctx context.Context) (int, error)
+	CountWaitingJobs(ctx context.Context) (int, error)
+	GetRunningJobs(ctx context.Context, runnerType models.RunnerType) ([]string, error)
+	AddHistoricalEntry(ctx context.Context, entry models.HistoricalEntry) error
+	GetQueueTimeStats(ctx context.Context, filter models.QueueTimeFilter) (models.QueueTimeStats, error)
+	GetQueueTimeHistogram(ctx context.Context, filter models.QueueTimeFilter, bounds []time.Duration) ([]models.HistogramBucket, error)
+	GetJobDurationStats(ctx context.Context, groupBy string, filter models.JobDurationFilter, limit int) ([]models.JobDurationStats, error)
+	GetLongestJobs(ctx context.Context, filter models.JobDurationFilter, limit int) ([]models.JobDuration, error)
+	ListJobs(ctx context.Context, filter models.JobFilter) ([]models.WorkflowJob, error)
+	GetJob(ctx context.Context, id int64) (models.WorkflowJob, bool, error)
+	AddJobEvent(ctx context.Context, event models.JobEvent) error
+	GetJobEvents(ctx context.Context, id int64, createdAt time.Time) ([]models.JobEvent, error)
+	AddQueueTimeDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error)
+	GetAverageApprovalWaitTime(ctx context.Context, period string) (time.Duration, error)
+	AddApprovalWaitDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error)
+	GetHistoricalDataByPeriod(ctx context.Context, period string) ([]models.HistoricalEntry, error)
+	GetHistoricalDataByRange(ctx context.Context, r models.TimeRange) ([]models.HistoricalEntry, error)
+	CalculatePeakDemand(ctx context.Context, period string) (int, string, error)
+	CountQueuedJobsByPool(ctx context.Context) (map[string]int, error)
+	CountRunningJobsByPool(ctx context.Context) (map[string]int, error)
+	CountWaitingJobsByPool(ctx context.Context) (map[string]int, error)
+	GetAverageQueueTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error)
+	GetAverageApprovalWaitTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error)
+	AddPoolHistoricalEntries(ctx context.Context, entries []models.PoolHistoricalEntry) error
+	GetPoolHistoricalDataByPeriod(ctx context.Context, period, pool string) ([]models.PoolHistoricalEntry, error)
+	GetPoolHistoricalDataByRange(ctx context.Context, r models.TimeRange, pool string) ([]models.PoolHistoricalEntry, error)
+	CalculatePeakDemandByPool(ctx context.Context, period, pool string) (int, string, error)
+	AddOrUpdateWorkflowRun(ctx context.Context, run models.WorkflowRun) error
+	RecordDelivery(ctx context.Context, deliveryID, event string, payload []byte, receivedAt time.Time) (bool, error)
+	MarkDeliveryProcessed(ctx context.Context, deliveryID string) error
+	ReleaseDelivery(ctx context.Context, deliveryID string) error
+	GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error)
+	ReapStaleJobs(ctx context.Context, status models.JobStatus, maxAge time.Duration) (int, error)
+	ApplyRetentionPolicies(ctx context.Context, policies models.RetentionPolicies) error
+	GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error)
+	StepGranularity(from, now time.Time) time.Duration
+	CreateAPIToken(ctx context.Context, token models.APIToken) error
+	GetAPIToken(ctx context.Context, hash string) (models.APIToken, bool, error)
+	ListAPITokens(ctx context.Context) ([]models.APIToken, error)
+	RevokeAPIToken(ctx context.Context, id string, revokedAt time.Time) (bool, error)
 }
 
-// DBWrapper wraps the actual DB instance and implements DatabaseInterface
-type DBWrapper struct{}
+// DBWrapper implements DatabaseInterface on a PostgreSQL connection pool
+type DBWrapper struct {
+	pool         *sql.DB
+	queryTimeout time.Duration
 
-// NewDBWrapper creates a new DBWrapper instance
-func NewDBWrapper() DatabaseInterface {
-	return &DBWrapper{}
+	mu        sync.RWMutex
+	retention models.RetentionPolicies
+	lastPrune time.Time
+}
+
+// NewDBWrapper creates a DBWrapper on an open connection pool. Each operation is cancelled
+// after queryTimeout, or only with its context when queryTimeout is zero.
+func NewDBWrapper(pool *sql.DB, queryTimeout time.Duration) *DBWrapper {
+	return &DBWrapper{pool: pool, queryTimeout: queryTimeout}
+}
+
+// Close closes the connection pool
+func (db *DBWrapper) Close() error {
+	return db.pool.Close()
+}
+
+// withTimeout bounds an operation by the query timeout on top of the caller's cancellation
+func (db *DBWrapper) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.queryTimeout)
 }
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+var (
+	jobDurationStatsQuery = `SELECT
+        %s,
+        COUNT(*),
+        AVG(duration_ms),
+        percentile_cont(0.5) WITHIN GROUP (ORDER BY duration_ms),
+        percentile_cont(0.95) WITHIN GROUP (ORDER BY duration_ms),
+        SUM(duration_ms) / 60000.0 AS runner_minutes
+    FROM (
+        SELECT runner_pool, repository_full_name, workflow_name, job_name,
+            EXTRACT(EPOCH FROM (completed_at - started_at)) * 1000 AS duration_ms
+        FROM workflow_jobs
+        WHERE %s
+    ) jobs
+    GROUP BY %s
+    ORDER BY runner_minutes DESC
+    LIMIT $%d`
+
+	longestJobsQuery = `SELECT
+        id, run_id, repository_full_name, workflow_name, job_name, runner_pool, conclusion,
+        started_at, completed_at,
+        (EXTRACT(EPOCH FROM (completed_at - started_at)) * 1000)::bigint AS duration_ms
+    FROM workflow_jobs
+    WHERE %s
+    ORDER BY duration_ms DESC
+    LIMIT $%d`
+
+	// jobDurationGroups lists the columns jobs are grouped by for each grouping. Workflow and
+	// job names are only unique within a repository, so they are grouped with their parents.
+	jobDurationGroups = map[string][]string{
+		"pool":       {"runner_pool"},
+		"repository": {"repository_full_name"},
+		"workflow":   {"repository_full_name", "workflow_name"},
+		"job":        {"repository_full_name", "workflow_name", "job_name"},
+	}
+
+	// jobDurationColumns are the grouping columns in the order they are selected and scanned
+	jobDurationColumns = []string{"runner_pool", "repository_full_name", "workflow_name", "job_name"}
+)
+
+// GetJobDurationStats returns the run duration aggregates of completed jobs matching the filter, grouped by
+// pool, repository, workflow or job. The groups that used the most runner minutes come first.
+func (db *DBWrapper) GetJobDurationStats(ctx context.Context, groupBy string, filter models.JobDurationFilter, limit int) ([]models.JobDurationStats, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	group, ok := jobDurationGroups[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("invalid grouping %q", groupBy)
+	}
+
+	conditions, args, err := jobDurationConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, limit)
+
+	selected := make([]string, len(jobDurationColumns))
+	for i, column := range jobDurationColumns {
+		selected[i] = "NULL"
+		for _, grouped := range group {
+			if grouped == column {
+				selected[i] = column
+			}
+		}
+	}
+
+	query := fmt.Sprintf(jobDurationStatsQuery,
+		strings.Join(selected, ", "), conditions, strings.Join(group, ", "), len(args))
+
+	rows, err := db.pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job duration stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []models.JobDurationStats{}
+	for rows.Next() {
+		var entry models.JobDurationStats
+		var pool, repository, workflow, job sql.NullString
+		var avg, p50, p95, runnerMinutes sql.NullFloat64
+		if err := rows.Scan(&pool, &repository, &workflow, &job, &entry.Count, &avg, &p50, &p95, &runnerMinutes); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		entry.Pool = pool.String
+		entry.Repository = repository.String
+		entry.Workflow = workflow.String
+		entry.Job = job.String
+		entry.AvgMs = int64(avg.Float64)
+		entry.P50Ms = int64(p50.Float64)
+		entry.P95Ms = int64(p95.Float64)
+		entry.RunnerMinutes = runnerMinutes.Float64
+		stats = append(stats, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetLongestJobs returns the completed jobs matching the filter that ran the longest
+func (db *DBWrapper) GetLongestJobs(ctx context.Context, filter models.JobDurationFilter, limit int) ([]models.JobDuration, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	conditions, args, err := jobDurationConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, limit)
+
+	rows, err := db.pool.QueryContext(ctx, fmt.Sprintf(longestJobsQuery, conditions, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query longest jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.JobDuration{}
+	for rows.Next() {
+		var job models.JobDuration
+		var runID sql.NullInt64
+		var repository, workflow, name, pool, conclusion sql.NullString
+		if err := rows.Scan(&job.ID, &runID, &repository, &workflow, &name, &pool, &conclusion,
+			&job.StartedAt, &job.CompletedAt, &job.DurationMs); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		job.RunID = runID.Int64
+		job.Repository = repository.String
+		job.Workflow = workflow.String
+		job.Job = name.String
+		job.Pool = pool.String
+		job.Conclusion = conclusion.String
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// jobDurationConditions builds the conditions selecting the completed jobs that match a filter
+func jobDurationConditions(filter models.JobDurationFilter) (string, []any, error) {
+	args := []any{string(models.JobStatusCompleted)}
+	conditions := []string{"status = $1", "started_at IS NOT NULL", "completed_at IS NOT NULL"}
+
+	if filter.Period != "" {
+		condition, err := periodCondition("completed_at", filter.Period)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	for _, field := range []struct {
+		column string
+		value  string
+	}{
+		{"runner_pool", filter.Pool},
+		{"repository_full_name", filter.Repository},
+		{"workflow_name", filter.Workflow},
+		{"job_name", filter.Job},
+	} {
+		if field.value != "" {
+			args = append(args, field.value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", field.column, len(args)))
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestGetJobDurationStats(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	columns := []string{"runner_pool", "repository_full_name", "workflow_name", "job_name", "count", "avg", "p50", "p95", "runner_minutes"}
+
+	t.Run("grouped by workflow", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT\s+NULL, repository_full_name, workflow_name, NULL,.*WHERE status = \$1 AND started_at IS NOT NULL AND completed_at IS NOT NULL AND completed_at >= NOW\(\) - INTERVAL '1 week' AND runner_pool = \$2\s+\) jobs\s+GROUP BY repository_full_name, workflow_name\s+ORDER BY runner_minutes DESC\s+LIMIT \$3`).
+			WithArgs(string(models.JobStatusCompleted), "gpu", 10).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(nil, "octo-org/app", "CI", nil, 12, 300000.0, 240000.0, 600000.0, 60.0).
+				AddRow(nil, "octo-org/app", "Nightly", nil, 1, 1800000.0, 1800000.0, 1800000.0, 30.0))
+
+		stats, err := dbWrapper.GetJobDurationStats(ctx, "workflow", models.JobDurationFilter{Period: "week", Pool: "gpu"}, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := []models.JobDurationStats{
+			{Repository: "octo-org/app", Workflow: "CI", Count: 12, AvgMs: 300000, P50Ms: 240000, P95Ms: 600000, RunnerMinutes: 60},
+			{Repository: "octo-org/app", Workflow: "Nightly", Count: 1, AvgMs: 1800000, P50Ms: 1800000, P95Ms: 1800000, RunnerMinutes: 30},
+		}
+		if len(stats) != len(expected) {
+			t.Fatalf("Expected %d groups, got %d", len(expected), len(stats))
+		}
+		for i := range expected {
+			if stats[i] != expected[i] {
+				t.Errorf("Group %d: expected %+v, got %+v", i, expected[i], stats[i])
+			}
+		}
+	})
+
+	t.Run("invalid grouping", func(t *testing.T) {
+		if _, err := dbWrapper.GetJobDurationStats(ctx, "runner", models.JobDurationFilter{}, 10); err == nil {
+			t.Error("Expected an error for an invalid grouping")
+		}
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+		if _, err := dbWrapper.GetJobDurationStats(ctx, "pool", models.JobDurationFilter{Period: "year"}, 10); err == nil {
+			t.Error("Expected an error for an invalid period")
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetLongestJobs(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	startedAt := time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)
+	completedAt := startedAt.Add(45 * time.Minute)
+
+	mock.ExpectQuery(`FROM workflow_jobs\s+WHERE status = \$1 AND started_at IS NOT NULL AND completed_at IS NOT NULL AND repository_full_name = \$2 AND job_name = \$3\s+ORDER BY duration_ms DESC\s+LIMIT \$4`).
+		WithArgs(string(models.JobStatusCompleted), "octo-org/app", "build", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "run_id", "repository_full_name", "workflow_name", "job_name", "runner_pool", "conclusion", "started_at", "completed_at", "duration_ms"}).
+			AddRow(42, 7, "octo-org/app", "CI", "build", "self-hosted", "success", startedAt, completedAt, 2700000).
+			AddRow(43, nil, "octo-org/app", nil, "build", nil, nil, startedAt, startedAt.Add(time.Minute), 60000))
+
+	jobs, err := dbWrapper.GetLongestJobs(ctx, models.JobDurationFilter{Repository: "octo-org/app", Job: "build"}, 5)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs, got %d", len(jobs))
+	}
+	expected := models.JobDuration{
+		ID: 42, RunID: 7, Repository: "octo-org/app", Workflow: "CI", Job: "build", Pool: "self-hosted",
+		Conclusion: "success", StartedAt: startedAt, CompletedAt: completedAt, DurationMs: 2700000,
+	}
+	if jobs[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, jobs[0])
+	}
+	if jobs[1].RunID != 0 || jobs[1].Workflow != "" || jobs[1].DurationMs != 60000 {
+		t.Errorf("Expected NULL columns to be empty, got %+v", jobs[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
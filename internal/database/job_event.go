@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// jobEventColumns lists the workflow_job_events columns in the order of AddJobEvent and scanJobEvent
+const jobEventColumns = `job_id, job_created_at, delivery_id, action, received_at, started_at,
+	completed_at, conclusion, runner_id, runner_name, runner_group_name`
+
+// AddJobEvent records a workflow_job event received for a job. An event from a delivery already
+// recorded for the job, such as a replayed one, is ignored.
+func (db *DBWrapper) AddJobEvent(ctx context.Context, event models.JobEvent) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx,
+		`INSERT INTO workflow_job_events (`+jobEventColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (delivery_id, job_created_at) DO NOTHING`,
+		event.JobID, event.JobCreatedAt, nullString(event.DeliveryID), event.Action, event.ReceivedAt,
+		nullTime(event.StartedAt), nullTime(event.CompletedAt), nullString(event.Conclusion),
+		nullInt64(event.RunnerID), nullString(event.RunnerName), nullString(event.RunnerGroupName),
+	)
+	return err
+}
+
+// GetJob returns the job with the given ID and reports whether it is stored. Job IDs are unique
+// on GitHub, but should two stored jobs share one, the most recently created is returned.
+func (db *DBWrapper) GetJob(ctx context.Context, id int64) (models.WorkflowJob, bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	job, err := scanJob(db.pool.QueryRowContext(ctx,
+		"SELECT "+jobColumns+" FROM workflow_jobs WHERE id = $1 ORDER BY created_at DESC LIMIT 1", id,
+	))
+	if err == sql.ErrNoRows {
+		return models.WorkflowJob{}, false, nil
+	}
+	if err != nil {
+		return models.WorkflowJob{}, false, fmt.Errorf("failed to query job: %w", err)
+	}
+	return job, true, nil
+}
+
+// GetJobEvents returns the events received for a job in the order they arrived
+func (db *DBWrapper) GetJobEvents(ctx context.Context, id int64, createdAt time.Time) ([]models.JobEvent, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT `+jobEventColumns+` FROM workflow_job_events
+		WHERE job_id = $1 AND job_created_at = $2
+		ORDER BY received_at, id`,
+		id, createdAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.JobEvent{}
+	for rows.Next() {
+		event, err := scanJobEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// scanJobEvent reads an event selected with jobEventColumns
+func scanJobEvent(row rowScanner) (models.JobEvent, error) {
+	var event models.JobEvent
+	var deliveryID, conclusion, runnerName, runnerGroupName sql.NullString
+	var runnerID sql.NullInt64
+	var startedAt, completedAt sql.NullTime
+
+	err := row.Scan(
+		&event.JobID, &event.JobCreatedAt, &deliveryID, &event.Action, &event.ReceivedAt, &startedAt,
+		&completedAt, &conclusion, &runnerID, &runnerName, &runnerGroupName,
+	)
+	if err != nil {
+		return models.JobEvent{}, err
+	}
+
+	event.DeliveryID = deliveryID.String
+	event.StartedAt = startedAt.Time
+	event.CompletedAt = completedAt.Time
+	event.Conclusion = conclusion.String
+	event.RunnerID = runnerID.Int64
+	event.RunnerName = runnerName.String
+	event.RunnerGroupName = runnerGroupName.String
+
+	return event, nil
+}
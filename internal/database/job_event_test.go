@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestAddJobEvent(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+	createdAt := time.Date(2025, 3, 24, 17, 0, 0, 0, time.UTC)
+	event := models.JobEvent{
+		JobID:        42,
+		JobCreatedAt: createdAt,
+		DeliveryID:   "d1",
+		Action:       "queued",
+		ReceivedAt:   createdAt.Add(time.Second),
+	}
+
+	mock.ExpectExec(`INSERT INTO workflow_job_events (.+) ON CONFLICT \(delivery_id, job_created_at\) DO NOTHING`).
+		WithArgs(int64(42), createdAt, nullString("d1"), "queued", event.ReceivedAt,
+			nullTime(time.Time{}), nullTime(time.Time{}), nullString(""), nullInt64(0), nullString(""), nullString("")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := dbWrapper.AddJobEvent(ctx, event); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetJob(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+	columns := strings.Split(strings.Join(strings.Fields(jobColumns), ""), ",")
+	job := models.WorkflowJob{
+		ID:         42,
+		Status:     models.JobStatusInProgress,
+		RunnerName: "runner-1",
+		Labels:     []string{"self-hosted"},
+		CreatedAt:  time.Date(2025, 3, 24, 17, 0, 0, 0, time.UTC),
+	}
+
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_jobs WHERE id = \$1 ORDER BY created_at DESC LIMIT 1`).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(jobValues(job)...))
+
+	got, found, err := dbWrapper.GetJob(ctx, 42)
+	if err != nil || !found {
+		t.Fatalf("Expected the job to be found, got %v (%v)", found, err)
+	}
+	if got.ID != 42 || got.RunnerName != "runner-1" || !got.CreatedAt.Equal(job.CreatedAt) {
+		t.Errorf("Unexpected job %+v", got)
+	}
+
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_jobs WHERE id = \$1`).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	if _, found, err := dbWrapper.GetJob(ctx, 7); err != nil || found {
+		t.Errorf("Expected an unknown job not to be found, got %v (%v)", found, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetJobEvents(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+	columns := strings.Split(strings.Join(strings.Fields(jobEventColumns), ""), ",")
+	createdAt := time.Date(2025, 3, 24, 17, 0, 0, 0, time.UTC)
+	startedAt := createdAt.Add(time.Minute)
+
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_job_events WHERE job_id = \$1 AND job_created_at = \$2 ORDER BY received_at, id`).
+		WithArgs(int64(42), createdAt).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(int64(42), createdAt, "d1", "queued", createdAt, nil, nil, nil, nil, nil, nil).
+			AddRow(int64(42), createdAt, nil, "in_progress", startedAt, startedAt, nil, nil, int64(3), "runner-1", "default"))
+
+	events, err := dbWrapper.GetJobEvents(ctx, 42, createdAt)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", events)
+	}
+	if events[0].DeliveryID != "d1" || events[0].Action != "queued" || !events[0].StartedAt.IsZero() {
+		t.Errorf("Unexpected first event %+v", events[0])
+	}
+	if events[1].DeliveryID != "" || events[1].RunnerID != 3 || events[1].RunnerName != "runner-1" || !events[1].StartedAt.Equal(startedAt) {
+		t.Errorf("Unexpected second event %+v", events[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
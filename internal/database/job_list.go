@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+	"github.com/lib/pq"
+)
+
+var (
+	// listJobsQuery selects jobs with their queue time and run time in milliseconds, computed
+	// like jobstate.SortKey. Both are NULL for jobs that have not started or completed.
+	listJobsQuery = `SELECT ` + jobColumns + `
+    FROM (
+        SELECT *,
+            CASE WHEN started_at IS NOT NULL THEN GREATEST(TRUNC(EXTRACT(EPOCH FROM (started_at -
+                CASE WHEN waiting_at IS NOT NULL AND queued_at IS NOT NULL THEN queued_at ELSE created_at END
+            )) * 1000), 0)::bigint END AS queue_time_ms,
+            TRUNC(EXTRACT(EPOCH FROM (completed_at - started_at)) * 1000)::bigint AS duration_ms
+        FROM workflow_jobs
+    ) jobs
+    WHERE %s
+    ORDER BY %s DESC, id DESC`
+
+	// jobSortColumns are the columns of listJobsQuery each sort orders by
+	jobSortColumns = map[models.JobSort]string{
+		models.JobSortCreated:   "created_at",
+		models.JobSortQueueTime: "queue_time_ms",
+		models.JobSortDuration:  "duration_ms",
+	}
+)
+
+// ListJobs returns a page of the jobs matching the filter in the order it selects
+func (db *DBWrapper) ListJobs(ctx context.Context, filter models.JobFilter) ([]models.WorkflowJob, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	sort := filter.Sort
+	if sort == "" {
+		sort = models.JobSortCreated
+	}
+	column, ok := jobSortColumns[sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort %q", filter.Sort)
+	}
+
+	conditions, args := jobListConditions(filter)
+	if sort != models.JobSortCreated {
+		conditions = append(conditions, column+" IS NOT NULL")
+	}
+
+	if filter.After != nil {
+		var key any = filter.After.Value
+		if sort == models.JobSortCreated {
+			key = time.UnixMicro(filter.After.Value)
+		}
+		args = append(args, key, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) < ($%d, $%d)", column, len(args)-1, len(args)))
+	}
+
+	query := fmt.Sprintf(listJobsQuery, strings.Join(conditions, " AND "), column)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := db.pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.WorkflowJob{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// jobListConditions builds the conditions selecting the jobs that match a filter, its sort and cursor aside
+func jobListConditions(filter models.JobFilter) ([]string, []any) {
+	conditions := []string{"TRUE"}
+	var args []any
+
+	for _, field := range []struct {
+		column string
+		value  string
+	}{
+		{"status", string(filter.Status)},
+		{"runner_pool", filter.Pool},
+		{"repository_full_name", filter.Repository},
+		{"workflow_name", filter.Workflow},
+	} {
+		if field.value != "" {
+			args = append(args, field.value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", field.column, len(args)))
+		}
+	}
+
+	for _, bound := range []struct {
+		condition string
+		value     time.Time
+	}{
+		{"created_at >= $%d", filter.CreatedFrom},
+		{"created_at < $%d", filter.CreatedTo},
+		{"started_at >= $%d", filter.StartedFrom},
+		{"started_at < $%d", filter.StartedTo},
+		{"completed_at >= $%d", filter.CompletedFrom},
+		{"completed_at < $%d", filter.CompletedTo},
+	} {
+		if !bound.value.IsZero() {
+			args = append(args, bound.value)
+			conditions = append(conditions, fmt.Sprintf(bound.condition, len(args)))
+		}
+	}
+
+	for _, minimum := range []struct {
+		column string
+		value  time.Duration
+	}{
+		{"queue_time_ms", filter.MinQueueTime},
+		{"duration_ms", filter.MinDuration},
+	} {
+		if minimum.value > 0 {
+			args = append(args, minimum.value.Milliseconds())
+			conditions = append(conditions, fmt.Sprintf("%s >= $%d", minimum.column, len(args)))
+		}
+	}
+
+	if len(filter.Labels) > 0 {
+		labels := make([]string, len(filter.Labels))
+		for i, label := range filter.Labels {
+			labels[i] = strings.ToLower(label)
+		}
+		args = append(args, pq.Array(labels))
+		conditions = append(conditions, fmt.Sprintf("ARRAY(SELECT lower(label) FROM unnest(labels) AS label) @> $%d::text[]", len(args)))
+	}
+
+	return conditions, args
+}
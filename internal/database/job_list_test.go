@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/lib/pq"
+)
+
+func TestListJobs(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+	columns := strings.Split(strings.Join(strings.Fields(jobColumns), ""), ",")
+	createdAt := time.Date(2025, 3, 24, 17, 0, 0, 0, time.UTC)
+	job := models.WorkflowJob{
+		ID:         42,
+		Status:     models.JobStatusCompleted,
+		RunnerPool: "gpu",
+		Labels:     []string{"self-hosted", "gpu"},
+		CreatedAt:  createdAt,
+		StartedAt:  createdAt.Add(15 * time.Minute),
+	}
+	from := createdAt.Add(-time.Hour)
+
+	t.Run("queue time order", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT (.+) FROM \(.+\) jobs WHERE TRUE AND runner_pool = \$1 AND started_at >= \$2 AND queue_time_ms >= \$3 AND ARRAY\(.+\) @> \$4::text\[\] AND queue_time_ms IS NOT NULL AND \(queue_time_ms, id\) < \(\$5, \$6\) ORDER BY queue_time_ms DESC, id DESC LIMIT \$7`).
+			WithArgs("gpu", from, int64(600000), pq.Array([]string{"gpu"}), int64(1200000), int64(7), 21).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(jobValues(job)...))
+
+		jobs, err := dbWrapper.ListJobs(ctx, models.JobFilter{
+			Pool:         "gpu",
+			StartedFrom:  from,
+			MinQueueTime: 10 * time.Minute,
+			Labels:       []string{"GPU"},
+			Sort:         models.JobSortQueueTime,
+			After:        &models.JobCursor{Value: 1200000, ID: 7},
+			Limit:        21,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(jobs) != 1 || jobs[0].ID != 42 || len(jobs[0].Labels) != 2 || !jobs[0].StartedAt.Equal(job.StartedAt) {
+			t.Errorf("Unexpected jobs %+v", jobs)
+		}
+	})
+
+	t.Run("created order", func(t *testing.T) {
+		mock.ExpectQuery(`WHERE TRUE AND status = \$1 AND \(created_at, id\) < \(\$2, \$3\) ORDER BY created_at DESC, id DESC$`).
+			WithArgs("queued", time.UnixMicro(createdAt.UnixMicro()), int64(42)).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		jobs, err := dbWrapper.ListJobs(ctx, models.JobFilter{
+			Status: models.JobStatusQueued,
+			After:  &models.JobCursor{Value: createdAt.UnixMicro(), ID: 42},
+		})
+		if err != nil || len(jobs) != 0 {
+			t.Errorf("Expected no jobs, got %+v (%v)", jobs, err)
+		}
+	})
+
+	if _, err := dbWrapper.ListJobs(ctx, models.JobFilter{Sort: "name"}); err == nil {
+		t.Error("Expected an error for an invalid sort")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,839 @@
+// Package memory implements the storage in process memory, for running rpulse as a single
+// binary without a database. Nothing survives a restart.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/database/aggregate"
+	"github.com/gateixeira/rpulse/internal/jobstate"
+	"github.com/gateixeira/rpulse/models"
+)
+
+// pruneInterval is how often data past its retention is dropped
+const pruneInterval = time.Minute
+
+var _ database.DatabaseInterface = (*Store)(nil)
+
+type jobKey struct {
+	id        int64
+	createdAt int64
+}
+
+type runKey struct {
+	id        int64
+	attempt   int
+	createdAt int64
+}
+
+type delivery struct {
+	event      string
+	payload    []byte
+	receivedAt time.Time
+	attempts   int
+	processed  bool
+	claimedAt  time.Time
+}
+
+// Store keeps the jobs, samples and durations in memory. Data past its retention is pruned
+// when a sample is recorded, at most once every pruneInterval.
+type Store struct {
+	mu            sync.RWMutex
+	jobs          map[jobKey]models.WorkflowJob
+	jobEvents     map[jobKey][]models.JobEvent
+	runs          map[runKey]models.WorkflowRun
+	deliveries    map[string]*delivery
+	apiTokens     map[string]models.APIToken
+	samples       []aggregate.Sample
+	poolSamples   []aggregate.PoolSample
+	queueTimes    []aggregate.DurationRecord
+	approvalWaits []aggregate.DurationRecord
+	retention     models.RetentionPolicies
+	lastPrune     time.Time
+}
+
+// NewStore creates an empty store that keeps everything until retention policies are applied
+func NewStore() *Store {
+	return &Store{
+		jobs:       make(map[jobKey]models.WorkflowJob),
+		jobEvents:  make(map[jobKey][]models.JobEvent),
+		runs:       make(map[runKey]models.WorkflowRun),
+		deliveries: make(map[string]*delivery),
+		apiTokens:  make(map[string]models.APIToken),
+	}
+}
+
+func keyOf(job models.WorkflowJob) jobKey {
+	return jobKey{id: job.ID, createdAt: job.CreatedAt.UnixMicro()}
+}
+
+// AddOrUpdateJob merges a job event into the stored job state and returns the merged state,
+// and whether the event moved the job to a new status
+func (s *Store) AddOrUpdateJob(ctx context.Context, job models.WorkflowJob) (models.WorkflowJob, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := keyOf(job)
+	current := s.jobs[key]
+	merged := jobstate.Merge(current, job)
+	s.jobs[key] = merged
+	return merged, merged.Status != current.Status, nil
+}
+
+// CountQueuedJobs returns the count of queued jobs
+func (s *Store) CountQueuedJobs(ctx context.Context) (int, error) {
+	return s.countJobs(models.JobStatusQueued), nil
+}
+
+// CountWaitingJobs returns the count of jobs waiting on deployment protection rules
+func (s *Store) CountWaitingJobs(ctx context.Context) (int, error) {
+	return s.countJobs(models.JobStatusWaiting), nil
+}
+
+func (s *Store) countJobs(status models.JobStatus) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, job := range s.jobs {
+		if job.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// GetRunningJobs returns all running workflow jobs of a specific type
+func (s *Store) GetRunningJobs(ctx context.Context, runnerType models.RunnerType) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var IDs []string
+	for _, job := range s.jobs {
+		if job.RunnerType == runnerType && job.Status == models.JobStatusInProgress {
+			IDs = append(IDs, strconv.FormatInt(job.ID, 10))
+		}
+	}
+	return IDs, nil
+}
+
+// CountQueuedJobsByPool returns the count of queued jobs in each runner pool
+func (s *Store) CountQueuedJobsByPool(ctx context.Context) (map[string]int, error) {
+	return s.countJobsByPool(models.JobStatusQueued), nil
+}
+
+// CountWaitingJobsByPool returns the count of jobs waiting on deployment protection rules in each runner pool
+func (s *Store) CountWaitingJobsByPool(ctx context.Context) (map[string]int, error) {
+	return s.countJobsByPool(models.JobStatusWaiting), nil
+}
+
+// CountRunningJobsByPool returns the count of running jobs in each runner pool
+func (s *Store) CountRunningJobsByPool(ctx context.Context) (map[string]int, error) {
+	return s.countJobsByPool(models.JobStatusInProgress), nil
+}
+
+func (s *Store) countJobsByPool(status models.JobStatus) map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, job := range s.jobs {
+		if job.Status == status && job.RunnerPool != "" {
+			counts[job.RunnerPool]++
+		}
+	}
+	return counts
+}
+
+// AddQueueTimeDuration records how long a job was queued, at the time it started. A job that already
+// has one keeps it.
+func (s *Store) AddQueueTimeDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var inserted bool
+	s.queueTimes, inserted = insertDuration(s.queueTimes, aggregate.DurationRecord{
+		JobID: ID, JobCreatedAt: createdAt, Pool: pool, Duration: duration, RecordedAt: recordedAt,
+	})
+	return inserted, nil
+}
+
+// AddApprovalWaitDuration records how long a job waited for deployment protection rules, at the time it was approved
+func (s *Store) AddApprovalWaitDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var inserted bool
+	s.approvalWaits, inserted = insertDuration(s.approvalWaits, aggregate.DurationRecord{
+		JobID: ID, JobCreatedAt: createdAt, Pool: pool, Duration: duration, RecordedAt: recordedAt,
+	})
+	return inserted, nil
+}
+
+// insertDuration adds a record to durations kept in the order they were recorded in, unless its
+// job already has one, and reports whether it did. Replayed deliveries record durations of the
+// past, so a record is not always the latest one.
+func insertDuration(records []aggregate.DurationRecord, record aggregate.DurationRecord) ([]aggregate.DurationRecord, bool) {
+	if slices.ContainsFunc(records, func(r aggregate.DurationRecord) bool {
+		return r.JobID == record.JobID && r.JobCreatedAt.Equal(record.JobCreatedAt)
+	}) {
+		return records, false
+	}
+
+	i := sort.Search(len(records), func(i int) bool { return records[i].RecordedAt.After(record.RecordedAt) })
+	return slices.Insert(records, i, record), true
+}
+
+// GetAverageApprovalWaitTime calculates and returns the average approval wait time of the jobs approved in a period
+func (s *Store) GetAverageApprovalWaitTime(ctx context.Context, period string) (time.Duration, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return averageByPool(s.approvalWaits, since, false)[""], nil
+}
+
+// GetAverageQueueTimeByPool calculates the average queue time of each runner pool over the jobs started in a period
+func (s *Store) GetAverageQueueTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return averageByPool(s.queueTimes, since, true), nil
+}
+
+// GetAverageApprovalWaitTimeByPool calculates the average approval wait time of each runner pool over the jobs
+// approved in a period
+func (s *Store) GetAverageApprovalWaitTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return averageByPool(s.approvalWaits, since, true), nil
+}
+
+// averageByPool averages the durations recorded since a time of each pool, or of all records under
+// the empty pool when byPool is false. Durations without a pool are left out of the pool averages.
+func averageByPool(records []aggregate.DurationRecord, since time.Time, byPool bool) map[string]time.Duration {
+	sums := make(map[string]time.Duration)
+	counts := make(map[string]int)
+	for _, record := range records {
+		if record.RecordedAt.Before(since) {
+			continue
+		}
+		pool := ""
+		if byPool {
+			if record.Pool == "" {
+				continue
+			}
+			pool = record.Pool
+		}
+		sums[pool] += record.Duration.Truncate(time.Millisecond)
+		counts[pool]++
+	}
+
+	averages := make(map[string]time.Duration)
+	for pool, sum := range sums {
+		averages[pool] = (sum / time.Duration(counts[pool])).Truncate(time.Millisecond)
+	}
+	return averages
+}
+
+// GetQueueTimeStats returns the count, average, percentiles and maximum of the queue times matching the filter
+func (s *Store) GetQueueTimeStats(ctx context.Context, filter models.QueueTimeFilter) (models.QueueTimeStats, error) {
+	durations, err := s.queueTimesMatching(filter)
+	if err != nil {
+		return models.QueueTimeStats{}, err
+	}
+	return aggregate.QueueTimeStats(durations), nil
+}
+
+// GetQueueTimeHistogram counts the queue times matching the filter in buckets split at the given ascending bounds
+func (s *Store) GetQueueTimeHistogram(ctx context.Context, filter models.QueueTimeFilter, bounds []time.Duration) ([]models.HistogramBucket, error) {
+	durations, err := s.queueTimesMatching(filter)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate.Histogram(durations, bounds), nil
+}
+
+func (s *Store) queueTimesMatching(filter models.QueueTimeFilter) ([]time.Duration, error) {
+	var since time.Time
+	if filter.Period != "" {
+		var err error
+		if since, err = aggregate.PeriodStart(filter.Period, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var durations []time.Duration
+	for _, record := range s.queueTimes {
+		job := s.jobs[jobKey{id: record.JobID, createdAt: record.JobCreatedAt.UnixMicro()}]
+		if aggregate.QueueTimeMatches(filter, since, record.RecordedAt, record.Pool, job) {
+			durations = append(durations, record.Duration)
+		}
+	}
+	return durations, nil
+}
+
+// GetJobDurationStats returns the run duration aggregates of completed jobs matching the filter, grouped by
+// pool, repository, workflow or job. The groups that used the most runner minutes come first.
+func (s *Store) GetJobDurationStats(ctx context.Context, groupBy string, filter models.JobDurationFilter, limit int) ([]models.JobDurationStats, error) {
+	jobs, err := s.completedJobs(filter)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate.JobDurationStats(jobs, groupBy, limit)
+}
+
+// GetLongestJobs returns the completed jobs matching the filter that ran the longest
+func (s *Store) GetLongestJobs(ctx context.Context, filter models.JobDurationFilter, limit int) ([]models.JobDuration, error) {
+	jobs, err := s.completedJobs(filter)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate.LongestJobs(jobs, limit), nil
+}
+
+func (s *Store) completedJobs(filter models.JobDurationFilter) ([]models.JobDuration, error) {
+	var since time.Time
+	if filter.Period != "" {
+		var err error
+		if since, err = aggregate.PeriodStart(filter.Period, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var jobs []models.JobDuration
+	for _, job := range s.jobs {
+		if duration, ok := aggregate.CompletedJob(job); ok && aggregate.JobDurationMatches(filter, since, duration) {
+			jobs = append(jobs, duration)
+		}
+	}
+	return jobs, nil
+}
+
+// ListJobs returns a page of the jobs matching the filter in the order it selects
+func (s *Store) ListJobs(ctx context.Context, filter models.JobFilter) ([]models.WorkflowJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]models.WorkflowJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return aggregate.ListJobs(jobs, filter), nil
+}
+
+// GetJob returns the job with the given ID and reports whether it is stored. Should two stored
+// jobs share the ID, the most recently created is returned.
+func (s *Store) GetJob(ctx context.Context, id int64) (models.WorkflowJob, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found models.WorkflowJob
+	for _, job := range s.jobs {
+		if job.ID == id && (found.ID == 0 || job.CreatedAt.After(found.CreatedAt)) {
+			found = job
+		}
+	}
+	return found, found.ID != 0, nil
+}
+
+// AddJobEvent records a workflow_job event received for a job. An event from a delivery already
+// recorded for the job is ignored.
+func (s *Store) AddJobEvent(ctx context.Context, event models.JobEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := jobKey{id: event.JobID, createdAt: event.JobCreatedAt.UnixMicro()}
+	if event.DeliveryID != "" {
+		for _, recorded := range s.jobEvents[key] {
+			if recorded.DeliveryID == event.DeliveryID {
+				return nil
+			}
+		}
+	}
+	s.jobEvents[key] = append(s.jobEvents[key], event)
+	return nil
+}
+
+// GetJobEvents returns the events received for a job in the order they arrived
+func (s *Store) GetJobEvents(ctx context.Context, id int64, createdAt time.Time) ([]models.JobEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := append([]models.JobEvent{}, s.jobEvents[jobKey{id: id, createdAt: createdAt.UnixMicro()}]...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ReceivedAt.Before(events[j].ReceivedAt) })
+	return events, nil
+}
+
+// AddHistoricalEntry records a runner demand sample
+func (s *Store) AddHistoricalEntry(ctx context.Context, entry models.HistoricalEntry) error {
+	t, err := time.Parse(time.RFC3339, entry.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q: %w", entry.Timestamp, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = insertSample(s.samples, aggregate.Sample{Time: t.UTC(), Entry: entry})
+	s.pruneIfDue(time.Now())
+	return nil
+}
+
+// AddPoolHistoricalEntries records one demand sample per runner pool
+func (s *Store) AddPoolHistoricalEntries(ctx context.Context, entries []models.PoolHistoricalEntry) error {
+	samples := make([]aggregate.PoolSample, len(entries))
+	for i, entry := range entries {
+		t, err := time.Parse(time.RFC3339, entry.Timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q: %w", entry.Timestamp, err)
+		}
+		samples[i] = aggregate.PoolSample{Time: t.UTC(), Entry: entry}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sample := range samples {
+		s.poolSamples = insertPoolSample(s.poolSamples, sample)
+	}
+	return nil
+}
+
+// insertSample keeps the samples ordered by time, appending in the common case
+func insertSample(samples []aggregate.Sample, sample aggregate.Sample) []aggregate.Sample {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Time.After(sample.Time) })
+	samples = append(samples, aggregate.Sample{})
+	copy(samples[i+1:], samples[i:])
+	samples[i] = sample
+	return samples
+}
+
+func insertPoolSample(samples []aggregate.PoolSample, sample aggregate.PoolSample) []aggregate.PoolSample {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Time.After(sample.Time) })
+	samples = append(samples, aggregate.PoolSample{})
+	copy(samples[i+1:], samples[i:])
+	samples[i] = sample
+	return samples
+}
+
+// GetHistoricalDataByPeriod returns the samples of the last hour, or longer periods in buckets
+func (s *Store) GetHistoricalDataByPeriod(ctx context.Context, period string) ([]models.HistoricalEntry, error) {
+	now := time.Now()
+	if period != "hour" {
+		r, err := aggregate.PeriodRange(period, now)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetHistoricalDataByRange(ctx, r)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []models.HistoricalEntry
+	for _, sample := range s.samples {
+		if !sample.Time.Before(now.Add(-time.Hour)) {
+			entry := sample.Entry
+			entry.Timestamp = aggregate.Timestamp(sample.Time)
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// GetHistoricalDataByRange returns the samples of a time range averaged in buckets of its step
+func (s *Store) GetHistoricalDataByRange(ctx context.Context, r models.TimeRange) ([]models.HistoricalEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return aggregate.History(s.samples, r), nil
+}
+
+// CalculatePeakDemand returns the peak demand and its timestamp for the given period
+func (s *Store) CalculatePeakDemand(ctx context.Context, period string) (int, string, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return 0, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	peak, timestamp := aggregate.Peak(s.samples, since)
+	return peak, timestamp, nil
+}
+
+// GetPoolHistoricalDataByPeriod returns the samples of a runner pool of the last hour, or longer periods in buckets
+func (s *Store) GetPoolHistoricalDataByPeriod(ctx context.Context, period, pool string) ([]models.PoolHistoricalEntry, error) {
+	now := time.Now()
+	if period != "hour" {
+		r, err := aggregate.PeriodRange(period, now)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetPoolHistoricalDataByRange(ctx, r, pool)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []models.PoolHistoricalEntry
+	for _, sample := range s.poolSamples {
+		if sample.Entry.Pool == pool && !sample.Time.Before(now.Add(-time.Hour)) {
+			entry := sample.Entry
+			entry.Timestamp = aggregate.Timestamp(sample.Time)
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// GetPoolHistoricalDataByRange returns the samples of a runner pool for a time range averaged in buckets of its step
+func (s *Store) GetPoolHistoricalDataByRange(ctx context.Context, r models.TimeRange, pool string) ([]models.PoolHistoricalEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return aggregate.PoolHistory(s.poolSamples, pool, r), nil
+}
+
+// CalculatePeakDemandByPool returns the peak demand of a runner pool and its timestamp for the given period
+func (s *Store) CalculatePeakDemandByPool(ctx context.Context, period, pool string) (int, string, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return 0, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	peak, timestamp := aggregate.PoolPeak(s.poolSamples, pool, since)
+	return peak, timestamp, nil
+}
+
+// AddOrUpdateWorkflowRun adds or updates a workflow run attempt
+func (s *Store) AddOrUpdateWorkflowRun(ctx context.Context, run models.WorkflowRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs[runKey{id: run.ID, attempt: run.RunAttempt, createdAt: run.CreatedAt.UnixMicro()}] = run
+	return nil
+}
+
+// RecordDelivery logs a webhook delivery by its GUID with its payload and reports whether the
+// caller claimed it for processing
+func (s *Store) RecordDelivery(ctx context.Context, deliveryID, event string, payload []byte, receivedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[deliveryID]
+	if !ok {
+		s.deliveries[deliveryID] = &delivery{
+			event:      event,
+			payload:    payload,
+			receivedAt: receivedAt,
+			attempts:   1,
+			claimedAt:  receivedAt,
+		}
+		return true, nil
+	}
+
+	d.attempts++
+	if d.payload == nil {
+		d.payload = payload
+	}
+
+	// Processed deliveries and deliveries in flight are not claimed again
+	if d.processed || (!d.claimedAt.IsZero() && !d.claimedAt.Before(receivedAt.Add(-database.DeliveryClaimTimeout))) {
+		return false, nil
+	}
+	d.claimedAt = receivedAt
+	return true, nil
+}
+
+// ReleaseDelivery gives up the claim on a delivery that could not be processed, so a redelivery
+// processes it again
+func (s *Store) ReleaseDelivery(ctx context.Context, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d, ok := s.deliveries[deliveryID]; ok && !d.processed {
+		d.claimedAt = time.Time{}
+	}
+	return nil
+}
+
+// MarkDeliveryProcessed flags a webhook delivery as successfully processed
+func (s *Store) MarkDeliveryProcessed(ctx context.Context, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d, ok := s.deliveries[deliveryID]; ok {
+		d.processed = true
+	}
+	return nil
+}
+
+// GetDeliveries lists the deliveries stored with a payload that match the filter
+func (s *Store) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var deliveries []models.WebhookDelivery
+	for id, d := range s.deliveries {
+		switch {
+		case d.payload == nil,
+			!filter.From.IsZero() && d.receivedAt.Before(filter.From),
+			!filter.To.IsZero() && !d.receivedAt.Before(filter.To),
+			filter.Unprocessed && d.processed,
+			filter.AfterID != "" && !deliveryAfter(d.receivedAt, id, filter.AfterReceivedAt, filter.AfterID):
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			ID:         id,
+			Event:      d.event,
+			Payload:    d.payload,
+			ReceivedAt: d.receivedAt,
+			Attempts:   d.attempts,
+			Processed:  d.processed,
+		})
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveryAfter(deliveries[j].ReceivedAt, deliveries[j].ID, deliveries[i].ReceivedAt, deliveries[i].ID)
+	})
+	if filter.Limit > 0 && len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+
+	return deliveries, nil
+}
+
+// deliveryAfter reports whether a delivery is listed after another one
+func deliveryAfter(receivedAt time.Time, id string, otherReceivedAt time.Time, otherID string) bool {
+	if !receivedAt.Equal(otherReceivedAt) {
+		return receivedAt.After(otherReceivedAt)
+	}
+	return id > otherID
+}
+
+// ReapStaleJobs marks jobs that have been in a status for longer than maxAge as abandoned.
+// It returns the number of reaped jobs.
+func (s *Store) ReapStaleJobs(ctx context.Context, status models.JobStatus, maxAge time.Duration) (int, error) {
+	if status != models.JobStatusWaiting && status != models.JobStatusQueued && status != models.JobStatusInProgress {
+		return 0, fmt.Errorf("jobs with status %q cannot be reaped", status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+	reaped := 0
+	for key, job := range s.jobs {
+		if job.Status == status && statusSince(job).Before(cutoff) {
+			job.Status = models.JobStatusAbandoned
+			s.jobs[key] = job
+			reaped++
+		}
+	}
+	return reaped, nil
+}
+
+// statusSince returns when a job entered its current status, falling back to its creation
+func statusSince(job models.WorkflowJob) time.Time {
+	var since time.Time
+	switch job.Status {
+	case models.JobStatusWaiting:
+		since = job.WaitingAt
+	case models.JobStatusQueued:
+		since = job.QueuedAt
+	case models.JobStatusInProgress:
+		since = job.StartedAt
+	}
+
+	if since.IsZero() {
+		return job.CreatedAt
+	}
+	return since
+}
+
+// ApplyRetentionPolicies sets how long each class of data is kept and prunes what is past it.
+// There are no rollups, so history is kept for the raw retention.
+func (s *Store) ApplyRetentionPolicies(ctx context.Context, policies models.RetentionPolicies) error {
+	for _, class := range []struct {
+		name      string
+		retention time.Duration
+	}{{"raw", policies.Raw}, {"jobs", policies.Jobs}, {"durations", policies.Durations}} {
+		if class.retention <= 0 {
+			return fmt.Errorf("retention of %s must be positive", class.name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retention = policies
+	s.prune(time.Now())
+	return nil
+}
+
+// GetRetentionPolicies returns the configured retention of every collection
+func (s *Store) GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.retention == (models.RetentionPolicies{}) {
+		return []models.RetentionPolicy{}, nil
+	}
+	return database.ConfiguredRetention(s.retention, false), nil
+}
+
+// StepGranularity returns a second: every range is read from the raw samples
+func (s *Store) StepGranularity(from, now time.Time) time.Duration {
+	return time.Second
+}
+
+// CreateAPIToken stores a new API token. Its ID and hash must be unique.
+func (s *Store) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.apiTokens {
+		if existing.ID == token.ID || existing.Hash == token.Hash {
+			return fmt.Errorf("api token %s already exists", token.ID)
+		}
+	}
+	s.apiTokens[token.ID] = token
+	return nil
+}
+
+// GetAPIToken returns the API token with the given secret hash and reports whether it exists
+func (s *Store) GetAPIToken(ctx context.Context, hash string) (models.APIToken, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.apiTokens {
+		if token.Hash == hash {
+			return token, true, nil
+		}
+	}
+	return models.APIToken{}, false, nil
+}
+
+// ListAPITokens returns every API token, revoked and expired ones included, oldest first
+func (s *Store) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]models.APIToken, 0, len(s.apiTokens))
+	for _, token := range s.apiTokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens, nil
+}
+
+// RevokeAPIToken revokes an API token and reports whether it exists. Revoking a token again
+// keeps the time it was first revoked.
+func (s *Store) RevokeAPIToken(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.apiTokens[id]
+	if !ok {
+		return false, nil
+	}
+	if token.RevokedAt.IsZero() {
+		token.RevokedAt = revokedAt
+		s.apiTokens[id] = token
+	}
+	return true, nil
+}
+
+func (s *Store) pruneIfDue(now time.Time) {
+	if now.Sub(s.lastPrune) >= pruneInterval {
+		s.prune(now)
+	}
+}
+
+// prune drops the data past its retention. Webhook deliveries are kept as long as jobs,
+// and job events as long as their job.
+func (s *Store) prune(now time.Time) {
+	s.lastPrune = now
+	if s.retention == (models.RetentionPolicies{}) {
+		return
+	}
+
+	rawCutoff := now.Add(-s.retention.Raw)
+	s.samples = s.samples[sort.Search(len(s.samples), func(i int) bool {
+		return !s.samples[i].Time.Before(rawCutoff)
+	}):]
+	s.poolSamples = s.poolSamples[sort.Search(len(s.poolSamples), func(i int) bool {
+		return !s.poolSamples[i].Time.Before(rawCutoff)
+	}):]
+
+	jobsCutoff := now.Add(-s.retention.Jobs)
+	for key, job := range s.jobs {
+		if job.CreatedAt.Before(jobsCutoff) {
+			delete(s.jobs, key)
+		}
+	}
+	for key := range s.jobEvents {
+		if key.createdAt < jobsCutoff.UnixMicro() {
+			delete(s.jobEvents, key)
+		}
+	}
+	for key, run := range s.runs {
+		if run.CreatedAt.Before(jobsCutoff) {
+			delete(s.runs, key)
+		}
+	}
+	for id, d := range s.deliveries {
+		if d.receivedAt.Before(jobsCutoff) {
+			delete(s.deliveries, id)
+		}
+	}
+
+	durationsCutoff := now.Add(-s.retention.Durations)
+	s.queueTimes = pruneDurations(s.queueTimes, durationsCutoff)
+	s.approvalWaits = pruneDurations(s.approvalWaits, durationsCutoff)
+}
+
+// pruneDurations drops the durations recorded before the cutoff, which are the oldest ones
+func pruneDurations(records []aggregate.DurationRecord, cutoff time.Time) []aggregate.DurationRecord {
+	i := sort.Search(len(records), func(i int) bool { return !records[i].RecordedAt.Before(cutoff) })
+	return records[i:]
+}
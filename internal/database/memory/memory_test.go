@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/database/storetest"
+)
+
+func newStore(t *testing.T) database.DatabaseInterface {
+	return NewStore()
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, newStore)
+}
+
+func TestRetention(t *testing.T) {
+	storetest.RunRetention(t, newStore)
+}
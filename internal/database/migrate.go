@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/gateixeira/rpulse/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Migrator applies and rolls back the schema migrations embedded in the binary
+type Migrator struct {
+	m *migrate.Migrate
+}
+
+// NewMigrator creates a migrator on a connection taken from the database's pool. Close
+// returns the connection to the pool and leaves the database open.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read embedded migrations: %w", err)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get a database connection: %w", err)
+	}
+
+	// WithInstance would close the whole pool with the migrator, WithConnection only the
+	// connection
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("could not create database driver: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		_ = driver.Close()
+		return nil, fmt.Errorf("could not create migration instance: %w", err)
+	}
+
+	return &Migrator{m: m}, nil
+}
+
+// Up applies every migration that has not been applied yet
+func (m *Migrator) Up() error {
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Down rolls back the given number of applied migrations
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	if err := m.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Version returns the current schema version, whether the last migration failed half-way,
+// and zero for a database that was never migrated
+func (m *Migrator) Version() (uint, bool, error) {
+	version, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// Force sets the schema version without running any migration and clears the dirty flag,
+// after a failed migration was repaired by hand
+func (m *Migrator) Force(version int) error {
+	return m.m.Force(version)
+}
+
+// Close returns the migrator's connection to the pool; the database stays open
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/migrations"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap/zaptest"
+)
+
+// latestMigration returns the version of the last embedded migration
+func latestMigration(t *testing.T) int {
+	entries, err := fs.ReadDir(migrations.FS, ".")
+	if err != nil {
+		t.Fatalf("Error reading migrations: %v", err)
+	}
+	latest := 0
+	for _, entry := range entries {
+		version, err := strconv.Atoi(strings.SplitN(entry.Name(), "_", 2)[0])
+		if err != nil {
+			t.Fatalf("Unexpected migration name %s", entry.Name())
+		}
+		latest = max(latest, version)
+	}
+	return latest
+}
+
+func TestRunMigrationsLeavesDatabaseOpen(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	latest := latestMigration(t)
+	version := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"version", "dirty"}).AddRow(latest, false)
+	}
+
+	mock.ExpectQuery("SELECT CURRENT_DATABASE\\(\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"current_database"}).AddRow("rpulse"))
+	mock.ExpectQuery("SELECT CURRENT_SCHEMA\\(\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"current_schema"}).AddRow("public"))
+	mock.ExpectExec("SELECT pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COUNT\\(1\\) FROM information_schema.tables").
+		WithArgs("public", "schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec("SELECT pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, dirty FROM \"public\".\"schema_migrations\"").WillReturnRows(version())
+	mock.ExpectExec("SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, dirty FROM \"public\".\"schema_migrations\"").WillReturnRows(version())
+
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"?column?"}).AddRow(1))
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("Error running migrations: %v", err)
+	}
+
+	var one int
+	if err := db.QueryRow("SELECT 1").Scan(&one); err != nil {
+		t.Fatalf("Expected the database to stay open after the migrations, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
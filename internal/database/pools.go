@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database/aggregate"
+	"github.com/gateixeira/rpulse/models"
+)
+
+var (
+	poolHourlyQuery = `SELECT
+        timestamp,
+        runner_pool,
+        count_running,
+        count_queued,
+        peak_total
+    FROM pool_historical_entries
+    WHERE runner_pool = $1 AND timestamp >= NOW() - INTERVAL '1 hour'
+    ORDER BY timestamp`
+
+	poolPeakQuery = `SELECT
+        peak_total AS peak,
+        timestamp
+    FROM pool_historical_entries
+    WHERE runner_pool = $1 AND timestamp >= NOW() - INTERVAL '1 hour'
+    ORDER BY peak DESC
+    LIMIT 1`
+
+	poolPeakRollupQuery = `SELECT
+        peak_total,
+        bucket
+    FROM %s
+    WHERE runner_pool = $1 AND bucket >= $2
+    ORDER BY peak_total DESC
+    LIMIT 1`
+)
+
+// CountQueuedJobsByPool returns the count of queued jobs in each runner pool
+func (db *DBWrapper) CountQueuedJobsByPool(ctx context.Context) (map[string]int, error) {
+	return db.countJobsByPool(ctx, models.JobStatusQueued)
+}
+
+// CountWaitingJobsByPool returns the count of jobs waiting on deployment protection rules in each runner pool
+func (db *DBWrapper) CountWaitingJobsByPool(ctx context.Context) (map[string]int, error) {
+	return db.countJobsByPool(ctx, models.JobStatusWaiting)
+}
+
+// CountRunningJobsByPool returns the count of running jobs in each runner pool
+func (db *DBWrapper) CountRunningJobsByPool(ctx context.Context) (map[string]int, error) {
+	return db.countJobsByPool(ctx, models.JobStatusInProgress)
+}
+
+func (db *DBWrapper) countJobsByPool(ctx context.Context, status models.JobStatus) (map[string]int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		"SELECT runner_pool, COUNT(*) FROM workflow_jobs WHERE status = $1 AND runner_pool IS NOT NULL GROUP BY runner_pool",
+		string(status),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var pool string
+		var count int
+		if err := rows.Scan(&pool, &count); err != nil {
+			return nil, err
+		}
+		counts[pool] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// GetAverageQueueTimeByPool calculates the average queue time of each runner pool over the jobs started in a period
+func (db *DBWrapper) GetAverageQueueTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	return db.averageDurationByPool(ctx, "queue_time_durations", period)
+}
+
+// GetAverageApprovalWaitTimeByPool calculates the average approval wait time of each runner pool over the jobs
+// approved in a period
+func (db *DBWrapper) GetAverageApprovalWaitTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	return db.averageDurationByPool(ctx, "approval_wait_durations", period)
+}
+
+// averageDurationByPool returns the average of the duration_ms column of a durations table for each runner pool
+// over a period
+func (db *DBWrapper) averageDurationByPool(ctx context.Context, table, period string) (map[string]time.Duration, error) {
+	condition, err := periodCondition("recorded_at", period)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		"SELECT runner_pool, AVG(duration_ms) FROM "+table+" WHERE runner_pool IS NOT NULL AND "+condition+" GROUP BY runner_pool",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	averages := make(map[string]time.Duration)
+	for rows.Next() {
+		var pool string
+		var avgMilliseconds float64
+		if err := rows.Scan(&pool, &avgMilliseconds); err != nil {
+			return nil, err
+		}
+		averages[pool] = time.Duration(int64(avgMilliseconds)) * time.Millisecond
+	}
+
+	return averages, rows.Err()
+}
+
+// AddPoolHistoricalEntries adds one historical data entry per runner pool in a single transaction
+func (db *DBWrapper) AddPoolHistoricalEntries(ctx context.Context, entries []models.PoolHistoricalEntry) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, entry := range entries {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO pool_historical_entries (timestamp, runner_pool, count_running, count_queued, peak_total) VALUES ($1, $2, $3, $4, $5)",
+			entry.Timestamp, entry.Pool, entry.CountRunning, entry.CountQueued, entry.PeakTotal,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPoolHistoricalDataByPeriod retrieves the historical data of a runner pool filtered by time period
+func (db *DBWrapper) GetPoolHistoricalDataByPeriod(ctx context.Context, period, pool string) ([]models.PoolHistoricalEntry, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if period != "hour" {
+		r, err := aggregate.PeriodRange(period, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return db.GetPoolHistoricalDataByRange(ctx, r, pool)
+	}
+
+	rows, err := db.pool.QueryContext(ctx, poolHourlyQuery, pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool historical data: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.PoolHistoricalEntry
+	for rows.Next() {
+		var entry models.PoolHistoricalEntry
+		var timestamp time.Time
+		if err := rows.Scan(&timestamp, &entry.Pool, &entry.CountRunning, &entry.CountQueued, &entry.PeakTotal); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entry.Timestamp = aggregate.Timestamp(timestamp)
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CalculatePeakDemandByPool returns the peak demand of a runner pool and its timestamp for the given period
+func (db *DBWrapper) CalculatePeakDemandByPool(ctx context.Context, period, pool string) (int, string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query, args := poolPeakQuery, []any{pool}
+	if period != "hour" {
+		r, err := aggregate.PeriodRange(period, time.Now())
+		if err != nil {
+			return 0, "", err
+		}
+		query, args = fmt.Sprintf(poolPeakRollupQuery, rollupFor(r.Step).pools), []any{pool, r.From}
+	}
+
+	return scanPeak(db.pool.QueryRowContext(ctx, query, args...))
+}
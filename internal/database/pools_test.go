@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestCountJobsByPool(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	mock.ExpectQuery("SELECT runner_pool, COUNT.*FROM workflow_jobs").
+		WithArgs(string(models.JobStatusQueued)).
+		WillReturnRows(sqlmock.NewRows([]string{"runner_pool", "count"}).
+			AddRow("gpu", 3).
+			AddRow("arm64", 1))
+	mock.ExpectQuery("SELECT runner_pool, COUNT.*FROM workflow_jobs").
+		WithArgs(string(models.JobStatusInProgress)).
+		WillReturnRows(sqlmock.NewRows([]string{"runner_pool", "count"}).
+			AddRow("gpu", 2))
+
+	queued, err := dbWrapper.CountQueuedJobsByPool(ctx)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if queued["gpu"] != 3 || queued["arm64"] != 1 {
+		t.Errorf("Unexpected queued counts %v", queued)
+	}
+
+	running, err := dbWrapper.CountRunningJobsByPool(ctx)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if running["gpu"] != 2 || len(running) != 1 {
+		t.Errorf("Unexpected running counts %v", running)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetAverageQueueTimeByPool(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	mock.ExpectQuery(`SELECT runner_pool, AVG.*FROM queue_time_durations WHERE runner_pool IS NOT NULL AND recorded_at >= NOW\(\) - INTERVAL '1 day'`).
+		WillReturnRows(sqlmock.NewRows([]string{"runner_pool", "avg"}).
+			AddRow("gpu", float64(300000)))
+
+	averages, err := dbWrapper.GetAverageQueueTimeByPool(ctx, "day")
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if averages["gpu"] != 5*time.Minute {
+		t.Errorf("Expected 5m for gpu, got %v", averages["gpu"])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddPoolHistoricalEntries(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	entries := []models.PoolHistoricalEntry{
+		{Timestamp: "2025-03-24T10:00:00Z", Pool: "gpu", CountRunning: 2, CountQueued: 1, PeakTotal: 5},
+		{Timestamp: "2025-03-24T10:00:00Z", Pool: "arm64", CountRunning: 0, CountQueued: 4, PeakTotal: 4},
+	}
+
+	mock.ExpectBegin()
+	for _, entry := range entries {
+		mock.ExpectExec("INSERT INTO pool_historical_entries").
+			WithArgs(entry.Timestamp, entry.Pool, entry.CountRunning, entry.CountQueued, entry.PeakTotal).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	if err := dbWrapper.AddPoolHistoricalEntries(ctx, entries); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetPoolHistoricalDataByPeriod(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	columns := []string{"timestamp", "runner_pool", "count_running", "count_queued", "peak_total"}
+
+	testCases := []struct {
+		name     string
+		period   string
+		query    string
+		args     []driver.Value
+		mockRows *sqlmock.Rows
+		wantLen  int
+		wantErr  bool
+	}{
+		{
+			name:   "hourly data",
+			period: "hour",
+			query:  "SELECT (.+) FROM pool_historical_entries WHERE runner_pool = (.+) INTERVAL '1 hour'",
+			args:   []driver.Value{"gpu"},
+			mockRows: sqlmock.NewRows(columns).
+				AddRow(time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC), "gpu", 2, 1, 4).
+				AddRow(time.Date(2025, 3, 24, 10, 0, 5, 0, time.UTC), "gpu", 3, 0, 3),
+			wantLen: 2,
+		},
+		{
+			name:   "weekly data",
+			period: "week",
+			query:  "FROM pool_stats_15m WHERE runner_pool = \\$4",
+			args:   []driver.Value{"1800 seconds", sqlmock.AnyArg(), sqlmock.AnyArg(), "gpu"},
+			mockRows: sqlmock.NewRows([]string{"step_bucket", "count_running", "count_queued", "peak_total"}).
+				AddRow(time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC), 2, 1, 6),
+			wantLen: 1,
+		},
+		{
+			name:    "invalid period",
+			period:  "all",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mockRows != nil {
+				mock.ExpectQuery(tc.query).WithArgs(tc.args...).WillReturnRows(tc.mockRows)
+			}
+
+			entries, err := dbWrapper.GetPoolHistoricalDataByPeriod(ctx, tc.period, "gpu")
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if len(entries) != tc.wantLen {
+				t.Errorf("Expected %d entries, got %d", tc.wantLen, len(entries))
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCalculatePeakDemandByPool(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	t.Run("with data", func(t *testing.T) {
+		mock.ExpectQuery("FROM pool_stats_1m WHERE runner_pool = \\$1 AND bucket >= \\$2").
+			WithArgs("gpu", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"peak_total", "bucket"}).AddRow(7, time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)))
+
+		peak, timestamp, err := dbWrapper.CalculatePeakDemandByPool(ctx, "day", "gpu")
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if peak != 7 || timestamp != "2025-03-24T10:00:00Z" {
+			t.Errorf("Unexpected peak %d at %s", peak, timestamp)
+		}
+	})
+
+	t.Run("without data", func(t *testing.T) {
+		mock.ExpectQuery("SELECT (.+) FROM pool_historical_entries").
+			WithArgs("gpu").
+			WillReturnError(sql.ErrNoRows)
+
+		peak, timestamp, err := dbWrapper.CalculatePeakDemandByPool(ctx, "hour", "gpu")
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if peak != 0 || timestamp != "" {
+			t.Errorf("Expected no peak, got %d at %q", peak, timestamp)
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+	"github.com/lib/pq"
+)
+
+var (
+	queueTimeStatsQuery = `SELECT
+        COUNT(*),
+        AVG(q.duration_ms),
+        percentile_cont(0.5) WITHIN GROUP (ORDER BY q.duration_ms),
+        percentile_cont(0.9) WITHIN GROUP (ORDER BY q.duration_ms),
+        percentile_cont(0.95) WITHIN GROUP (ORDER BY q.duration_ms),
+        percentile_cont(0.99) WITHIN GROUP (ORDER BY q.duration_ms),
+        MAX(q.duration_ms)
+    FROM queue_time_durations q
+    LEFT JOIN workflow_jobs j ON j.id = q.job_id AND j.created_at = q.job_created_at%s`
+
+	queueTimeHistogramQuery = `SELECT
+        width_bucket(q.duration_ms, $1::bigint[]) AS bucket,
+        COUNT(*)
+    FROM queue_time_durations q
+    LEFT JOIN workflow_jobs j ON j.id = q.job_id AND j.created_at = q.job_created_at%s
+    GROUP BY bucket`
+
+	// periodIntervals are the periods analytics can be scoped to
+	periodIntervals = map[string]string{
+		"hour":  "1 hour",
+		"day":   "1 day",
+		"week":  "1 week",
+		"month": "1 month",
+	}
+)
+
+// GetQueueTimeStats returns the count, average, percentiles and maximum of the queue times matching the filter
+func (db *DBWrapper) GetQueueTimeStats(ctx context.Context, filter models.QueueTimeFilter) (models.QueueTimeStats, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	conditions, args, err := queueTimeConditions(filter, nil)
+	if err != nil {
+		return models.QueueTimeStats{}, err
+	}
+
+	var stats models.QueueTimeStats
+	var avg, p50, p90, p95, p99 sql.NullFloat64
+	var maxMs sql.NullInt64
+	err = db.pool.QueryRowContext(ctx, fmt.Sprintf(queueTimeStatsQuery, conditions), args...).
+		Scan(&stats.Count, &avg, &p50, &p90, &p95, &p99, &maxMs)
+	if err != nil {
+		return models.QueueTimeStats{}, fmt.Errorf("failed to query queue time stats: %w", err)
+	}
+
+	stats.AvgMs = int64(avg.Float64)
+	stats.P50Ms = int64(p50.Float64)
+	stats.P90Ms = int64(p90.Float64)
+	stats.P95Ms = int64(p95.Float64)
+	stats.P99Ms = int64(p99.Float64)
+	stats.MaxMs = maxMs.Int64
+
+	return stats, nil
+}
+
+// GetQueueTimeHistogram counts the queue times matching the filter in buckets split at the given
+// ascending bounds. It returns one bucket more than there are bounds, including empty buckets.
+func (db *DBWrapper) GetQueueTimeHistogram(ctx context.Context, filter models.QueueTimeFilter, bounds []time.Duration) ([]models.HistogramBucket, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	boundsMs := make([]int64, len(bounds))
+	for i, bound := range bounds {
+		boundsMs[i] = bound.Milliseconds()
+	}
+
+	conditions, args, err := queueTimeConditions(filter, []any{pq.Array(boundsMs)})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.pool.QueryContext(ctx, fmt.Sprintf(queueTimeHistogramQuery, conditions), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue time histogram: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make([]models.HistogramBucket, len(boundsMs)+1)
+	for i := range buckets {
+		if i > 0 {
+			buckets[i].MinMs = boundsMs[i-1]
+		}
+		if i < len(boundsMs) {
+			buckets[i].MaxMs = boundsMs[i]
+		}
+	}
+
+	for rows.Next() {
+		var bucket int
+		var count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if bucket < 0 || bucket >= len(buckets) {
+			return nil, fmt.Errorf("unexpected histogram bucket %d", bucket)
+		}
+		buckets[bucket].Count = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// queueTimeConditions builds the WHERE clause for a filter. Its placeholders are numbered after args,
+// which it returns extended with the filter values.
+func queueTimeConditions(filter models.QueueTimeFilter, args []any) (string, []any, error) {
+	var conditions []string
+
+	if filter.Period != "" {
+		condition, err := periodCondition("q.recorded_at", filter.Period)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if filter.Pool != "" {
+		args = append(args, filter.Pool)
+		conditions = append(conditions, fmt.Sprintf("q.runner_pool = $%d", len(args)))
+	}
+
+	if filter.Repository != "" {
+		args = append(args, filter.Repository)
+		conditions = append(conditions, fmt.Sprintf("j.repository_full_name = $%d", len(args)))
+	}
+
+	if len(filter.Labels) > 0 {
+		labels := make([]string, len(filter.Labels))
+		for i, label := range filter.Labels {
+			labels[i] = strings.ToLower(label)
+		}
+		args = append(args, pq.Array(labels))
+		conditions = append(conditions, fmt.Sprintf("ARRAY(SELECT lower(label) FROM unnest(j.labels) AS label) @> $%d::text[]", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+
+	return "\n    WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// periodCondition restricts a timestamp column to a period
+func periodCondition(column, period string) (string, error) {
+	interval, ok := periodIntervals[period]
+	if !ok {
+		return "", fmt.Errorf("invalid period %q", period)
+	}
+	return fmt.Sprintf("%s >= NOW() - INTERVAL '%s'", column, interval), nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/lib/pq"
+)
+
+func TestGetQueueTimeStats(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	columns := []string{"count", "avg", "p50", "p90", "p95", "p99", "max"}
+
+	t.Run("filtered", func(t *testing.T) {
+		mock.ExpectQuery(`FROM queue_time_durations q\s+LEFT JOIN workflow_jobs j .*WHERE q.recorded_at >= NOW\(\) - INTERVAL '1 day' AND q.runner_pool = \$1 AND j.repository_full_name = \$2 AND .* @> \$3::text\[\]`).
+			WithArgs("gpu", "octo-org/app", pq.Array([]string{"self-hosted", "gpu"})).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(40, 61000.5, 30000.0, 120000.0, 180000.0, 600000.0, 900000))
+
+		stats, err := dbWrapper.GetQueueTimeStats(ctx, models.QueueTimeFilter{
+			Period:     "day",
+			Pool:       "gpu",
+			Repository: "octo-org/app",
+			Labels:     []string{"Self-Hosted", "GPU"},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := models.QueueTimeStats{Count: 40, AvgMs: 61000, P50Ms: 30000, P90Ms: 120000, P95Ms: 180000, P99Ms: 600000, MaxMs: 900000}
+		if stats != expected {
+			t.Errorf("Expected stats %+v, got %+v", expected, stats)
+		}
+	})
+
+	t.Run("no queue times", func(t *testing.T) {
+		mock.ExpectQuery(`FROM queue_time_durations q\s+LEFT JOIN workflow_jobs j ON j.id = q.job_id AND j.created_at = q.job_created_at$`).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(0, nil, nil, nil, nil, nil, nil))
+
+		stats, err := dbWrapper.GetQueueTimeStats(ctx, models.QueueTimeFilter{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats != (models.QueueTimeStats{}) {
+			t.Errorf("Expected empty stats, got %+v", stats)
+		}
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+		if _, err := dbWrapper.GetQueueTimeStats(ctx, models.QueueTimeFilter{Period: "year"}); err == nil {
+			t.Error("Expected an error for an invalid period")
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetQueueTimeHistogram(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	mock.ExpectQuery(`width_bucket\(q.duration_ms, \$1::bigint\[\]\).*WHERE q.recorded_at >= NOW\(\) - INTERVAL '1 hour' AND q.runner_pool = \$2`).
+		WithArgs(pq.Array([]int64{60000, 300000}), "gpu").
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}).
+			AddRow(0, 12).
+			AddRow(2, 3))
+
+	buckets, err := dbWrapper.GetQueueTimeHistogram(ctx,
+		models.QueueTimeFilter{Period: "hour", Pool: "gpu"},
+		[]time.Duration{time.Minute, 5 * time.Minute},
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []models.HistogramBucket{
+		{MinMs: 0, MaxMs: 60000, Count: 12},
+		{MinMs: 60000, MaxMs: 300000, Count: 0},
+		{MinMs: 300000, Count: 3},
+	}
+	if len(buckets) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %d", len(expected), len(buckets))
+	}
+	for i := range expected {
+		if buckets[i] != expected[i] {
+			t.Errorf("Bucket %d: expected %+v, got %+v", i, expected[i], buckets[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// staleSince is the column each reapable status is aged from
+var staleSince = map[models.JobStatus]string{
+	models.JobStatusWaiting:    "COALESCE(waiting_at, created_at)",
+	models.JobStatusQueued:     "COALESCE(queued_at, created_at)",
+	models.JobStatusInProgress: "COALESCE(started_at, created_at)",
+}
+
+// ReapStaleJobs marks jobs that have been in a status for longer than maxAge as abandoned
+// and records how many were reaped. It returns the number of reaped jobs.
+func (db *DBWrapper) ReapStaleJobs(ctx context.Context, status models.JobStatus, maxAge time.Duration) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	since, ok := staleSince[status]
+	if !ok {
+		return 0, fmt.Errorf("jobs with status %q cannot be reaped", status)
+	}
+
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx,
+		"UPDATE workflow_jobs SET status = $1 WHERE status = $2 AND "+since+" < $3",
+		string(models.JobStatusAbandoned), string(status), now.Add(-maxAge),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	reaped, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if reaped > 0 {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO reaped_jobs (reaped_at, status, count) VALUES ($1, $2, $3)",
+			now, string(status), reaped,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(reaped), nil
+}
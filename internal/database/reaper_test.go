@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestReapStaleJobs(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+
+	t.Run("stale jobs are abandoned and recorded", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE workflow_jobs SET status = (.+) COALESCE\\(started_at, created_at\\)").
+			WithArgs(string(models.JobStatusAbandoned), string(models.JobStatusInProgress), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("INSERT INTO reaped_jobs").
+			WithArgs(sqlmock.AnyArg(), string(models.JobStatusInProgress), int64(3)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		reaped, err := dbWrapper.ReapStaleJobs(ctx, models.JobStatusInProgress, 5*24*time.Hour)
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if reaped != 3 {
+			t.Errorf("Expected 3 reaped jobs, got %d", reaped)
+		}
+	})
+
+	t.Run("nothing to reap is not recorded", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE workflow_jobs SET status = (.+) COALESCE\\(queued_at, created_at\\)").
+			WithArgs(string(models.JobStatusAbandoned), string(models.JobStatusQueued), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		reaped, err := dbWrapper.ReapStaleJobs(ctx, models.JobStatusQueued, 24*time.Hour)
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if reaped != 0 {
+			t.Errorf("Expected no reaped jobs, got %d", reaped)
+		}
+	})
+
+	t.Run("terminal status cannot be reaped", func(t *testing.T) {
+		if _, err := dbWrapper.ReapStaleJobs(ctx, models.JobStatusCompleted, time.Hour); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
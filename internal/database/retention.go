@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// minSourceRetention is the shortest retention of a table the rollups are built from. The rollups
+// are refreshed over the last 29 days, and a refresh over dropped chunks would clear their buckets.
+const minSourceRetention = 30 * 24 * time.Hour
+
+// pruneInterval is how often the rows of plain tables past their retention are deleted
+const pruneInterval = time.Minute
+
+// retentionClass groups the tables that share a retention. Hypertables are dropped by chunk
+// with a TimescaleDB policy, and the rows of plain tables are deleted by the application.
+type retentionClass struct {
+	name      string
+	tables    []string
+	pruned    []prunedTable
+	retention func(models.RetentionPolicies) time.Duration
+	source    bool // rolled up into a continuous aggregate
+	rollup    bool // a continuous aggregate
+}
+
+// prunedTable is a plain table and the time column its rows are aged from
+type prunedTable struct {
+	table  string
+	column string
+}
+
+var retentionClasses = []retentionClass{
+	{
+		name:      "raw",
+		tables:    []string{"historical_entries", "pool_historical_entries"},
+		retention: func(p models.RetentionPolicies) time.Duration { return p.Raw },
+		source:    true,
+	},
+	{
+		name:      "jobs",
+		tables:    []string{"workflow_jobs", "workflow_job_events", "workflow_runs", "reaped_jobs"},
+		pruned:    []prunedTable{{table: "webhook_deliveries", column: "received_at"}},
+		retention: func(p models.RetentionPolicies) time.Duration { return p.Jobs },
+	},
+	{
+		name:      "durations",
+		tables:    []string{"queue_time_durations", "approval_wait_durations"},
+		retention: func(p models.RetentionPolicies) time.Duration { return p.Durations },
+	},
+	{
+		name:      "rollup_1m",
+		tables:    []string{"runner_stats_1m", "pool_stats_1m"},
+		retention: func(p models.RetentionPolicies) time.Duration { return p.Rollup1m },
+		source:    true,
+		rollup:    true,
+	},
+	{
+		name:      "rollup_15m",
+		tables:    []string{"runner_stats_15m", "pool_stats_15m"},
+		retention: func(p models.RetentionPolicies) time.Duration { return p.Rollup15m },
+		source:    true,
+		rollup:    true,
+	},
+	{
+		name:      "rollup_1h",
+		tables:    []string{"runner_stats_1h", "pool_stats_1h"},
+		retention: func(p models.RetentionPolicies) time.Duration { return p.Rollup1h },
+		rollup:    true,
+	},
+}
+
+var retentionPoliciesQuery = `SELECT
+        COALESCE(ca.view_name, j.hypertable_name) AS table_name,
+        j.config->>'drop_after'
+    FROM timescaledb_information.jobs j
+    LEFT JOIN timescaledb_information.continuous_aggregates ca
+        ON ca.materialization_hypertable_schema = j.hypertable_schema
+        AND ca.materialization_hypertable_name = j.hypertable_name
+    WHERE j.proc_name = 'policy_retention'
+    ORDER BY table_name`
+
+// ApplyRetentionPolicies replaces the retention policy of every hypertable with the configured one
+// in a single transaction, deletes the rows of plain tables past it, and reads older ranges from
+// the rollups that still keep them
+func (db *DBWrapper) ApplyRetentionPolicies(ctx context.Context, policies models.RetentionPolicies) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	for _, class := range retentionClasses {
+		retention := class.retention(policies)
+		if retention <= 0 {
+			return fmt.Errorf("retention of %s must be positive", class.name)
+		}
+		if class.source && retention < minSourceRetention {
+			return fmt.Errorf("retention of %s must be at least %s to keep the data it is rolled up from", class.name, minSourceRetention)
+		}
+	}
+
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, class := range retentionClasses {
+		interval := RetentionInterval(class.retention(policies))
+		for _, table := range class.tables {
+			if _, err := tx.ExecContext(ctx, "SELECT remove_retention_policy($1::regclass, if_exists => true)", table); err != nil {
+				return fmt.Errorf("failed to remove retention policy of %s: %w", table, err)
+			}
+			if _, err := tx.ExecContext(ctx, "SELECT add_retention_policy($1::regclass, $2::interval)", table, interval); err != nil {
+				return fmt.Errorf("failed to add retention policy of %s: %w", table, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	db.retention = policies
+	db.mu.Unlock()
+
+	return db.prune(ctx, time.Now())
+}
+
+// pruneIfDue deletes the rows of plain tables past their retention, at most once every pruneInterval
+func (db *DBWrapper) pruneIfDue(ctx context.Context, now time.Time) error {
+	db.mu.RLock()
+	due := db.retention != (models.RetentionPolicies{}) && now.Sub(db.lastPrune) >= pruneInterval
+	db.mu.RUnlock()
+
+	if !due {
+		return nil
+	}
+	return db.prune(ctx, now)
+}
+
+// prune deletes the rows of plain tables past their retention. Nothing is deleted until
+// ApplyRetentionPolicies sets the retention.
+func (db *DBWrapper) prune(ctx context.Context, now time.Time) error {
+	db.mu.Lock()
+	db.lastPrune = now
+	policies := db.retention
+	db.mu.Unlock()
+
+	if policies == (models.RetentionPolicies{}) {
+		return nil
+	}
+
+	for _, class := range retentionClasses {
+		cutoff := now.Add(-class.retention(policies))
+		for _, t := range class.pruned {
+			if _, err := db.pool.ExecContext(ctx, "DELETE FROM "+t.table+" WHERE "+t.column+" < $1", cutoff); err != nil {
+				return fmt.Errorf("failed to prune %s: %w", t.table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// retentionPolicies returns the retention applied with ApplyRetentionPolicies, or the default one
+func (db *DBWrapper) retentionPolicies() models.RetentionPolicies {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.retention == (models.RetentionPolicies{}) {
+		return defaultRetention
+	}
+	return db.retention
+}
+
+// GetRetentionPolicies returns the retention policies in effect, with the data class of each table
+func (db *DBWrapper) GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	classes := make(map[string]string)
+	for _, class := range retentionClasses {
+		for _, table := range class.tables {
+			classes[table] = class.name
+		}
+	}
+	db.mu.RLock()
+	applied := db.retention
+	db.mu.RUnlock()
+
+	rows, err := db.pool.QueryContext(ctx, retentionPoliciesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query retention policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []models.RetentionPolicy{}
+	for rows.Next() {
+		var policy models.RetentionPolicy
+		if err := rows.Scan(&policy.Table, &policy.DropAfter); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		policy.DataClass = classes[policy.Table]
+		policies = append(policies, policy)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	// Plain tables have no TimescaleDB policy, they are pruned once the retention is applied
+	for _, class := range retentionClasses {
+		if applied == (models.RetentionPolicies{}) {
+			break
+		}
+		for _, t := range class.pruned {
+			policies = append(policies, models.RetentionPolicy{
+				Table:     t.table,
+				DataClass: class.name,
+				DropAfter: RetentionInterval(class.retention(applied)),
+			})
+		}
+	}
+
+	return policies, nil
+}
+
+// ConfiguredRetention lists the configured retention of every table. Backends without continuous
+// aggregates leave out the rollups.
+func ConfiguredRetention(policies models.RetentionPolicies, withRollups bool) []models.RetentionPolicy {
+	var configured []models.RetentionPolicy
+	for _, class := range retentionClasses {
+		if class.rollup && !withRollups {
+			continue
+		}
+		dropAfter := RetentionInterval(class.retention(policies))
+		for _, table := range class.tables {
+			configured = append(configured, models.RetentionPolicy{Table: table, DataClass: class.name, DropAfter: dropAfter})
+		}
+		for _, t := range class.pruned {
+			configured = append(configured, models.RetentionPolicy{Table: t.table, DataClass: class.name, DropAfter: dropAfter})
+		}
+	}
+	return configured
+}
+
+// RetentionInterval formats a retention as a PostgreSQL interval, in days when it is a whole number of them
+func RetentionInterval(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return fmt.Sprintf("%d seconds", d/time.Second)
+}
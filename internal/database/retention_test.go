@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+var testRetentionPolicies = models.RetentionPolicies{
+	Raw:       60 * 24 * time.Hour,
+	Jobs:      90 * 24 * time.Hour,
+	Durations: 36 * time.Hour,
+	Rollup1m:  180 * 24 * time.Hour,
+	Rollup15m: 365 * 24 * time.Hour,
+	Rollup1h:  5 * 365 * 24 * time.Hour,
+}
+
+func TestApplyRetentionPolicies(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	intervals := map[string]string{
+		"historical_entries":      "60 days",
+		"pool_historical_entries": "60 days",
+		"workflow_jobs":           "90 days",
+		"workflow_job_events":     "90 days",
+		"workflow_runs":           "90 days",
+		"reaped_jobs":             "90 days",
+		"queue_time_durations":    "129600 seconds",
+		"approval_wait_durations": "129600 seconds",
+		"runner_stats_1m":         "180 days",
+		"pool_stats_1m":           "180 days",
+		"runner_stats_15m":        "365 days",
+		"pool_stats_15m":          "365 days",
+		"runner_stats_1h":         "1825 days",
+		"pool_stats_1h":           "1825 days",
+	}
+
+	mock.ExpectBegin()
+	for _, class := range retentionClasses {
+		for _, table := range class.tables {
+			mock.ExpectExec("SELECT remove_retention_policy").WithArgs(table).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("SELECT add_retention_policy").WithArgs(table, intervals[table]).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+	}
+	mock.ExpectCommit()
+	mock.ExpectExec("DELETE FROM webhook_deliveries WHERE received_at < \\$1").WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	if err := dbWrapper.ApplyRetentionPolicies(ctx, testRetentionPolicies); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	// The configured retention only applies to this database
+	now := time.Now()
+	if got := NewDBWrapper(db, 0).StepGranularity(now.AddDate(0, 0, -45), now); got != time.Minute {
+		t.Errorf("Expected another database to keep the default retention, got a granularity of %s", got)
+	}
+	if got := dbWrapper.StepGranularity(now.AddDate(0, 0, -45), now); got != time.Second {
+		t.Errorf("Expected raw entries within the raw retention, got a granularity of %s", got)
+	}
+	if got := dbWrapper.StepGranularity(now.AddDate(-3, 0, 0), now); got != time.Hour {
+		t.Errorf("Expected the hourly rollup within its retention, got a granularity of %s", got)
+	}
+}
+
+func TestApplyRetentionPolicies_Invalid(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	testCases := []struct {
+		name   string
+		modify func(*models.RetentionPolicies)
+	}{
+		{name: "raw shorter than the rollup refresh window", modify: func(p *models.RetentionPolicies) { p.Raw = 7 * 24 * time.Hour }},
+		{name: "rollup source shorter than the refresh window", modify: func(p *models.RetentionPolicies) { p.Rollup15m = 14 * 24 * time.Hour }},
+		{name: "zero retention", modify: func(p *models.RetentionPolicies) { p.Jobs = 0 }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policies := testRetentionPolicies
+			tc.modify(&policies)
+
+			if err := dbWrapper.ApplyRetentionPolicies(ctx, policies); err == nil {
+				t.Error("Expected an error for an invalid retention")
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetRetentionPolicies(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	dbWrapper := NewDBWrapper(db, 0)
+
+	mock.ExpectQuery("FROM timescaledb_information.jobs").
+		WillReturnRows(sqlmock.NewRows([]string{"table_name", "drop_after"}).
+			AddRow("historical_entries", "30 days").
+			AddRow("runner_stats_1h", "2 years").
+			AddRow("deliveries", "7 days"))
+
+	policies, err := dbWrapper.GetRetentionPolicies(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []models.RetentionPolicy{
+		{Table: "historical_entries", DataClass: "raw", DropAfter: "30 days"},
+		{Table: "runner_stats_1h", DataClass: "rollup_1h", DropAfter: "2 years"},
+		{Table: "deliveries", DropAfter: "7 days"},
+	}
+	if len(policies) != len(expected) {
+		t.Fatalf("Expected %d policies, got %d", len(expected), len(policies))
+	}
+	for i := range expected {
+		if policies[i] != expected[i] {
+			t.Errorf("Policy %d: expected %+v, got %+v", i, expected[i], policies[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
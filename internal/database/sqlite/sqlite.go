@@ -0,0 +1,1374 @@
+// Package sqlite implements the storage in a single SQLite file using a pure-Go driver, for
+// running rpulse without a database server. Times are stored as microseconds since the epoch,
+// and time buckets, percentiles and retention are computed in Go.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/database/aggregate"
+	"github.com/gateixeira/rpulse/internal/jobstate"
+	"github.com/gateixeira/rpulse/models"
+	_ "modernc.org/sqlite"
+)
+
+// pruneInterval is how often data past its retention is deleted
+const pruneInterval = time.Minute
+
+var _ database.DatabaseInterface = (*Store)(nil)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS workflow_jobs (
+    id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    runner_type TEXT,
+    run_id INTEGER,
+    run_attempt INTEGER,
+    workflow_name TEXT,
+    job_name TEXT,
+    head_branch TEXT,
+    head_sha TEXT,
+    conclusion TEXT,
+    labels TEXT NOT NULL DEFAULT '[]',
+    runner_id INTEGER,
+    runner_name TEXT,
+    runner_group_id INTEGER,
+    runner_group_name TEXT,
+    repository_id INTEGER,
+    repository_full_name TEXT,
+    organization_id INTEGER,
+    organization_login TEXT,
+    enterprise_id INTEGER,
+    enterprise_slug TEXT,
+    created_at INTEGER NOT NULL,
+    started_at INTEGER,
+    completed_at INTEGER,
+    runner_pool TEXT,
+    waiting_at INTEGER,
+    queued_at INTEGER,
+    PRIMARY KEY (id, created_at)
+);
+
+CREATE INDEX IF NOT EXISTS workflow_jobs_status_idx ON workflow_jobs (status, runner_pool);
+CREATE INDEX IF NOT EXISTS workflow_jobs_completed_at_idx ON workflow_jobs (completed_at);
+
+CREATE TABLE IF NOT EXISTS workflow_job_events (
+    id INTEGER PRIMARY KEY,
+    job_id INTEGER NOT NULL,
+    job_created_at INTEGER NOT NULL,
+    delivery_id TEXT,
+    action TEXT NOT NULL,
+    received_at INTEGER NOT NULL,
+    started_at INTEGER,
+    completed_at INTEGER,
+    conclusion TEXT,
+    runner_id INTEGER,
+    runner_name TEXT,
+    runner_group_name TEXT,
+    UNIQUE (delivery_id, job_created_at)
+);
+
+CREATE INDEX IF NOT EXISTS workflow_job_events_job_idx ON workflow_job_events (job_id, job_created_at, received_at);
+
+CREATE TABLE IF NOT EXISTS workflow_runs (
+    id INTEGER NOT NULL,
+    run_attempt INTEGER NOT NULL,
+    workflow_id INTEGER,
+    workflow_name TEXT,
+    event TEXT,
+    status TEXT NOT NULL,
+    conclusion TEXT,
+    created_at INTEGER NOT NULL,
+    run_started_at INTEGER,
+    completed_at INTEGER,
+    duration_ms INTEGER,
+    PRIMARY KEY (id, run_attempt, created_at)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    delivery_id TEXT PRIMARY KEY,
+    event TEXT NOT NULL,
+    received_at INTEGER NOT NULL,
+    last_received_at INTEGER NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    processed INTEGER NOT NULL DEFAULT 0,
+    processed_at INTEGER,
+    payload BLOB,
+    claimed_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_received_at_idx ON webhook_deliveries (received_at, delivery_id);
+
+CREATE TABLE IF NOT EXISTS historical_entries (
+    timestamp INTEGER NOT NULL,
+    count_self_hosted INTEGER NOT NULL,
+    count_github_hosted INTEGER NOT NULL,
+    count_queued INTEGER NOT NULL,
+    peak_total INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS historical_entries_timestamp_idx ON historical_entries (timestamp);
+
+CREATE TABLE IF NOT EXISTS pool_historical_entries (
+    timestamp INTEGER NOT NULL,
+    runner_pool TEXT NOT NULL,
+    count_running INTEGER NOT NULL,
+    count_queued INTEGER NOT NULL,
+    peak_total INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS pool_historical_entries_pool_idx ON pool_historical_entries (runner_pool, timestamp);
+
+CREATE TABLE IF NOT EXISTS queue_time_durations (
+    job_id INTEGER NOT NULL,
+    job_created_at INTEGER NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    recorded_at INTEGER NOT NULL,
+    runner_pool TEXT
+);
+
+CREATE INDEX IF NOT EXISTS queue_time_durations_recorded_at_idx ON queue_time_durations (recorded_at);
+
+-- A job's duration is recorded once; copies stored before the key existed are dropped
+DELETE FROM queue_time_durations WHERE rowid NOT IN (SELECT MIN(rowid) FROM queue_time_durations GROUP BY job_id, job_created_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS queue_time_durations_job_key ON queue_time_durations (job_id, job_created_at);
+
+CREATE TABLE IF NOT EXISTS approval_wait_durations (
+    job_id INTEGER NOT NULL,
+    job_created_at INTEGER NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    recorded_at INTEGER NOT NULL,
+    runner_pool TEXT
+);
+
+CREATE INDEX IF NOT EXISTS approval_wait_durations_recorded_at_idx ON approval_wait_durations (recorded_at);
+
+-- A job's duration is recorded once; copies stored before the key existed are dropped
+DELETE FROM approval_wait_durations WHERE rowid NOT IN (SELECT MIN(rowid) FROM approval_wait_durations GROUP BY job_id, job_created_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS approval_wait_durations_job_key ON approval_wait_durations (job_id, job_created_at);
+
+CREATE TABLE IF NOT EXISTS reaped_jobs (
+    reaped_at INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    count INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scope TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER,
+    revoked_at INTEGER
+);
+`
+
+// jobColumns lists the workflow_jobs columns in the order of jobArgs and scanJob
+const jobColumns = `id, status, runner_type, run_id, run_attempt, workflow_name, job_name,
+	head_branch, head_sha, conclusion, labels, runner_id, runner_name, runner_group_id,
+	runner_group_name, repository_id, repository_full_name, organization_id, organization_login,
+	enterprise_id, enterprise_slug, created_at, started_at, completed_at, runner_pool,
+	waiting_at, queued_at`
+
+// jobEventColumns lists the workflow_job_events columns in the order of AddJobEvent and GetJobEvents
+const jobEventColumns = `job_id, job_created_at, delivery_id, action, received_at, started_at,
+	completed_at, conclusion, runner_id, runner_name, runner_group_name`
+
+// addedColumns lists the columns added after their table was created, which databases created
+// before lack
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"webhook_deliveries", "claimed_at", "INTEGER"},
+}
+
+// apiTokenColumns lists the api_tokens columns in the order of scanAPIToken
+const apiTokenColumns = "id, name, token_hash, scope, created_at, expires_at, revoked_at"
+
+// staleSince is the column each reapable status is aged from
+var staleSince = map[models.JobStatus]string{
+	models.JobStatusWaiting:    "COALESCE(waiting_at, created_at)",
+	models.JobStatusQueued:     "COALESCE(queued_at, created_at)",
+	models.JobStatusInProgress: "COALESCE(started_at, created_at)",
+}
+
+// retentionTables lists the tables pruned for each class of data and their time column
+var retentionTables = []struct {
+	table     string
+	column    string
+	retention func(models.RetentionPolicies) time.Duration
+}{
+	{"historical_entries", "timestamp", func(p models.RetentionPolicies) time.Duration { return p.Raw }},
+	{"pool_historical_entries", "timestamp", func(p models.RetentionPolicies) time.Duration { return p.Raw }},
+	{"workflow_jobs", "created_at", func(p models.RetentionPolicies) time.Duration { return p.Jobs }},
+	{"workflow_job_events", "job_created_at", func(p models.RetentionPolicies) time.Duration { return p.Jobs }},
+	{"workflow_runs", "created_at", func(p models.RetentionPolicies) time.Duration { return p.Jobs }},
+	{"reaped_jobs", "reaped_at", func(p models.RetentionPolicies) time.Duration { return p.Jobs }},
+	{"webhook_deliveries", "received_at", func(p models.RetentionPolicies) time.Duration { return p.Jobs }},
+	{"queue_time_durations", "recorded_at", func(p models.RetentionPolicies) time.Duration { return p.Durations }},
+	{"approval_wait_durations", "recorded_at", func(p models.RetentionPolicies) time.Duration { return p.Durations }},
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Store keeps the data in an SQLite database. Data past its retention is deleted when a
+// sample is recorded, at most once every pruneInterval.
+type Store struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	retention models.RetentionPolicies
+	lastPrune time.Time
+}
+
+// Open opens or creates the SQLite database at path and creates its tables
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, so all statements share one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not create tables: %w", err)
+	}
+	if err := addColumns(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not add columns: %w", err)
+	}
+
+	// Only one process uses the database, so deliveries claimed before it was opened are no
+	// longer processed and a redelivery can claim them
+	if _, err := db.Exec("UPDATE webhook_deliveries SET claimed_at = NULL WHERE claimed_at IS NOT NULL"); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not release delivery claims: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// addColumns adds the columns in addedColumns that a table lacks
+func addColumns(db *sql.DB) error {
+	for _, c := range addedColumns {
+		var exists bool
+		if err := db.QueryRow(
+			"SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?", c.table, c.column,
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + c.table + " ADD COLUMN " + c.column + " " + c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// AddOrUpdateJob merges a job event into the stored job state and returns the merged state,
+// and whether the event moved the job to a new status
+func (s *Store) AddOrUpdateJob(ctx context.Context, job models.WorkflowJob) (models.WorkflowJob, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.WorkflowJob{}, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	current, err := scanJob(tx.QueryRowContext(ctx,
+		"SELECT "+jobColumns+" FROM workflow_jobs WHERE id = ? AND created_at = ?",
+		job.ID, job.CreatedAt.UnixMicro(),
+	))
+	if err == sql.ErrNoRows {
+		current = models.WorkflowJob{}
+	} else if err != nil {
+		return models.WorkflowJob{}, false, err
+	}
+
+	merged := jobstate.Merge(current, job)
+	args, err := jobArgs(merged)
+	if err != nil {
+		return models.WorkflowJob{}, false, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT OR REPLACE INTO workflow_jobs ("+jobColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		args...,
+	); err != nil {
+		return models.WorkflowJob{}, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.WorkflowJob{}, false, err
+	}
+	return merged, merged.Status != current.Status, nil
+}
+
+// jobArgs returns the query arguments for a job in the order of jobColumns
+func jobArgs(job models.WorkflowJob) ([]any, error) {
+	labels := job.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	encoded, err := json.Marshal(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{
+		job.ID,
+		string(job.Status),
+		nullString(string(job.RunnerType)),
+		nullInt64(job.RunID),
+		nullInt64(int64(job.RunAttempt)),
+		nullString(job.WorkflowName),
+		nullString(job.Name),
+		nullString(job.HeadBranch),
+		nullString(job.HeadSHA),
+		nullString(job.Conclusion),
+		string(encoded),
+		nullInt64(job.RunnerID),
+		nullString(job.RunnerName),
+		nullInt64(job.RunnerGroupID),
+		nullString(job.RunnerGroupName),
+		nullInt64(job.Repository.ID),
+		nullString(job.Repository.FullName),
+		nullInt64(job.Organization.ID),
+		nullString(job.Organization.Login),
+		nullInt64(job.Enterprise.ID),
+		nullString(job.Enterprise.Slug),
+		job.CreatedAt.UnixMicro(),
+		nullTime(job.StartedAt),
+		nullTime(job.CompletedAt),
+		nullString(job.RunnerPool),
+		nullTime(job.WaitingAt),
+		nullTime(job.QueuedAt),
+	}, nil
+}
+
+// scanJob reads a job selected with jobColumns
+func scanJob(row rowScanner) (models.WorkflowJob, error) {
+	var job models.WorkflowJob
+	var labels string
+	var createdAt int64
+	var runnerType, runnerPool, workflowName, name, headBranch, headSHA, conclusion sql.NullString
+	var runnerName, runnerGroupName, repositoryName, organizationLogin, enterpriseSlug sql.NullString
+	var runID, runAttempt, runnerID, runnerGroupID, repositoryID, organizationID, enterpriseID sql.NullInt64
+	var waitingAt, queuedAt, startedAt, completedAt sql.NullInt64
+
+	err := row.Scan(
+		&job.ID, &job.Status, &runnerType, &runID, &runAttempt, &workflowName, &name,
+		&headBranch, &headSHA, &conclusion, &labels, &runnerID, &runnerName, &runnerGroupID,
+		&runnerGroupName, &repositoryID, &repositoryName, &organizationID, &organizationLogin,
+		&enterpriseID, &enterpriseSlug, &createdAt, &startedAt, &completedAt, &runnerPool,
+		&waitingAt, &queuedAt,
+	)
+	if err != nil {
+		return models.WorkflowJob{}, err
+	}
+
+	if err := json.Unmarshal([]byte(labels), &job.Labels); err != nil {
+		return models.WorkflowJob{}, fmt.Errorf("invalid labels of job %d: %w", job.ID, err)
+	}
+
+	job.RunnerType = models.RunnerType(runnerType.String)
+	job.RunnerPool = runnerPool.String
+	job.RunID = runID.Int64
+	job.RunAttempt = int(runAttempt.Int64)
+	job.WorkflowName = workflowName.String
+	job.Name = name.String
+	job.HeadBranch = headBranch.String
+	job.HeadSHA = headSHA.String
+	job.Conclusion = conclusion.String
+	job.RunnerID = runnerID.Int64
+	job.RunnerName = runnerName.String
+	job.RunnerGroupID = runnerGroupID.Int64
+	job.RunnerGroupName = runnerGroupName.String
+	job.Repository = models.Repository{ID: repositoryID.Int64, FullName: repositoryName.String}
+	job.Organization = models.Organization{ID: organizationID.Int64, Login: organizationLogin.String}
+	job.Enterprise = models.Enterprise{ID: enterpriseID.Int64, Slug: enterpriseSlug.String}
+	job.CreatedAt = time.UnixMicro(createdAt).UTC()
+	job.WaitingAt = fromMicros(waitingAt)
+	job.QueuedAt = fromMicros(queuedAt)
+	job.StartedAt = fromMicros(startedAt)
+	job.CompletedAt = fromMicros(completedAt)
+
+	return job, nil
+}
+
+// CountQueuedJobs returns the count of queued jobs
+func (s *Store) CountQueuedJobs(ctx context.Context) (int, error) {
+	return s.countJobs(ctx, models.JobStatusQueued)
+}
+
+// CountWaitingJobs returns the count of jobs waiting on deployment protection rules
+func (s *Store) CountWaitingJobs(ctx context.Context) (int, error) {
+	return s.countJobs(ctx, models.JobStatusWaiting)
+}
+
+func (s *Store) countJobs(ctx context.Context, status models.JobStatus) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM workflow_jobs WHERE status = ?", string(status)).Scan(&count)
+	return count, err
+}
+
+// GetRunningJobs returns all running workflow jobs of a specific type
+func (s *Store) GetRunningJobs(ctx context.Context, runnerType models.RunnerType) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id FROM workflow_jobs WHERE runner_type = ? AND status = ?",
+		string(runnerType), string(models.JobStatusInProgress),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var IDs []string
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		IDs = append(IDs, strconv.FormatInt(id, 10))
+	}
+
+	return IDs, rows.Err()
+}
+
+// CountQueuedJobsByPool returns the count of queued jobs in each runner pool
+func (s *Store) CountQueuedJobsByPool(ctx context.Context) (map[string]int, error) {
+	return s.countJobsByPool(ctx, models.JobStatusQueued)
+}
+
+// CountWaitingJobsByPool returns the count of jobs waiting on deployment protection rules in each runner pool
+func (s *Store) CountWaitingJobsByPool(ctx context.Context) (map[string]int, error) {
+	return s.countJobsByPool(ctx, models.JobStatusWaiting)
+}
+
+// CountRunningJobsByPool returns the count of running jobs in each runner pool
+func (s *Store) CountRunningJobsByPool(ctx context.Context) (map[string]int, error) {
+	return s.countJobsByPool(ctx, models.JobStatusInProgress)
+}
+
+func (s *Store) countJobsByPool(ctx context.Context, status models.JobStatus) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT runner_pool, COUNT(*) FROM workflow_jobs WHERE status = ? AND runner_pool IS NOT NULL GROUP BY runner_pool",
+		string(status),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var pool string
+		var count int
+		if err := rows.Scan(&pool, &count); err != nil {
+			return nil, err
+		}
+		counts[pool] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// AddQueueTimeDuration records how long a job was queued, at the time it started. A job that already
+// has one keeps it.
+func (s *Store) AddQueueTimeDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	return s.addDuration(ctx, "queue_time_durations", ID, createdAt, pool, duration, recordedAt)
+}
+
+// AddApprovalWaitDuration records how long a job waited for deployment protection rules, at the time it was approved
+func (s *Store) AddApprovalWaitDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	return s.addDuration(ctx, "approval_wait_durations", ID, createdAt, pool, duration, recordedAt)
+}
+
+// addDuration adds a job's duration to a durations table unless the job already has one there,
+// and reports whether it did
+func (s *Store) addDuration(ctx context.Context, table string, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO "+table+" (job_id, job_created_at, duration_ms, recorded_at, runner_pool) VALUES (?, ?, ?, ?, ?)",
+		ID, createdAt.UnixMicro(), duration.Milliseconds(), recordedAt.UnixMicro(), nullString(pool),
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// GetAverageApprovalWaitTime calculates and returns the average approval wait time of the jobs approved in a period
+func (s *Store) GetAverageApprovalWaitTime(ctx context.Context, period string) (time.Duration, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var avgMilliseconds sql.NullFloat64
+	if err := s.db.QueryRowContext(ctx,
+		"SELECT AVG(duration_ms) FROM approval_wait_durations WHERE recorded_at >= ?", since.UnixMicro(),
+	).Scan(&avgMilliseconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(int64(avgMilliseconds.Float64)) * time.Millisecond, nil
+}
+
+// GetAverageQueueTimeByPool calculates the average queue time of each runner pool over the jobs started in a period
+func (s *Store) GetAverageQueueTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	return s.averageDurationByPool(ctx, "queue_time_durations", period)
+}
+
+// GetAverageApprovalWaitTimeByPool calculates the average approval wait time of each runner pool over the jobs
+// approved in a period
+func (s *Store) GetAverageApprovalWaitTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	return s.averageDurationByPool(ctx, "approval_wait_durations", period)
+}
+
+func (s *Store) averageDurationByPool(ctx context.Context, table, period string) (map[string]time.Duration, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT runner_pool, AVG(duration_ms) FROM "+table+" WHERE runner_pool IS NOT NULL AND recorded_at >= ? GROUP BY runner_pool",
+		since.UnixMicro(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	averages := make(map[string]time.Duration)
+	for rows.Next() {
+		var pool string
+		var avgMilliseconds float64
+		if err := rows.Scan(&pool, &avgMilliseconds); err != nil {
+			return nil, err
+		}
+		averages[pool] = time.Duration(int64(avgMilliseconds)) * time.Millisecond
+	}
+
+	return averages, rows.Err()
+}
+
+// GetQueueTimeStats returns the count, average, percentiles and maximum of the queue times matching the filter
+func (s *Store) GetQueueTimeStats(ctx context.Context, filter models.QueueTimeFilter) (models.QueueTimeStats, error) {
+	durations, err := s.queueTimesMatching(ctx, filter)
+	if err != nil {
+		return models.QueueTimeStats{}, err
+	}
+	return aggregate.QueueTimeStats(durations), nil
+}
+
+// GetQueueTimeHistogram counts the queue times matching the filter in buckets split at the given ascending bounds
+func (s *Store) GetQueueTimeHistogram(ctx context.Context, filter models.QueueTimeFilter, bounds []time.Duration) ([]models.HistogramBucket, error) {
+	durations, err := s.queueTimesMatching(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate.Histogram(durations, bounds), nil
+}
+
+func (s *Store) queueTimesMatching(ctx context.Context, filter models.QueueTimeFilter) ([]time.Duration, error) {
+	var since time.Time
+	if filter.Period != "" {
+		var err error
+		if since, err = aggregate.PeriodStart(filter.Period, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT q.duration_ms, q.recorded_at, q.runner_pool, j.repository_full_name, j.labels
+		FROM queue_time_durations q
+		LEFT JOIN workflow_jobs j ON j.id = q.job_id AND j.created_at = q.job_created_at
+		WHERE q.recorded_at >= ?`,
+		since.UnixMicro(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue times: %w", err)
+	}
+	defer rows.Close()
+
+	var durations []time.Duration
+	for rows.Next() {
+		var durationMs, recordedAt int64
+		var pool, repository, labels sql.NullString
+		if err := rows.Scan(&durationMs, &recordedAt, &pool, &repository, &labels); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		job := models.WorkflowJob{Repository: models.Repository{FullName: repository.String}}
+		if labels.Valid {
+			if err := json.Unmarshal([]byte(labels.String), &job.Labels); err != nil {
+				return nil, fmt.Errorf("invalid job labels: %w", err)
+			}
+		}
+
+		if aggregate.QueueTimeMatches(filter, since, time.UnixMicro(recordedAt), pool.String, job) {
+			durations = append(durations, time.Duration(durationMs)*time.Millisecond)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return durations, nil
+}
+
+// GetJobDurationStats returns the run duration aggregates of completed jobs matching the filter, grouped by
+// pool, repository, workflow or job. The groups that used the most runner minutes come first.
+func (s *Store) GetJobDurationStats(ctx context.Context, groupBy string, filter models.JobDurationFilter, limit int) ([]models.JobDurationStats, error) {
+	jobs, err := s.completedJobs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate.JobDurationStats(jobs, groupBy, limit)
+}
+
+// GetLongestJobs returns the completed jobs matching the filter that ran the longest
+func (s *Store) GetLongestJobs(ctx context.Context, filter models.JobDurationFilter, limit int) ([]models.JobDuration, error) {
+	jobs, err := s.completedJobs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate.LongestJobs(jobs, limit), nil
+}
+
+func (s *Store) completedJobs(ctx context.Context, filter models.JobDurationFilter) ([]models.JobDuration, error) {
+	var since time.Time
+	if filter.Period != "" {
+		var err error
+		if since, err = aggregate.PeriodStart(filter.Period, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+jobColumns+" FROM workflow_jobs WHERE status = ? AND started_at IS NOT NULL AND completed_at >= ?",
+		string(models.JobStatusCompleted), since.UnixMicro(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query completed jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.JobDuration
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if duration, ok := aggregate.CompletedJob(job); ok && aggregate.JobDurationMatches(filter, since, duration) {
+			jobs = append(jobs, duration)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ListJobs returns a page of the jobs matching the filter in the order it selects. The
+// columns with an index or an exact value are filtered in SQL, and the rest in Go.
+func (s *Store) ListJobs(ctx context.Context, filter models.JobFilter) ([]models.WorkflowJob, error) {
+	var conditions []string
+	var args []any
+	for _, field := range []struct {
+		column string
+		value  string
+	}{
+		{"status", string(filter.Status)},
+		{"runner_pool", filter.Pool},
+		{"repository_full_name", filter.Repository},
+		{"workflow_name", filter.Workflow},
+	} {
+		if field.value != "" {
+			conditions = append(conditions, field.column+" = ?")
+			args = append(args, field.value)
+		}
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.UnixMicro())
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.CreatedTo.UnixMicro())
+	}
+
+	query := "SELECT " + jobColumns + " FROM workflow_jobs"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.WorkflowJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return aggregate.ListJobs(jobs, filter), nil
+}
+
+// GetJob returns the job with the given ID and reports whether it is stored. Should two stored
+// jobs share the ID, the most recently created is returned.
+func (s *Store) GetJob(ctx context.Context, id int64) (models.WorkflowJob, bool, error) {
+	job, err := scanJob(s.db.QueryRowContext(ctx,
+		"SELECT "+jobColumns+" FROM workflow_jobs WHERE id = ? ORDER BY created_at DESC LIMIT 1", id,
+	))
+	if err == sql.ErrNoRows {
+		return models.WorkflowJob{}, false, nil
+	}
+	if err != nil {
+		return models.WorkflowJob{}, false, fmt.Errorf("failed to query job: %w", err)
+	}
+	return job, true, nil
+}
+
+// AddJobEvent records a workflow_job event received for a job. An event from a delivery already
+// recorded for the job is ignored.
+func (s *Store) AddJobEvent(ctx context.Context, event models.JobEvent) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO workflow_job_events ("+jobEventColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.JobID, event.JobCreatedAt.UnixMicro(), nullString(event.DeliveryID), event.Action,
+		event.ReceivedAt.UnixMicro(), nullTime(event.StartedAt), nullTime(event.CompletedAt),
+		nullString(event.Conclusion), nullInt64(event.RunnerID), nullString(event.RunnerName),
+		nullString(event.RunnerGroupName),
+	)
+	return err
+}
+
+// GetJobEvents returns the events received for a job in the order they arrived
+func (s *Store) GetJobEvents(ctx context.Context, id int64, createdAt time.Time) ([]models.JobEvent, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+jobEventColumns+` FROM workflow_job_events
+		WHERE job_id = ? AND job_created_at = ?
+		ORDER BY received_at, id`,
+		id, createdAt.UnixMicro(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.JobEvent{}
+	for rows.Next() {
+		var event models.JobEvent
+		var jobCreatedAt, receivedAt int64
+		var deliveryID, conclusion, runnerName, runnerGroupName sql.NullString
+		var runnerID, startedAt, completedAt sql.NullInt64
+		if err := rows.Scan(
+			&event.JobID, &jobCreatedAt, &deliveryID, &event.Action, &receivedAt, &startedAt,
+			&completedAt, &conclusion, &runnerID, &runnerName, &runnerGroupName,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		event.JobCreatedAt = time.UnixMicro(jobCreatedAt).UTC()
+		event.DeliveryID = deliveryID.String
+		event.ReceivedAt = time.UnixMicro(receivedAt).UTC()
+		event.StartedAt = fromMicros(startedAt)
+		event.CompletedAt = fromMicros(completedAt)
+		event.Conclusion = conclusion.String
+		event.RunnerID = runnerID.Int64
+		event.RunnerName = runnerName.String
+		event.RunnerGroupName = runnerGroupName.String
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// AddHistoricalEntry records a runner demand sample
+func (s *Store) AddHistoricalEntry(ctx context.Context, entry models.HistoricalEntry) error {
+	t, err := time.Parse(time.RFC3339, entry.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q: %w", entry.Timestamp, err)
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		"INSERT INTO historical_entries (timestamp, count_self_hosted, count_github_hosted, count_queued, peak_total) VALUES (?, ?, ?, ?, ?)",
+		t.UnixMicro(), entry.CountSelfHosted, entry.CountGitHubHosted, entry.CountQueued, entry.PeakTotal,
+	); err != nil {
+		return err
+	}
+
+	return s.pruneIfDue(ctx, time.Now())
+}
+
+// AddPoolHistoricalEntries adds one demand sample per runner pool in a single transaction
+func (s *Store) AddPoolHistoricalEntries(ctx context.Context, entries []models.PoolHistoricalEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, entry := range entries {
+		t, err := time.Parse(time.RFC3339, entry.Timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q: %w", entry.Timestamp, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO pool_historical_entries (timestamp, runner_pool, count_running, count_queued, peak_total) VALUES (?, ?, ?, ?, ?)",
+			t.UnixMicro(), entry.Pool, entry.CountRunning, entry.CountQueued, entry.PeakTotal,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetHistoricalDataByPeriod returns the samples of the last hour, or longer periods in buckets
+func (s *Store) GetHistoricalDataByPeriod(ctx context.Context, period string) ([]models.HistoricalEntry, error) {
+	now := time.Now()
+	if period != "hour" {
+		r, err := aggregate.PeriodRange(period, now)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetHistoricalDataByRange(ctx, r)
+	}
+
+	samples, err := s.samples(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []models.HistoricalEntry
+	for _, sample := range samples {
+		entry := sample.Entry
+		entry.Timestamp = aggregate.Timestamp(sample.Time)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetHistoricalDataByRange returns the samples of a time range averaged in buckets of its step
+func (s *Store) GetHistoricalDataByRange(ctx context.Context, r models.TimeRange) ([]models.HistoricalEntry, error) {
+	samples, err := s.samples(ctx, r.From, r.To)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate.History(samples, r), nil
+}
+
+// samples reads the runner demand samples from from up to, but excluding, to
+func (s *Store) samples(ctx context.Context, from, to time.Time) ([]aggregate.Sample, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT timestamp, count_self_hosted, count_github_hosted, count_queued, peak_total
+		FROM historical_entries
+		WHERE timestamp >= ? AND timestamp < ?
+		ORDER BY timestamp`,
+		from.UnixMicro(), to.UnixMicro(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query historical data: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []aggregate.Sample
+	for rows.Next() {
+		var timestamp int64
+		var entry models.HistoricalEntry
+		if err := rows.Scan(&timestamp, &entry.CountSelfHosted, &entry.CountGitHubHosted, &entry.CountQueued, &entry.PeakTotal); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		samples = append(samples, aggregate.Sample{Time: time.UnixMicro(timestamp).UTC(), Entry: entry})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return samples, nil
+}
+
+// CalculatePeakDemand returns the peak demand and its timestamp for the given period
+func (s *Store) CalculatePeakDemand(ctx context.Context, period string) (int, string, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return 0, "", err
+	}
+
+	return scanPeak(s.db.QueryRowContext(ctx,
+		"SELECT peak_total, timestamp FROM historical_entries WHERE timestamp >= ? ORDER BY peak_total DESC, timestamp LIMIT 1",
+		since.UnixMicro(),
+	))
+}
+
+// GetPoolHistoricalDataByPeriod returns the samples of a runner pool of the last hour, or longer periods in buckets
+func (s *Store) GetPoolHistoricalDataByPeriod(ctx context.Context, period, pool string) ([]models.PoolHistoricalEntry, error) {
+	now := time.Now()
+	if period != "hour" {
+		r, err := aggregate.PeriodRange(period, now)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetPoolHistoricalDataByRange(ctx, r, pool)
+	}
+
+	samples, err := s.poolSamples(ctx, pool, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []models.PoolHistoricalEntry
+	for _, sample := range samples {
+		entry := sample.Entry
+		entry.Timestamp = aggregate.Timestamp(sample.Time)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetPoolHistoricalDataByRange returns the samples of a runner pool for a time range averaged in buckets of its step
+func (s *Store) GetPoolHistoricalDataByRange(ctx context.Context, r models.TimeRange, pool string) ([]models.PoolHistoricalEntry, error) {
+	samples, err := s.poolSamples(ctx, pool, r.From, r.To)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate.PoolHistory(samples, pool, r), nil
+}
+
+// poolSamples reads the demand samples of a runner pool from from up to, but excluding, to
+func (s *Store) poolSamples(ctx context.Context, pool string, from, to time.Time) ([]aggregate.PoolSample, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT timestamp, count_running, count_queued, peak_total
+		FROM pool_historical_entries
+		WHERE runner_pool = ? AND timestamp >= ? AND timestamp < ?
+		ORDER BY timestamp`,
+		pool, from.UnixMicro(), to.UnixMicro(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool historical data: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []aggregate.PoolSample
+	for rows.Next() {
+		var timestamp int64
+		entry := models.PoolHistoricalEntry{Pool: pool}
+		if err := rows.Scan(&timestamp, &entry.CountRunning, &entry.CountQueued, &entry.PeakTotal); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		samples = append(samples, aggregate.PoolSample{Time: time.UnixMicro(timestamp).UTC(), Entry: entry})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return samples, nil
+}
+
+// CalculatePeakDemandByPool returns the peak demand of a runner pool and its timestamp for the given period
+func (s *Store) CalculatePeakDemandByPool(ctx context.Context, period, pool string) (int, string, error) {
+	since, err := aggregate.PeriodStart(period, time.Now())
+	if err != nil {
+		return 0, "", err
+	}
+
+	return scanPeak(s.db.QueryRowContext(ctx,
+		"SELECT peak_total, timestamp FROM pool_historical_entries WHERE runner_pool = ? AND timestamp >= ? ORDER BY peak_total DESC, timestamp LIMIT 1",
+		pool, since.UnixMicro(),
+	))
+}
+
+// scanPeak reads a peak and its timestamp, treating no data as a peak of zero
+func scanPeak(row *sql.Row) (int, string, error) {
+	var peak int
+	var timestamp int64
+	err := row.Scan(&peak, &timestamp)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	return peak, aggregate.Timestamp(time.UnixMicro(timestamp)), nil
+}
+
+// AddOrUpdateWorkflowRun adds or updates a workflow run attempt
+func (s *Store) AddOrUpdateWorkflowRun(ctx context.Context, run models.WorkflowRun) error {
+	var durationMs sql.NullInt64
+	if run.Duration != 0 {
+		durationMs = sql.NullInt64{Int64: run.Duration.Milliseconds(), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO workflow_runs (id, run_attempt, workflow_id, workflow_name, event, status, conclusion,
+			created_at, run_started_at, completed_at, duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, run.RunAttempt, run.WorkflowID, run.WorkflowName, run.Event, run.Status,
+		nullString(run.Conclusion), run.CreatedAt.UnixMicro(), nullTime(run.RunStartedAt), nullTime(run.CompletedAt),
+		durationMs,
+	)
+	return err
+}
+
+// RecordDelivery logs a webhook delivery by its GUID with its payload and reports whether the
+// caller claimed it for processing. A redelivery only claims it when it is not processed and not
+// claimed within database.DeliveryClaimTimeout, otherwise it only bumps the attempt counter.
+func (s *Store) RecordDelivery(ctx context.Context, deliveryID, event string, payload []byte, receivedAt time.Time) (bool, error) {
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO webhook_deliveries (delivery_id, event, received_at, last_received_at, payload, claimed_at)
+		VALUES (?1, ?2, ?3, ?3, ?4, ?3)
+		ON CONFLICT (delivery_id) DO UPDATE SET
+			attempts = webhook_deliveries.attempts + 1,
+			last_received_at = excluded.last_received_at,
+			payload = COALESCE(webhook_deliveries.payload, excluded.payload),
+			claimed_at = excluded.claimed_at
+		WHERE NOT webhook_deliveries.processed
+			AND (webhook_deliveries.claimed_at IS NULL OR webhook_deliveries.claimed_at < ?5)
+		RETURNING delivery_id`,
+		deliveryID, event, receivedAt.UnixMicro(), payload, receivedAt.Add(-database.DeliveryClaimTimeout).UnixMicro(),
+	).Scan(&deliveryID)
+	if err == nil {
+		return true, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	// The delivery is processed or in flight, the redelivery is only counted
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET
+			attempts = attempts + 1,
+			last_received_at = ?,
+			payload = COALESCE(payload, ?)
+		WHERE delivery_id = ?`,
+		receivedAt.UnixMicro(), payload, deliveryID,
+	)
+	return false, err
+}
+
+// ReleaseDelivery gives up the claim on a delivery that could not be processed, so a redelivery
+// processes it again
+func (s *Store) ReleaseDelivery(ctx context.Context, deliveryID string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET claimed_at = NULL WHERE delivery_id = ? AND NOT processed",
+		deliveryID,
+	)
+	return err
+}
+
+// MarkDeliveryProcessed flags a webhook delivery as successfully processed
+func (s *Store) MarkDeliveryProcessed(ctx context.Context, deliveryID string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET processed = 1, processed_at = ? WHERE delivery_id = ?",
+		time.Now().UnixMicro(), deliveryID,
+	)
+	return err
+}
+
+// GetDeliveries lists the deliveries stored with a payload that match the filter
+func (s *Store) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	conditions := []string{"payload IS NOT NULL"}
+	var args []any
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "received_at >= ?")
+		args = append(args, filter.From.UnixMicro())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "received_at < ?")
+		args = append(args, filter.To.UnixMicro())
+	}
+	if filter.Unprocessed {
+		conditions = append(conditions, "NOT processed")
+	}
+	if filter.AfterID != "" {
+		conditions = append(conditions, "(received_at, delivery_id) > (?, ?)")
+		args = append(args, filter.AfterReceivedAt.UnixMicro(), filter.AfterID)
+	}
+
+	query := `SELECT delivery_id, event, payload, received_at, attempts, processed
+		FROM webhook_deliveries
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY received_at, delivery_id`
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var receivedAt int64
+		if err := rows.Scan(&d.ID, &d.Event, &d.Payload, &receivedAt, &d.Attempts, &d.Processed); err != nil {
+			return nil, err
+		}
+		d.ReceivedAt = time.UnixMicro(receivedAt).UTC()
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ReapStaleJobs marks jobs that have been in a status for longer than maxAge as abandoned
+// and records how many were reaped. It returns the number of reaped jobs.
+func (s *Store) ReapStaleJobs(ctx context.Context, status models.JobStatus, maxAge time.Duration) (int, error) {
+	since, ok := staleSince[status]
+	if !ok {
+		return 0, fmt.Errorf("jobs with status %q cannot be reaped", status)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx,
+		"UPDATE workflow_jobs SET status = ? WHERE status = ? AND "+since+" < ?",
+		string(models.JobStatusAbandoned), string(status), now.Add(-maxAge).UnixMicro(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	reaped, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if reaped > 0 {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO reaped_jobs (reaped_at, status, count) VALUES (?, ?, ?)",
+			now.UnixMicro(), string(status), reaped,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(reaped), nil
+}
+
+// ApplyRetentionPolicies sets how long each class of data is kept and deletes what is past it.
+// There are no rollups, so history is kept for the raw retention.
+func (s *Store) ApplyRetentionPolicies(ctx context.Context, policies models.RetentionPolicies) error {
+	for _, class := range []struct {
+		name      string
+		retention time.Duration
+	}{{"raw", policies.Raw}, {"jobs", policies.Jobs}, {"durations", policies.Durations}} {
+		if class.retention <= 0 {
+			return fmt.Errorf("retention of %s must be positive", class.name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retention = policies
+	return s.prune(ctx, time.Now())
+}
+
+// GetRetentionPolicies returns the configured retention of every table
+func (s *Store) GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.retention == (models.RetentionPolicies{}) {
+		return []models.RetentionPolicy{}, nil
+	}
+	return database.ConfiguredRetention(s.retention, false), nil
+}
+
+// StepGranularity returns a second: every range is read from the raw samples
+func (s *Store) StepGranularity(from, now time.Time) time.Duration {
+	return time.Second
+}
+
+// CreateAPIToken stores a new API token
+func (s *Store) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO api_tokens ("+apiTokenColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		token.ID, token.Name, token.Hash, token.Scope, token.CreatedAt.UnixMicro(), nullTime(token.ExpiresAt), nullTime(token.RevokedAt),
+	)
+	return err
+}
+
+// GetAPIToken returns the API token with the given secret hash and reports whether it exists
+func (s *Store) GetAPIToken(ctx context.Context, hash string) (models.APIToken, bool, error) {
+	token, err := scanAPIToken(s.db.QueryRowContext(ctx,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = ?", hash,
+	))
+	if err == sql.ErrNoRows {
+		return models.APIToken{}, false, nil
+	}
+	if err != nil {
+		return models.APIToken{}, false, err
+	}
+
+	return token, true, nil
+}
+
+// ListAPITokens returns every API token, revoked and expired ones included, oldest first
+func (s *Store) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes an API token and reports whether it exists. Revoking a token again
+// keeps the time it was first revoked.
+func (s *Store) RevokeAPIToken(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE api_tokens SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?",
+		revokedAt.UnixMicro(), id,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// scanAPIToken reads a token selected with apiTokenColumns
+func scanAPIToken(row rowScanner) (models.APIToken, error) {
+	var token models.APIToken
+	var createdAt int64
+	var expiresAt, revokedAt sql.NullInt64
+	if err := row.Scan(&token.ID, &token.Name, &token.Hash, &token.Scope, &createdAt, &expiresAt, &revokedAt); err != nil {
+		return models.APIToken{}, err
+	}
+	token.CreatedAt = time.UnixMicro(createdAt).UTC()
+	token.ExpiresAt = fromMicros(expiresAt)
+	token.RevokedAt = fromMicros(revokedAt)
+	return token, nil
+}
+
+func (s *Store) pruneIfDue(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPrune) < pruneInterval {
+		return nil
+	}
+	return s.prune(ctx, now)
+}
+
+// prune deletes the data past its retention. Webhook deliveries are kept as long as jobs,
+// and job events as long as their job.
+func (s *Store) prune(ctx context.Context, now time.Time) error {
+	s.lastPrune = now
+	if s.retention == (models.RetentionPolicies{}) {
+		return nil
+	}
+
+	for _, t := range retentionTables {
+		if _, err := s.db.ExecContext(ctx,
+			"DELETE FROM "+t.table+" WHERE "+t.column+" < ?",
+			now.Add(-t.retention(s.retention)).UnixMicro(),
+		); err != nil {
+			return fmt.Errorf("failed to prune %s: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+// nullString maps an empty string to SQL NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt64 maps zero to SQL NULL
+func nullInt64(i int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: i, Valid: i != 0}
+}
+
+// nullTime maps the zero time to SQL NULL and other times to microseconds since the epoch
+func nullTime(t time.Time) sql.NullInt64 {
+	return sql.NullInt64{Int64: t.UnixMicro(), Valid: !t.IsZero()}
+}
+
+// fromMicros maps SQL NULL to the zero time
+func fromMicros(v sql.NullInt64) time.Time {
+	if !v.Valid {
+		return time.Time{}
+	}
+	return time.UnixMicro(v.Int64).UTC()
+}
@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/database/storetest"
+)
+
+func newStore(t *testing.T) database.DatabaseInterface {
+	store, err := Open(filepath.Join(t.TempDir(), "rpulse.db"))
+	if err != nil {
+		t.Fatalf("Expected no error opening the database, got %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, newStore)
+}
+
+func TestRetention(t *testing.T) {
+	storetest.RunRetention(t, newStore)
+}
+
+func TestOpenExisting(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rpulse.db")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.RecordDelivery(ctx, "guid-1", "workflow_job", nil, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Expected no error closing the database, got %v", err)
+	}
+
+	// Reopening keeps the stored data and releases the deliveries claimed before
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error reopening the database, got %v", err)
+	}
+	defer store.Close()
+
+	if process, err := store.RecordDelivery(ctx, "guid-1", "workflow_job", nil, time.Now()); err != nil || !process {
+		t.Errorf("Expected the unprocessed delivery to be kept, got %v (%v)", process, err)
+	}
+}
+
+func TestOpenAddsColumns(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rpulse.db")
+
+	// A database created before deliveries were claimed
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE webhook_deliveries (
+		delivery_id TEXT PRIMARY KEY,
+		event TEXT NOT NULL,
+		received_at INTEGER NOT NULL,
+		last_received_at INTEGER NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 1,
+		processed INTEGER NOT NULL DEFAULT 0,
+		processed_at INTEGER,
+		payload BLOB
+	)`); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error opening the database, got %v", err)
+	}
+	defer store.Close()
+
+	if process, err := store.RecordDelivery(ctx, "guid-1", "workflow_job", nil, time.Now()); err != nil || !process {
+		t.Errorf("Expected the delivery to be claimed, got %v (%v)", process, err)
+	}
+}
@@ -0,0 +1,1136 @@
+// Package storetest is a conformance suite for storage backends. It drives a backend through
+// the job lifecycles and demand samples the ingest pipeline produces and checks the counts,
+// averages, peaks and period queries the dashboard and API read back.
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/jobstate"
+	"github.com/gateixeira/rpulse/models"
+)
+
+// Run runs the conformance tests against fresh, empty stores returned by newStore
+func Run(t *testing.T, newStore func(t *testing.T) database.DatabaseInterface) {
+	t.Run("lifecycle", func(t *testing.T) { testLifecycle(t, newStore(t)) })
+	t.Run("out of order events", func(t *testing.T) { testOutOfOrder(t, newStore(t)) })
+	t.Run("redelivered events", func(t *testing.T) { testRedelivered(t, newStore(t)) })
+	t.Run("re-run jobs", func(t *testing.T) { testRerun(t, newStore(t)) })
+	t.Run("periods", func(t *testing.T) { testPeriods(t, newStore(t)) })
+	t.Run("jobs", func(t *testing.T) { testJobs(t, newStore(t)) })
+	t.Run("queue times", func(t *testing.T) { testQueueTimes(t, newStore(t)) })
+	t.Run("job durations", func(t *testing.T) { testJobDurations(t, newStore(t)) })
+	t.Run("job listing", func(t *testing.T) { testListJobs(t, newStore(t)) })
+	t.Run("job events", func(t *testing.T) { testJobEvents(t, newStore(t)) })
+	t.Run("history", func(t *testing.T) { testHistory(t, newStore(t)) })
+	t.Run("pool history", func(t *testing.T) { testPoolHistory(t, newStore(t)) })
+	t.Run("deliveries", func(t *testing.T) { testDeliveries(t, newStore(t)) })
+	t.Run("concurrent deliveries", func(t *testing.T) { testConcurrentDeliveries(t, newStore(t)) })
+	t.Run("delivery retention", func(t *testing.T) { testDeliveryRetention(t, newStore(t)) })
+	t.Run("api tokens", func(t *testing.T) { testAPITokens(t, newStore(t)) })
+	t.Run("reaper", func(t *testing.T) { testReaper(t, newStore(t)) })
+}
+
+// RunRetention tests the retention of backends that prune expired data themselves rather than
+// through TimescaleDB policies
+func RunRetention(t *testing.T, newStore func(t *testing.T) database.DatabaseInterface) {
+	testRetention(t, newStore(t))
+}
+
+func addJob(t *testing.T, db database.DatabaseInterface, job models.WorkflowJob) models.WorkflowJob {
+	t.Helper()
+	ctx := context.Background()
+	merged, _, err := db.AddOrUpdateJob(ctx, job)
+	if err != nil {
+		t.Fatalf("Expected no error adding job %d, got %v", job.ID, err)
+	}
+	return merged
+}
+
+// deliver stores a workflow_job event received at receivedAt the way the ingest processor
+// does, recording the queue time and approval wait once the job starts
+func deliver(t *testing.T, db database.DatabaseInterface, job models.WorkflowJob, receivedAt time.Time) models.WorkflowJob {
+	t.Helper()
+	ctx := context.Background()
+	switch job.Status {
+	case models.JobStatusWaiting:
+		job.WaitingAt = receivedAt
+	case models.JobStatusQueued:
+		job.QueuedAt = receivedAt
+	}
+
+	merged := addJob(t, db, job)
+	if job.Status != models.JobStatusInProgress {
+		return merged
+	}
+
+	if _, err := db.AddQueueTimeDuration(ctx, merged.ID, merged.CreatedAt, merged.RunnerPool, jobstate.QueueTime(merged), merged.StartedAt); err != nil {
+		t.Fatalf("Expected no error adding queue time, got %v", err)
+	}
+	if wait, ok := jobstate.ApprovalWait(merged); ok {
+		if _, err := db.AddApprovalWaitDuration(ctx, merged.ID, merged.CreatedAt, merged.RunnerPool, wait, merged.QueuedAt); err != nil {
+			t.Fatalf("Expected no error adding approval wait, got %v", err)
+		}
+	}
+	return merged
+}
+
+// event returns a workflow_job event of a job in a status
+func event(job models.WorkflowJob, status models.JobStatus, startedAt, completedAt time.Time) models.WorkflowJob {
+	job.Status = status
+	job.StartedAt = startedAt
+	job.CompletedAt = completedAt
+	if status == models.JobStatusCompleted {
+		job.Conclusion = "success"
+	}
+	return job
+}
+
+// counts are the live job counts shown on the dashboard
+type counts struct {
+	queued, waiting, running int
+	queuedByPool             map[string]int
+	runningByPool            map[string]int
+}
+
+func expectCounts(t *testing.T, step string, db database.DatabaseInterface, expected counts) {
+	t.Helper()
+	ctx := context.Background()
+
+	queued, err := db.CountQueuedJobs(ctx)
+	if err != nil || queued != expected.queued {
+		t.Errorf("%s: expected %d queued jobs, got %d (%v)", step, expected.queued, queued, err)
+	}
+	waiting, err := db.CountWaitingJobs(ctx)
+	if err != nil || waiting != expected.waiting {
+		t.Errorf("%s: expected %d waiting jobs, got %d (%v)", step, expected.waiting, waiting, err)
+	}
+
+	selfHosted, err := db.GetRunningJobs(ctx, models.RunnerTypeSelfHosted)
+	if err != nil {
+		t.Fatalf("%s: expected no error, got %v", step, err)
+	}
+	githubHosted, err := db.GetRunningJobs(ctx, models.RunnerTypeGitHubHosted)
+	if err != nil {
+		t.Fatalf("%s: expected no error, got %v", step, err)
+	}
+	if running := len(selfHosted) + len(githubHosted); running != expected.running {
+		t.Errorf("%s: expected %d running jobs, got %d", step, expected.running, running)
+	}
+
+	expectPoolCounts(t, step+": queued", db.CountQueuedJobsByPool, expected.queuedByPool)
+	expectPoolCounts(t, step+": running", db.CountRunningJobsByPool, expected.runningByPool)
+}
+
+func expectPoolCounts(t *testing.T, step string, count func(context.Context) (map[string]int, error), expected map[string]int) {
+	t.Helper()
+
+	got, err := count(context.Background())
+	if err != nil {
+		t.Fatalf("%s: expected no error, got %v", step, err)
+	}
+	for pool, n := range expected {
+		if got[pool] != n {
+			t.Errorf("%s: expected %d jobs in %s, got %v", step, n, pool, got)
+		}
+	}
+	for pool, n := range got {
+		if _, ok := expected[pool]; !ok && n != 0 {
+			t.Errorf("%s: expected no jobs in %s, got %v", step, pool, got)
+		}
+	}
+}
+
+func testLifecycle(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	t0 := time.Now().Add(-2 * time.Hour).UTC().Truncate(time.Second)
+	build := models.WorkflowJob{ID: 1, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "linux", Labels: []string{"self-hosted", "linux"}, Repository: models.Repository{FullName: "octo/app"}, WorkflowName: "CI", Name: "build", CreatedAt: t0}
+	deploy := models.WorkflowJob{ID: 2, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "linux", Labels: []string{"self-hosted", "linux"}, Repository: models.Repository{FullName: "octo/app"}, WorkflowName: "CD", Name: "deploy", CreatedAt: t0}
+	train := models.WorkflowJob{ID: 3, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "gpu", Labels: []string{"self-hosted", "gpu"}, Repository: models.Repository{FullName: "octo/ml"}, WorkflowName: "Train", Name: "train", CreatedAt: t0}
+
+	expectCounts(t, "empty", db, counts{})
+
+	deliver(t, db, event(build, models.JobStatusQueued, time.Time{}, time.Time{}), t0)
+	deliver(t, db, event(deploy, models.JobStatusWaiting, time.Time{}, time.Time{}), t0)
+	deliver(t, db, event(train, models.JobStatusQueued, time.Time{}, time.Time{}), t0)
+	expectCounts(t, "created", db, counts{
+		queued: 2, waiting: 1,
+		queuedByPool: map[string]int{"linux": 1, "gpu": 1},
+	})
+
+	// build waits 2m for a runner, deploy 5m for approval and then 1m for a runner
+	deliver(t, db, event(build, models.JobStatusInProgress, t0.Add(2*time.Minute), time.Time{}), t0.Add(2*time.Minute))
+	deliver(t, db, event(deploy, models.JobStatusQueued, time.Time{}, time.Time{}), t0.Add(5*time.Minute))
+	expectCounts(t, "build started and deploy approved", db, counts{
+		queued: 2, running: 1,
+		queuedByPool:  map[string]int{"linux": 1, "gpu": 1},
+		runningByPool: map[string]int{"linux": 1},
+	})
+
+	deliver(t, db, event(deploy, models.JobStatusInProgress, t0.Add(6*time.Minute), time.Time{}), t0.Add(6*time.Minute))
+	expectCounts(t, "deploy started", db, counts{
+		queued: 1, running: 2,
+		queuedByPool:  map[string]int{"gpu": 1},
+		runningByPool: map[string]int{"linux": 2},
+	})
+
+	deliver(t, db, event(build, models.JobStatusCompleted, t0.Add(2*time.Minute), t0.Add(12*time.Minute)), t0.Add(12*time.Minute))
+	deliver(t, db, event(deploy, models.JobStatusCompleted, t0.Add(6*time.Minute), t0.Add(36*time.Minute)), t0.Add(36*time.Minute))
+	expectCounts(t, "completed", db, counts{
+		queued:       1,
+		queuedByPool: map[string]int{"gpu": 1},
+	})
+
+	averages, err := db.GetAverageQueueTimeByPool(ctx, "day")
+	if err != nil || averages["linux"] != 90*time.Second {
+		t.Errorf("Expected an average queue time of 90s in linux, got %v (%v)", averages, err)
+	}
+	if _, ok := averages["gpu"]; ok {
+		t.Errorf("Expected no queue time for the gpu job that never started, got %v", averages)
+	}
+	if wait, err := db.GetAverageApprovalWaitTime(ctx, "day"); err != nil || wait != 5*time.Minute {
+		t.Errorf("Expected an average approval wait of 5m, got %s (%v)", wait, err)
+	}
+
+	stats, err := db.GetQueueTimeStats(ctx, models.QueueTimeFilter{Period: "day", Pool: "linux"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expectedStats := models.QueueTimeStats{Count: 2, AvgMs: 90000, P50Ms: 90000, P90Ms: 114000, P95Ms: 117000, P99Ms: 119400, MaxMs: 120000}
+	if stats != expectedStats {
+		t.Errorf("Expected %+v, got %+v", expectedStats, stats)
+	}
+
+	durations, err := db.GetJobDurationStats(ctx, "workflow", models.JobDurationFilter{Period: "day"}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(durations) != 2 || durations[0].Workflow != "CD" || durations[0].AvgMs != 1800000 || durations[1].Workflow != "CI" || durations[1].RunnerMinutes != 10 {
+		t.Errorf("Expected CD with 30 runner minutes before CI with 10, got %+v", durations)
+	}
+}
+
+func testOutOfOrder(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	t0 := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	job := models.WorkflowJob{ID: 1, RunnerType: models.RunnerTypeGitHubHosted, RunnerPool: "linux", CreatedAt: t0}
+
+	// The completed event overtakes the others, which must not bring the job back
+	deliver(t, db, event(job, models.JobStatusCompleted, t0.Add(time.Minute), t0.Add(5*time.Minute)), t0.Add(5*time.Minute))
+	deliver(t, db, event(job, models.JobStatusInProgress, t0.Add(time.Minute), time.Time{}), t0.Add(5*time.Minute))
+	merged := deliver(t, db, event(job, models.JobStatusQueued, time.Time{}, time.Time{}), t0.Add(5*time.Minute))
+
+	if merged.Status != models.JobStatusCompleted {
+		t.Errorf("Expected the job to stay completed, got %s", merged.Status)
+	}
+	expectCounts(t, "after late events", db, counts{})
+
+	longest, err := db.GetLongestJobs(ctx, models.JobDurationFilter{}, 10)
+	if err != nil || len(longest) != 1 || longest[0].DurationMs != 240000 {
+		t.Errorf("Expected one job that ran for 4m, got %+v (%v)", longest, err)
+	}
+}
+
+func testRedelivered(t *testing.T, db database.DatabaseInterface) {
+	t0 := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	job := models.WorkflowJob{ID: 1, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "linux", CreatedAt: t0}
+
+	for i := 0; i < 3; i++ {
+		deliver(t, db, event(job, models.JobStatusQueued, time.Time{}, time.Time{}), t0.Add(time.Duration(i)*time.Minute))
+	}
+	expectCounts(t, "queued three times", db, counts{queued: 1, queuedByPool: map[string]int{"linux": 1}})
+
+	for i := 0; i < 2; i++ {
+		deliver(t, db, event(job, models.JobStatusInProgress, t0.Add(3*time.Minute), time.Time{}), t0.Add(3*time.Minute))
+	}
+	expectCounts(t, "started twice", db, counts{running: 1, runningByPool: map[string]int{"linux": 1}})
+
+	// Only the first of the redelivered events moves the job to a new status
+	completed := event(job, models.JobStatusCompleted, t0.Add(3*time.Minute), t0.Add(4*time.Minute))
+	for i, expected := range []bool{true, false} {
+		if _, statusChanged, err := db.AddOrUpdateJob(context.Background(), completed); err != nil || statusChanged != expected {
+			t.Errorf("Expected completed delivery %d to report a status change %v, got %v (%v)", i+1, expected, statusChanged, err)
+		}
+	}
+}
+
+func testRerun(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	t0 := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	first := models.WorkflowJob{ID: 1, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "linux", CreatedAt: t0}
+	rerun := first
+	rerun.CreatedAt = t0.Add(30 * time.Minute)
+
+	// Jobs are identified by their ID and creation time, so a re-run does not update the first run
+	deliver(t, db, event(first, models.JobStatusCompleted, t0.Add(time.Minute), t0.Add(2*time.Minute)), t0.Add(2*time.Minute))
+	deliver(t, db, event(rerun, models.JobStatusQueued, time.Time{}, time.Time{}), rerun.CreatedAt)
+
+	expectCounts(t, "re-run queued", db, counts{queued: 1, queuedByPool: map[string]int{"linux": 1}})
+
+	if longest, err := db.GetLongestJobs(ctx, models.JobDurationFilter{}, 10); err != nil || len(longest) != 1 {
+		t.Errorf("Expected the first run to stay completed, got %+v (%v)", longest, err)
+	}
+}
+
+func testPeriods(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	samples := []struct {
+		age  time.Duration
+		peak int
+	}{
+		{age: 10 * time.Minute, peak: 3},
+		{age: 12 * time.Hour, peak: 7},
+		{age: 3 * 24 * time.Hour, peak: 11},
+		{age: 20 * 24 * time.Hour, peak: 13},
+		{age: 40 * 24 * time.Hour, peak: 17},
+	}
+	for _, sample := range samples {
+		entry := models.HistoricalEntry{Timestamp: now.Add(-sample.age).Format(time.RFC3339), CountSelfHosted: sample.peak, PeakTotal: sample.peak}
+		if err := db.AddHistoricalEntry(ctx, entry); err != nil {
+			t.Fatalf("Expected no error adding entry, got %v", err)
+		}
+	}
+
+	testCases := []struct {
+		period  string
+		peak    int
+		samples int
+	}{
+		{period: "hour", peak: 3, samples: 1},
+		{period: "day", peak: 7, samples: 2},
+		{period: "week", peak: 11, samples: 3},
+		{period: "month", peak: 13, samples: 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.period, func(t *testing.T) {
+			peak, timestamp, err := db.CalculatePeakDemand(ctx, tc.period)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if peak != tc.peak {
+				t.Errorf("Expected a peak of %d, got %d", tc.peak, peak)
+			}
+			if _, err := time.Parse(time.RFC3339, timestamp); err != nil {
+				t.Errorf("Expected an RFC3339 peak timestamp, got %q", timestamp)
+			}
+
+			entries, err := db.GetHistoricalDataByPeriod(ctx, tc.period)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			// Every sample is in a bucket of its own, so the buckets add up to the samples
+			var total int
+			for _, entry := range entries {
+				if _, err := time.Parse(time.RFC3339, entry.Timestamp); err != nil {
+					t.Errorf("Expected RFC3339 timestamps, got %q", entry.Timestamp)
+				}
+				total += entry.CountSelfHosted
+			}
+			var expected int
+			for _, sample := range samples[:tc.samples] {
+				expected += sample.peak
+			}
+			if len(entries) != tc.samples || total != expected {
+				t.Errorf("Expected %d buckets adding up to %d, got %+v", tc.samples, expected, entries)
+			}
+		})
+	}
+}
+
+func testJobs(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	createdAt := time.Now().Add(-10 * time.Minute).UTC().Truncate(time.Second)
+	job := models.WorkflowJob{
+		ID:           1,
+		RunnerType:   models.RunnerTypeSelfHosted,
+		RunnerPool:   "linux",
+		Labels:       []string{"self-hosted", "linux"},
+		Repository:   models.Repository{ID: 7, FullName: "octo/app"},
+		WorkflowName: "CI",
+		Name:         "build",
+		CreatedAt:    createdAt,
+	}
+
+	// The in_progress event arrives before the queued one
+	inProgress := job
+	inProgress.Status = models.JobStatusInProgress
+	inProgress.StartedAt = createdAt.Add(2 * time.Minute)
+	addJob(t, db, inProgress)
+
+	queued := job
+	queued.Status = models.JobStatusQueued
+	merged := addJob(t, db, queued)
+	if merged.Status != models.JobStatusInProgress {
+		t.Errorf("Expected a late queued event to keep the job in_progress, got %s", merged.Status)
+	}
+	if !merged.StartedAt.Equal(inProgress.StartedAt) {
+		t.Errorf("Expected StartedAt %s, got %s", inProgress.StartedAt, merged.StartedAt)
+	}
+	if len(merged.Labels) != 2 || merged.Repository.FullName != "octo/app" {
+		t.Errorf("Expected the stored labels and repository, got %+v", merged)
+	}
+
+	addJob(t, db, models.WorkflowJob{ID: 2, Status: models.JobStatusQueued, RunnerType: models.RunnerTypeGitHubHosted, RunnerPool: "linux", CreatedAt: createdAt})
+	addJob(t, db, models.WorkflowJob{ID: 3, Status: models.JobStatusWaiting, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "gpu", CreatedAt: createdAt})
+
+	if count, err := db.CountQueuedJobs(ctx); err != nil || count != 1 {
+		t.Errorf("Expected 1 queued job, got %d (%v)", count, err)
+	}
+	if count, err := db.CountWaitingJobs(ctx); err != nil || count != 1 {
+		t.Errorf("Expected 1 waiting job, got %d (%v)", count, err)
+	}
+
+	running, err := db.GetRunningJobs(ctx, models.RunnerTypeSelfHosted)
+	if err != nil || len(running) != 1 || running[0] != "1" {
+		t.Errorf("Expected job 1 running on self-hosted runners, got %v (%v)", running, err)
+	}
+
+	if counts, err := db.CountRunningJobsByPool(ctx); err != nil || counts["linux"] != 1 {
+		t.Errorf("Expected 1 running job in linux, got %v (%v)", counts, err)
+	}
+	if counts, err := db.CountQueuedJobsByPool(ctx); err != nil || counts["linux"] != 1 {
+		t.Errorf("Expected 1 queued job in linux, got %v (%v)", counts, err)
+	}
+	if counts, err := db.CountWaitingJobsByPool(ctx); err != nil || counts["gpu"] != 1 {
+		t.Errorf("Expected 1 waiting job in gpu, got %v (%v)", counts, err)
+	}
+
+	run := models.WorkflowRun{ID: 10, RunAttempt: 1, WorkflowName: "CI", Status: "completed", CreatedAt: createdAt}
+	if err := db.AddOrUpdateWorkflowRun(ctx, run); err != nil {
+		t.Errorf("Expected no error adding workflow run, got %v", err)
+	}
+	if err := db.AddOrUpdateWorkflowRun(ctx, run); err != nil {
+		t.Errorf("Expected no error updating workflow run, got %v", err)
+	}
+}
+
+func testQueueTimes(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	createdAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	addJob(t, db, models.WorkflowJob{ID: 1, Status: models.JobStatusQueued, RunnerPool: "linux", Labels: []string{"Linux"}, Repository: models.Repository{FullName: "octo/app"}, CreatedAt: createdAt})
+	addJob(t, db, models.WorkflowJob{ID: 2, Status: models.JobStatusQueued, RunnerPool: "linux", Labels: []string{"linux", "large"}, Repository: models.Repository{FullName: "octo/lib"}, CreatedAt: createdAt})
+	addJob(t, db, models.WorkflowJob{ID: 3, Status: models.JobStatusQueued, RunnerPool: "gpu", CreatedAt: createdAt})
+
+	for _, d := range []struct {
+		id       int64
+		pool     string
+		duration time.Duration
+	}{
+		{1, "linux", 10 * time.Second},
+		{2, "linux", 30 * time.Second},
+		{3, "gpu", 2 * time.Minute},
+	} {
+		if recorded, err := db.AddQueueTimeDuration(ctx, d.id, createdAt, d.pool, d.duration, createdAt.Add(d.duration)); err != nil || !recorded {
+			t.Fatalf("Expected the queue time of job %d to be recorded, got %v (%v)", d.id, recorded, err)
+		}
+	}
+	if recorded, err := db.AddApprovalWaitDuration(ctx, 3, createdAt, "gpu", 4*time.Minute, createdAt.Add(4*time.Minute)); err != nil || !recorded {
+		t.Fatalf("Expected the approval wait to be recorded, got %v (%v)", recorded, err)
+	}
+
+	// Reprocessing the deliveries of a job records its durations once
+	if recorded, err := db.AddQueueTimeDuration(ctx, 1, createdAt, "linux", 10*time.Second, createdAt.Add(10*time.Second)); err != nil || recorded {
+		t.Fatalf("Expected a queue time added again not to be recorded, got %v (%v)", recorded, err)
+	}
+	if recorded, err := db.AddApprovalWaitDuration(ctx, 3, createdAt, "gpu", 4*time.Minute, createdAt.Add(4*time.Minute)); err != nil || recorded {
+		t.Fatalf("Expected an approval wait added again not to be recorded, got %v (%v)", recorded, err)
+	}
+
+	// A job's durations are keyed by the job alone, so adding them again at another time does
+	// not record them twice
+	if recorded, err := db.AddQueueTimeDuration(ctx, 1, createdAt, "linux", 50*time.Second, createdAt.Add(50*time.Second)); err != nil || recorded {
+		t.Fatalf("Expected a queue time added at another time not to be recorded, got %v (%v)", recorded, err)
+	}
+	if recorded, err := db.AddApprovalWaitDuration(ctx, 3, createdAt, "gpu", 6*time.Minute, createdAt.Add(6*time.Minute)); err != nil || recorded {
+		t.Fatalf("Expected an approval wait added at another time not to be recorded, got %v (%v)", recorded, err)
+	}
+
+	averages, err := db.GetAverageQueueTimeByPool(ctx, "day")
+	if err != nil || averages["linux"] != 20*time.Second || averages["gpu"] != 2*time.Minute {
+		t.Errorf("Expected averages of 20s for linux and 2m for gpu, got %v (%v)", averages, err)
+	}
+	if average, err := db.GetAverageApprovalWaitTime(ctx, "day"); err != nil || average != 4*time.Minute {
+		t.Errorf("Expected an average approval wait of 4m, got %s (%v)", average, err)
+	}
+	if averages, err := db.GetAverageApprovalWaitTimeByPool(ctx, "day"); err != nil || averages["gpu"] != 4*time.Minute {
+		t.Errorf("Expected an approval wait of 4m for gpu, got %v (%v)", averages, err)
+	}
+
+	testCases := []struct {
+		name   string
+		filter models.QueueTimeFilter
+		count  int64
+		maxMs  int64
+	}{
+		{name: "all", filter: models.QueueTimeFilter{}, count: 3, maxMs: 120000},
+		{name: "period", filter: models.QueueTimeFilter{Period: "day"}, count: 3, maxMs: 120000},
+		{name: "pool", filter: models.QueueTimeFilter{Pool: "linux"}, count: 2, maxMs: 30000},
+		{name: "repository", filter: models.QueueTimeFilter{Repository: "octo/app"}, count: 1, maxMs: 10000},
+		{name: "labels ignore case", filter: models.QueueTimeFilter{Labels: []string{"LINUX"}}, count: 2, maxMs: 30000},
+		{name: "every label", filter: models.QueueTimeFilter{Labels: []string{"linux", "large"}}, count: 1, maxMs: 30000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats, err := db.GetQueueTimeStats(ctx, tc.filter)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if stats.Count != tc.count || stats.MaxMs != tc.maxMs {
+				t.Errorf("Expected %d queue times up to %dms, got %+v", tc.count, tc.maxMs, stats)
+			}
+		})
+	}
+
+	stats, err := db.GetQueueTimeStats(ctx, models.QueueTimeFilter{Pool: "linux"})
+	if err != nil || stats.AvgMs != 20000 || stats.P50Ms != 20000 {
+		t.Errorf("Expected an average and median of 20000ms, got %+v (%v)", stats, err)
+	}
+
+	buckets, err := db.GetQueueTimeHistogram(ctx, models.QueueTimeFilter{}, []time.Duration{30 * time.Second, time.Minute})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []models.HistogramBucket{
+		{MinMs: 0, MaxMs: 30000, Count: 1},
+		{MinMs: 30000, MaxMs: 60000, Count: 1},
+		{MinMs: 60000, MaxMs: 0, Count: 1},
+	}
+	if len(buckets) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %+v", len(expected), buckets)
+	}
+	for i := range expected {
+		if buckets[i] != expected[i] {
+			t.Errorf("Expected bucket %d to be %+v, got %+v", i, expected[i], buckets[i])
+		}
+	}
+
+	// A queue time replayed from an old delivery counts in the period its job started in
+	startedAt := createdAt.Add(-72 * time.Hour)
+	addJob(t, db, models.WorkflowJob{ID: 4, Status: models.JobStatusQueued, RunnerPool: "arm", CreatedAt: startedAt.Add(-time.Minute)})
+	if _, err := db.AddQueueTimeDuration(ctx, 4, startedAt.Add(-time.Minute), "arm", time.Minute, startedAt); err != nil {
+		t.Fatalf("Expected no error adding queue time, got %v", err)
+	}
+	if stats, err := db.GetQueueTimeStats(ctx, models.QueueTimeFilter{Period: "day", Pool: "arm"}); err != nil || stats.Count != 0 {
+		t.Errorf("Expected no queue time of the last day, got %+v (%v)", stats, err)
+	}
+	if stats, err := db.GetQueueTimeStats(ctx, models.QueueTimeFilter{Period: "week", Pool: "arm"}); err != nil || stats.Count != 1 {
+		t.Errorf("Expected the queue time of the last week, got %+v (%v)", stats, err)
+	}
+
+	// Averages only cover the durations recorded in the period
+	if _, err := db.AddApprovalWaitDuration(ctx, 4, startedAt.Add(-time.Minute), "arm", 10*time.Minute, startedAt); err != nil {
+		t.Fatalf("Expected no error adding approval wait, got %v", err)
+	}
+	if averages, err := db.GetAverageQueueTimeByPool(ctx, "day"); err != nil || averages["arm"] != 0 {
+		t.Errorf("Expected no arm queue time of the last day, got %v (%v)", averages, err)
+	}
+	if averages, err := db.GetAverageQueueTimeByPool(ctx, "week"); err != nil || averages["arm"] != time.Minute {
+		t.Errorf("Expected an arm queue time of 1m in the last week, got %v (%v)", averages, err)
+	}
+	if average, err := db.GetAverageApprovalWaitTime(ctx, "day"); err != nil || average != 4*time.Minute {
+		t.Errorf("Expected an average approval wait of 4m in the last day, got %s (%v)", average, err)
+	}
+	if average, err := db.GetAverageApprovalWaitTime(ctx, "week"); err != nil || average != 7*time.Minute {
+		t.Errorf("Expected an average approval wait of 7m in the last week, got %s (%v)", average, err)
+	}
+	if averages, err := db.GetAverageApprovalWaitTimeByPool(ctx, "day"); err != nil || averages["arm"] != 0 {
+		t.Errorf("Expected no arm approval wait of the last day, got %v (%v)", averages, err)
+	}
+	if averages, err := db.GetAverageApprovalWaitTimeByPool(ctx, "week"); err != nil || averages["arm"] != 10*time.Minute {
+		t.Errorf("Expected an arm approval wait of 10m in the last week, got %v (%v)", averages, err)
+	}
+	if _, err := db.GetAverageApprovalWaitTime(ctx, "year"); err == nil {
+		t.Error("Expected an error for an invalid period")
+	}
+}
+
+func testJobDurations(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	startedAt := time.Now().Add(-2 * time.Hour).UTC().Truncate(time.Second)
+	for i, d := range []struct {
+		pool     string
+		duration time.Duration
+	}{
+		{"linux", 10 * time.Minute},
+		{"linux", 20 * time.Minute},
+		{"gpu", 5 * time.Minute},
+	} {
+		addJob(t, db, models.WorkflowJob{
+			ID:           int64(i + 1),
+			Status:       models.JobStatusCompleted,
+			Conclusion:   "success",
+			RunnerPool:   d.pool,
+			Repository:   models.Repository{FullName: "octo/app"},
+			WorkflowName: "CI",
+			Name:         "build",
+			CreatedAt:    startedAt.Add(-time.Minute),
+			StartedAt:    startedAt,
+			CompletedAt:  startedAt.Add(d.duration),
+		})
+	}
+	// Jobs that have not completed are left out
+	addJob(t, db, models.WorkflowJob{ID: 4, Status: models.JobStatusInProgress, RunnerPool: "gpu", CreatedAt: startedAt, StartedAt: startedAt})
+
+	stats, err := db.GetJobDurationStats(ctx, "pool", models.JobDurationFilter{Period: "day"}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 pools, got %+v", stats)
+	}
+	if stats[0].Pool != "linux" || stats[0].Count != 2 || stats[0].AvgMs != 900000 || stats[0].RunnerMinutes != 30 {
+		t.Errorf("Expected linux first with 2 jobs averaging 15m, got %+v", stats[0])
+	}
+
+	if _, err := db.GetJobDurationStats(ctx, "branch", models.JobDurationFilter{}, 10); err == nil {
+		t.Error("Expected an error for an invalid grouping")
+	}
+
+	longest, err := db.GetLongestJobs(ctx, models.JobDurationFilter{Pool: "linux"}, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(longest) != 1 || longest[0].ID != 2 || longest[0].DurationMs != 1200000 {
+		t.Errorf("Expected job 2 to be the longest, got %+v", longest)
+	}
+}
+
+func testListJobs(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	base := time.Now().Add(-2 * time.Hour).UTC().Truncate(time.Second)
+	newJob := func(id int64, pool, repository, workflow string, labels []string, created time.Duration) models.WorkflowJob {
+		return models.WorkflowJob{
+			ID:           id,
+			RunnerPool:   pool,
+			Repository:   models.Repository{FullName: repository},
+			WorkflowName: workflow,
+			Labels:       labels,
+			CreatedAt:    base.Add(created),
+		}
+	}
+
+	// Job 1 queued for 15m and ran 30m, job 2 queued for 2m and ran 60m
+	job1 := newJob(1, "linux", "octo/app", "CI", []string{"self-hosted", "linux", "gpu"}, 0)
+	deliver(t, db, event(job1, models.JobStatusQueued, time.Time{}, time.Time{}), base)
+	deliver(t, db, event(job1, models.JobStatusInProgress, base.Add(15*time.Minute), time.Time{}), base.Add(15*time.Minute))
+	deliver(t, db, event(job1, models.JobStatusCompleted, base.Add(15*time.Minute), base.Add(45*time.Minute)), base.Add(45*time.Minute))
+
+	job2 := newJob(2, "linux", "octo/app", "CI", []string{"self-hosted", "linux"}, time.Minute)
+	deliver(t, db, event(job2, models.JobStatusQueued, time.Time{}, time.Time{}), base.Add(time.Minute))
+	deliver(t, db, event(job2, models.JobStatusInProgress, base.Add(3*time.Minute), time.Time{}), base.Add(3*time.Minute))
+	deliver(t, db, event(job2, models.JobStatusCompleted, base.Add(3*time.Minute), base.Add(63*time.Minute)), base.Add(63*time.Minute))
+
+	// Job 3 queued for 20m and is still running, job 4 is still queued
+	job3 := newJob(3, "windows", "octo/lib", "Release", []string{"windows"}, 2*time.Minute)
+	deliver(t, db, event(job3, models.JobStatusInProgress, base.Add(22*time.Minute), time.Time{}), base.Add(22*time.Minute))
+
+	job4 := newJob(4, "linux", "octo/app", "CI", []string{"linux"}, 3*time.Minute)
+	deliver(t, db, event(job4, models.JobStatusQueued, time.Time{}, time.Time{}), base.Add(3*time.Minute))
+
+	// Job 5 waited 6m for approval, so its queue time is 2m rather than 8m
+	job5 := newJob(5, "linux", "octo/app", "Deploy", []string{"linux"}, 4*time.Minute)
+	deliver(t, db, event(job5, models.JobStatusWaiting, time.Time{}, time.Time{}), base.Add(4*time.Minute))
+	deliver(t, db, event(job5, models.JobStatusQueued, time.Time{}, time.Time{}), base.Add(10*time.Minute))
+	deliver(t, db, event(job5, models.JobStatusInProgress, base.Add(12*time.Minute), time.Time{}), base.Add(12*time.Minute))
+
+	ids := func(filter models.JobFilter) []int64 {
+		t.Helper()
+		jobs, err := db.ListJobs(ctx, filter)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ids := []int64{}
+		for _, job := range jobs {
+			ids = append(ids, job.ID)
+		}
+		return ids
+	}
+
+	testCases := []struct {
+		name     string
+		filter   models.JobFilter
+		expected []int64
+	}{
+		{name: "newest first", filter: models.JobFilter{}, expected: []int64{5, 4, 3, 2, 1}},
+		{name: "status", filter: models.JobFilter{Status: models.JobStatusInProgress}, expected: []int64{5, 3}},
+		{name: "pool", filter: models.JobFilter{Pool: "linux"}, expected: []int64{5, 4, 2, 1}},
+		{name: "repository", filter: models.JobFilter{Repository: "octo/lib"}, expected: []int64{3}},
+		{name: "workflow", filter: models.JobFilter{Workflow: "CI"}, expected: []int64{4, 2, 1}},
+		{name: "labels ignore case", filter: models.JobFilter{Labels: []string{"GPU"}}, expected: []int64{1}},
+		{name: "every label", filter: models.JobFilter{Labels: []string{"linux", "self-hosted"}}, expected: []int64{2, 1}},
+		{name: "created range", filter: models.JobFilter{CreatedFrom: base.Add(time.Minute), CreatedTo: base.Add(3 * time.Minute)}, expected: []int64{3, 2}},
+		{name: "started range", filter: models.JobFilter{StartedFrom: base.Add(10 * time.Minute), StartedTo: base.Add(20 * time.Minute)}, expected: []int64{5, 1}},
+		{name: "completed since", filter: models.JobFilter{CompletedFrom: base.Add(50 * time.Minute)}, expected: []int64{2}},
+		{name: "longest queue time first", filter: models.JobFilter{Sort: models.JobSortQueueTime}, expected: []int64{3, 1, 5, 2}},
+		{name: "minimum queue time", filter: models.JobFilter{Sort: models.JobSortQueueTime, MinQueueTime: 10 * time.Minute}, expected: []int64{3, 1}},
+		{name: "longest duration first", filter: models.JobFilter{Sort: models.JobSortDuration}, expected: []int64{2, 1}},
+		{name: "minimum duration", filter: models.JobFilter{MinDuration: 45 * time.Minute}, expected: []int64{2}},
+		{name: "limit", filter: models.JobFilter{Limit: 2}, expected: []int64{5, 4}},
+		{name: "after", filter: models.JobFilter{After: &models.JobCursor{Value: job3.CreatedAt.UnixMicro(), ID: 3}}, expected: []int64{2, 1}},
+		{name: "after a tie", filter: models.JobFilter{Sort: models.JobSortQueueTime, After: &models.JobCursor{Value: (2 * time.Minute).Milliseconds(), ID: 5}}, expected: []int64{2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ids(tc.filter); fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+				t.Errorf("Expected jobs %v, got %v", tc.expected, got)
+			}
+		})
+	}
+
+	jobs, err := db.ListJobs(ctx, models.JobFilter{Status: models.JobStatusCompleted, Limit: 1})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected one job, got %+v (%v)", jobs, err)
+	}
+	job := jobs[0]
+	if job.ID != 2 || job.Conclusion != "success" || len(job.Labels) != 2 || !job.StartedAt.Equal(base.Add(3*time.Minute)) || !job.CompletedAt.Equal(base.Add(63*time.Minute)) {
+		t.Errorf("Expected the stored job to be returned, got %+v", job)
+	}
+}
+
+func testHistory(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	entries := []models.HistoricalEntry{
+		{Timestamp: now.Add(-30 * time.Minute).Format(time.RFC3339), CountSelfHosted: 2, CountGitHubHosted: 1, CountQueued: 1, PeakTotal: 4},
+		{Timestamp: now.Add(-20 * time.Minute).Format(time.RFC3339), CountSelfHosted: 4, CountGitHubHosted: 2, CountQueued: 0, PeakTotal: 9},
+		{Timestamp: now.Add(-3 * time.Hour).Format(time.RFC3339), CountSelfHosted: 8, CountGitHubHosted: 0, CountQueued: 0, PeakTotal: 8},
+	}
+	for _, entry := range entries {
+		if err := db.AddHistoricalEntry(ctx, entry); err != nil {
+			t.Fatalf("Expected no error adding entry, got %v", err)
+		}
+	}
+
+	hour, err := db.GetHistoricalDataByPeriod(ctx, "hour")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(hour) != 2 || hour[0] != entries[0] || hour[1] != entries[1] {
+		t.Errorf("Expected the samples of the last hour, got %+v", hour)
+	}
+
+	day, err := db.GetHistoricalDataByPeriod(ctx, "day")
+	if err != nil || len(day) == 0 {
+		t.Errorf("Expected buckets for the last day, got %+v (%v)", day, err)
+	}
+
+	if _, err := db.GetHistoricalDataByPeriod(ctx, "decade"); err == nil {
+		t.Error("Expected an error for an invalid period")
+	}
+
+	r := models.TimeRange{From: now.Add(-time.Hour).Truncate(time.Hour), To: now.Add(time.Hour), Step: time.Hour}
+	buckets, err := db.GetHistoricalDataByRange(ctx, r)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var total int
+	for _, bucket := range buckets {
+		total += bucket.CountSelfHosted
+		if bucket.PeakTotal > 9 {
+			t.Errorf("Expected peaks of at most 9, got %+v", bucket)
+		}
+	}
+	if len(buckets) == 1 && (buckets[0].CountSelfHosted != 3 || buckets[0].PeakTotal != 9) {
+		t.Errorf("Expected a single bucket to average both samples, got %+v", buckets[0])
+	}
+	if total == 0 {
+		t.Errorf("Expected buckets with the recent samples, got %+v", buckets)
+	}
+
+	peak, timestamp, err := db.CalculatePeakDemand(ctx, "hour")
+	if err != nil || peak != 9 || timestamp != entries[1].Timestamp {
+		t.Errorf("Expected a peak of 9 at %s, got %d at %s (%v)", entries[1].Timestamp, peak, timestamp, err)
+	}
+	if peak, _, err := db.CalculatePeakDemand(ctx, "day"); err != nil || peak != 9 {
+		t.Errorf("Expected a daily peak of 9, got %d (%v)", peak, err)
+	}
+}
+
+func testPoolHistory(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	timestamp := now.Add(-10 * time.Minute).Format(time.RFC3339)
+	if err := db.AddPoolHistoricalEntries(ctx, []models.PoolHistoricalEntry{
+		{Timestamp: timestamp, Pool: "linux", CountRunning: 3, CountQueued: 1, PeakTotal: 5},
+		{Timestamp: timestamp, Pool: "gpu", CountRunning: 1, CountQueued: 0, PeakTotal: 1},
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := db.GetPoolHistoricalDataByPeriod(ctx, "hour", "linux")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := models.PoolHistoricalEntry{Timestamp: timestamp, Pool: "linux", CountRunning: 3, CountQueued: 1, PeakTotal: 5}
+	if len(entries) != 1 || entries[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, entries)
+	}
+
+	r := models.TimeRange{From: now.Add(-time.Hour), To: now, Step: time.Hour}
+	if entries, err := db.GetPoolHistoricalDataByRange(ctx, r, "gpu"); err != nil || len(entries) != 1 || entries[0].Pool != "gpu" {
+		t.Errorf("Expected one gpu bucket, got %+v (%v)", entries, err)
+	}
+
+	peak, at, err := db.CalculatePeakDemandByPool(ctx, "day", "linux")
+	if err != nil || peak != 5 || at != timestamp {
+		t.Errorf("Expected a peak of 5 at %s, got %d at %s (%v)", timestamp, peak, at, err)
+	}
+	if peak, at, err := db.CalculatePeakDemandByPool(ctx, "day", "arm"); err != nil || peak != 0 || at != "" {
+		t.Errorf("Expected no peak for a pool without samples, got %d at %q (%v)", peak, at, err)
+	}
+}
+
+func testDeliveries(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	receivedAt := time.Now().UTC().Truncate(time.Microsecond)
+	payload := []byte(`{"action":"queued"}`)
+
+	if process, err := db.RecordDelivery(ctx, "guid-1", "workflow_job", payload, receivedAt); err != nil || !process {
+		t.Errorf("Expected a new delivery to need processing, got %v (%v)", process, err)
+	}
+	if process, err := db.RecordDelivery(ctx, "guid-1", "workflow_job", payload, receivedAt); err != nil || process {
+		t.Errorf("Expected a redelivery of a delivery in flight to be skipped, got %v (%v)", process, err)
+	}
+	if err := db.ReleaseDelivery(ctx, "guid-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if process, err := db.RecordDelivery(ctx, "guid-1", "workflow_job", payload, receivedAt); err != nil || !process {
+		t.Errorf("Expected a redelivery of a released delivery to need processing, got %v (%v)", process, err)
+	}
+	if process, err := db.RecordDelivery(ctx, "guid-1", "workflow_job", payload, receivedAt.Add(database.DeliveryClaimTimeout+time.Second)); err != nil || !process {
+		t.Errorf("Expected a redelivery past the claim timeout to reclaim the delivery, got %v (%v)", process, err)
+	}
+	if err := db.MarkDeliveryProcessed(ctx, "guid-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if process, err := db.RecordDelivery(ctx, "guid-1", "workflow_job", payload, receivedAt); err != nil || process {
+		t.Errorf("Expected a processed redelivery to be skipped, got %v (%v)", process, err)
+	}
+
+	// Deliveries are listed in the order they were received, and those without a payload are not listed
+	mustRecord := func(id string, payload []byte, at time.Time) {
+		t.Helper()
+		if _, err := db.RecordDelivery(ctx, id, "workflow_job", payload, at); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	mustRecord("guid-3", payload, receivedAt.Add(time.Minute))
+	mustRecord("guid-2", payload, receivedAt.Add(time.Minute))
+	mustRecord("guid-4", nil, receivedAt.Add(2*time.Minute))
+	mustRecord("guid-5", payload, receivedAt.Add(3*time.Minute))
+
+	ids := func(filter models.DeliveryFilter) []string {
+		t.Helper()
+		deliveries, err := db.GetDeliveries(ctx, filter)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ids := []string{}
+		for _, d := range deliveries {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+
+	testCases := []struct {
+		name     string
+		filter   models.DeliveryFilter
+		expected []string
+	}{
+		{name: "all", filter: models.DeliveryFilter{}, expected: []string{"guid-1", "guid-2", "guid-3", "guid-5"}},
+		{name: "unprocessed", filter: models.DeliveryFilter{Unprocessed: true}, expected: []string{"guid-2", "guid-3", "guid-5"}},
+		{name: "time range", filter: models.DeliveryFilter{From: receivedAt.Add(time.Minute), To: receivedAt.Add(3 * time.Minute)}, expected: []string{"guid-2", "guid-3"}},
+		{name: "limit", filter: models.DeliveryFilter{Limit: 2}, expected: []string{"guid-1", "guid-2"}},
+		{name: "after", filter: models.DeliveryFilter{AfterReceivedAt: receivedAt.Add(time.Minute), AfterID: "guid-2"}, expected: []string{"guid-3", "guid-5"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ids(tc.filter); strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected deliveries %v, got %v", tc.expected, got)
+			}
+		})
+	}
+
+	deliveries, err := db.GetDeliveries(ctx, models.DeliveryFilter{Limit: 1})
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected one delivery, got %+v (%v)", deliveries, err)
+	}
+	d := deliveries[0]
+	if d.Event != "workflow_job" || string(d.Payload) != string(payload) || !d.ReceivedAt.Equal(receivedAt) || d.Attempts != 5 || !d.Processed {
+		t.Errorf("Expected the stored delivery to be returned, got %+v", d)
+	}
+}
+
+func testConcurrentDeliveries(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	receivedAt := time.Now().UTC().Truncate(time.Microsecond)
+	payload := []byte(`{"action":"queued"}`)
+
+	// Copies of a delivery received at once are claimed by a single caller
+	const copies = 10
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	for range copies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			process, err := db.RecordDelivery(ctx, "guid-1", "workflow_job", payload, receivedAt)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if process {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := claimed.Load(); n != 1 {
+		t.Errorf("Expected one copy to claim the delivery, got %d", n)
+	}
+
+	deliveries, err := db.GetDeliveries(ctx, models.DeliveryFilter{})
+	if err != nil || len(deliveries) != 1 || deliveries[0].Attempts != copies {
+		t.Errorf("Expected one delivery with %d attempts, got %+v (%v)", copies, deliveries, err)
+	}
+}
+
+func testDeliveryRetention(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	payload := []byte(`{"action":"queued"}`)
+
+	for id, age := range map[string]time.Duration{"old": 100 * 24 * time.Hour, "recent": time.Hour} {
+		if _, err := db.RecordDelivery(ctx, id, "workflow_job", payload, now.Add(-age)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// Deliveries are kept as long as jobs, on every backend
+	if err := db.ApplyRetentionPolicies(ctx, models.RetentionPolicies{
+		Raw:       30 * 24 * time.Hour,
+		Jobs:      60 * 24 * time.Hour,
+		Durations: 30 * 24 * time.Hour,
+		Rollup1m:  90 * 24 * time.Hour,
+		Rollup15m: 365 * 24 * time.Hour,
+		Rollup1h:  2 * 365 * 24 * time.Hour,
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	deliveries, err := db.GetDeliveries(ctx, models.DeliveryFilter{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].ID != "recent" {
+		t.Errorf("Expected only the recent delivery to be kept, got %+v", deliveries)
+	}
+
+	policies, err := db.GetRetentionPolicies(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var found bool
+	for _, policy := range policies {
+		if policy.Table == "webhook_deliveries" {
+			found = policy.DataClass == "jobs" && policy.DropAfter == "60 days"
+		}
+	}
+	if !found {
+		t.Errorf("Expected the deliveries to be reported with the jobs retention, got %+v", policies)
+	}
+}
+
+func testJobEvents(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	createdAt := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	startedAt := createdAt.Add(2 * time.Minute)
+
+	if _, found, err := db.GetJob(ctx, 1); err != nil || found {
+		t.Errorf("Expected no job before it is stored, got %v (%v)", found, err)
+	}
+
+	// A re-run job shares nothing but its ID with an older one, which GetJob passes over
+	addJob(t, db, models.WorkflowJob{ID: 1, Status: models.JobStatusCompleted, CreatedAt: createdAt.Add(-24 * time.Hour)})
+	addJob(t, db, models.WorkflowJob{ID: 1, Status: models.JobStatusInProgress, CreatedAt: createdAt, StartedAt: startedAt, RunnerName: "runner-1"})
+
+	job, found, err := db.GetJob(ctx, 1)
+	if err != nil || !found {
+		t.Fatalf("Expected the job to be found, got %v (%v)", found, err)
+	}
+	if !job.CreatedAt.Equal(createdAt) || job.Status != models.JobStatusInProgress || job.RunnerName != "runner-1" {
+		t.Errorf("Expected the most recently created job, got %+v", job)
+	}
+
+	// Events are returned in the order they arrived, whatever the order they were stored in
+	queued := models.JobEvent{JobID: 1, JobCreatedAt: createdAt, DeliveryID: "d1", Action: "queued", ReceivedAt: createdAt.Add(time.Second)}
+	started := models.JobEvent{
+		JobID: 1, JobCreatedAt: createdAt, DeliveryID: "d2", Action: "in_progress", ReceivedAt: startedAt.Add(time.Second),
+		StartedAt: startedAt, RunnerID: 3, RunnerName: "runner-1", RunnerGroupName: "Default",
+	}
+	undelivered := models.JobEvent{JobID: 1, JobCreatedAt: createdAt, Action: "in_progress", ReceivedAt: startedAt.Add(2 * time.Second)}
+	other := models.JobEvent{JobID: 1, JobCreatedAt: createdAt.Add(-24 * time.Hour), DeliveryID: "d0", Action: "completed", ReceivedAt: createdAt}
+
+	// A replayed delivery is recorded once, but events without a delivery ID are all kept
+	for _, event := range []models.JobEvent{started, queued, other, started, undelivered, undelivered} {
+		if err := db.AddJobEvent(ctx, event); err != nil {
+			t.Fatalf("Expected no error adding event, got %v", err)
+		}
+	}
+
+	events, err := db.GetJobEvents(ctx, 1, createdAt)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events, got %+v", events)
+	}
+	for i, expected := range []models.JobEvent{queued, started, undelivered, undelivered} {
+		got := events[i]
+		if got.JobID != expected.JobID || !got.JobCreatedAt.Equal(expected.JobCreatedAt) || got.DeliveryID != expected.DeliveryID ||
+			got.Action != expected.Action || !got.ReceivedAt.Equal(expected.ReceivedAt) || !got.StartedAt.Equal(expected.StartedAt) ||
+			!got.CompletedAt.IsZero() || got.RunnerID != expected.RunnerID || got.RunnerName != expected.RunnerName ||
+			got.RunnerGroupName != expected.RunnerGroupName {
+			t.Errorf("Expected event %d to be %+v, got %+v", i, expected, got)
+		}
+	}
+
+	if events, err := db.GetJobEvents(ctx, 2, createdAt); err != nil || len(events) != 0 {
+		t.Errorf("Expected no events of an unknown job, got %+v (%v)", events, err)
+	}
+}
+
+func testAPITokens(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	read := models.APIToken{ID: "a1", Name: "grafana", Hash: "hash-1", Scope: models.TokenScopeRead, CreatedAt: createdAt}
+	admin := models.APIToken{ID: "b2", Name: "ops", Hash: "hash-2", Scope: models.TokenScopeAdmin, CreatedAt: createdAt.Add(time.Minute), ExpiresAt: createdAt.Add(time.Hour)}
+
+	for _, token := range []models.APIToken{admin, read} {
+		if err := db.CreateAPIToken(ctx, token); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := db.CreateAPIToken(ctx, models.APIToken{ID: "c3", Name: "copy", Hash: "hash-1", Scope: models.TokenScopeRead, CreatedAt: createdAt}); err == nil {
+		t.Error("Expected an error creating a token with an existing hash")
+	}
+
+	token, found, err := db.GetAPIToken(ctx, "hash-2")
+	if err != nil || !found {
+		t.Fatalf("Expected the token to be found, got %v (%v)", found, err)
+	}
+	if token.ID != admin.ID || token.Name != admin.Name || token.Hash != admin.Hash || token.Scope != admin.Scope ||
+		!token.CreatedAt.Equal(admin.CreatedAt) || !token.ExpiresAt.Equal(admin.ExpiresAt) || !token.RevokedAt.IsZero() {
+		t.Errorf("Expected the stored token %+v, got %+v", admin, token)
+	}
+	if _, found, err := db.GetAPIToken(ctx, "unknown"); err != nil || found {
+		t.Errorf("Expected an unknown hash not to be found, got %v (%v)", found, err)
+	}
+
+	// The first revocation time is kept
+	revokedAt := createdAt.Add(2 * time.Minute)
+	for _, at := range []time.Time{revokedAt, revokedAt.Add(time.Minute)} {
+		if found, err := db.RevokeAPIToken(ctx, read.ID, at); err != nil || !found {
+			t.Errorf("Expected the token to be revoked, got %v (%v)", found, err)
+		}
+	}
+	if found, err := db.RevokeAPIToken(ctx, "unknown", revokedAt); err != nil || found {
+		t.Errorf("Expected an unknown token not to be found, got %v (%v)", found, err)
+	}
+
+	// Tokens are listed in the order they were created
+	tokens, err := db.ListAPITokens(ctx)
+	if err != nil || len(tokens) != 2 {
+		t.Fatalf("Expected 2 tokens, got %+v (%v)", tokens, err)
+	}
+	if tokens[0].ID != read.ID || tokens[1].ID != admin.ID {
+		t.Errorf("Expected tokens ordered by creation, got %+v", tokens)
+	}
+	if !tokens[0].RevokedAt.Equal(revokedAt) || !tokens[0].ExpiresAt.IsZero() || !tokens[1].RevokedAt.IsZero() {
+		t.Errorf("Expected the revocation and expiry to be returned, got %+v", tokens)
+	}
+}
+
+func testReaper(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	addJob(t, db, models.WorkflowJob{ID: 1, Status: models.JobStatusQueued, CreatedAt: now.Add(-3 * time.Hour)})
+	addJob(t, db, models.WorkflowJob{ID: 2, Status: models.JobStatusQueued, CreatedAt: now.Add(-3 * time.Hour), QueuedAt: now.Add(-10 * time.Minute)})
+	addJob(t, db, models.WorkflowJob{ID: 3, Status: models.JobStatusInProgress, CreatedAt: now.Add(-3 * time.Hour), StartedAt: now.Add(-3 * time.Hour)})
+
+	reaped, err := db.ReapStaleJobs(ctx, models.JobStatusQueued, time.Hour)
+	if err != nil || reaped != 1 {
+		t.Errorf("Expected 1 reaped job, got %d (%v)", reaped, err)
+	}
+	if count, err := db.CountQueuedJobs(ctx); err != nil || count != 1 {
+		t.Errorf("Expected 1 queued job left, got %d (%v)", count, err)
+	}
+
+	if _, err := db.ReapStaleJobs(ctx, models.JobStatusCompleted, time.Hour); err == nil {
+		t.Error("Expected an error reaping completed jobs")
+	}
+}
+
+func testRetention(t *testing.T, db database.DatabaseInterface) {
+	ctx := context.Background()
+	if policies, err := db.GetRetentionPolicies(ctx); err != nil || len(policies) != 0 {
+		t.Errorf("Expected no policies before they are applied, got %+v (%v)", policies, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, age := range []time.Duration{3 * time.Hour, 10 * time.Minute} {
+		if err := db.AddHistoricalEntry(ctx, models.HistoricalEntry{Timestamp: now.Add(-age).Format(time.RFC3339), CountSelfHosted: 1, PeakTotal: 1}); err != nil {
+			t.Fatalf("Expected no error adding entry, got %v", err)
+		}
+	}
+	addJob(t, db, models.WorkflowJob{ID: 1, Status: models.JobStatusQueued, CreatedAt: now.Add(-3 * time.Hour)})
+	if err := db.AddJobEvent(ctx, models.JobEvent{JobID: 1, JobCreatedAt: now.Add(-3 * time.Hour), Action: "queued", ReceivedAt: now.Add(-3 * time.Hour)}); err != nil {
+		t.Fatalf("Expected no error adding event, got %v", err)
+	}
+
+	if err := db.ApplyRetentionPolicies(ctx, models.RetentionPolicies{Raw: time.Hour, Jobs: time.Hour}); err == nil {
+		t.Error("Expected an error for a missing retention")
+	}
+
+	if err := db.ApplyRetentionPolicies(ctx, models.RetentionPolicies{Raw: time.Hour, Jobs: time.Hour, Durations: 24 * time.Hour}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := db.GetHistoricalDataByRange(ctx, models.TimeRange{From: now.Add(-24 * time.Hour), To: now, Step: time.Minute})
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the recent sample to be kept, got %+v (%v)", entries, err)
+	}
+	if count, err := db.CountQueuedJobs(ctx); err != nil || count != 0 {
+		t.Errorf("Expected the old job to be dropped, got %d (%v)", count, err)
+	}
+	if events, err := db.GetJobEvents(ctx, 1, now.Add(-3*time.Hour)); err != nil || len(events) != 0 {
+		t.Errorf("Expected the events of the old job to be dropped, got %+v (%v)", events, err)
+	}
+
+	policies, err := db.GetRetentionPolicies(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	drops := make(map[string]string)
+	for _, policy := range policies {
+		drops[policy.Table] = policy.DropAfter
+	}
+	if drops["historical_entries"] != "3600 seconds" || drops["queue_time_durations"] != "1 days" {
+		t.Errorf("Expected the configured retention of each table, got %+v", policies)
+	}
+	if _, ok := drops["runner_stats_1m"]; ok {
+		t.Errorf("Expected no rollups, got %+v", policies)
+	}
+}
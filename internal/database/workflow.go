@@ -1,48 +1,217 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/gateixeira/rpulse/internal/jobstate"
 	"github.com/gateixeira/rpulse/models"
+	"github.com/lib/pq"
 )
 
-// AddOrUpdateJob adds or updates a job to the database with retries
-func (db *DBWrapper) AddOrUpdateJob(ID int64, status models.JobStatus,
-	runnerType models.RunnerType, createdAt time.Time, startedAt time.Time, completedAt time.Time) error {
+// jobColumns lists the workflow_jobs columns in the order of jobArgs and scanJob
+const jobColumns = `id, status, runner_type, run_id, run_attempt, workflow_name, job_name,
+	head_branch, head_sha, conclusion, labels, runner_id, runner_name, runner_group_id,
+	runner_group_name, repository_id, repository_full_name, organization_id, organization_login,
+	enterprise_id, enterprise_slug, created_at, started_at, completed_at, runner_pool,
+	waiting_at, queued_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// AddOrUpdateJob merges a job event into the stored job state with retries and returns
+// the merged state, and whether the event moved the job to a new status. Stale events
+// never move the status backwards; see jobstate.Merge.
+func (db *DBWrapper) AddOrUpdateJob(ctx context.Context, job models.WorkflowJob) (models.WorkflowJob, bool, error) {
 	var err error
+	var merged models.WorkflowJob
+	var statusChanged bool
 	maxRetries := 3
 
 	for i := 0; i < maxRetries; i++ {
-		_, err = DB.Exec(
-			`INSERT INTO workflow_jobs (id, status, runner_type, created_at, started_at, completed_at) 
-			VALUES ($1, $2, $3, $4, $5, $6)
-			ON CONFLICT (id, created_at) DO UPDATE SET
-				status = EXCLUDED.status,
-				runner_type = EXCLUDED.runner_type,
-				started_at = EXCLUDED.started_at,
-				completed_at = EXCLUDED.completed_at`,
-			ID, string(status), string(runnerType), createdAt, startedAt, completedAt,
-		)
+		merged, statusChanged, err = db.mergeJob(ctx, job)
 		if err == nil {
-			return nil
+			return merged, statusChanged, nil
+		}
+		// Wait a bit before retrying, unless the caller gave up
+		select {
+		case <-ctx.Done():
+			return models.WorkflowJob{}, false, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
 		}
-		// Wait a bit before retrying
-		time.Sleep(time.Millisecond * 100)
 	}
-	return err
+	return models.WorkflowJob{}, false, err
+}
+
+// mergeJob locks the stored job row, merges the incoming event into it and writes it back
+func (db *DBWrapper) mergeJob(ctx context.Context, incoming models.WorkflowJob) (models.WorkflowJob, bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return models.WorkflowJob{}, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	current, err := scanJob(tx.QueryRowContext(ctx,
+		"SELECT "+jobColumns+" FROM workflow_jobs WHERE id = $1 AND created_at = $2 FOR UPDATE",
+		incoming.ID, incoming.CreatedAt,
+	))
+
+	var merged models.WorkflowJob
+	switch {
+	case err == sql.ErrNoRows:
+		merged = jobstate.Merge(models.WorkflowJob{}, incoming)
+		result, err := tx.ExecContext(ctx,
+			`INSERT INTO workflow_jobs (`+jobColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27)
+			ON CONFLICT (id, created_at) DO NOTHING`,
+			jobArgs(merged)...,
+		)
+		if err != nil {
+			return models.WorkflowJob{}, false, err
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return models.WorkflowJob{}, false, err
+		} else if rows == 0 {
+			return models.WorkflowJob{}, false, errors.New("job was inserted concurrently")
+		}
+	case err != nil:
+		return models.WorkflowJob{}, false, err
+	default:
+		merged = jobstate.Merge(current, incoming)
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE workflow_jobs SET status = $2, runner_type = $3, run_id = $4, run_attempt = $5,
+				workflow_name = $6, job_name = $7, head_branch = $8, head_sha = $9, conclusion = $10,
+				labels = $11, runner_id = $12, runner_name = $13, runner_group_id = $14,
+				runner_group_name = $15, repository_id = $16, repository_full_name = $17,
+				organization_id = $18, organization_login = $19, enterprise_id = $20,
+				enterprise_slug = $21, started_at = $23, completed_at = $24, runner_pool = $25,
+				waiting_at = $26, queued_at = $27
+			WHERE id = $1 AND created_at = $22`,
+			jobArgs(merged)...,
+		); err != nil {
+			return models.WorkflowJob{}, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.WorkflowJob{}, false, err
+	}
+	return merged, merged.Status != current.Status, nil
+}
+
+// jobArgs returns the query arguments for a job in the order of jobColumns
+func jobArgs(job models.WorkflowJob) []any {
+	labels := job.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+
+	return []any{
+		job.ID,
+		string(job.Status),
+		string(job.RunnerType),
+		nullInt64(job.RunID),
+		nullInt64(int64(job.RunAttempt)),
+		nullString(job.WorkflowName),
+		nullString(job.Name),
+		nullString(job.HeadBranch),
+		nullString(job.HeadSHA),
+		nullString(job.Conclusion),
+		pq.Array(labels),
+		nullInt64(job.RunnerID),
+		nullString(job.RunnerName),
+		nullInt64(job.RunnerGroupID),
+		nullString(job.RunnerGroupName),
+		nullInt64(job.Repository.ID),
+		nullString(job.Repository.FullName),
+		nullInt64(job.Organization.ID),
+		nullString(job.Organization.Login),
+		nullInt64(job.Enterprise.ID),
+		nullString(job.Enterprise.Slug),
+		job.CreatedAt,
+		nullTime(job.StartedAt),
+		nullTime(job.CompletedAt),
+		nullString(job.RunnerPool),
+		nullTime(job.WaitingAt),
+		nullTime(job.QueuedAt),
+	}
+}
+
+// scanJob reads a job selected with jobColumns
+func scanJob(row rowScanner) (models.WorkflowJob, error) {
+	var job models.WorkflowJob
+	var runnerType, runnerPool, workflowName, name, headBranch, headSHA, conclusion sql.NullString
+	var runnerName, runnerGroupName, repositoryName, organizationLogin, enterpriseSlug sql.NullString
+	var runID, runAttempt, runnerID, runnerGroupID, repositoryID, organizationID, enterpriseID sql.NullInt64
+	var waitingAt, queuedAt, startedAt, completedAt sql.NullTime
+
+	err := row.Scan(
+		&job.ID, &job.Status, &runnerType, &runID, &runAttempt, &workflowName, &name,
+		&headBranch, &headSHA, &conclusion, pq.Array(&job.Labels), &runnerID, &runnerName, &runnerGroupID,
+		&runnerGroupName, &repositoryID, &repositoryName, &organizationID, &organizationLogin,
+		&enterpriseID, &enterpriseSlug, &job.CreatedAt, &startedAt, &completedAt, &runnerPool,
+		&waitingAt, &queuedAt,
+	)
+	if err != nil {
+		return models.WorkflowJob{}, err
+	}
+
+	job.RunnerType = models.RunnerType(runnerType.String)
+	job.RunnerPool = runnerPool.String
+	job.RunID = runID.Int64
+	job.RunAttempt = int(runAttempt.Int64)
+	job.WorkflowName = workflowName.String
+	job.Name = name.String
+	job.HeadBranch = headBranch.String
+	job.HeadSHA = headSHA.String
+	job.Conclusion = conclusion.String
+	job.RunnerID = runnerID.Int64
+	job.RunnerName = runnerName.String
+	job.RunnerGroupID = runnerGroupID.Int64
+	job.RunnerGroupName = runnerGroupName.String
+	job.Repository = models.Repository{ID: repositoryID.Int64, FullName: repositoryName.String}
+	job.Organization = models.Organization{ID: organizationID.Int64, Login: organizationLogin.String}
+	job.Enterprise = models.Enterprise{ID: enterpriseID.Int64, Slug: enterpriseSlug.String}
+	job.WaitingAt = waitingAt.Time
+	job.QueuedAt = queuedAt.Time
+	job.StartedAt = startedAt.Time
+	job.CompletedAt = completedAt.Time
+
+	return job, nil
 }
 
 // CountQueuedJobs returns the count of queued jobs
-func (db *DBWrapper) CountQueuedJobs() (int, error) {
+func (db *DBWrapper) CountQueuedJobs(ctx context.Context) (int, error) {
+	return db.countJobs(ctx, models.JobStatusQueued)
+}
+
+// CountWaitingJobs returns the count of jobs waiting on deployment protection rules
+func (db *DBWrapper) CountWaitingJobs(ctx context.Context) (int, error) {
+	return db.countJobs(ctx, models.JobStatusWaiting)
+}
+
+func (db *DBWrapper) countJobs(ctx context.Context, status models.JobStatus) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM workflow_jobs WHERE status = $1", string(models.JobStatusQueued)).Scan(&count)
+	err := db.pool.QueryRowContext(ctx, "SELECT COUNT(*) FROM workflow_jobs WHERE status = $1", string(status)).Scan(&count)
 	return count, err
 }
 
 // GetRunningJobs returns all running workflow jobs of a specific type
-func (db *DBWrapper) GetRunningJobs(runnerType models.RunnerType) ([]string, error) {
-	rows, err := DB.Query(
+func (db *DBWrapper) GetRunningJobs(ctx context.Context, runnerType models.RunnerType) ([]string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
 		"SELECT id FROM workflow_jobs WHERE runner_type = $1 AND status = $2",
 		string(runnerType), string(models.JobStatusInProgress),
 	)
@@ -63,19 +232,73 @@ func (db *DBWrapper) GetRunningJobs(runnerType models.RunnerType) ([]string, err
 	return IDs, nil
 }
 
-// AddQueueTimeDuration adds a record of queue duration to the database
-func (db *DBWrapper) AddQueueTimeDuration(ID int64, createdAt time.Time, duration time.Duration) error {
-	_, err := DB.Exec(
-		"INSERT INTO queue_time_durations (job_id, job_created_at, duration_ms, recorded_at) VALUES ($1, $2, $3, $4)",
-		ID, createdAt, duration.Milliseconds(), time.Now(),
+// AddQueueTimeDuration adds a record of queue duration to the database, at the time the job started.
+// A job that already has one keeps it, so reprocessing its deliveries records it once.
+func (db *DBWrapper) AddQueueTimeDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	return db.addDuration(ctx, "queue_time_durations", ID, createdAt, pool, duration, recordedAt)
+}
+
+// AddApprovalWaitDuration adds a record of how long a job waited for deployment protection rules,
+// at the time it was approved. A job that already has one keeps it.
+func (db *DBWrapper) AddApprovalWaitDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	return db.addDuration(ctx, "approval_wait_durations", ID, createdAt, pool, duration, recordedAt)
+}
+
+// addDuration adds a job's duration to a durations table unless the job already has one there,
+// and reports whether it did. TimescaleDB unique indexes must include recorded_at, so the job's
+// row is looked up under a lock on the job instead, and a duration added again at another time
+// is still recorded once.
+func (db *DBWrapper) addDuration(ctx context.Context, table string, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2::text))", table, ID); err != nil {
+		return false, err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO `+table+` (job_id, job_created_at, duration_ms, recorded_at, runner_pool)
+		SELECT $1::bigint, $2::timestamptz, $3::bigint, $4::timestamptz, $5::text
+		WHERE NOT EXISTS (SELECT 1 FROM `+table+` WHERE job_id = $1 AND job_created_at = $2)`,
+		ID, createdAt, duration.Milliseconds(), recordedAt, nullString(pool),
 	)
-	return err
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return rows > 0, nil
 }
 
-// GetAverageQueueTime calculates and returns the average queue time
-func (db *DBWrapper) GetAverageQueueTime() (time.Duration, error) {
+// GetAverageApprovalWaitTime calculates and returns the average approval wait time of the jobs approved in a period
+func (db *DBWrapper) GetAverageApprovalWaitTime(ctx context.Context, period string) (time.Duration, error) {
+	return db.averageDuration(ctx, "approval_wait_durations", period)
+}
+
+// averageDuration returns the average of the duration_ms column of a durations table over a period
+func (db *DBWrapper) averageDuration(ctx context.Context, table, period string) (time.Duration, error) {
+	condition, err := periodCondition("recorded_at", period)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var avgMilliseconds sql.NullFloat64
-	err := DB.QueryRow("SELECT AVG(duration_ms) FROM queue_time_durations").Scan(&avgMilliseconds)
+	err = db.pool.QueryRowContext(ctx, "SELECT AVG(duration_ms) FROM "+table+" WHERE "+condition).Scan(&avgMilliseconds)
 	if err != nil {
 		return 0, err
 	}
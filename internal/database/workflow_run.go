@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"github.com/gateixeira/rpulse/models"
+)
+
+// AddOrUpdateWorkflowRun adds or updates a workflow run attempt in the database
+func (db *DBWrapper) AddOrUpdateWorkflowRun(ctx context.Context, run models.WorkflowRun) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx,
+		`INSERT INTO workflow_runs (id, run_attempt, workflow_id, workflow_name, event, status, conclusion,
+			created_at, run_started_at, completed_at, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id, run_attempt, created_at) DO UPDATE SET
+			workflow_id = EXCLUDED.workflow_id,
+			workflow_name = EXCLUDED.workflow_name,
+			event = EXCLUDED.event,
+			status = EXCLUDED.status,
+			conclusion = EXCLUDED.conclusion,
+			run_started_at = EXCLUDED.run_started_at,
+			completed_at = EXCLUDED.completed_at,
+			duration_ms = EXCLUDED.duration_ms`,
+		run.ID, run.RunAttempt, run.WorkflowID, run.WorkflowName, run.Event, run.Status,
+		nullString(run.Conclusion), run.CreatedAt, nullTime(run.RunStartedAt), nullTime(run.CompletedAt),
+		nullDurationMs(run.Duration),
+	)
+	return err
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gateixeira/rpulse/models"
+)
+
+func TestAddOrUpdateWorkflowRun(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+
+	createdAt := time.Now()
+	startedAt := createdAt.Add(time.Minute)
+
+	t.Run("in progress run", func(t *testing.T) {
+		run := models.WorkflowRun{
+			ID:           987,
+			RunAttempt:   1,
+			WorkflowID:   55,
+			WorkflowName: "CI",
+			Event:        "push",
+			Status:       "in_progress",
+			CreatedAt:    createdAt,
+			RunStartedAt: startedAt,
+		}
+
+		mock.ExpectExec("INSERT INTO workflow_runs").
+			WithArgs(run.ID, run.RunAttempt, run.WorkflowID, run.WorkflowName, run.Event, run.Status,
+				nil, createdAt, startedAt, nil, nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		if err := dbWrapper.AddOrUpdateWorkflowRun(ctx, run); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("completed run", func(t *testing.T) {
+		completedAt := startedAt.Add(10 * time.Minute)
+		run := models.WorkflowRun{
+			ID:           987,
+			RunAttempt:   1,
+			WorkflowID:   55,
+			WorkflowName: "CI",
+			Event:        "push",
+			Status:       "completed",
+			Conclusion:   "failure",
+			CreatedAt:    createdAt,
+			RunStartedAt: startedAt,
+			CompletedAt:  completedAt,
+			Duration:     10 * time.Minute,
+		}
+
+		mock.ExpectExec("INSERT INTO workflow_runs").
+			WithArgs(run.ID, run.RunAttempt, run.WorkflowID, run.WorkflowName, run.Event, run.Status,
+				"failure", createdAt, startedAt, completedAt, int64(600000)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		if err := dbWrapper.AddOrUpdateWorkflowRun(ctx, run); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
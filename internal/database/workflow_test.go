@@ -1,7 +1,10 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,45 +12,175 @@ import (
 	"github.com/gateixeira/rpulse/models"
 )
 
+// jobRow returns the values a SELECT of jobColumns yields for a stored job
+func jobValues(job models.WorkflowJob) []driver.Value {
+	args := jobArgs(job)
+	row := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if valuer, ok := arg.(driver.Valuer); ok {
+			row[i], _ = valuer.Value()
+			continue
+		}
+		row[i] = arg
+	}
+	return row
+}
+
 func TestAddOrUpdateJob(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 	defer db.Close()
 
-	DB = db
-	dbWrapper := &DBWrapper{}
+	dbWrapper := NewDBWrapper(db, 0)
 
-	jobID := int64(123)
-	status := models.JobStatusQueued
-	runnerType := models.RunnerTypeSelfHosted
 	createdAt := time.Now()
 	startedAt := createdAt.Add(time.Minute)
 	completedAt := startedAt.Add(time.Minute)
+	columns := strings.Split(strings.Join(strings.Fields(jobColumns), ""), ",")
+
+	base := models.WorkflowJob{
+		ID:              123,
+		RunnerType:      models.RunnerTypeSelfHosted,
+		RunnerPool:      "linux",
+		RunID:           987,
+		RunAttempt:      1,
+		WorkflowName:    "CI",
+		Name:            "build",
+		HeadBranch:      "main",
+		HeadSHA:         "abc123",
+		Labels:          []string{"self-hosted", "linux"},
+		RunnerGroupID:   7,
+		RunnerGroupName: "Default",
+		Repository:      models.Repository{ID: 1001, FullName: "octo-org/app"},
+		Organization:    models.Organization{ID: 2002, Login: "octo-org"},
+		CreatedAt:       createdAt,
+	}
+	withStatus := func(status models.JobStatus, mutate func(*models.WorkflowJob)) models.WorkflowJob {
+		job := base
+		job.Status = status
+		if mutate != nil {
+			mutate(&job)
+		}
+		return job
+	}
 
-	// Successful insert case
-	mock.ExpectExec("INSERT INTO workflow_jobs").
-		WithArgs(jobID, string(status), string(runnerType), createdAt, startedAt, completedAt).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	queued := withStatus(models.JobStatusQueued, nil)
+	inProgress := withStatus(models.JobStatusInProgress, func(j *models.WorkflowJob) {
+		j.StartedAt = startedAt
+		j.RunnerID = 42
+		j.RunnerName = "runner-42"
+	})
+	completed := withStatus(models.JobStatusCompleted, func(j *models.WorkflowJob) {
+		j.StartedAt = startedAt
+		j.CompletedAt = completedAt
+		j.Conclusion = "success"
+		j.RunnerID = 42
+		j.RunnerName = "runner-42"
+	})
 
-	err = dbWrapper.AddOrUpdateJob(jobID, status, runnerType, createdAt, startedAt, completedAt)
-	if err != nil {
-		t.Errorf("Expected no error, got %v", err)
-	}
+	t.Run("new job is inserted with metadata", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM workflow_jobs (.+) FOR UPDATE").
+			WithArgs(base.ID, createdAt).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec("INSERT INTO workflow_jobs").
+			WithArgs(int64(123), string(models.JobStatusInProgress), string(models.RunnerTypeSelfHosted),
+				int64(987), int64(1), "CI", "build", "main", "abc123", nil,
+				"{\"self-hosted\",\"linux\"}", int64(42), "runner-42", int64(7), "Default",
+				int64(1001), "octo-org/app", int64(2002), "octo-org", nil, nil,
+				createdAt, startedAt, nil, "linux", nil, nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		_, _, err := dbWrapper.AddOrUpdateJob(ctx, inProgress)
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
 
-	// Test retry on error
-	mock.ExpectExec("INSERT INTO workflow_jobs").
-		WithArgs(jobID, string(status), string(runnerType), createdAt, startedAt, completedAt).
-		WillReturnError(sql.ErrConnDone)
-	mock.ExpectExec("INSERT INTO workflow_jobs").
-		WithArgs(jobID, string(status), string(runnerType), createdAt, startedAt, completedAt).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	t.Run("stale event does not regress status", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM workflow_jobs (.+) FOR UPDATE").
+			WithArgs(base.ID, createdAt).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(jobValues(completed)...))
+		mock.ExpectExec("UPDATE workflow_jobs SET").
+			WithArgs(jobValues(completed)...).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, statusChanged, err := dbWrapper.AddOrUpdateJob(ctx, queued)
+		if err != nil || statusChanged {
+			t.Errorf("Expected the status to stay, got %v (%v)", statusChanged, err)
+		}
+	})
 
-	err = dbWrapper.AddOrUpdateJob(jobID, status, runnerType, createdAt, startedAt, completedAt)
-	if err != nil {
-		t.Errorf("Expected no error after retry, got %v", err)
-	}
+	t.Run("newer event advances status and keeps metadata", func(t *testing.T) {
+		// The completed event lacks runner details; they are kept from the stored row
+		incoming := completed
+		incoming.StartedAt = time.Time{}
+		incoming.RunnerID = 0
+		incoming.RunnerName = ""
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM workflow_jobs (.+) FOR UPDATE").
+			WithArgs(base.ID, createdAt).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(jobValues(inProgress)...))
+		mock.ExpectExec("UPDATE workflow_jobs SET").
+			WithArgs(jobValues(completed)...).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		merged, statusChanged, err := dbWrapper.AddOrUpdateJob(ctx, incoming)
+		if err != nil || !statusChanged {
+			t.Errorf("Expected the status to change, got %v (%v)", statusChanged, err)
+		}
+		if merged.Status != models.JobStatusCompleted || merged.RunnerName != "runner-42" {
+			t.Errorf("Expected the merged job to be returned, got %+v", merged)
+		}
+	})
+
+	t.Run("retry on error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(sql.ErrConnDone)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM workflow_jobs (.+) FOR UPDATE").
+			WithArgs(base.ID, createdAt).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec("INSERT INTO workflow_jobs").
+			WithArgs(jobValues(queued)...).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		_, _, err := dbWrapper.AddOrUpdateJob(ctx, queued)
+		if err != nil {
+			t.Errorf("Expected no error after retry, got %v", err)
+		}
+	})
+
+	t.Run("retry on concurrent insert", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM workflow_jobs (.+) FOR UPDATE").
+			WithArgs(base.ID, createdAt).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec("INSERT INTO workflow_jobs").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM workflow_jobs (.+) FOR UPDATE").
+			WithArgs(base.ID, createdAt).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(jobValues(inProgress)...))
+		mock.ExpectExec("UPDATE workflow_jobs SET").
+			WithArgs(jobValues(inProgress)...).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, _, err := dbWrapper.AddOrUpdateJob(ctx, queued)
+		if err != nil {
+			t.Errorf("Expected no error after retry, got %v", err)
+		}
+	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("There were unfulfilled expectations: %s", err)
@@ -55,21 +188,21 @@ func TestAddOrUpdateJob(t *testing.T) {
 }
 
 func TestCountQueuedJobs(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 	defer db.Close()
 
-	DB = db
-	dbWrapper := &DBWrapper{}
+	dbWrapper := NewDBWrapper(db, 0)
 
 	rows := sqlmock.NewRows([]string{"count"}).AddRow(5)
 	mock.ExpectQuery("SELECT COUNT.*FROM workflow_jobs").
 		WithArgs(string(models.JobStatusQueued)).
 		WillReturnRows(rows)
 
-	count, err := dbWrapper.CountQueuedJobs()
+	count, err := dbWrapper.CountQueuedJobs(ctx)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -77,20 +210,63 @@ func TestCountQueuedJobs(t *testing.T) {
 		t.Errorf("Expected count of 5, got %d", count)
 	}
 
+	mock.ExpectQuery("SELECT COUNT.*FROM workflow_jobs").
+		WithArgs(string(models.JobStatusWaiting)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	count, err = dbWrapper.CountWaitingJobs(ctx)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected waiting count of 2, got %d", count)
+	}
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
 
+func TestQueryTimeout(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 10*time.Millisecond)
+
+	mock.ExpectQuery("SELECT COUNT.*FROM workflow_jobs").
+		WithArgs(string(models.JobStatusQueued)).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+	if _, err := dbWrapper.CountQueuedJobs(ctx); err == nil {
+		t.Error("Expected the query to time out")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	mock.ExpectQuery("SELECT COUNT.*FROM workflow_jobs").
+		WithArgs(string(models.JobStatusQueued)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+	if _, err := dbWrapper.CountQueuedJobs(cancelled); err == nil {
+		t.Error("Expected the query to be cancelled")
+	}
+}
+
 func TestGetRunningJobs(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 	defer db.Close()
 
-	DB = db
-	dbWrapper := &DBWrapper{}
+	dbWrapper := NewDBWrapper(db, 0)
 
 	expectedIDs := []string{"123", "456", "789"}
 	rows := sqlmock.NewRows([]string{"id"})
@@ -102,7 +278,7 @@ func TestGetRunningJobs(t *testing.T) {
 		WithArgs(string(models.RunnerTypeSelfHosted), string(models.JobStatusInProgress)).
 		WillReturnRows(rows)
 
-	ids, err := dbWrapper.GetRunningJobs(models.RunnerTypeSelfHosted)
+	ids, err := dbWrapper.GetRunningJobs(ctx, models.RunnerTypeSelfHosted)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -123,50 +299,97 @@ func TestGetRunningJobs(t *testing.T) {
 }
 
 func TestAddQueueTimeDuration(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 	defer db.Close()
 
-	DB = db
-	dbWrapper := &DBWrapper{}
+	dbWrapper := NewDBWrapper(db, 0)
 
 	jobID := int64(123)
 	createdAt := time.Now()
 	duration := time.Duration(5 * time.Minute)
 
-	mock.ExpectExec("INSERT INTO queue_time_durations").
-		WithArgs(jobID, createdAt, duration.Milliseconds(), sqlmock.AnyArg()).
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs("queue_time_durations", jobID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO queue_time_durations (.+) WHERE NOT EXISTS \(SELECT 1 FROM queue_time_durations WHERE job_id = \$1 AND job_created_at = \$2\)`).
+		WithArgs(jobID, createdAt, duration.Milliseconds(), createdAt.Add(duration), "gpu").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	recorded, err := dbWrapper.AddQueueTimeDuration(ctx, jobID, createdAt, "gpu", duration, createdAt.Add(duration))
+	if err != nil || !recorded {
+		t.Errorf("Expected the queue time to be recorded, got %v (%v)", recorded, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddApprovalWaitDuration(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	dbWrapper := NewDBWrapper(db, 0)
+
+	jobID := int64(123)
+	createdAt := time.Now()
+	duration := 10 * time.Minute
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs("approval_wait_durations", jobID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO approval_wait_durations (.+) WHERE NOT EXISTS \(SELECT 1 FROM approval_wait_durations WHERE job_id = \$1 AND job_created_at = \$2\)`).
+		WithArgs(jobID, createdAt, duration.Milliseconds(), createdAt.Add(duration), "deploy").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT AVG.*FROM approval_wait_durations").
+		WillReturnRows(sqlmock.NewRows([]string{"avg"}).AddRow(float64(600000)))
+
+	if recorded, err := dbWrapper.AddApprovalWaitDuration(ctx, jobID, createdAt, "deploy", duration, createdAt.Add(duration)); err != nil || !recorded {
+		t.Errorf("Expected the approval wait to be recorded, got %v (%v)", recorded, err)
+	}
 
-	err = dbWrapper.AddQueueTimeDuration(jobID, createdAt, duration)
+	avgDuration, err := dbWrapper.GetAverageApprovalWaitTime(ctx, "hour")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
+	if avgDuration != duration {
+		t.Errorf("Expected duration %v, got %v", duration, avgDuration)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
 
-func TestGetAverageQueueTime(t *testing.T) {
+func TestGetAverageApprovalWaitTime(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Error creating mock database: %v", err)
 	}
 	defer db.Close()
 
-	DB = db
-	dbWrapper := &DBWrapper{}
+	dbWrapper := NewDBWrapper(db, 0)
 
 	t.Run("with valid average", func(t *testing.T) {
 		expectedAvg := float64(300000) // 5 minutes in milliseconds
 		rows := sqlmock.NewRows([]string{"avg"}).AddRow(expectedAvg)
-		mock.ExpectQuery("SELECT AVG.*FROM queue_time_durations").
+		mock.ExpectQuery(`SELECT AVG.*FROM approval_wait_durations WHERE recorded_at >= NOW\(\) - INTERVAL '1 hour'`).
 			WillReturnRows(rows)
 
-		avgDuration, err := dbWrapper.GetAverageQueueTime()
+		avgDuration, err := dbWrapper.GetAverageApprovalWaitTime(ctx, "hour")
 		if err != nil {
 			t.Errorf("Expected no error, got %v", err)
 		}
@@ -179,10 +402,10 @@ func TestGetAverageQueueTime(t *testing.T) {
 
 	t.Run("with null average", func(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"avg"}).AddRow(nil)
-		mock.ExpectQuery("SELECT AVG.*FROM queue_time_durations").
+		mock.ExpectQuery("SELECT AVG.*FROM approval_wait_durations").
 			WillReturnRows(rows)
 
-		avgDuration, err := dbWrapper.GetAverageQueueTime()
+		avgDuration, err := dbWrapper.GetAverageApprovalWaitTime(ctx, "hour")
 		if err != nil {
 			t.Errorf("Expected no error, got %v", err)
 		}
@@ -192,6 +415,12 @@ func TestGetAverageQueueTime(t *testing.T) {
 		}
 	})
 
+	t.Run("with invalid period", func(t *testing.T) {
+		if _, err := dbWrapper.GetAverageApprovalWaitTime(ctx, "year"); err == nil {
+			t.Error("Expected an error for an invalid period")
+		}
+	})
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
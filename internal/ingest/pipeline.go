@@ -0,0 +1,178 @@
+// Package ingest processes webhook deliveries outside of the HTTP request.
+//
+// The webhook handler only validates a delivery and enqueues it. A bounded
+// queue feeds a pool of workers that do the database work, so GitHub's
+// delivery timeout is never spent waiting on the database. When the queue is
+// full, Enqueue fails and the handler answers 503 so GitHub retries later.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrQueueFull is returned by Enqueue when no queue slot is available
+	ErrQueueFull = errors.New("ingest queue is full")
+	// ErrClosed is returned by Enqueue once the pipeline is shutting down
+	ErrClosed = errors.New("ingest pipeline is shut down")
+)
+
+// Stats is a point-in-time view of the pipeline
+type Stats struct {
+	QueueDepth    int   `json:"queue_depth"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Workers       int   `json:"workers"`
+	Processed     int64 `json:"processed"`
+	Failed        int64 `json:"failed"`
+	Rejected      int64 `json:"rejected"`
+	AvgLatencyMs  int64 `json:"avg_latency_ms"`
+	MaxLatencyMs  int64 `json:"max_latency_ms"`
+}
+
+// Pipeline is a bounded in-process queue drained by a pool of workers
+type Pipeline struct {
+	processor *Processor
+	queue     chan Delivery
+	workers   int
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	processed    atomic.Int64
+	failed       atomic.Int64
+	rejected     atomic.Int64
+	totalLatency atomic.Int64
+	maxLatency   atomic.Int64
+}
+
+// NewPipeline creates a pipeline with the given number of workers and queue capacity
+func NewPipeline(processor *Processor, workers, queueSize int) *Pipeline {
+	return &Pipeline{
+		processor: processor,
+		queue:     make(chan Delivery, queueSize),
+		workers:   workers,
+	}
+}
+
+// Handles reports whether deliveries of the event type are processed by the pipeline
+func (p *Pipeline) Handles(event string) bool {
+	return p.processor.Handles(event)
+}
+
+// Start launches the workers
+func (p *Pipeline) Start() {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	logger.Logger.Info("Ingest pipeline started",
+		zap.Int("workers", p.workers),
+		zap.Int("queueSize", cap(p.queue)))
+}
+
+// Enqueue hands a delivery to the workers without blocking
+func (p *Pipeline) Enqueue(d Delivery) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	select {
+	case p.queue <- d:
+		return nil
+	default:
+		p.rejected.Add(1)
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting deliveries and waits for the queued ones to be processed
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Logger.Info("Ingest pipeline drained", zap.Int64("processed", p.processed.Load()))
+		return nil
+	case <-ctx.Done():
+		logger.Logger.Warn("Ingest pipeline did not drain in time", zap.Int("remaining", len(p.queue)))
+		return ctx.Err()
+	}
+}
+
+// Stats returns the current queue depth, counters and processing latency
+func (p *Pipeline) Stats() Stats {
+	stats := Stats{
+		QueueDepth:    len(p.queue),
+		QueueCapacity: cap(p.queue),
+		Workers:       p.workers,
+		Processed:     p.processed.Load(),
+		Failed:        p.failed.Load(),
+		Rejected:      p.rejected.Load(),
+		MaxLatencyMs:  time.Duration(p.maxLatency.Load()).Milliseconds(),
+	}
+
+	if done := stats.Processed + stats.Failed; done > 0 {
+		stats.AvgLatencyMs = time.Duration(p.totalLatency.Load() / done).Milliseconds()
+	}
+
+	return stats
+}
+
+func (p *Pipeline) work() {
+	defer p.wg.Done()
+
+	for d := range p.queue {
+		err := p.processor.Process(context.Background(), d)
+
+		// Latency covers the time spent queued as well as processing
+		latency := time.Since(d.ReceivedAt)
+		p.observeLatency(latency)
+
+		if err != nil {
+			p.failed.Add(1)
+			logger.Logger.Error("Failed to process delivery",
+				zap.Error(err),
+				zap.String("deliveryID", d.ID),
+				zap.String("event", d.Event))
+			continue
+		}
+
+		p.processed.Add(1)
+		logger.Logger.Debug("Processed delivery",
+			zap.String("deliveryID", d.ID),
+			zap.String("event", d.Event),
+			zap.Duration("latency", latency))
+	}
+}
+
+func (p *Pipeline) observeLatency(latency time.Duration) {
+	p.totalLatency.Add(int64(latency))
+	for {
+		current := p.maxLatency.Load()
+		if int64(latency) <= current || p.maxLatency.CompareAndSwap(current, int64(latency)) {
+			return
+		}
+	}
+}
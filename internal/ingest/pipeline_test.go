@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func newRunDelivery(id string) Delivery {
+	return Delivery{
+		ID:         id,
+		Event:      "workflow_run",
+		Payload:    []byte(`{"action": "requested", "workflow_run": {"id": 1}}`),
+		ReceivedAt: time.Now(),
+	}
+}
+
+func TestPipeline_EnqueueFull(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	pipeline := NewPipeline(newTestProcessor(new(mockDB), pools.Default()), 1, 2)
+
+	assert.NoError(t, pipeline.Enqueue(newRunDelivery("guid-1")))
+	assert.NoError(t, pipeline.Enqueue(newRunDelivery("guid-2")))
+	assert.ErrorIs(t, pipeline.Enqueue(newRunDelivery("guid-3")), ErrQueueFull)
+
+	stats := pipeline.Stats()
+	assert.Equal(t, 2, stats.QueueDepth)
+	assert.Equal(t, 2, stats.QueueCapacity)
+	assert.Equal(t, int64(1), stats.Rejected)
+}
+
+func TestPipeline_ShutdownDrainsQueue(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	db := new(mockDB)
+	db.On("AddOrUpdateWorkflowRun", mock.Anything).Return(nil).Times(2)
+	db.On("AddOrUpdateWorkflowRun", mock.Anything).Return(errors.New("database error")).Once()
+	db.On("MarkDeliveryProcessed", mock.Anything).Return(nil)
+	db.On("ReleaseDelivery", mock.Anything).Return(nil)
+
+	pipeline := NewPipeline(newTestProcessor(db, pools.Default()), 2, 10)
+
+	// Deliveries queued before the workers start are still processed
+	for _, id := range []string{"guid-1", "guid-2", "guid-3"} {
+		assert.NoError(t, pipeline.Enqueue(newRunDelivery(id)))
+	}
+	pipeline.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, pipeline.Shutdown(ctx))
+
+	stats := pipeline.Stats()
+	assert.Equal(t, 0, stats.QueueDepth)
+	assert.Equal(t, int64(2), stats.Processed)
+	assert.Equal(t, int64(1), stats.Failed)
+	assert.GreaterOrEqual(t, stats.MaxLatencyMs, stats.AvgLatencyMs)
+
+	assert.ErrorIs(t, pipeline.Enqueue(newRunDelivery("guid-4")), ErrClosed)
+	db.AssertNumberOfCalls(t, "MarkDeliveryProcessed", 2)
+	db.AssertNumberOfCalls(t, "ReleaseDelivery", 1)
+}
@@ -0,0 +1,237 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/jobstate"
+	"github.com/gateixeira/rpulse/internal/metrics"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/internal/sampler"
+	"github.com/gateixeira/rpulse/internal/utils"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Delivery is a validated webhook delivery waiting to be processed
+type Delivery struct {
+	ID         string
+	Event      string
+	Payload    []byte
+	ReceivedAt time.Time
+}
+
+// eventProcessor stores the delivery of a single event type
+type eventProcessor func(ctx context.Context, d Delivery) error
+
+// Processor performs the database work for webhook deliveries, dispatching on the event type
+type Processor struct {
+	db         database.DatabaseInterface
+	classifier *pools.Classifier
+	sampler    *sampler.Sampler
+	events     map[string]eventProcessor
+}
+
+// NewProcessor creates a Processor for the supported event types, assigning jobs to runner pools
+// with the classifier and reporting every stored job event to the demand sampler
+func NewProcessor(db database.DatabaseInterface, classifier *pools.Classifier, sampler *sampler.Sampler) *Processor {
+	p := &Processor{db: db, classifier: classifier, sampler: sampler}
+	p.events = map[string]eventProcessor{
+		"workflow_job": p.processWorkflowJob,
+		"workflow_run": p.processWorkflowRun,
+	}
+	return p
+}
+
+// Handles reports whether the processor knows how to process an event type
+func (p *Processor) Handles(event string) bool {
+	_, ok := p.events[event]
+	return ok
+}
+
+// Process stores a delivery and marks it as processed in the delivery log
+func (p *Processor) Process(ctx context.Context, d Delivery) error {
+	process, ok := p.events[d.Event]
+	if !ok {
+		return fmt.Errorf("unsupported event %q", d.Event)
+	}
+
+	if err := process(ctx, d); err != nil {
+		// Failed deliveries stay unprocessed and are released so a redelivery is handled again
+		p.release(ctx, d.ID)
+		return err
+	}
+
+	if d.ID != "" {
+		if err := p.db.MarkDeliveryProcessed(ctx, d.ID); err != nil {
+			logger.Logger.Error("Error marking delivery as processed", zap.Error(err), zap.String("deliveryID", d.ID))
+		}
+	}
+
+	return nil
+}
+
+// release gives up the claim on a delivery that was not processed
+func (p *Processor) release(ctx context.Context, deliveryID string) {
+	if deliveryID == "" {
+		return
+	}
+	if err := p.db.ReleaseDelivery(ctx, deliveryID); err != nil {
+		logger.Logger.Error("Error releasing delivery", zap.Error(err), zap.String("deliveryID", deliveryID))
+	}
+}
+
+// processWorkflowJob stores a workflow_job event and lets the sampler observe the new demand
+func (p *Processor) processWorkflowJob(ctx context.Context, d Delivery) error {
+	var event models.WebhookEvent
+	if err := json.Unmarshal(d.Payload, &event); err != nil {
+		return fmt.Errorf("failed to parse workflow_job payload: %w", err)
+	}
+
+	wj := event.WorkflowJob
+	job := models.WorkflowJob{
+		ID:              wj.ID,
+		Status:          models.JobStatus(event.Action),
+		RunnerType:      utils.GetRunnerType(wj.Labels),
+		RunnerPool:      p.classifier.Classify(wj.Labels),
+		RunID:           wj.RunID,
+		RunAttempt:      wj.RunAttempt,
+		WorkflowName:    wj.WorkflowName,
+		Name:            wj.Name,
+		HeadBranch:      wj.HeadBranch,
+		HeadSHA:         wj.HeadSHA,
+		Conclusion:      wj.Conclusion,
+		Labels:          wj.Labels,
+		RunnerID:        wj.RunnerID,
+		RunnerName:      wj.RunnerName,
+		RunnerGroupID:   wj.RunnerGroupID,
+		RunnerGroupName: wj.RunnerGroupName,
+		Repository:      event.Repository,
+		Organization:    event.Organization,
+		Enterprise:      event.Enterprise,
+		CreatedAt:       wj.CreatedAt,
+		StartedAt:       wj.StartedAt,
+		CompletedAt:     wj.CompletedAt,
+	}
+
+	// The payload has no timestamp for these transitions, so the delivery time is used
+	switch job.Status {
+	case models.JobStatusWaiting:
+		job.WaitingAt = d.ReceivedAt
+	case models.JobStatusQueued:
+		job.QueuedAt = d.ReceivedAt
+	}
+
+	merged, statusChanged, err := p.db.AddOrUpdateJob(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+
+	// The event is kept as received, next to the merged job state
+	if err := p.db.AddJobEvent(ctx, models.JobEvent{
+		JobID:           wj.ID,
+		JobCreatedAt:    wj.CreatedAt,
+		DeliveryID:      d.ID,
+		Action:          event.Action,
+		ReceivedAt:      d.ReceivedAt,
+		StartedAt:       wj.StartedAt,
+		CompletedAt:     wj.CompletedAt,
+		Conclusion:      wj.Conclusion,
+		RunnerID:        wj.RunnerID,
+		RunnerName:      wj.RunnerName,
+		RunnerGroupName: wj.RunnerGroupName,
+	}); err != nil {
+		return fmt.Errorf("failed to save job event: %w", err)
+	}
+
+	switch job.Status {
+	case models.JobStatusInProgress:
+		p.handleInProgressJob(ctx, merged)
+	case models.JobStatusCompleted:
+		// A job's duration is observed once, when it completes, however often the event is
+		// processed. Jobs cancelled before they started have no duration.
+		if statusChanged && merged.Status == models.JobStatusCompleted && !merged.StartedAt.IsZero() && !merged.CompletedAt.Before(merged.StartedAt) {
+			metrics.JobDuration.WithLabelValues(merged.RunnerPool).Observe(merged.CompletedAt.Sub(merged.StartedAt).Seconds())
+		}
+	}
+
+	// Peaks between two samples would be lost if the new counts were not observed. The event
+	// is already stored, so a failure only loses the peak and the delivery is not retried.
+	if err := p.sampler.Observe(ctx); err != nil {
+		logger.Logger.Error("Error observing demand", zap.Error(err), zap.String("deliveryID", d.ID))
+	}
+
+	return nil
+}
+
+func (p *Processor) handleInProgressJob(ctx context.Context, job models.WorkflowJob) {
+	logger.Logger.Debug("Job is running", zap.Int64("ID", job.ID))
+
+	// Durations are recorded at the time the wait ended rather than when the event is processed,
+	// so replayed deliveries count in the period the job started in. A job without a start time
+	// has no queue time to record.
+	if !job.StartedAt.IsZero() {
+		// Time spent waiting for approval is tracked apart so it does not count as runner queue time
+		queueTime := jobstate.QueueTime(job)
+
+		// The queue time is observed when it is first recorded, so reprocessed deliveries do not
+		// count it again
+		if recorded, err := p.db.AddQueueTimeDuration(ctx, job.ID, job.CreatedAt, job.RunnerPool, queueTime, job.StartedAt); err != nil {
+			logger.Logger.Error("Error adding queue time duration", zap.Error(err))
+			// Continue execution even if we fail to add queue time
+		} else if recorded {
+			metrics.QueueTime.WithLabelValues(job.RunnerPool).Observe(queueTime.Seconds())
+		}
+		logger.Logger.Debug("Job was in queue for", zap.Int64("ID", job.ID), zap.Duration("queueTime", queueTime))
+	}
+
+	if approvalWait, ok := jobstate.ApprovalWait(job); ok {
+		if _, err := p.db.AddApprovalWaitDuration(ctx, job.ID, job.CreatedAt, job.RunnerPool, approvalWait, job.QueuedAt); err != nil {
+			logger.Logger.Error("Error adding approval wait duration", zap.Error(err))
+		}
+		logger.Logger.Debug("Job waited for approval for", zap.Int64("ID", job.ID), zap.Duration("approvalWait", approvalWait))
+	}
+}
+
+// processWorkflowRun stores a workflow_run event as a run-level record
+func (p *Processor) processWorkflowRun(ctx context.Context, d Delivery) error {
+	var event models.WebhookWorkflowRunEvent
+	if err := json.Unmarshal(d.Payload, &event); err != nil {
+		return fmt.Errorf("failed to parse workflow_run payload: %w", err)
+	}
+
+	run := models.WorkflowRun{
+		ID:           event.WorkflowRun.ID,
+		RunAttempt:   event.WorkflowRun.RunAttempt,
+		WorkflowID:   event.WorkflowRun.WorkflowID,
+		WorkflowName: event.WorkflowRun.Name,
+		Event:        event.WorkflowRun.Event,
+		Status:       event.WorkflowRun.Status,
+		Conclusion:   event.WorkflowRun.Conclusion,
+		CreatedAt:    event.WorkflowRun.CreatedAt,
+		RunStartedAt: event.WorkflowRun.RunStartedAt,
+	}
+
+	if event.Action == "completed" {
+		run.CompletedAt = event.WorkflowRun.UpdatedAt
+		if !run.RunStartedAt.IsZero() {
+			run.Duration = run.CompletedAt.Sub(run.RunStartedAt)
+		}
+	}
+
+	if err := p.db.AddOrUpdateWorkflowRun(ctx, run); err != nil {
+		return fmt.Errorf("failed to save workflow run: %w", err)
+	}
+
+	logger.Logger.Debug("Workflow run stored",
+		zap.Int64("ID", run.ID),
+		zap.Int("attempt", run.RunAttempt),
+		zap.String("status", run.Status),
+	)
+
+	return nil
+}
@@ -0,0 +1,527 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/metrics"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/internal/sampler"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+// mockDB implements the DatabaseInterface methods used by the processor
+type mockDB struct {
+	database.DatabaseInterface
+	mock.Mock
+}
+
+func (m *mockDB) AddOrUpdateJob(ctx context.Context, job models.WorkflowJob) (models.WorkflowJob, bool, error) {
+	args := m.Called(job)
+	return args.Get(0).(models.WorkflowJob), args.Bool(1), args.Error(2)
+}
+
+func (m *mockDB) AddJobEvent(ctx context.Context, event models.JobEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *mockDB) GetRunningJobs(ctx context.Context, runnerType models.RunnerType) ([]string, error) {
+	args := m.Called(runnerType)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockDB) CountQueuedJobs(ctx context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockDB) CountWaitingJobs(ctx context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockDB) AddApprovalWaitDuration(ctx context.Context, jobID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	args := m.Called(jobID, createdAt, pool, duration, recordedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockDB) AddQueueTimeDuration(ctx context.Context, jobID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	args := m.Called(jobID, createdAt, pool, duration, recordedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockDB) CountRunningJobsByPool(ctx context.Context) (map[string]int, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *mockDB) CountQueuedJobsByPool(ctx context.Context) (map[string]int, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *mockDB) AddOrUpdateWorkflowRun(ctx context.Context, run models.WorkflowRun) error {
+	args := m.Called(run)
+	return args.Error(0)
+}
+
+func (m *mockDB) MarkDeliveryProcessed(ctx context.Context, deliveryID string) error {
+	args := m.Called(deliveryID)
+	return args.Error(0)
+}
+
+func (m *mockDB) ReleaseDelivery(ctx context.Context, deliveryID string) error {
+	args := m.Called(deliveryID)
+	return args.Error(0)
+}
+
+// newTestProcessor creates a processor whose sampler is never started, so only observations reach the database
+func newTestProcessor(db *mockDB, classifier *pools.Classifier) *Processor {
+	return NewProcessor(db, classifier, sampler.NewSampler(db, classifier, time.Minute, nil))
+}
+
+const workflowJobPayload = `{
+	"action": "in_progress",
+	"workflow_job": {
+		"id": 123,
+		"run_id": 987,
+		"run_attempt": 1,
+		"workflow_name": "CI",
+		"name": "build",
+		"head_branch": "main",
+		"head_sha": "abc123",
+		"labels": ["self-hosted", "linux"],
+		"runner_id": 42,
+		"runner_name": "runner-42",
+		"runner_group_id": 7,
+		"runner_group_name": "Default",
+		"created_at": "2025-03-24T17:25:36Z",
+		"started_at": "2025-03-24T17:30:36Z",
+		"completed_at": "0001-01-01T00:00:00Z"
+	},
+	"repository": {"id": 1001, "full_name": "octo-org/app"},
+	"organization": {"id": 2002, "login": "octo-org"},
+	"enterprise": {"id": 3003, "slug": "octo-corp"}
+}`
+
+func TestProcessor_WorkflowJob(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	db := new(mockDB)
+	classifier, err := pools.NewClassifier([]pools.Rule{
+		{Pool: "linux", Match: pools.MatchSubset, Labels: []string{"self-hosted", "linux"}},
+	})
+	assert.NoError(t, err)
+	processor := newTestProcessor(db, classifier)
+
+	createdAt := time.Date(2025, 3, 24, 17, 25, 36, 0, time.UTC)
+	startedAt := createdAt.Add(5 * time.Minute)
+	receivedAt := startedAt.Add(time.Second)
+
+	job := models.WorkflowJob{
+		ID:              123,
+		Status:          models.JobStatusInProgress,
+		RunnerType:      models.RunnerTypeSelfHosted,
+		RunnerPool:      "linux",
+		RunID:           987,
+		RunAttempt:      1,
+		WorkflowName:    "CI",
+		Name:            "build",
+		HeadBranch:      "main",
+		HeadSHA:         "abc123",
+		Labels:          []string{"self-hosted", "linux"},
+		RunnerID:        42,
+		RunnerName:      "runner-42",
+		RunnerGroupID:   7,
+		RunnerGroupName: "Default",
+		Repository:      models.Repository{ID: 1001, FullName: "octo-org/app"},
+		Organization:    models.Organization{ID: 2002, Login: "octo-org"},
+		Enterprise:      models.Enterprise{ID: 3003, Slug: "octo-corp"},
+		CreatedAt:       createdAt,
+		StartedAt:       startedAt,
+	}
+	db.On("AddOrUpdateJob", job).Return(job, true, nil)
+	db.On("AddJobEvent", models.JobEvent{
+		JobID:           123,
+		JobCreatedAt:    createdAt,
+		DeliveryID:      "guid-1",
+		Action:          "in_progress",
+		ReceivedAt:      receivedAt,
+		StartedAt:       startedAt,
+		CompletedAt:     time.Time{},
+		RunnerID:        42,
+		RunnerName:      "runner-42",
+		RunnerGroupName: "Default",
+	}).Return(nil)
+	db.On("AddQueueTimeDuration", int64(123), createdAt, "linux", 5*time.Minute, startedAt).Return(true, nil)
+	db.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{"123", "456"}, nil)
+	db.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return([]string{"789"}, nil)
+	db.On("CountQueuedJobs").Return(3, nil)
+	db.On("CountWaitingJobs").Return(0, nil)
+	db.On("CountRunningJobsByPool").Return(map[string]int{"linux": 2, "github-hosted": 1}, nil)
+	db.On("CountQueuedJobsByPool").Return(map[string]int{"linux": 1}, nil)
+	db.On("MarkDeliveryProcessed", "guid-1").Return(nil)
+
+	err = processor.Process(context.Background(), Delivery{ID: "guid-1", Event: "workflow_job", Payload: []byte(workflowJobPayload), ReceivedAt: receivedAt})
+
+	assert.NoError(t, err)
+	db.AssertExpectations(t)
+}
+
+func TestProcessor_WorkflowJob_ApprovalWait(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	createdAt := time.Date(2025, 3, 24, 17, 25, 36, 0, time.UTC)
+	startedAt := createdAt.Add(5 * time.Minute)
+	approvedAt := createdAt.Add(3 * time.Minute)
+
+	// The stored job was waiting on a protection rule and approved three minutes after it was created
+	merged := models.WorkflowJob{
+		ID:         123,
+		Status:     models.JobStatusInProgress,
+		RunnerPool: "self-hosted",
+		CreatedAt:  createdAt,
+		WaitingAt:  createdAt,
+		QueuedAt:   approvedAt,
+		StartedAt:  startedAt,
+	}
+
+	db := new(mockDB)
+	db.On("AddOrUpdateJob", mock.Anything).Return(merged, true, nil)
+	db.On("AddJobEvent", mock.Anything).Return(nil)
+	db.On("AddQueueTimeDuration", int64(123), createdAt, "self-hosted", 2*time.Minute, startedAt).Return(true, nil)
+	db.On("AddApprovalWaitDuration", int64(123), createdAt, "self-hosted", 3*time.Minute, approvedAt).Return(true, nil)
+	db.On("GetRunningJobs", mock.Anything).Return([]string{}, nil)
+	db.On("CountQueuedJobs").Return(0, nil)
+	db.On("CountWaitingJobs").Return(0, nil)
+	db.On("CountRunningJobsByPool").Return(map[string]int{}, nil)
+	db.On("CountQueuedJobsByPool").Return(map[string]int{}, nil)
+
+	err := newTestProcessor(db, pools.Default()).Process(context.Background(), Delivery{Event: "workflow_job", Payload: []byte(workflowJobPayload)})
+
+	assert.NoError(t, err)
+	db.AssertExpectations(t)
+}
+
+func TestProcessor_WorkflowJob_WithoutStartTime(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	// A job whose start time is missing has no queue time, so nothing is recorded for it
+	merged := models.WorkflowJob{
+		ID:         123,
+		Status:     models.JobStatusInProgress,
+		RunnerPool: "self-hosted",
+		CreatedAt:  time.Date(2025, 3, 24, 17, 25, 36, 0, time.UTC),
+	}
+
+	db := new(mockDB)
+	db.On("AddOrUpdateJob", mock.Anything).Return(merged, true, nil)
+	db.On("AddJobEvent", mock.Anything).Return(nil)
+	db.On("GetRunningJobs", mock.Anything).Return([]string{}, nil)
+	db.On("CountQueuedJobs").Return(0, nil)
+	db.On("CountWaitingJobs").Return(0, nil)
+	db.On("CountRunningJobsByPool").Return(map[string]int{}, nil)
+	db.On("CountQueuedJobsByPool").Return(map[string]int{}, nil)
+
+	err := newTestProcessor(db, pools.Default()).Process(context.Background(), Delivery{Event: "workflow_job", Payload: []byte(workflowJobPayload)})
+
+	assert.NoError(t, err)
+	db.AssertExpectations(t)
+	db.AssertNotCalled(t, "AddQueueTimeDuration", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProcessor_WorkflowJob_TransitionTimes(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	receivedAt := time.Date(2025, 3, 24, 17, 28, 0, 0, time.UTC)
+
+	for _, status := range []models.JobStatus{models.JobStatusWaiting, models.JobStatusQueued} {
+		t.Run(string(status), func(t *testing.T) {
+			db := new(mockDB)
+			db.On("AddOrUpdateJob", mock.MatchedBy(func(job models.WorkflowJob) bool {
+				if status == models.JobStatusWaiting {
+					return job.WaitingAt.Equal(receivedAt) && job.QueuedAt.IsZero()
+				}
+				return job.QueuedAt.Equal(receivedAt) && job.WaitingAt.IsZero()
+			})).Return(models.WorkflowJob{}, true, nil)
+			db.On("AddJobEvent", mock.Anything).Return(nil)
+			db.On("GetRunningJobs", mock.Anything).Return([]string{}, nil)
+			db.On("CountQueuedJobs").Return(0, nil)
+			db.On("CountWaitingJobs").Return(0, nil)
+			db.On("CountRunningJobsByPool").Return(map[string]int{}, nil)
+			db.On("CountQueuedJobsByPool").Return(map[string]int{}, nil)
+
+			payload := strings.Replace(workflowJobPayload, `"action": "in_progress"`, `"action": "`+string(status)+`"`, 1)
+			err := newTestProcessor(db, pools.Default()).Process(context.Background(), Delivery{
+				Event:      "workflow_job",
+				Payload:    []byte(payload),
+				ReceivedAt: receivedAt,
+			})
+
+			assert.NoError(t, err)
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProcessor_WorkflowJob_Duration(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	startedAt := time.Date(2025, 3, 24, 17, 30, 36, 0, time.UTC)
+	completedAt := startedAt.Add(90 * time.Second)
+
+	testCases := []struct {
+		name          string
+		merged        models.WorkflowJob
+		reprocessed   bool
+		expectedCount uint64
+		expectedSum   float64
+	}{
+		{
+			name:          "completed job",
+			merged:        models.WorkflowJob{Status: models.JobStatusCompleted, RunnerPool: "duration-test", StartedAt: startedAt, CompletedAt: completedAt},
+			expectedCount: 1,
+			expectedSum:   90,
+		},
+		{
+			name:        "completed event processed again",
+			merged:      models.WorkflowJob{Status: models.JobStatusCompleted, RunnerPool: "duration-test", StartedAt: startedAt, CompletedAt: completedAt},
+			reprocessed: true,
+		},
+		{
+			name:   "job cancelled before it started",
+			merged: models.WorkflowJob{Status: models.JobStatusCompleted, RunnerPool: "duration-test", CompletedAt: completedAt},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := new(mockDB)
+			db.On("AddOrUpdateJob", mock.Anything).Return(tc.merged, !tc.reprocessed, nil)
+			db.On("AddJobEvent", mock.Anything).Return(nil)
+			db.On("GetRunningJobs", mock.Anything).Return([]string{}, nil)
+			db.On("CountQueuedJobs").Return(0, nil)
+			db.On("CountWaitingJobs").Return(0, nil)
+			db.On("CountRunningJobsByPool").Return(map[string]int{}, nil)
+			db.On("CountQueuedJobsByPool").Return(map[string]int{}, nil)
+
+			before := histogram(t, metrics.JobDuration, "duration-test")
+
+			payload := strings.Replace(workflowJobPayload, `"action": "in_progress"`, `"action": "completed"`, 1)
+			err := newTestProcessor(db, pools.Default()).Process(context.Background(), Delivery{Event: "workflow_job", Payload: []byte(payload)})
+			assert.NoError(t, err)
+
+			after := histogram(t, metrics.JobDuration, "duration-test")
+			assert.Equal(t, tc.expectedCount, after.GetSampleCount()-before.GetSampleCount())
+			assert.Equal(t, tc.expectedSum, after.GetSampleSum()-before.GetSampleSum())
+		})
+	}
+}
+
+func TestProcessor_WorkflowJob_QueueTimeObservedOnce(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	createdAt := time.Date(2025, 3, 24, 17, 25, 36, 0, time.UTC)
+	startedAt := createdAt.Add(time.Minute)
+	merged := models.WorkflowJob{ID: 123, Status: models.JobStatusInProgress, RunnerPool: "queue-time-test", CreatedAt: createdAt, StartedAt: startedAt}
+
+	// The second processing of the delivery finds the queue time already recorded
+	for i, recorded := range []bool{true, false} {
+		db := new(mockDB)
+		db.On("AddOrUpdateJob", mock.Anything).Return(merged, i == 0, nil)
+		db.On("AddJobEvent", mock.Anything).Return(nil)
+		db.On("AddQueueTimeDuration", int64(123), createdAt, "queue-time-test", time.Minute, startedAt).Return(recorded, nil)
+		db.On("GetRunningJobs", mock.Anything).Return([]string{}, nil)
+		db.On("CountQueuedJobs").Return(0, nil)
+		db.On("CountWaitingJobs").Return(0, nil)
+		db.On("CountRunningJobsByPool").Return(map[string]int{}, nil)
+		db.On("CountQueuedJobsByPool").Return(map[string]int{}, nil)
+
+		err := newTestProcessor(db, pools.Default()).Process(context.Background(), Delivery{Event: "workflow_job", Payload: []byte(workflowJobPayload)})
+		assert.NoError(t, err)
+		db.AssertExpectations(t)
+	}
+
+	queueTimes := histogram(t, metrics.QueueTime, "queue-time-test")
+	assert.Equal(t, uint64(1), queueTimes.GetSampleCount())
+	assert.Equal(t, float64(60), queueTimes.GetSampleSum())
+}
+
+// histogram returns the histogram of a runner pool
+func histogram(t *testing.T, vec *prometheus.HistogramVec, pool string) *dto.Histogram {
+	var m dto.Metric
+	assert.NoError(t, vec.WithLabelValues(pool).(prometheus.Metric).Write(&m))
+	return m.GetHistogram()
+}
+
+func TestProcessor_WorkflowJob_DatabaseErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		setupMocks    func(*mockDB)
+		expectedError string
+	}{
+		{
+			name: "AddOrUpdateJob error",
+			setupMocks: func(db *mockDB) {
+				db.On("AddOrUpdateJob", mock.Anything).
+					Return(models.WorkflowJob{}, false, errors.New("database error"))
+			},
+			expectedError: "failed to save job",
+		},
+		{
+			name: "AddJobEvent error",
+			setupMocks: func(db *mockDB) {
+				db.On("AddOrUpdateJob", mock.Anything).Return(models.WorkflowJob{}, true, nil)
+				db.On("AddJobEvent", mock.Anything).Return(errors.New("database error"))
+			},
+			expectedError: "failed to save job event",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger.Logger = zaptest.NewLogger(t)
+
+			db := new(mockDB)
+			tc.setupMocks(db)
+			db.On("ReleaseDelivery", "guid-1").Return(nil)
+
+			err := newTestProcessor(db, pools.Default()).Process(context.Background(), Delivery{ID: "guid-1", Event: "workflow_job", Payload: []byte(workflowJobPayload)})
+
+			// A failed delivery must not be marked as processed, and is released for a redelivery
+			assert.ErrorContains(t, err, tc.expectedError)
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProcessor_WorkflowJob_ObserveErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		setupMocks func(*mockDB)
+	}{
+		{
+			name: "GetRunningJobs self-hosted error",
+			setupMocks: func(db *mockDB) {
+				db.On("AddOrUpdateJob", mock.Anything).
+					Return(models.WorkflowJob{}, true, nil)
+				db.On("AddJobEvent", mock.Anything).Return(nil)
+				db.On("GetRunningJobs", models.RunnerTypeSelfHosted).
+					Return(nil, errors.New("database error"))
+			},
+		},
+		{
+			name: "GetRunningJobs github-hosted error",
+			setupMocks: func(db *mockDB) {
+				db.On("AddOrUpdateJob", mock.Anything).
+					Return(models.WorkflowJob{}, true, nil)
+				db.On("AddJobEvent", mock.Anything).Return(nil)
+				db.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string{}, nil)
+				db.On("GetRunningJobs", models.RunnerTypeGitHubHosted).
+					Return(nil, errors.New("database error"))
+			},
+		},
+		{
+			name: "CountQueuedJobs error",
+			setupMocks: func(db *mockDB) {
+				db.On("AddOrUpdateJob", mock.Anything).
+					Return(models.WorkflowJob{}, true, nil)
+				db.On("AddJobEvent", mock.Anything).Return(nil)
+				db.On("GetRunningJobs", mock.Anything).Return([]string{}, nil)
+				db.On("CountQueuedJobs").Return(0, errors.New("database error"))
+			},
+		},
+		{
+			name: "CountRunningJobsByPool error",
+			setupMocks: func(db *mockDB) {
+				db.On("AddOrUpdateJob", mock.Anything).Return(models.WorkflowJob{}, true, nil)
+				db.On("AddJobEvent", mock.Anything).Return(nil)
+				db.On("GetRunningJobs", mock.Anything).Return([]string{}, nil)
+				db.On("CountQueuedJobs").Return(0, nil)
+				db.On("CountWaitingJobs").Return(0, nil)
+				db.On("CountRunningJobsByPool").Return(nil, errors.New("database error"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger.Logger = zaptest.NewLogger(t)
+
+			db := new(mockDB)
+			tc.setupMocks(db)
+			db.On("MarkDeliveryProcessed", "guid-1").Return(nil)
+
+			err := newTestProcessor(db, pools.Default()).Process(context.Background(), Delivery{ID: "guid-1", Event: "workflow_job", Payload: []byte(workflowJobPayload)})
+
+			// The event is stored, so the delivery is processed even though the counts could not be observed
+			assert.NoError(t, err)
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProcessor_WorkflowRun(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	rawJSON := `{
+		"action": "completed",
+		"workflow_run": {
+			"id": 987,
+			"run_attempt": 2,
+			"workflow_id": 55,
+			"name": "CI",
+			"event": "pull_request",
+			"status": "completed",
+			"conclusion": "success",
+			"created_at": "2025-03-24T17:00:00Z",
+			"run_started_at": "2025-03-24T17:05:00Z",
+			"updated_at": "2025-03-24T17:15:30Z"
+		}
+	}`
+
+	db := new(mockDB)
+	db.On("AddOrUpdateWorkflowRun", mock.MatchedBy(func(run models.WorkflowRun) bool {
+		return run.ID == 987 &&
+			run.RunAttempt == 2 &&
+			run.WorkflowName == "CI" &&
+			run.Event == "pull_request" &&
+			run.Conclusion == "success" &&
+			run.Duration == 10*time.Minute+30*time.Second
+	})).Return(nil)
+
+	// Deliveries without a GUID are processed but not logged
+	err := newTestProcessor(db, pools.Default()).Process(context.Background(), Delivery{Event: "workflow_run", Payload: []byte(rawJSON)})
+
+	assert.NoError(t, err)
+	db.AssertExpectations(t)
+}
+
+func TestProcessor_Handles(t *testing.T) {
+	processor := newTestProcessor(new(mockDB), pools.Default())
+
+	assert.True(t, processor.Handles("workflow_job"))
+	assert.True(t, processor.Handles("workflow_run"))
+	assert.False(t, processor.Handles("push"))
+	assert.Error(t, processor.Process(context.Background(), Delivery{Event: "push", Payload: []byte(`{}`)}))
+}
@@ -0,0 +1,194 @@
+// Package jobstate implements the forward-only lifecycle of workflow jobs.
+//
+// GitHub does not guarantee that workflow_job events arrive in the order they
+// were sent, so a job's stored state is never replaced by an incoming event.
+// Instead both are merged: the status only moves forward along
+// waiting → queued → in_progress → completed, and fields are combined one by
+// one so a stale event can fill gaps without overwriting newer data.
+//
+// Jobs whose completed event was lost are marked abandoned by the reaper.
+// Abandoned ranks after in_progress, so a stale event cannot revive the job,
+// but before completed, so a completed event that finally arrives still wins.
+package jobstate
+
+import (
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// ranks orders the known statuses along the job lifecycle
+var ranks = map[models.JobStatus]int{
+	models.JobStatusWaiting:    1,
+	models.JobStatusQueued:     2,
+	models.JobStatusInProgress: 3,
+	models.JobStatusAbandoned:  4,
+	models.JobStatusCompleted:  5,
+}
+
+// Rank returns the position of a status in the job lifecycle. Unknown statuses rank lowest.
+func Rank(status models.JobStatus) int {
+	return ranks[status]
+}
+
+// Merge combines the stored state of a job with an incoming event for the same job.
+// The status never moves backwards. Fields set by the more advanced of the two win,
+// while the other only fills fields that are still unset.
+func Merge(current, incoming models.WorkflowJob) models.WorkflowJob {
+	incoming = normalize(incoming)
+	if current.ID == 0 {
+		return incoming
+	}
+
+	newer, older := current, incoming
+	if Rank(incoming.Status) >= Rank(current.Status) {
+		newer, older = incoming, current
+	}
+
+	merged := newer
+	merged.RunnerType = firstValue(merged.RunnerType, older.RunnerType)
+	merged.RunnerPool = firstValue(merged.RunnerPool, older.RunnerPool)
+	merged.RunID = firstValue(merged.RunID, older.RunID)
+	merged.RunAttempt = firstValue(merged.RunAttempt, older.RunAttempt)
+	merged.WorkflowName = firstValue(merged.WorkflowName, older.WorkflowName)
+	merged.Name = firstValue(merged.Name, older.Name)
+	merged.HeadBranch = firstValue(merged.HeadBranch, older.HeadBranch)
+	merged.HeadSHA = firstValue(merged.HeadSHA, older.HeadSHA)
+	merged.Conclusion = firstValue(merged.Conclusion, older.Conclusion)
+	merged.RunnerID = firstValue(merged.RunnerID, older.RunnerID)
+	merged.RunnerName = firstValue(merged.RunnerName, older.RunnerName)
+	merged.RunnerGroupID = firstValue(merged.RunnerGroupID, older.RunnerGroupID)
+	merged.RunnerGroupName = firstValue(merged.RunnerGroupName, older.RunnerGroupName)
+	merged.Repository = firstValue(merged.Repository, older.Repository)
+	merged.Organization = firstValue(merged.Organization, older.Organization)
+	merged.Enterprise = firstValue(merged.Enterprise, older.Enterprise)
+	if len(merged.Labels) == 0 {
+		merged.Labels = older.Labels
+	}
+	merged.CreatedAt = firstSet(merged.CreatedAt, older.CreatedAt)
+	merged.WaitingAt = firstSet(merged.WaitingAt, older.WaitingAt)
+	merged.QueuedAt = firstSet(merged.QueuedAt, older.QueuedAt)
+	merged.StartedAt = firstSet(merged.StartedAt, older.StartedAt)
+	merged.CompletedAt = firstSet(merged.CompletedAt, older.CompletedAt)
+
+	return merged
+}
+
+// QueueTime returns how long a started job waited for a runner. For a job that was
+// waiting on deployment protection rules, the wait only starts once it was approved.
+func QueueTime(job models.WorkflowJob) time.Duration {
+	queuedAt := job.CreatedAt
+	if _, ok := ApprovalWait(job); ok {
+		queuedAt = job.QueuedAt
+	}
+
+	// The approval is timed by the delivery of the queued event, which may arrive after the job started
+	if job.StartedAt.Before(queuedAt) {
+		return 0
+	}
+	return job.StartedAt.Sub(queuedAt)
+}
+
+// ApprovalWait returns how long a job waited for deployment protection rules before it
+// was queued. It reports false for jobs that never waited or whose approval was not seen.
+func ApprovalWait(job models.WorkflowJob) (time.Duration, bool) {
+	if job.WaitingAt.IsZero() || job.QueuedAt.IsZero() {
+		return 0, false
+	}
+	if job.QueuedAt.Before(job.CreatedAt) {
+		return 0, true
+	}
+	return job.QueuedAt.Sub(job.CreatedAt), true
+}
+
+// RunTime returns how long a job ran on its runner. It reports false for jobs that lack their
+// start or completion time.
+func RunTime(job models.WorkflowJob) (time.Duration, bool) {
+	if job.StartedAt.IsZero() || job.CompletedAt.IsZero() {
+		return 0, false
+	}
+	return job.CompletedAt.Sub(job.StartedAt), true
+}
+
+// SortKey returns the value a job is ordered by in a listing sorted by sort, as JobCursor holds it.
+// It reports false when the job has no such value: the queue time of a job is only known once
+// it started, and its run time once it completed.
+func SortKey(job models.WorkflowJob, sort models.JobSort) (int64, bool) {
+	switch sort {
+	case models.JobSortQueueTime:
+		if job.StartedAt.IsZero() {
+			return 0, false
+		}
+		return QueueTime(job).Milliseconds(), true
+	case models.JobSortDuration:
+		runTime, ok := RunTime(job)
+		return runTime.Milliseconds(), ok
+	default:
+		return job.CreatedAt.UnixMicro(), true
+	}
+}
+
+// Phases returns the stages a job went through, timed like ApprovalWait, QueueTime and RunTime.
+// A job cancelled or rejected before it started ends its last phase at its completion.
+func Phases(job models.WorkflowJob) []models.JobPhase {
+	var phases []models.JobPhase
+	queuedAt := job.CreatedAt
+	if _, ok := ApprovalWait(job); ok {
+		phases = append(phases, phase(models.JobPhaseWaiting, job.CreatedAt, job.QueuedAt))
+		queuedAt = job.QueuedAt
+	} else if !job.WaitingAt.IsZero() && job.StartedAt.IsZero() {
+		// Without an approval the job never left deployment protection rules
+		return []models.JobPhase{phase(models.JobPhaseWaiting, job.CreatedAt, job.CompletedAt)}
+	}
+
+	if job.StartedAt.IsZero() {
+		return append(phases, phase(models.JobPhaseQueued, queuedAt, job.CompletedAt))
+	}
+	return append(phases,
+		phase(models.JobPhaseQueued, queuedAt, job.StartedAt),
+		phase(models.JobPhaseRunning, job.StartedAt, job.CompletedAt),
+	)
+}
+
+// phase builds a phase that does not end before it starts, which a transition timed by the
+// delivery of its event could otherwise do
+func phase(name models.JobPhaseName, start, end time.Time) models.JobPhase {
+	if !end.IsZero() && end.Before(start) {
+		end = start
+	}
+	return models.JobPhase{Name: name, Start: start, End: end}
+}
+
+// normalize clears timestamps an event cannot vouch for. GitHub fills started_at on
+// queued events too, but only an in_progress or later event knows when the job started.
+func normalize(job models.WorkflowJob) models.WorkflowJob {
+	if Rank(job.Status) < Rank(models.JobStatusInProgress) {
+		job.StartedAt = time.Time{}
+	}
+	if Rank(job.Status) < Rank(models.JobStatusCompleted) {
+		job.CompletedAt = time.Time{}
+	}
+	return job
+}
+
+// firstValue returns the first non-zero value
+func firstValue[T comparable](values ...T) T {
+	var zero T
+	for _, v := range values {
+		if v != zero {
+			return v
+		}
+	}
+	return zero
+}
+
+// firstSet returns the first non-zero time. Times are compared with IsZero rather
+// than == since equal instants may carry different locations.
+func firstSet(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
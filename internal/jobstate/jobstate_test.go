@@ -0,0 +1,409 @@
+package jobstate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+var (
+	createdAt   = time.Date(2025, 3, 24, 17, 0, 0, 0, time.UTC)
+	queuedAt    = createdAt.Add(time.Second)
+	startedAt   = createdAt.Add(5 * time.Minute)
+	completedAt = createdAt.Add(15 * time.Minute)
+)
+
+// lifecycle returns the events GitHub sends for one job. Like GitHub, the queued
+// event carries its own started_at, which the in_progress event must win over.
+func lifecycle() []models.WorkflowJob {
+	job := models.WorkflowJob{ID: 1, RunnerType: models.RunnerTypeSelfHosted, CreatedAt: createdAt}
+
+	waiting := job
+	waiting.Status = models.JobStatusWaiting
+
+	queued := job
+	queued.Status = models.JobStatusQueued
+	queued.StartedAt = queuedAt
+
+	inProgress := job
+	inProgress.Status = models.JobStatusInProgress
+	inProgress.StartedAt = startedAt
+
+	completed := job
+	completed.Status = models.JobStatusCompleted
+	completed.CompletedAt = completedAt
+
+	return []models.WorkflowJob{waiting, queued, inProgress, completed}
+}
+
+// permutations returns every ordering of the given events
+func permutations(events []models.WorkflowJob) [][]models.WorkflowJob {
+	if len(events) <= 1 {
+		return [][]models.WorkflowJob{events}
+	}
+
+	var result [][]models.WorkflowJob
+	for i := range events {
+		rest := make([]models.WorkflowJob, 0, len(events)-1)
+		rest = append(rest, events[:i]...)
+		rest = append(rest, events[i+1:]...)
+		for _, perm := range permutations(rest) {
+			result = append(result, append([]models.WorkflowJob{events[i]}, perm...))
+		}
+	}
+	return result
+}
+
+func TestRank(t *testing.T) {
+	statuses := []models.JobStatus{
+		models.JobStatusWaiting,
+		models.JobStatusQueued,
+		models.JobStatusInProgress,
+		models.JobStatusAbandoned,
+		models.JobStatusCompleted,
+	}
+
+	for i := 1; i < len(statuses); i++ {
+		if Rank(statuses[i]) <= Rank(statuses[i-1]) {
+			t.Errorf("Rank(%s) = %d, want greater than Rank(%s) = %d",
+				statuses[i], Rank(statuses[i]), statuses[i-1], Rank(statuses[i-1]))
+		}
+	}
+
+	if Rank("unknown") >= Rank(models.JobStatusWaiting) {
+		t.Errorf("Rank(unknown) = %d, want lower than waiting", Rank("unknown"))
+	}
+}
+
+func TestMerge_AllDeliveryOrders(t *testing.T) {
+	orders := permutations(lifecycle())
+	if len(orders) != 24 {
+		t.Fatalf("Expected 24 delivery orders, got %d", len(orders))
+	}
+
+	for _, order := range orders {
+		name := ""
+		for _, event := range order {
+			name += string(event.Status) + ">"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			var state models.WorkflowJob
+			for _, event := range order {
+				previous := state
+				state = Merge(state, event)
+
+				if Rank(state.Status) < Rank(previous.Status) {
+					t.Fatalf("Status regressed from %s to %s", previous.Status, state.Status)
+				}
+			}
+
+			if state.Status != models.JobStatusCompleted {
+				t.Errorf("Expected final status completed, got %s", state.Status)
+			}
+			if !state.StartedAt.Equal(startedAt) {
+				t.Errorf("Expected started_at %v from the in_progress event, got %v", startedAt, state.StartedAt)
+			}
+			if !state.CompletedAt.Equal(completedAt) {
+				t.Errorf("Expected completed_at %v, got %v", completedAt, state.CompletedAt)
+			}
+			if !state.CreatedAt.Equal(createdAt) {
+				t.Errorf("Expected created_at %v, got %v", createdAt, state.CreatedAt)
+			}
+			if state.RunnerType != models.RunnerTypeSelfHosted {
+				t.Errorf("Expected runner type %s, got %s", models.RunnerTypeSelfHosted, state.RunnerType)
+			}
+		})
+	}
+}
+
+func TestMerge_PartialDeliveries(t *testing.T) {
+	events := lifecycle()
+	waiting, queued, inProgress, completed := events[0], events[1], events[2], events[3]
+
+	// The reaper abandons a job that stayed in progress without a completed event
+	abandoned := inProgress
+	abandoned.Status = models.JobStatusAbandoned
+
+	tests := []struct {
+		name            string
+		events          []models.WorkflowJob
+		expectedStatus  models.JobStatus
+		expectedStarted time.Time
+	}{
+		{
+			name:            "late queued after in_progress",
+			events:          []models.WorkflowJob{inProgress, queued},
+			expectedStatus:  models.JobStatusInProgress,
+			expectedStarted: startedAt,
+		},
+		{
+			name:            "in_progress after queued",
+			events:          []models.WorkflowJob{queued, inProgress},
+			expectedStatus:  models.JobStatusInProgress,
+			expectedStarted: startedAt,
+		},
+		{
+			name:           "late waiting after approval",
+			events:         []models.WorkflowJob{queued, waiting},
+			expectedStatus: models.JobStatusQueued,
+		},
+		{
+			name:            "stale in_progress after abandoned",
+			events:          []models.WorkflowJob{abandoned, inProgress},
+			expectedStatus:  models.JobStatusAbandoned,
+			expectedStarted: startedAt,
+		},
+		{
+			name:            "late completed after abandoned",
+			events:          []models.WorkflowJob{abandoned, completed},
+			expectedStatus:  models.JobStatusCompleted,
+			expectedStarted: startedAt,
+		},
+		{
+			name:           "duplicate queued",
+			events:         []models.WorkflowJob{queued, queued},
+			expectedStatus: models.JobStatusQueued,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state models.WorkflowJob
+			for _, event := range tt.events {
+				state = Merge(state, event)
+			}
+
+			if state.Status != tt.expectedStatus {
+				t.Errorf("Expected status %s, got %s", tt.expectedStatus, state.Status)
+			}
+			if !state.StartedAt.Equal(tt.expectedStarted) {
+				t.Errorf("Expected started_at %v, got %v", tt.expectedStarted, state.StartedAt)
+			}
+		})
+	}
+}
+
+func TestMerge_Metadata(t *testing.T) {
+	queued := models.WorkflowJob{
+		ID:           1,
+		Status:       models.JobStatusQueued,
+		WorkflowName: "CI",
+		Name:         "build",
+		Labels:       []string{"self-hosted", "linux"},
+		Repository:   models.Repository{ID: 10, FullName: "octo-org/app"},
+		CreatedAt:    createdAt,
+	}
+	inProgress := models.WorkflowJob{
+		ID:         1,
+		Status:     models.JobStatusInProgress,
+		RunnerID:   42,
+		RunnerName: "runner-42",
+		CreatedAt:  createdAt,
+		StartedAt:  startedAt,
+	}
+	completed := models.WorkflowJob{
+		ID:          1,
+		Status:      models.JobStatusCompleted,
+		Name:        "build (renamed)",
+		Conclusion:  "success",
+		CreatedAt:   createdAt,
+		CompletedAt: completedAt,
+	}
+
+	// Whatever the delivery order, the newest event wins and gaps are filled from older ones
+	for _, order := range [][]models.WorkflowJob{
+		{queued, inProgress, completed},
+		{completed, inProgress, queued},
+	} {
+		var state models.WorkflowJob
+		for _, event := range order {
+			state = Merge(state, event)
+		}
+
+		if state.Name != "build (renamed)" {
+			t.Errorf("Expected name from newest event, got %q", state.Name)
+		}
+		if state.WorkflowName != "CI" || state.Repository.FullName != "octo-org/app" {
+			t.Errorf("Expected workflow and repository from queued event, got %q %q",
+				state.WorkflowName, state.Repository.FullName)
+		}
+		if state.RunnerName != "runner-42" || state.RunnerID != 42 {
+			t.Errorf("Expected runner from in_progress event, got %q %d", state.RunnerName, state.RunnerID)
+		}
+		if state.Conclusion != "success" {
+			t.Errorf("Expected conclusion success, got %q", state.Conclusion)
+		}
+		if len(state.Labels) != 2 {
+			t.Errorf("Expected labels to be kept, got %v", state.Labels)
+		}
+	}
+}
+
+func TestQueueTimeAndApprovalWait(t *testing.T) {
+	approvedAt := createdAt.Add(3 * time.Minute)
+
+	tests := []struct {
+		name             string
+		job              models.WorkflowJob
+		expectedQueue    time.Duration
+		expectedApproval time.Duration
+		expectedWaited   bool
+	}{
+		{
+			name:          "job without protection rules",
+			job:           models.WorkflowJob{CreatedAt: createdAt, QueuedAt: queuedAt, StartedAt: startedAt},
+			expectedQueue: 5 * time.Minute,
+		},
+		{
+			name: "approved job",
+			job: models.WorkflowJob{
+				CreatedAt: createdAt, WaitingAt: createdAt, QueuedAt: approvedAt, StartedAt: startedAt,
+			},
+			expectedQueue:    2 * time.Minute,
+			expectedApproval: 3 * time.Minute,
+			expectedWaited:   true,
+		},
+		{
+			name:          "approval not seen",
+			job:           models.WorkflowJob{CreatedAt: createdAt, WaitingAt: createdAt, StartedAt: startedAt},
+			expectedQueue: 5 * time.Minute,
+		},
+		{
+			name: "approval delivered after the job started",
+			job: models.WorkflowJob{
+				CreatedAt: createdAt, WaitingAt: createdAt, QueuedAt: startedAt.Add(time.Second), StartedAt: startedAt,
+			},
+			expectedApproval: 5*time.Minute + time.Second,
+			expectedWaited:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QueueTime(tt.job); got != tt.expectedQueue {
+				t.Errorf("QueueTime() = %v, want %v", got, tt.expectedQueue)
+			}
+
+			approval, waited := ApprovalWait(tt.job)
+			if waited != tt.expectedWaited || approval != tt.expectedApproval {
+				t.Errorf("ApprovalWait() = %v, %v, want %v, %v", approval, waited, tt.expectedApproval, tt.expectedWaited)
+			}
+		})
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	queued := models.WorkflowJob{Status: models.JobStatusQueued, CreatedAt: createdAt}
+	started := models.WorkflowJob{Status: models.JobStatusInProgress, CreatedAt: createdAt, StartedAt: startedAt}
+	completed := models.WorkflowJob{Status: models.JobStatusCompleted, CreatedAt: createdAt, StartedAt: startedAt, CompletedAt: completedAt}
+
+	tests := []struct {
+		name     string
+		job      models.WorkflowJob
+		sort     models.JobSort
+		expected int64
+		ok       bool
+	}{
+		{name: "created", job: queued, sort: models.JobSortCreated, expected: createdAt.UnixMicro(), ok: true},
+		{name: "queue time of a queued job", job: queued, sort: models.JobSortQueueTime},
+		{name: "queue time of a started job", job: started, sort: models.JobSortQueueTime, expected: (5 * time.Minute).Milliseconds(), ok: true},
+		{name: "duration of a running job", job: started, sort: models.JobSortDuration},
+		{name: "duration of a completed job", job: completed, sort: models.JobSortDuration, expected: (10 * time.Minute).Milliseconds(), ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := SortKey(tt.job, tt.sort)
+			if key != tt.expected || ok != tt.ok {
+				t.Errorf("SortKey() = %d, %v, want %d, %v", key, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPhases(t *testing.T) {
+	approvedAt := createdAt.Add(3 * time.Minute)
+	waiting := func(end time.Time) models.JobPhase {
+		return models.JobPhase{Name: models.JobPhaseWaiting, Start: createdAt, End: end}
+	}
+	queued := func(start, end time.Time) models.JobPhase {
+		return models.JobPhase{Name: models.JobPhaseQueued, Start: start, End: end}
+	}
+	running := func(end time.Time) models.JobPhase {
+		return models.JobPhase{Name: models.JobPhaseRunning, Start: startedAt, End: end}
+	}
+
+	tests := []struct {
+		name     string
+		job      models.WorkflowJob
+		expected []models.JobPhase
+	}{
+		{
+			name:     "queued job",
+			job:      models.WorkflowJob{Status: models.JobStatusQueued, CreatedAt: createdAt, QueuedAt: queuedAt},
+			expected: []models.JobPhase{queued(createdAt, time.Time{})},
+		},
+		{
+			name: "running job",
+			job: models.WorkflowJob{
+				Status: models.JobStatusInProgress, CreatedAt: createdAt, QueuedAt: queuedAt, StartedAt: startedAt,
+			},
+			expected: []models.JobPhase{queued(createdAt, startedAt), running(time.Time{})},
+		},
+		{
+			name: "approved and completed job",
+			job: models.WorkflowJob{
+				Status: models.JobStatusCompleted, CreatedAt: createdAt, WaitingAt: createdAt,
+				QueuedAt: approvedAt, StartedAt: startedAt, CompletedAt: completedAt,
+			},
+			expected: []models.JobPhase{waiting(approvedAt), queued(approvedAt, startedAt), running(completedAt)},
+		},
+		{
+			name:     "job waiting on protection rules",
+			job:      models.WorkflowJob{Status: models.JobStatusWaiting, CreatedAt: createdAt, WaitingAt: createdAt},
+			expected: []models.JobPhase{waiting(time.Time{})},
+		},
+		{
+			name: "rejected job",
+			job: models.WorkflowJob{
+				Status: models.JobStatusCompleted, CreatedAt: createdAt, WaitingAt: createdAt, CompletedAt: approvedAt,
+			},
+			expected: []models.JobPhase{waiting(approvedAt)},
+		},
+		{
+			name: "job cancelled in the queue",
+			job: models.WorkflowJob{
+				Status: models.JobStatusCompleted, CreatedAt: createdAt, QueuedAt: queuedAt, CompletedAt: approvedAt,
+			},
+			expected: []models.JobPhase{queued(createdAt, approvedAt)},
+		},
+		{
+			name: "approval delivered after the job started",
+			job: models.WorkflowJob{
+				Status: models.JobStatusInProgress, CreatedAt: createdAt, WaitingAt: createdAt,
+				QueuedAt: startedAt.Add(time.Second), StartedAt: startedAt,
+			},
+			expected: []models.JobPhase{
+				waiting(startedAt.Add(time.Second)),
+				queued(startedAt.Add(time.Second), startedAt.Add(time.Second)),
+				running(time.Time{}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Phases(tt.job)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Phases() = %v, want %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i].Name != tt.expected[i].Name || !got[i].Start.Equal(tt.expected[i].Start) || !got[i].End.Equal(tt.expected[i].End) {
+					t.Errorf("Phases()[%d] = %v, want %v", i, got[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
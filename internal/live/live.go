@@ -0,0 +1,135 @@
+// Package live pushes runner demand to the open dashboards as it changes.
+//
+// Polling made every open dashboard re-run the same queries, so the load grew
+// with the number of viewers. The broadcaster instead receives the counts the
+// sampler reads anyway, once per processed webhook and sample, and fans them
+// out to every subscriber. Viewers cost a channel each, not a query.
+package live
+
+import (
+	"sync"
+
+	"github.com/gateixeira/rpulse/models"
+)
+
+// clientBuffer is how many events a client may fall behind before it is dropped
+const clientBuffer = 16
+
+const (
+	// EventCounts carries the current job counts whenever they change
+	EventCounts = "counts"
+	// EventSample carries each demand sample as it is recorded, a new point of the chart
+	EventSample = "sample"
+)
+
+// Counts are the current numbers of running, queued and waiting jobs, named like the fields of /running-count
+type Counts struct {
+	GitHubHosted int `json:"current_count_github_hosted"`
+	SelfHosted   int `json:"current_count_self_hosted"`
+	Queued       int `json:"current_queued_count"`
+	Waiting      int `json:"current_waiting_count"`
+}
+
+// Event is a named update sent to every client
+type Event struct {
+	Name string
+	Data any
+}
+
+// Broadcaster fans out count changes and new samples to its clients. A client that falls
+// more than clientBuffer events behind is dropped, and is expected to reconnect and reload.
+type Broadcaster struct {
+	mu      sync.Mutex
+	clients map[chan Event]struct{}
+	counts  *Counts // last published, sent to new clients first
+	closed  bool
+}
+
+// NewBroadcaster creates a broadcaster without clients
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{clients: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a client and returns its events, starting with the current counts when
+// they are known. The channel is closed when the client is dropped or the broadcaster closed.
+// The returned function unsubscribes the client.
+func (b *Broadcaster) Subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make(chan Event, clientBuffer)
+	if b.closed {
+		close(events)
+		return events, func() {}
+	}
+
+	if b.counts != nil {
+		events <- Event{Name: EventCounts, Data: *b.counts}
+	}
+	b.clients[events] = struct{}{}
+
+	return events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(events)
+	}
+}
+
+// PublishCounts sends the current counts to every client, unless they did not change
+func (b *Broadcaster) PublishCounts(counts Counts) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.counts != nil && *b.counts == counts {
+		return
+	}
+	b.counts = &counts
+	b.publish(Event{Name: EventCounts, Data: counts})
+}
+
+// PublishSample sends a newly recorded sample to every client
+func (b *Broadcaster) PublishSample(entry models.HistoricalEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.publish(Event{Name: EventSample, Data: entry})
+}
+
+// Clients returns the number of subscribed clients
+func (b *Broadcaster) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.clients)
+}
+
+// Close drops every client and refuses new ones, so that their streams end on shutdown
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for events := range b.clients {
+		b.drop(events)
+	}
+}
+
+// publish sends an event to every client, dropping the ones whose buffer is full.
+// The caller must hold b.mu.
+func (b *Broadcaster) publish(event Event) {
+	for events := range b.clients {
+		select {
+		case events <- event:
+		default:
+			b.drop(events)
+		}
+	}
+}
+
+// drop unregisters a client and closes its channel. The caller must hold b.mu.
+func (b *Broadcaster) drop(events chan Event) {
+	if _, ok := b.clients[events]; ok {
+		delete(b.clients, events)
+		close(events)
+	}
+}
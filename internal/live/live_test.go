@@ -0,0 +1,68 @@
+package live
+
+import (
+	"testing"
+
+	"github.com/gateixeira/rpulse/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcaster_Publish(t *testing.T) {
+	b := NewBroadcaster()
+	first, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	counts := Counts{GitHubHosted: 1, SelfHosted: 2, Queued: 3}
+	b.PublishCounts(counts)
+	b.PublishCounts(counts)
+	b.PublishSample(models.HistoricalEntry{Timestamp: "2025-03-24T10:00:00Z", CountQueued: 3})
+
+	assert.Equal(t, Event{Name: EventCounts, Data: counts}, <-first)
+	assert.Equal(t, Event{Name: EventSample, Data: models.HistoricalEntry{Timestamp: "2025-03-24T10:00:00Z", CountQueued: 3}}, <-first)
+	assert.Empty(t, first, "Unchanged counts should not be published again")
+
+	// A new client starts with the current counts
+	second, unsubscribeSecond := b.Subscribe()
+	assert.Equal(t, Event{Name: EventCounts, Data: counts}, <-second)
+	assert.Equal(t, 2, b.Clients())
+
+	unsubscribeSecond()
+	_, open := <-second
+	assert.False(t, open, "Unsubscribing should close the channel")
+	assert.Equal(t, 1, b.Clients())
+}
+
+func TestBroadcaster_DropsSlowClients(t *testing.T) {
+	b := NewBroadcaster()
+	slow, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i <= clientBuffer; i++ {
+		b.PublishCounts(Counts{Queued: i})
+	}
+
+	assert.Equal(t, 0, b.Clients())
+	received := 0
+	for range slow {
+		received++
+	}
+	assert.Equal(t, clientBuffer, received)
+}
+
+func TestBroadcaster_Close(t *testing.T) {
+	b := NewBroadcaster()
+	events, unsubscribe := b.Subscribe()
+
+	b.Close()
+	_, open := <-events
+	assert.False(t, open, "Closing should end every client")
+	unsubscribe()
+
+	late, _ := b.Subscribe()
+	_, open = <-late
+	assert.False(t, open, "A closed broadcaster should refuse new clients")
+	assert.Equal(t, 0, b.Clients())
+
+	// Publishing after closing is a no-op
+	b.PublishCounts(Counts{Queued: 1})
+}
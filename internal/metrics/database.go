@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/models"
+)
+
+// instrumentedDB records the latency of every operation of the database it wraps
+type instrumentedDB struct {
+	db database.DatabaseInterface
+}
+
+// InstrumentDB wraps db so the latency of its operations is observed by DBQueryDuration
+func InstrumentDB(db database.DatabaseInterface) database.DatabaseInterface {
+	return &instrumentedDB{db: db}
+}
+
+// observe records the time elapsed since start for an operation. It is deferred with the
+// start time evaluated when the operation begins.
+func observe(operation string, start time.Time) {
+	DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+func (i *instrumentedDB) AddOrUpdateJob(ctx context.Context, job models.WorkflowJob) (models.WorkflowJob, bool, error) {
+	defer observe("AddOrUpdateJob", time.Now())
+	return i.db.AddOrUpdateJob(ctx, job)
+}
+
+func (i *instrumentedDB) CountQueuedJobs(ctx context.Context) (int, error) {
+	defer observe("CountQueuedJobs", time.Now())
+	return i.db.CountQueuedJobs(ctx)
+}
+
+func (i *instrumentedDB) CountWaitingJobs(ctx context.Context) (int, error) {
+	defer observe("CountWaitingJobs", time.Now())
+	return i.db.CountWaitingJobs(ctx)
+}
+
+func (i *instrumentedDB) GetRunningJobs(ctx context.Context, runnerType models.RunnerType) ([]string, error) {
+	defer observe("GetRunningJobs", time.Now())
+	return i.db.GetRunningJobs(ctx, runnerType)
+}
+
+func (i *instrumentedDB) AddHistoricalEntry(ctx context.Context, entry models.HistoricalEntry) error {
+	defer observe("AddHistoricalEntry", time.Now())
+	return i.db.AddHistoricalEntry(ctx, entry)
+}
+
+func (i *instrumentedDB) GetQueueTimeStats(ctx context.Context, filter models.QueueTimeFilter) (models.QueueTimeStats, error) {
+	defer observe("GetQueueTimeStats", time.Now())
+	return i.db.GetQueueTimeStats(ctx, filter)
+}
+
+func (i *instrumentedDB) GetQueueTimeHistogram(ctx context.Context, filter models.QueueTimeFilter, bounds []time.Duration) ([]models.HistogramBucket, error) {
+	defer observe("GetQueueTimeHistogram", time.Now())
+	return i.db.GetQueueTimeHistogram(ctx, filter, bounds)
+}
+
+func (i *instrumentedDB) GetJobDurationStats(ctx context.Context, groupBy string, filter models.JobDurationFilter, limit int) ([]models.JobDurationStats, error) {
+	defer observe("GetJobDurationStats", time.Now())
+	return i.db.GetJobDurationStats(ctx, groupBy, filter, limit)
+}
+
+func (i *instrumentedDB) GetLongestJobs(ctx context.Context, filter models.JobDurationFilter, limit int) ([]models.JobDuration, error) {
+	defer observe("GetLongestJobs", time.Now())
+	return i.db.GetLongestJobs(ctx, filter, limit)
+}
+
+func (i *instrumentedDB) ListJobs(ctx context.Context, filter models.JobFilter) ([]models.WorkflowJob, error) {
+	defer observe("ListJobs", time.Now())
+	return i.db.ListJobs(ctx, filter)
+}
+
+func (i *instrumentedDB) GetJob(ctx context.Context, id int64) (models.WorkflowJob, bool, error) {
+	defer observe("GetJob", time.Now())
+	return i.db.GetJob(ctx, id)
+}
+
+func (i *instrumentedDB) AddJobEvent(ctx context.Context, event models.JobEvent) error {
+	defer observe("AddJobEvent", time.Now())
+	return i.db.AddJobEvent(ctx, event)
+}
+
+func (i *instrumentedDB) GetJobEvents(ctx context.Context, id int64, createdAt time.Time) ([]models.JobEvent, error) {
+	defer observe("GetJobEvents", time.Now())
+	return i.db.GetJobEvents(ctx, id, createdAt)
+}
+
+func (i *instrumentedDB) AddQueueTimeDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	defer observe("AddQueueTimeDuration", time.Now())
+	return i.db.AddQueueTimeDuration(ctx, ID, createdAt, pool, duration, recordedAt)
+}
+
+func (i *instrumentedDB) GetAverageApprovalWaitTime(ctx context.Context, period string) (time.Duration, error) {
+	defer observe("GetAverageApprovalWaitTime", time.Now())
+	return i.db.GetAverageApprovalWaitTime(ctx, period)
+}
+
+func (i *instrumentedDB) AddApprovalWaitDuration(ctx context.Context, ID int64, createdAt time.Time, pool string, duration time.Duration, recordedAt time.Time) (bool, error) {
+	defer observe("AddApprovalWaitDuration", time.Now())
+	return i.db.AddApprovalWaitDuration(ctx, ID, createdAt, pool, duration, recordedAt)
+}
+
+func (i *instrumentedDB) GetHistoricalDataByPeriod(ctx context.Context, period string) ([]models.HistoricalEntry, error) {
+	defer observe("GetHistoricalDataByPeriod", time.Now())
+	return i.db.GetHistoricalDataByPeriod(ctx, period)
+}
+
+func (i *instrumentedDB) GetHistoricalDataByRange(ctx context.Context, r models.TimeRange) ([]models.HistoricalEntry, error) {
+	defer observe("GetHistoricalDataByRange", time.Now())
+	return i.db.GetHistoricalDataByRange(ctx, r)
+}
+
+func (i *instrumentedDB) CalculatePeakDemand(ctx context.Context, period string) (int, string, error) {
+	defer observe("CalculatePeakDemand", time.Now())
+	return i.db.CalculatePeakDemand(ctx, period)
+}
+
+func (i *instrumentedDB) CountQueuedJobsByPool(ctx context.Context) (map[string]int, error) {
+	defer observe("CountQueuedJobsByPool", time.Now())
+	return i.db.CountQueuedJobsByPool(ctx)
+}
+
+func (i *instrumentedDB) CountRunningJobsByPool(ctx context.Context) (map[string]int, error) {
+	defer observe("CountRunningJobsByPool", time.Now())
+	return i.db.CountRunningJobsByPool(ctx)
+}
+
+func (i *instrumentedDB) CountWaitingJobsByPool(ctx context.Context) (map[string]int, error) {
+	defer observe("CountWaitingJobsByPool", time.Now())
+	return i.db.CountWaitingJobsByPool(ctx)
+}
+
+func (i *instrumentedDB) GetAverageQueueTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	defer observe("GetAverageQueueTimeByPool", time.Now())
+	return i.db.GetAverageQueueTimeByPool(ctx, period)
+}
+
+func (i *instrumentedDB) GetAverageApprovalWaitTimeByPool(ctx context.Context, period string) (map[string]time.Duration, error) {
+	defer observe("GetAverageApprovalWaitTimeByPool", time.Now())
+	return i.db.GetAverageApprovalWaitTimeByPool(ctx, period)
+}
+
+func (i *instrumentedDB) AddPoolHistoricalEntries(ctx context.Context, entries []models.PoolHistoricalEntry) error {
+	defer observe("AddPoolHistoricalEntries", time.Now())
+	return i.db.AddPoolHistoricalEntries(ctx, entries)
+}
+
+func (i *instrumentedDB) GetPoolHistoricalDataByPeriod(ctx context.Context, period, pool string) ([]models.PoolHistoricalEntry, error) {
+	defer observe("GetPoolHistoricalDataByPeriod", time.Now())
+	return i.db.GetPoolHistoricalDataByPeriod(ctx, period, pool)
+}
+
+func (i *instrumentedDB) GetPoolHistoricalDataByRange(ctx context.Context, r models.TimeRange, pool string) ([]models.PoolHistoricalEntry, error) {
+	defer observe("GetPoolHistoricalDataByRange", time.Now())
+	return i.db.GetPoolHistoricalDataByRange(ctx, r, pool)
+}
+
+func (i *instrumentedDB) CalculatePeakDemandByPool(ctx context.Context, period, pool string) (int, string, error) {
+	defer observe("CalculatePeakDemandByPool", time.Now())
+	return i.db.CalculatePeakDemandByPool(ctx, period, pool)
+}
+
+func (i *instrumentedDB) AddOrUpdateWorkflowRun(ctx context.Context, run models.WorkflowRun) error {
+	defer observe("AddOrUpdateWorkflowRun", time.Now())
+	return i.db.AddOrUpdateWorkflowRun(ctx, run)
+}
+
+func (i *instrumentedDB) RecordDelivery(ctx context.Context, deliveryID, event string, payload []byte, receivedAt time.Time) (bool, error) {
+	defer observe("RecordDelivery", time.Now())
+	return i.db.RecordDelivery(ctx, deliveryID, event, payload, receivedAt)
+}
+
+func (i *instrumentedDB) MarkDeliveryProcessed(ctx context.Context, deliveryID string) error {
+	defer observe("MarkDeliveryProcessed", time.Now())
+	return i.db.MarkDeliveryProcessed(ctx, deliveryID)
+}
+
+func (i *instrumentedDB) ReleaseDelivery(ctx context.Context, deliveryID string) error {
+	defer observe("ReleaseDelivery", time.Now())
+	return i.db.ReleaseDelivery(ctx, deliveryID)
+}
+
+func (i *instrumentedDB) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	defer observe("GetDeliveries", time.Now())
+	return i.db.GetDeliveries(ctx, filter)
+}
+
+func (i *instrumentedDB) ReapStaleJobs(ctx context.Context, status models.JobStatus, maxAge time.Duration) (int, error) {
+	defer observe("ReapStaleJobs", time.Now())
+	return i.db.ReapStaleJobs(ctx, status, maxAge)
+}
+
+func (i *instrumentedDB) ApplyRetentionPolicies(ctx context.Context, policies models.RetentionPolicies) error {
+	defer observe("ApplyRetentionPolicies", time.Now())
+	return i.db.ApplyRetentionPolicies(ctx, policies)
+}
+
+func (i *instrumentedDB) GetRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	defer observe("GetRetentionPolicies", time.Now())
+	return i.db.GetRetentionPolicies(ctx)
+}
+
+// StepGranularity does not query the database, so it is not timed
+func (i *instrumentedDB) StepGranularity(from, now time.Time) time.Duration {
+	return i.db.StepGranularity(from, now)
+}
+
+func (i *instrumentedDB) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	defer observe("CreateAPIToken", time.Now())
+	return i.db.CreateAPIToken(ctx, token)
+}
+
+func (i *instrumentedDB) GetAPIToken(ctx context.Context, hash string) (models.APIToken, bool, error) {
+	defer observe("GetAPIToken", time.Now())
+	return i.db.GetAPIToken(ctx, hash)
+}
+
+func (i *instrumentedDB) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	defer observe("ListAPITokens", time.Now())
+	return i.db.ListAPITokens(ctx)
+}
+
+func (i *instrumentedDB) RevokeAPIToken(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	defer observe("RevokeAPIToken", time.Now())
+	return i.db.RevokeAPIToken(ctx, id, revokedAt)
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// DemandCollector reports the current number of jobs of every runner pool on each scrape
+type DemandCollector struct {
+	db         database.DatabaseInterface
+	classifier *pools.Classifier
+
+	running *prometheus.Desc
+	queued  *prometheus.Desc
+	waiting *prometheus.Desc
+}
+
+// NewDemandCollector creates a collector for the jobs stored in db. The pools of the
+// classifier are always reported, with zero counts when they have no jobs.
+func NewDemandCollector(db database.DatabaseInterface, classifier *pools.Classifier) *DemandCollector {
+	return &DemandCollector{
+		db:         db,
+		classifier: classifier,
+		running: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "running_jobs"),
+			"Jobs currently running, by runner pool.", []string{"pool"}, nil),
+		queued: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queued_jobs"),
+			"Jobs currently queued for a runner, by runner pool.", []string{"pool"}, nil),
+		waiting: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "waiting_jobs"),
+			"Jobs currently waiting for deployment protection rules, by runner pool.", []string{"pool"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *DemandCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.running
+	ch <- c.queued
+	ch <- c.waiting
+}
+
+// Collect implements prometheus.Collector
+func (c *DemandCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+
+	counts := []struct {
+		desc  *prometheus.Desc
+		count func(context.Context) (map[string]int, error)
+	}{
+		{c.running, c.db.CountRunningJobsByPool},
+		{c.queued, c.db.CountQueuedJobsByPool},
+		{c.waiting, c.db.CountWaitingJobsByPool},
+	}
+
+	for _, gauge := range counts {
+		byPool, err := gauge.count(ctx)
+		if err != nil {
+			logger.Logger.Error("Failed to collect job counts", zap.Error(err))
+			ch <- prometheus.NewInvalidMetric(gauge.desc, err)
+			continue
+		}
+
+		for _, pool := range c.poolNames(byPool) {
+			ch <- prometheus.MustNewConstMetric(gauge.desc, prometheus.GaugeValue, float64(byPool[pool]), pool)
+		}
+	}
+}
+
+// poolNames returns the configured pools followed by the other pools that have jobs
+func (c *DemandCollector) poolNames(byPool map[string]int) []string {
+	names := c.classifier.Pools()
+	configured := make(map[string]bool, len(names))
+	for _, pool := range names {
+		configured[pool] = true
+	}
+
+	var unconfigured []string
+	for pool := range byPool {
+		if !configured[pool] {
+			unconfigured = append(unconfigured, pool)
+		}
+	}
+	sort.Strings(unconfigured)
+
+	return append(names, unconfigured...)
+}
@@ -0,0 +1,111 @@
+// Package metrics exposes runner demand and the health of rpulse to Prometheus.
+//
+// The job counts are read from the database on every scrape, so they are
+// always in line with the dashboard. Queue times, job durations, webhook
+// deliveries and database latency are recorded as they happen by the
+// components that observe them, through the package-level collectors.
+package metrics
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rpulse"
+
+// Outcomes of a webhook delivery
+const (
+	OutcomeQueued       = "queued"
+	OutcomeProcessed    = "processed"
+	OutcomeIgnored      = "ignored"
+	OutcomeDuplicate    = "duplicate"
+	OutcomeRejected     = "rejected"
+	OutcomeInvalid      = "invalid"
+	OutcomeUnauthorized = "unauthorized"
+	OutcomeError        = "error"
+)
+
+// LabelOther replaces the event and action labels that are not known, so that deliveries
+// cannot create a series for every value they send
+const LabelOther = "other"
+
+// webhookActions are the actions of the webhook events rpulse handles
+var webhookActions = map[string][]string{
+	"ping":         nil,
+	"workflow_job": {"waiting", "queued", "in_progress", "completed"},
+	"workflow_run": {"requested", "in_progress", "completed"},
+}
+
+// WebhookLabels returns the event and action labels of a delivery. Unknown events and actions
+// are reported as LabelOther, and missing ones stay empty.
+func WebhookLabels(event, action string) (string, string) {
+	actions, known := webhookActions[event]
+	if event != "" && !known {
+		event = LabelOther
+	}
+	if action != "" && !slices.Contains(actions, action) {
+		action = LabelOther
+	}
+	return event, action
+}
+
+var (
+	// WebhookDeliveries counts the webhook deliveries received, by event, action and outcome
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook deliveries received, by event, action and outcome.",
+	}, []string{"event", "action", "outcome"})
+
+	// QueueTime observes how long started jobs waited for a runner, by runner pool
+	QueueTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_time_seconds",
+		Help:      "Time jobs waited for a runner, by runner pool.",
+		Buckets:   []float64{5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"pool"})
+
+	// JobDuration observes how long completed jobs ran, by runner pool
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time completed jobs ran, by runner pool.",
+		Buckets:   []float64{30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 21600},
+	}, []string{"pool"})
+
+	// DBQueryDuration observes the latency of database operations, by operation
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database operations, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+// Registry holds the collectors served on /metrics
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		WebhookDeliveries,
+		QueueTime,
+		JobDuration,
+		DBQueryDuration,
+	)
+}
+
+// Handler serves the registry in the Prometheus text or OpenMetrics format, as negotiated
+// by the scraper. Metrics that fail to be collected are left out of the response.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		ErrorHandling:     promhttp.ContinueOnError,
+		Registry:          Registry,
+	})
+}
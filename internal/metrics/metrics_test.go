@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database/memory"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestDemandCollector(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+	ctx := context.Background()
+
+	classifier, err := pools.NewClassifier([]pools.Rule{{Pool: "gpu", Match: pools.MatchSubset, Labels: []string{"gpu"}}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	store := memory.NewStore()
+	createdAt := time.Now().Add(-time.Minute)
+	for _, job := range []models.WorkflowJob{
+		{ID: 1, Status: models.JobStatusInProgress, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "gpu", CreatedAt: createdAt, StartedAt: createdAt},
+		{ID: 2, Status: models.JobStatusInProgress, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "gpu", CreatedAt: createdAt, StartedAt: createdAt},
+		{ID: 3, Status: models.JobStatusQueued, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "self-hosted", CreatedAt: createdAt},
+		{ID: 4, Status: models.JobStatusWaiting, RunnerType: models.RunnerTypeSelfHosted, RunnerPool: "legacy", CreatedAt: createdAt},
+	} {
+		if _, _, err := store.AddOrUpdateJob(ctx, job); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// Configured pools are reported even without jobs, unconfigured ones only when they have jobs
+	expected := `
+# HELP rpulse_queued_jobs Jobs currently queued for a runner, by runner pool.
+# TYPE rpulse_queued_jobs gauge
+rpulse_queued_jobs{pool="github-hosted"} 0
+rpulse_queued_jobs{pool="gpu"} 0
+rpulse_queued_jobs{pool="self-hosted"} 1
+# HELP rpulse_running_jobs Jobs currently running, by runner pool.
+# TYPE rpulse_running_jobs gauge
+rpulse_running_jobs{pool="github-hosted"} 0
+rpulse_running_jobs{pool="gpu"} 2
+rpulse_running_jobs{pool="self-hosted"} 0
+# HELP rpulse_waiting_jobs Jobs currently waiting for deployment protection rules, by runner pool.
+# TYPE rpulse_waiting_jobs gauge
+rpulse_waiting_jobs{pool="github-hosted"} 0
+rpulse_waiting_jobs{pool="gpu"} 0
+rpulse_waiting_jobs{pool="legacy"} 1
+rpulse_waiting_jobs{pool="self-hosted"} 0
+`
+	if err := testutil.CollectAndCompare(NewDemandCollector(store, classifier), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebhookLabels(t *testing.T) {
+	testCases := []struct {
+		event, action                 string
+		expectedEvent, expectedAction string
+	}{
+		{"workflow_job", "queued", "workflow_job", "queued"},
+		{"workflow_run", "requested", "workflow_run", "requested"},
+		{"ping", "", "ping", ""},
+		{"workflow_job", "requested", "workflow_job", LabelOther},
+		{"issues", "opened", LabelOther, LabelOther},
+		{"push", "", LabelOther, ""},
+		{"", "", "", ""},
+	}
+
+	for _, tc := range testCases {
+		event, action := WebhookLabels(tc.event, tc.action)
+		if event != tc.expectedEvent || action != tc.expectedAction {
+			t.Errorf("WebhookLabels(%q, %q) = %q, %q, want %q, %q", tc.event, tc.action, event, action, tc.expectedEvent, tc.expectedAction)
+		}
+	}
+}
+
+func TestInstrumentDB(t *testing.T) {
+	db := InstrumentDB(memory.NewStore())
+
+	if _, err := db.CountQueuedJobs(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !strings.Contains(scrape(t, "text/plain"), `rpulse_db_query_duration_seconds_count{operation="CountQueuedJobs"}`) {
+		t.Error("Expected the latency of CountQueuedJobs to be reported")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	WebhookDeliveries.WithLabelValues("workflow_job", "queued", OutcomeQueued).Inc()
+
+	testCases := []struct {
+		name     string
+		accept   string
+		expected []string
+	}{
+		{
+			name:     "prometheus text format",
+			accept:   "text/plain",
+			expected: []string{`rpulse_webhook_deliveries_total{action="queued",event="workflow_job",outcome="queued"}`, "go_goroutines"},
+		},
+		{
+			name:     "openmetrics format",
+			accept:   "application/openmetrics-text; version=1.0.0",
+			expected: []string{`rpulse_webhook_deliveries_total{action="queued",event="workflow_job",outcome="queued"}`, "# EOF"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := scrape(t, tc.accept)
+			for _, expected := range tc.expected {
+				if !strings.Contains(body, expected) {
+					t.Errorf("Expected the response to contain %q", expected)
+				}
+			}
+		})
+	}
+}
+
+// scrape requests the metrics in the given format and returns the response body
+func scrape(t *testing.T, accept string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body, _ := io.ReadAll(w.Body)
+	return string(body)
+}
@@ -0,0 +1,182 @@
+// Package pools classifies workflow jobs into named runner pools based on their labels.
+package pools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gateixeira/rpulse/internal/utils"
+	"github.com/gateixeira/rpulse/models"
+)
+
+// Match types supported by a Rule
+const (
+	MatchExact  = "exact"
+	MatchSubset = "subset"
+	MatchGlob   = "glob"
+)
+
+// Rule maps a label set to a named runner pool
+type Rule struct {
+	Pool     string   `json:"pool"`
+	Match    string   `json:"match"`
+	Labels   []string `json:"labels"`
+	Priority int      `json:"priority"`
+}
+
+// File is the format of the runner pools configuration file
+type File struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Classifier assigns a job's labels to the pool of the first matching rule.
+// Jobs matching no rule fall back to "self-hosted" or "github-hosted".
+type Classifier struct {
+	rules []Rule
+}
+
+// NewClassifier validates the rules and orders them by ascending priority.
+// Rules with the same priority keep their configured order.
+func NewClassifier(rules []Rule) (*Classifier, error) {
+	sorted := make([]Rule, len(rules))
+	for i, rule := range rules {
+		if rule.Pool == "" {
+			return nil, fmt.Errorf("rule %d: pool is required", i)
+		}
+		if len(rule.Labels) == 0 {
+			return nil, fmt.Errorf("rule %d (%s): labels are required", i, rule.Pool)
+		}
+
+		labels := make([]string, len(rule.Labels))
+		for j, label := range rule.Labels {
+			labels[j] = strings.ToLower(label)
+		}
+
+		switch rule.Match {
+		case MatchExact, MatchSubset:
+		case MatchGlob:
+			for _, pattern := range labels {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("rule %d (%s): invalid pattern %q: %w", i, rule.Pool, pattern, err)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("rule %d (%s): unknown match type %q", i, rule.Pool, rule.Match)
+		}
+
+		rule.Labels = labels
+		sorted[i] = rule
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	return &Classifier{rules: sorted}, nil
+}
+
+// Default returns a classifier without rules, which only tells self-hosted and GitHub-hosted apart
+func Default() *Classifier {
+	return &Classifier{}
+}
+
+// Load reads the rules from a JSON file. An empty path returns the default classifier.
+func Load(filename string) (*Classifier, error) {
+	if filename == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runner pools file: %w", err)
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse runner pools file: %w", err)
+	}
+
+	return NewClassifier(file.Rules)
+}
+
+// Classify returns the pool for a job's labels
+func (c *Classifier) Classify(labels []string) string {
+	normalized := make([]string, len(labels))
+	for i, label := range labels {
+		normalized[i] = strings.ToLower(label)
+	}
+
+	for _, rule := range c.rules {
+		if rule.matches(normalized) {
+			return rule.Pool
+		}
+	}
+
+	return string(utils.GetRunnerType(labels))
+}
+
+// Pools returns every pool the classifier can assign, in rule order, followed by the fallback pools
+func (c *Classifier) Pools() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, rule := range c.rules {
+		if !seen[rule.Pool] {
+			seen[rule.Pool] = true
+			names = append(names, rule.Pool)
+		}
+	}
+	for _, fallback := range []string{string(models.RunnerTypeSelfHosted), string(models.RunnerTypeGitHubHosted)} {
+		if !seen[fallback] {
+			seen[fallback] = true
+			names = append(names, fallback)
+		}
+	}
+	return names
+}
+
+func (r Rule) matches(labels []string) bool {
+	switch r.Match {
+	case MatchExact:
+		return len(unique(labels)) == len(unique(r.Labels)) && containsAll(labels, r.Labels)
+	case MatchSubset:
+		return containsAll(labels, r.Labels)
+	case MatchGlob:
+		// Every pattern has to match at least one of the job's labels
+		for _, pattern := range r.Labels {
+			matched := false
+			for _, label := range labels {
+				if ok, _ := path.Match(pattern, label); ok {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// containsAll reports whether every wanted label is present in labels
+func containsAll(labels, wanted []string) bool {
+	for _, label := range wanted {
+		if !utils.Contains(labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+func unique(labels []string) map[string]bool {
+	set := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		set[label] = true
+	}
+	return set
+}
@@ -0,0 +1,106 @@
+package pools
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	classifier, err := NewClassifier([]Rule{
+		{Pool: "gpu", Match: MatchSubset, Labels: []string{"self-hosted", "gpu"}, Priority: 10},
+		{Pool: "arm64", Match: MatchGlob, Labels: []string{"self-hosted", "arm*"}, Priority: 20},
+		{Pool: "large-linux", Match: MatchExact, Labels: []string{"self-hosted", "linux", "large"}, Priority: 30},
+		{Pool: "gh-larger", Match: MatchGlob, Labels: []string{"ubuntu-*-16core"}, Priority: 40},
+		{Pool: "gpu-arm", Match: MatchSubset, Labels: []string{"gpu", "arm64"}, Priority: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewClassifier() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		labels   []string
+		expected string
+	}{
+		{"subset match", []string{"self-hosted", "linux", "gpu"}, "gpu"},
+		{"glob match", []string{"self-hosted", "ARM64"}, "arm64"},
+		{"exact match ignores order", []string{"large", "linux", "self-hosted"}, "large-linux"},
+		{"exact match rejects extra labels", []string{"self-hosted", "linux", "large", "x64"}, "self-hosted"},
+		{"github larger runner", []string{"ubuntu-22.04-16core"}, "gh-larger"},
+		{"priority wins over order", []string{"self-hosted", "gpu", "arm64"}, "gpu-arm"},
+		{"self-hosted fallback", []string{"self-hosted", "windows"}, "self-hosted"},
+		{"github-hosted fallback", []string{"ubuntu-latest"}, "github-hosted"},
+		{"no labels", nil, "github-hosted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifier.Classify(tt.labels); got != tt.expected {
+				t.Errorf("Classify(%v) = %q, want %q", tt.labels, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	classifier := Default()
+
+	if got := classifier.Classify([]string{"self-hosted", "linux"}); got != "self-hosted" {
+		t.Errorf("Classify() = %q, want self-hosted", got)
+	}
+	if got := classifier.Classify([]string{"ubuntu-latest"}); got != "github-hosted" {
+		t.Errorf("Classify() = %q, want github-hosted", got)
+	}
+	if got := classifier.Pools(); !reflect.DeepEqual(got, []string{"self-hosted", "github-hosted"}) {
+		t.Errorf("Pools() = %v", got)
+	}
+}
+
+func TestNewClassifier_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"missing pool", Rule{Match: MatchExact, Labels: []string{"gpu"}}},
+		{"missing labels", Rule{Pool: "gpu", Match: MatchExact}},
+		{"unknown match type", Rule{Pool: "gpu", Match: "regex", Labels: []string{"gpu"}}},
+		{"invalid glob", Rule{Pool: "gpu", Match: MatchGlob, Labels: []string{"gpu["}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClassifier([]Rule{tt.rule}); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "pools.json")
+	content := `{"rules": [
+		{"pool": "gpu", "match": "subset", "labels": ["gpu"], "priority": 1},
+		{"pool": "arm64", "match": "glob", "labels": ["arm*"], "priority": 2}
+	]}`
+	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	classifier, err := Load(filename)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := classifier.Classify([]string{"self-hosted", "arm64"}); got != "arm64" {
+		t.Errorf("Classify() = %q, want arm64", got)
+	}
+	if got := classifier.Pools(); !reflect.DeepEqual(got, []string{"gpu", "arm64", "self-hosted", "github-hosted"}) {
+		t.Errorf("Pools() = %v", got)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
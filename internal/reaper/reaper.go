@@ -0,0 +1,132 @@
+// Package reaper abandons jobs that stopped receiving events.
+//
+// When a job's completed event is lost (a failed delivery, an outage or a
+// rejected signature), the job would otherwise stay queued or in progress
+// forever and inflate the live counts. The reaper periodically marks jobs
+// that have been in such a status for longer than its configured maximum age
+// as abandoned and records how many it reaped, so data loss stays visible.
+package reaper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Stats is a point-in-time view of the reaper
+type Stats struct {
+	IntervalMs int64                      `json:"interval_ms"`
+	MaxAgesMs  map[models.JobStatus]int64 `json:"max_ages_ms"`
+	LastRun    time.Time                  `json:"last_run"`
+	Reaped     map[models.JobStatus]int64 `json:"reaped"`
+	Failed     int64                      `json:"failed"`
+}
+
+// Reaper periodically abandons jobs stuck in a status for longer than its maximum age
+type Reaper struct {
+	db       database.DatabaseInterface
+	maxAges  map[models.JobStatus]time.Duration
+	interval time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	lastRun time.Time
+	reaped  map[models.JobStatus]int64
+	failed  int64
+}
+
+// NewReaper creates a reaper that runs every interval. Statuses without a maximum age are never reaped.
+func NewReaper(db database.DatabaseInterface, maxAges map[models.JobStatus]time.Duration, interval time.Duration) *Reaper {
+	return &Reaper{
+		db:       db,
+		maxAges:  maxAges,
+		interval: interval,
+		stop:     make(chan struct{}),
+		reaped:   make(map[models.JobStatus]int64),
+	}
+}
+
+// Start runs the reaper once and then on every interval until Shutdown
+func (r *Reaper) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			r.Run(context.Background())
+			select {
+			case <-ticker.C:
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+	logger.Logger.Info("Job reaper started", zap.Duration("interval", r.interval))
+}
+
+// Shutdown stops the reaper and waits for a running pass to finish
+func (r *Reaper) Shutdown() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// Run abandons the stale jobs of every status with a maximum age
+func (r *Reaper) Run(ctx context.Context) {
+	for status, maxAge := range r.maxAges {
+		count, err := r.db.ReapStaleJobs(ctx, status, maxAge)
+
+		r.mu.Lock()
+		if err != nil {
+			r.failed++
+		}
+		r.reaped[status] += int64(count)
+		r.mu.Unlock()
+
+		if err != nil {
+			logger.Logger.Error("Failed to reap stale jobs", zap.Error(err), zap.String("status", string(status)))
+			continue
+		}
+		if count > 0 {
+			logger.Logger.Warn("Reaped stale jobs",
+				zap.String("status", string(status)),
+				zap.Int("count", count),
+				zap.Duration("maxAge", maxAge))
+		}
+	}
+
+	r.mu.Lock()
+	r.lastRun = time.Now()
+	r.mu.Unlock()
+}
+
+// Stats returns the configuration, the time of the last pass and the number of jobs reaped per status
+func (r *Reaper) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := Stats{
+		IntervalMs: r.interval.Milliseconds(),
+		MaxAgesMs:  make(map[models.JobStatus]int64, len(r.maxAges)),
+		LastRun:    r.lastRun,
+		Reaped:     make(map[models.JobStatus]int64, len(r.reaped)),
+		Failed:     r.failed,
+	}
+	for status, maxAge := range r.maxAges {
+		stats.MaxAgesMs[status] = maxAge.Milliseconds()
+	}
+	for status, count := range r.reaped {
+		stats.Reaped[status] = count
+	}
+
+	return stats
+}
@@ -0,0 +1,77 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+// mockDB implements the DatabaseInterface methods used by the reaper
+type mockDB struct {
+	database.DatabaseInterface
+	mock.Mock
+}
+
+func (m *mockDB) ReapStaleJobs(ctx context.Context, status models.JobStatus, maxAge time.Duration) (int, error) {
+	args := m.Called(status, maxAge)
+	return args.Int(0), args.Error(1)
+}
+
+func TestReaper_Run(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	db := new(mockDB)
+	db.On("ReapStaleJobs", models.JobStatusQueued, 24*time.Hour).Return(2, nil)
+	db.On("ReapStaleJobs", models.JobStatusInProgress, 6*time.Hour).Return(0, errors.New("database error")).Once()
+	db.On("ReapStaleJobs", models.JobStatusInProgress, 6*time.Hour).Return(1, nil)
+
+	r := NewReaper(db, map[models.JobStatus]time.Duration{
+		models.JobStatusQueued:     24 * time.Hour,
+		models.JobStatusInProgress: 6 * time.Hour,
+	}, time.Minute)
+
+	r.Run(context.Background())
+	r.Run(context.Background())
+
+	stats := r.Stats()
+	assert.Equal(t, int64(4), stats.Reaped[models.JobStatusQueued])
+	assert.Equal(t, int64(1), stats.Reaped[models.JobStatusInProgress])
+	assert.Equal(t, int64(1), stats.Failed)
+	assert.Equal(t, (6 * time.Hour).Milliseconds(), stats.MaxAgesMs[models.JobStatusInProgress])
+	assert.False(t, stats.LastRun.IsZero())
+	db.AssertExpectations(t)
+}
+
+func TestReaper_StartAndShutdown(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	db := new(mockDB)
+	ran := make(chan struct{}, 1)
+	db.On("ReapStaleJobs", models.JobStatusQueued, time.Hour).Return(0, nil).Run(func(mock.Arguments) {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	})
+
+	r := NewReaper(db, map[models.JobStatus]time.Duration{models.JobStatusQueued: time.Hour}, time.Hour)
+	r.Start()
+
+	// The first pass runs right away rather than after the first interval
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the reaper to run on start")
+	}
+
+	r.Shutdown()
+	db.AssertExpectations(t)
+}
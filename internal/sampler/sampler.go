@@ -0,0 +1,242 @@
+// Package sampler records runner demand at a fixed interval.
+//
+// Recording a snapshot for every webhook leaves gaps in quiet periods and
+// writes bursts of near-identical rows under load, so the aggregated views
+// average unevenly spaced samples. The sampler instead writes one sample per
+// interval. Job events in between are still observed so that the highest
+// demand seen since the previous sample is kept as the sample's peak. Both
+// the observed counts and the samples are published to the live dashboards.
+package sampler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/live"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/internal/utils"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// snapshot holds the job counts at one point in time. Jobs waiting for approval do not need a
+// runner, so they are published but not part of the demand.
+type snapshot struct {
+	selfHosted   int
+	githubHosted int
+	queued       int
+	waiting      int
+	poolRunning  map[string]int
+	poolQueued   map[string]int
+}
+
+func (s snapshot) total() int {
+	return s.selfHosted + s.githubHosted + s.queued
+}
+
+func (s snapshot) counts() live.Counts {
+	return live.Counts{GitHubHosted: s.githubHosted, SelfHosted: s.selfHosted, Queued: s.queued, Waiting: s.waiting}
+}
+
+func (s snapshot) poolTotal(pool string) int {
+	return s.poolRunning[pool] + s.poolQueued[pool]
+}
+
+// Sampler writes a historical entry for the whole fleet and for every runner pool on each interval
+type Sampler struct {
+	db         database.DatabaseInterface
+	classifier *pools.Classifier
+	interval   time.Duration
+	live       *live.Broadcaster // nil when nothing is streamed
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	// Highest demand observed since the last sample
+	mu        sync.Mutex
+	peak      int
+	poolPeaks map[string]int
+}
+
+// NewSampler creates a sampler that records a sample every interval and publishes
+// the counts to the broadcaster, which may be nil
+func NewSampler(db database.DatabaseInterface, classifier *pools.Classifier, interval time.Duration, broadcaster *live.Broadcaster) *Sampler {
+	return &Sampler{
+		db:         db,
+		classifier: classifier,
+		interval:   interval,
+		live:       broadcaster,
+		stop:       make(chan struct{}),
+		poolPeaks:  make(map[string]int),
+	}
+}
+
+// Start records a sample on every interval until Shutdown
+func (s *Sampler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				if err := s.Sample(context.Background(), now); err != nil {
+					logger.Logger.Error("Failed to record demand sample", zap.Error(err))
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	logger.Logger.Info("Demand sampler started", zap.Duration("interval", s.interval))
+}
+
+// Shutdown stops the sampler and waits for a running sample to finish
+func (s *Sampler) Shutdown() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Observe reads the current counts and keeps them if they are the highest since the last sample
+func (s *Sampler) Observe(ctx context.Context) error {
+	current, err := s.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.observe(current)
+	s.mu.Unlock()
+
+	if s.live != nil {
+		s.live.PublishCounts(current.counts())
+	}
+
+	return nil
+}
+
+// Sample records the current counts together with the peak observed since the previous sample
+func (s *Sampler) Sample(ctx context.Context, now time.Time) error {
+	current, err := s.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.observe(current)
+	peak, poolPeaks := s.peak, s.poolPeaks
+	s.peak, s.poolPeaks = 0, make(map[string]int)
+	s.mu.Unlock()
+
+	timestamp := now.Format(time.RFC3339)
+	entry := models.HistoricalEntry{
+		Timestamp:         timestamp,
+		CountSelfHosted:   current.selfHosted,
+		CountGitHubHosted: current.githubHosted,
+		CountQueued:       current.queued,
+		PeakTotal:         peak,
+	}
+
+	if err := s.db.AddHistoricalEntry(ctx, entry); err != nil {
+		return fmt.Errorf("failed to add historical entry: %w", err)
+	}
+
+	names := s.poolNames(current, poolPeaks)
+	entries := make([]models.PoolHistoricalEntry, 0, len(names))
+	for _, pool := range names {
+		entries = append(entries, models.PoolHistoricalEntry{
+			Timestamp:    timestamp,
+			Pool:         pool,
+			CountRunning: current.poolRunning[pool],
+			CountQueued:  current.poolQueued[pool],
+			PeakTotal:    poolPeaks[pool],
+		})
+	}
+
+	if err := s.db.AddPoolHistoricalEntries(ctx, entries); err != nil {
+		return fmt.Errorf("failed to add pool historical entries: %w", err)
+	}
+
+	if s.live != nil {
+		s.live.PublishCounts(current.counts())
+		s.live.PublishSample(entry)
+	}
+
+	return nil
+}
+
+// observe folds a snapshot into the peaks. The caller must hold s.mu.
+func (s *Sampler) observe(current snapshot) {
+	s.peak = max(s.peak, current.total())
+	for _, counts := range []map[string]int{current.poolRunning, current.poolQueued} {
+		for pool := range counts {
+			s.poolPeaks[pool] = max(s.poolPeaks[pool], current.poolTotal(pool))
+		}
+	}
+}
+
+// poolNames returns the configured pools, which are recorded even when idle, followed by
+// the pools that are no longer configured but had jobs since the previous sample
+func (s *Sampler) poolNames(current snapshot, poolPeaks map[string]int) []string {
+	configured := s.classifier.Pools()
+	var unconfigured []string
+	for _, counts := range []map[string]int{current.poolRunning, current.poolQueued, poolPeaks} {
+		for pool := range counts {
+			if !utils.Contains(configured, pool) && !utils.Contains(unconfigured, pool) {
+				unconfigured = append(unconfigured, pool)
+			}
+		}
+	}
+	sort.Strings(unconfigured)
+
+	return append(configured, unconfigured...)
+}
+
+func (s *Sampler) snapshot(ctx context.Context) (snapshot, error) {
+	selfHosted, err := s.db.GetRunningJobs(ctx, models.RunnerTypeSelfHosted)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("failed to get self-hosted count: %w", err)
+	}
+
+	githubHosted, err := s.db.GetRunningJobs(ctx, models.RunnerTypeGitHubHosted)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("failed to get github-hosted count: %w", err)
+	}
+
+	queued, err := s.db.CountQueuedJobs(ctx)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("failed to get queued count: %w", err)
+	}
+
+	waiting, err := s.db.CountWaitingJobs(ctx)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("failed to get waiting count: %w", err)
+	}
+
+	poolRunning, err := s.db.CountRunningJobsByPool(ctx)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("failed to get running count by pool: %w", err)
+	}
+
+	poolQueued, err := s.db.CountQueuedJobsByPool(ctx)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("failed to get queued count by pool: %w", err)
+	}
+
+	return snapshot{
+		selfHosted:   len(selfHosted),
+		githubHosted: len(githubHosted),
+		queued:       queued,
+		waiting:      waiting,
+		poolRunning:  poolRunning,
+		poolQueued:   poolQueued,
+	}, nil
+}
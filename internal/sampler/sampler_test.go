@@ -0,0 +1,217 @@
+package sampler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gateixeira/rpulse/internal/database"
+	"github.com/gateixeira/rpulse/internal/live"
+	"github.com/gateixeira/rpulse/internal/pools"
+	"github.com/gateixeira/rpulse/models"
+	"github.com/gateixeira/rpulse/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+// mockDB implements the DatabaseInterface methods used by the sampler
+type mockDB struct {
+	database.DatabaseInterface
+	mock.Mock
+}
+
+func (m *mockDB) GetRunningJobs(ctx context.Context, runnerType models.RunnerType) ([]string, error) {
+	args := m.Called(runnerType)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockDB) CountQueuedJobs(ctx context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockDB) CountRunningJobsByPool(ctx context.Context) (map[string]int, error) {
+	args := m.Called()
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *mockDB) CountWaitingJobs(ctx context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockDB) CountQueuedJobsByPool(ctx context.Context) (map[string]int, error) {
+	args := m.Called()
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *mockDB) AddHistoricalEntry(ctx context.Context, entry models.HistoricalEntry) error {
+	args := m.Called(entry)
+	return args.Error(0)
+}
+
+func (m *mockDB) AddPoolHistoricalEntries(ctx context.Context, entries []models.PoolHistoricalEntry) error {
+	args := m.Called(entries)
+	return args.Error(0)
+}
+
+// expectCounts sets up a single snapshot of the job counts
+func expectCounts(db *mockDB, selfHosted, githubHosted []string, queued, waiting int, poolRunning, poolQueued map[string]int) {
+	db.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return(selfHosted, nil).Once()
+	db.On("GetRunningJobs", models.RunnerTypeGitHubHosted).Return(githubHosted, nil).Once()
+	db.On("CountQueuedJobs").Return(queued, nil).Once()
+	db.On("CountWaitingJobs").Return(waiting, nil).Once()
+	db.On("CountRunningJobsByPool").Return(poolRunning, nil).Once()
+	db.On("CountQueuedJobsByPool").Return(poolQueued, nil).Once()
+}
+
+func TestSampler_Sample(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	classifier, err := pools.NewClassifier([]pools.Rule{
+		{Pool: "gpu", Match: pools.MatchSubset, Labels: []string{"self-hosted", "gpu"}, Priority: 10},
+		{Pool: "arm64", Match: pools.MatchSubset, Labels: []string{"self-hosted", "arm64"}, Priority: 20},
+	})
+	if err != nil {
+		t.Fatalf("NewClassifier() error = %v", err)
+	}
+
+	db := new(mockDB)
+	s := NewSampler(db, classifier, time.Minute, nil)
+	now := time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)
+
+	// A burst between samples that has drained by the time the sample is taken. Jobs waiting
+	// for approval are not part of the demand.
+	expectCounts(db, []string{"1", "2", "3"}, []string{"4"}, 2, 4,
+		map[string]int{"gpu": 3, "legacy": 1}, map[string]int{"gpu": 2})
+	assert.NoError(t, s.Observe(context.Background()))
+
+	expectCounts(db, []string{"1"}, []string{}, 0, 0,
+		map[string]int{"gpu": 1}, map[string]int{})
+	db.On("AddHistoricalEntry", models.HistoricalEntry{
+		Timestamp:         "2025-03-24T10:00:00Z",
+		CountSelfHosted:   1,
+		CountGitHubHosted: 0,
+		CountQueued:       0,
+		PeakTotal:         6,
+	}).Return(nil).Once()
+	db.On("AddPoolHistoricalEntries", []models.PoolHistoricalEntry{
+		{Timestamp: "2025-03-24T10:00:00Z", Pool: "gpu", CountRunning: 1, CountQueued: 0, PeakTotal: 5},
+		{Timestamp: "2025-03-24T10:00:00Z", Pool: "arm64", CountRunning: 0, CountQueued: 0, PeakTotal: 0},
+		{Timestamp: "2025-03-24T10:00:00Z", Pool: "self-hosted", CountRunning: 0, CountQueued: 0, PeakTotal: 0},
+		{Timestamp: "2025-03-24T10:00:00Z", Pool: "github-hosted", CountRunning: 0, CountQueued: 0, PeakTotal: 0},
+		{Timestamp: "2025-03-24T10:00:00Z", Pool: "legacy", CountRunning: 0, CountQueued: 0, PeakTotal: 1},
+	}).Return(nil).Once()
+	assert.NoError(t, s.Sample(context.Background(), now))
+
+	// The peaks start over after every sample
+	expectCounts(db, []string{}, []string{}, 0, 0, map[string]int{}, map[string]int{})
+	db.On("AddHistoricalEntry", models.HistoricalEntry{
+		Timestamp: "2025-03-24T10:01:00Z",
+	}).Return(nil).Once()
+	db.On("AddPoolHistoricalEntries", []models.PoolHistoricalEntry{
+		{Timestamp: "2025-03-24T10:01:00Z", Pool: "gpu"},
+		{Timestamp: "2025-03-24T10:01:00Z", Pool: "arm64"},
+		{Timestamp: "2025-03-24T10:01:00Z", Pool: "self-hosted"},
+		{Timestamp: "2025-03-24T10:01:00Z", Pool: "github-hosted"},
+	}).Return(nil).Once()
+	assert.NoError(t, s.Sample(context.Background(), now.Add(time.Minute)))
+
+	db.AssertExpectations(t)
+}
+
+func TestSampler_Publish(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	db := new(mockDB)
+	broadcaster := live.NewBroadcaster()
+	events, unsubscribe := broadcaster.Subscribe()
+	defer unsubscribe()
+	s := NewSampler(db, pools.Default(), time.Minute, broadcaster)
+
+	expectCounts(db, []string{"1", "2"}, []string{"3"}, 4, 1, map[string]int{}, map[string]int{})
+	assert.NoError(t, s.Observe(context.Background()))
+	assert.Equal(t, live.Event{Name: live.EventCounts, Data: live.Counts{GitHubHosted: 1, SelfHosted: 2, Queued: 4, Waiting: 1}}, <-events)
+
+	// Unchanged counts are not published again, the sample is
+	expectCounts(db, []string{"1", "2"}, []string{"3"}, 4, 1, map[string]int{}, map[string]int{})
+	db.On("AddHistoricalEntry", mock.Anything).Return(nil).Once()
+	db.On("AddPoolHistoricalEntries", mock.Anything).Return(nil).Once()
+	assert.NoError(t, s.Sample(context.Background(), time.Date(2025, 3, 24, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, live.Event{Name: live.EventSample, Data: models.HistoricalEntry{
+		Timestamp:         "2025-03-24T10:00:00Z",
+		CountSelfHosted:   2,
+		CountGitHubHosted: 1,
+		CountQueued:       4,
+		PeakTotal:         7,
+	}}, <-events)
+	assert.Empty(t, events)
+
+	db.AssertExpectations(t)
+}
+
+func TestSampler_Errors(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	t.Run("snapshot error", func(t *testing.T) {
+		db := new(mockDB)
+		db.On("GetRunningJobs", models.RunnerTypeSelfHosted).Return([]string(nil), errors.New("database error"))
+
+		err := NewSampler(db, pools.Default(), time.Minute, nil).Observe(context.Background())
+		assert.EqualError(t, err, "failed to get self-hosted count: database error")
+		db.AssertExpectations(t)
+	})
+
+	t.Run("historical entry error", func(t *testing.T) {
+		db := new(mockDB)
+		expectCounts(db, []string{}, []string{}, 0, 0, map[string]int{}, map[string]int{})
+		db.On("AddHistoricalEntry", mock.Anything).Return(errors.New("database error"))
+
+		err := NewSampler(db, pools.Default(), time.Minute, nil).Sample(context.Background(), time.Now())
+		assert.EqualError(t, err, "failed to add historical entry: database error")
+		db.AssertNotCalled(t, "AddPoolHistoricalEntries", mock.Anything)
+	})
+
+	t.Run("pool historical entries error", func(t *testing.T) {
+		db := new(mockDB)
+		expectCounts(db, []string{}, []string{}, 0, 0, map[string]int{}, map[string]int{})
+		db.On("AddHistoricalEntry", mock.Anything).Return(nil)
+		db.On("AddPoolHistoricalEntries", mock.Anything).Return(errors.New("database error"))
+
+		err := NewSampler(db, pools.Default(), time.Minute, nil).Sample(context.Background(), time.Now())
+		assert.EqualError(t, err, "failed to add pool historical entries: database error")
+		db.AssertExpectations(t)
+	})
+}
+
+func TestSampler_StartAndShutdown(t *testing.T) {
+	logger.Logger = zaptest.NewLogger(t)
+
+	db := new(mockDB)
+	sampled := make(chan struct{}, 1)
+	db.On("GetRunningJobs", mock.Anything).Return([]string{}, nil)
+	db.On("CountQueuedJobs").Return(0, nil)
+	db.On("CountWaitingJobs").Return(0, nil)
+	db.On("CountRunningJobsByPool").Return(map[string]int{}, nil)
+	db.On("CountQueuedJobsByPool").Return(map[string]int{}, nil)
+	db.On("AddHistoricalEntry", mock.Anything).Return(nil)
+	db.On("AddPoolHistoricalEntries", mock.Anything).Return(nil).Run(func(mock.Arguments) {
+		select {
+		case sampled <- struct{}{}:
+		default:
+		}
+	})
+
+	s := NewSampler(db, pools.Default(), 10*time.Millisecond, nil)
+	s.Start()
+
+	select {
+	case <-sampled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the sampler to record a sample")
+	}
+
+	s.Shutdown()
+}
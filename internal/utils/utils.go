@@ -41,3 +41,6 @@ const CookieName = "csrf_token"
 
 // HeaderName is the name of the CSRF header
 const HeaderName = "X-CSRF-Token"
+
+// QueryParam is the name of the CSRF query parameter, for requests that cannot set headers like EventSource
+const QueryParam = "csrf_token"
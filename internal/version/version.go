@@ -0,0 +1,58 @@
+// Package version identifies the build of the running binary.
+//
+// Release builds set Commit and Date with the linker:
+//
+//	go build -ldflags "-X github.com/gateixeira/rpulse/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/gateixeira/rpulse/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to the VCS information the Go toolchain embeds.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with -ldflags "-X ..."
+var (
+	Commit = ""
+	Date   = ""
+)
+
+// Info describes the build of the running binary
+type Info struct {
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information, falling back to "unknown" for what is not known
+func Get() Info {
+	info := Info{Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+
+	return info
+}
+
+// String formats the build information for display
+func (i Info) String() string {
+	return fmt.Sprintf("rpulse commit %s built %s with %s", i.Commit, i.Date, i.GoVersion)
+}
@@ -62,13 +62,14 @@ function sendWebhookEvent(jobId, status, baseTime) {
   const res = http.post(webhookUrl, payloadStr, {
     headers: { 
       'Content-Type': 'application/x-www-form-urlencoded',
+      'X-GitHub-Event': 'workflow_job',
       'X-Hub-Signature-256': signature
     },
   });
 
   check(res, { 
-    "status was 200": (r) => r.status == 200,
-    "response has success status": (r) => r.json().status === "success"
+    "status was 202": (r) => r.status == 202,
+    "response has queued status": (r) => r.json().status === "queued"
   });
 }
 
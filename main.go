@@ -1,9 +1,11 @@
 package main
 
 import (
-	"github.com/gateixeira/rpulse/cmd/server"
+	"os"
+
+	"github.com/gateixeira/rpulse/cmd"
 )
 
 func main() {
-	server.SetupAndRun()
+	os.Exit(cmd.Execute(os.Args[1:]))
 }
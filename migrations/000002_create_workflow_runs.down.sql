@@ -0,0 +1,3 @@
+SELECT remove_retention_policy('workflow_runs');
+
+DROP TABLE IF EXISTS workflow_runs;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS workflow_runs (
+    id BIGINT NOT NULL,
+    run_attempt INTEGER NOT NULL,
+    workflow_id BIGINT,
+    workflow_name TEXT,
+    event TEXT,
+    status TEXT NOT NULL,
+    conclusion TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    run_started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    duration_ms BIGINT,
+    CONSTRAINT workflow_runs_pkey PRIMARY KEY (id, run_attempt, created_at)
+);
+
+SELECT create_hypertable('workflow_runs', 'created_at', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS workflow_runs_workflow_name_idx ON workflow_runs (workflow_name, created_at DESC);
+
+SELECT add_retention_policy('workflow_runs', INTERVAL '30 days');
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    delivery_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL,
+    last_received_at TIMESTAMPTZ NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    processed BOOLEAN NOT NULL DEFAULT FALSE,
+    processed_at TIMESTAMPTZ,
+    CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (delivery_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_received_at_idx ON webhook_deliveries (received_at DESC);
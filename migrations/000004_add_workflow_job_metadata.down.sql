@@ -0,0 +1,22 @@
+DROP INDEX IF EXISTS workflow_jobs_run_idx;
+DROP INDEX IF EXISTS workflow_jobs_repository_idx;
+
+ALTER TABLE workflow_jobs
+    DROP COLUMN IF EXISTS enterprise_slug,
+    DROP COLUMN IF EXISTS enterprise_id,
+    DROP COLUMN IF EXISTS organization_login,
+    DROP COLUMN IF EXISTS organization_id,
+    DROP COLUMN IF EXISTS repository_full_name,
+    DROP COLUMN IF EXISTS repository_id,
+    DROP COLUMN IF EXISTS runner_group_name,
+    DROP COLUMN IF EXISTS runner_group_id,
+    DROP COLUMN IF EXISTS runner_name,
+    DROP COLUMN IF EXISTS runner_id,
+    DROP COLUMN IF EXISTS labels,
+    DROP COLUMN IF EXISTS conclusion,
+    DROP COLUMN IF EXISTS head_sha,
+    DROP COLUMN IF EXISTS head_branch,
+    DROP COLUMN IF EXISTS job_name,
+    DROP COLUMN IF EXISTS workflow_name,
+    DROP COLUMN IF EXISTS run_attempt,
+    DROP COLUMN IF EXISTS run_id;
@@ -0,0 +1,26 @@
+ALTER TABLE workflow_jobs
+    ADD COLUMN IF NOT EXISTS run_id BIGINT,
+    ADD COLUMN IF NOT EXISTS run_attempt INTEGER,
+    ADD COLUMN IF NOT EXISTS workflow_name TEXT,
+    ADD COLUMN IF NOT EXISTS job_name TEXT,
+    ADD COLUMN IF NOT EXISTS head_branch TEXT,
+    ADD COLUMN IF NOT EXISTS head_sha TEXT,
+    ADD COLUMN IF NOT EXISTS conclusion TEXT,
+    ADD COLUMN IF NOT EXISTS labels TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS runner_id BIGINT,
+    ADD COLUMN IF NOT EXISTS runner_name TEXT,
+    ADD COLUMN IF NOT EXISTS runner_group_id BIGINT,
+    ADD COLUMN IF NOT EXISTS runner_group_name TEXT,
+    ADD COLUMN IF NOT EXISTS repository_id BIGINT,
+    ADD COLUMN IF NOT EXISTS repository_full_name TEXT,
+    ADD COLUMN IF NOT EXISTS organization_id BIGINT,
+    ADD COLUMN IF NOT EXISTS organization_login TEXT,
+    ADD COLUMN IF NOT EXISTS enterprise_id BIGINT,
+    ADD COLUMN IF NOT EXISTS enterprise_slug TEXT;
+
+-- Earlier versions stored unset timestamps as the zero time instead of NULL
+UPDATE workflow_jobs SET started_at = NULL WHERE started_at < '1970-01-01';
+UPDATE workflow_jobs SET completed_at = NULL WHERE completed_at < '1970-01-01';
+
+CREATE INDEX IF NOT EXISTS workflow_jobs_repository_idx ON workflow_jobs (repository_full_name, created_at DESC);
+CREATE INDEX IF NOT EXISTS workflow_jobs_run_idx ON workflow_jobs (run_id, run_attempt);
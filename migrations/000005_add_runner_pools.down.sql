@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS pool_historical_entries;
+
+DROP INDEX IF EXISTS workflow_jobs_pool_status_idx;
+
+ALTER TABLE queue_time_durations DROP COLUMN IF EXISTS runner_pool;
+ALTER TABLE workflow_jobs DROP COLUMN IF EXISTS runner_pool;
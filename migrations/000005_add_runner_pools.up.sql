@@ -0,0 +1,26 @@
+ALTER TABLE workflow_jobs ADD COLUMN IF NOT EXISTS runner_pool TEXT;
+ALTER TABLE queue_time_durations ADD COLUMN IF NOT EXISTS runner_pool TEXT;
+
+-- Jobs stored before pools were configurable belong to the pool of their runner type
+UPDATE workflow_jobs SET runner_pool = runner_type WHERE runner_pool IS NULL;
+
+UPDATE queue_time_durations q SET runner_pool = j.runner_pool
+FROM workflow_jobs j
+WHERE q.runner_pool IS NULL AND j.id = q.job_id AND j.created_at = q.job_created_at;
+
+CREATE INDEX IF NOT EXISTS workflow_jobs_pool_status_idx ON workflow_jobs (runner_pool, status);
+
+CREATE TABLE IF NOT EXISTS pool_historical_entries (
+    id SERIAL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    runner_pool TEXT NOT NULL,
+    count_running INTEGER NOT NULL,
+    count_queued INTEGER NOT NULL,
+    CONSTRAINT pool_historical_entries_pkey PRIMARY KEY (id, timestamp)
+);
+
+SELECT create_hypertable('pool_historical_entries', 'timestamp', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS pool_historical_entries_pool_idx ON pool_historical_entries (runner_pool, timestamp DESC);
+
+SELECT add_retention_policy('pool_historical_entries', INTERVAL '30 days');
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS approval_wait_durations;
+
+ALTER TABLE workflow_jobs
+    DROP COLUMN IF EXISTS queued_at,
+    DROP COLUMN IF EXISTS waiting_at;
@@ -0,0 +1,17 @@
+ALTER TABLE workflow_jobs
+    ADD COLUMN IF NOT EXISTS waiting_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS queued_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS approval_wait_durations (
+    id SERIAL,
+    job_id BIGINT NOT NULL,
+    job_created_at TIMESTAMPTZ NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL,
+    runner_pool TEXT,
+    CONSTRAINT approval_wait_durations_pkey PRIMARY KEY (id, recorded_at)
+);
+
+SELECT create_hypertable('approval_wait_durations', 'recorded_at', if_not_exists => TRUE);
+
+SELECT add_retention_policy('approval_wait_durations', INTERVAL '30 days');
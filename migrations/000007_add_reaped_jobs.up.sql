@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS reaped_jobs (
+    id SERIAL,
+    reaped_at TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL,
+    count INTEGER NOT NULL,
+    CONSTRAINT reaped_jobs_pkey PRIMARY KEY (id, reaped_at)
+);
+
+SELECT create_hypertable('reaped_jobs', 'reaped_at', if_not_exists => TRUE);
+
+SELECT add_retention_policy('reaped_jobs', INTERVAL '30 days');
@@ -0,0 +1,38 @@
+CREATE OR REPLACE VIEW daily_runner_stats AS
+SELECT
+    time_bucket('3 minutes', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(count_self_hosted + count_github_hosted + count_queued) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 day'
+GROUP BY bucket
+ORDER BY bucket;
+
+CREATE OR REPLACE VIEW weekly_runner_stats AS
+SELECT
+    time_bucket('30 minutes', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(count_self_hosted + count_github_hosted + count_queued) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 week'
+GROUP BY bucket
+ORDER BY bucket;
+
+CREATE OR REPLACE VIEW monthly_runner_stats AS
+SELECT
+    time_bucket('2 hours', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(count_self_hosted + count_github_hosted + count_queued) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 month'
+GROUP BY bucket
+ORDER BY bucket;
+
+ALTER TABLE pool_historical_entries DROP COLUMN IF EXISTS peak_total;
+ALTER TABLE historical_entries DROP COLUMN IF EXISTS peak_total;
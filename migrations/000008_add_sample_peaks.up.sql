@@ -0,0 +1,45 @@
+ALTER TABLE historical_entries ADD COLUMN IF NOT EXISTS peak_total INTEGER;
+ALTER TABLE pool_historical_entries ADD COLUMN IF NOT EXISTS peak_total INTEGER;
+
+-- Entries written per webhook have no separate peak; their own total is the peak
+UPDATE historical_entries SET peak_total = count_self_hosted + count_github_hosted + count_queued WHERE peak_total IS NULL;
+UPDATE pool_historical_entries SET peak_total = count_running + count_queued WHERE peak_total IS NULL;
+
+ALTER TABLE historical_entries ALTER COLUMN peak_total SET NOT NULL;
+ALTER TABLE pool_historical_entries ALTER COLUMN peak_total SET NOT NULL;
+
+CREATE OR REPLACE VIEW daily_runner_stats AS
+SELECT
+    time_bucket('3 minutes', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 day'
+GROUP BY bucket
+ORDER BY bucket;
+
+CREATE OR REPLACE VIEW weekly_runner_stats AS
+SELECT
+    time_bucket('30 minutes', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 week'
+GROUP BY bucket
+ORDER BY bucket;
+
+CREATE OR REPLACE VIEW monthly_runner_stats AS
+SELECT
+    time_bucket('2 hours', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 month'
+GROUP BY bucket
+ORDER BY bucket;
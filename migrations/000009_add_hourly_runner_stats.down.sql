@@ -0,0 +1,2 @@
+DROP MATERIALIZED VIEW IF EXISTS hourly_pool_stats;
+DROP MATERIALIZED VIEW IF EXISTS hourly_runner_stats;
@@ -0,0 +1,37 @@
+-- Hourly rollups outlive the raw entries so that past windows can still be queried
+CREATE MATERIALIZED VIEW IF NOT EXISTS hourly_runner_stats
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+GROUP BY bucket
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS hourly_pool_stats
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', timestamp) AS bucket,
+    runner_pool,
+    AVG(count_running) AS avg_running,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM pool_historical_entries
+GROUP BY bucket, runner_pool
+WITH NO DATA;
+
+-- The refresh window stays inside the 30-day raw retention so dropped chunks never clear materialized hours
+SELECT add_continuous_aggregate_policy('hourly_runner_stats',
+    start_offset => INTERVAL '29 days',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes');
+SELECT add_continuous_aggregate_policy('hourly_pool_stats',
+    start_offset => INTERVAL '29 days',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes');
+
+SELECT add_retention_policy('hourly_runner_stats', INTERVAL '1 year');
+SELECT add_retention_policy('hourly_pool_stats', INTERVAL '1 year');
@@ -0,0 +1,79 @@
+DROP MATERIALIZED VIEW IF EXISTS pool_stats_1h;
+DROP MATERIALIZED VIEW IF EXISTS pool_stats_15m;
+DROP MATERIALIZED VIEW IF EXISTS pool_stats_1m;
+DROP MATERIALIZED VIEW IF EXISTS runner_stats_1h;
+DROP MATERIALIZED VIEW IF EXISTS runner_stats_15m;
+DROP MATERIALIZED VIEW IF EXISTS runner_stats_1m;
+
+CREATE OR REPLACE VIEW daily_runner_stats AS
+SELECT
+    time_bucket('3 minutes', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 day'
+GROUP BY bucket
+ORDER BY bucket;
+
+CREATE OR REPLACE VIEW weekly_runner_stats AS
+SELECT
+    time_bucket('30 minutes', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 week'
+GROUP BY bucket
+ORDER BY bucket;
+
+CREATE OR REPLACE VIEW monthly_runner_stats AS
+SELECT
+    time_bucket('2 hours', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+WHERE timestamp >= NOW() - INTERVAL '1 month'
+GROUP BY bucket
+ORDER BY bucket;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS hourly_runner_stats
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', timestamp) AS bucket,
+    AVG(count_self_hosted) AS avg_self_hosted,
+    AVG(count_github_hosted) AS avg_github_hosted,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+GROUP BY bucket
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS hourly_pool_stats
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', timestamp) AS bucket,
+    runner_pool,
+    AVG(count_running) AS avg_running,
+    AVG(count_queued) AS avg_queued,
+    MAX(peak_total) AS peak_total
+FROM pool_historical_entries
+GROUP BY bucket, runner_pool
+WITH NO DATA;
+
+-- The refresh window stays inside the 30-day raw retention so dropped chunks never clear materialized hours
+SELECT add_continuous_aggregate_policy('hourly_runner_stats',
+    start_offset => INTERVAL '29 days',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes');
+SELECT add_continuous_aggregate_policy('hourly_pool_stats',
+    start_offset => INTERVAL '29 days',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes');
+
+SELECT add_retention_policy('hourly_runner_stats', INTERVAL '1 year');
+SELECT add_retention_policy('hourly_pool_stats', INTERVAL '1 year');
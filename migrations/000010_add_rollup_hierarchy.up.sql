@@ -0,0 +1,109 @@
+-- The hourly rollups are rebuilt on top of the finer levels and rematerialized from the retained raw entries
+DROP MATERIALIZED VIEW IF EXISTS hourly_pool_stats;
+DROP MATERIALIZED VIEW IF EXISTS hourly_runner_stats;
+
+DROP VIEW IF EXISTS daily_runner_stats;
+DROP VIEW IF EXISTS weekly_runner_stats;
+DROP VIEW IF EXISTS monthly_runner_stats;
+
+-- Rollups store sums and sample counts rather than averages so that every level above
+-- the first averages the raw samples exactly
+CREATE MATERIALIZED VIEW IF NOT EXISTS runner_stats_1m
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 minute', timestamp) AS bucket,
+    COUNT(*) AS samples,
+    SUM(count_self_hosted) AS sum_self_hosted,
+    SUM(count_github_hosted) AS sum_github_hosted,
+    SUM(count_queued) AS sum_queued,
+    MAX(peak_total) AS peak_total
+FROM historical_entries
+GROUP BY bucket
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS runner_stats_15m
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('15 minutes', bucket) AS bucket,
+    SUM(samples) AS samples,
+    SUM(sum_self_hosted) AS sum_self_hosted,
+    SUM(sum_github_hosted) AS sum_github_hosted,
+    SUM(sum_queued) AS sum_queued,
+    MAX(peak_total) AS peak_total
+FROM runner_stats_1m
+GROUP BY 1
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS runner_stats_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    SUM(samples) AS samples,
+    SUM(sum_self_hosted) AS sum_self_hosted,
+    SUM(sum_github_hosted) AS sum_github_hosted,
+    SUM(sum_queued) AS sum_queued,
+    MAX(peak_total) AS peak_total
+FROM runner_stats_15m
+GROUP BY 1
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS pool_stats_1m
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 minute', timestamp) AS bucket,
+    runner_pool,
+    COUNT(*) AS samples,
+    SUM(count_running) AS sum_running,
+    SUM(count_queued) AS sum_queued,
+    MAX(peak_total) AS peak_total
+FROM pool_historical_entries
+GROUP BY bucket, runner_pool
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS pool_stats_15m
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('15 minutes', bucket) AS bucket,
+    runner_pool,
+    SUM(samples) AS samples,
+    SUM(sum_running) AS sum_running,
+    SUM(sum_queued) AS sum_queued,
+    MAX(peak_total) AS peak_total
+FROM pool_stats_1m
+GROUP BY 1, runner_pool
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS pool_stats_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    runner_pool,
+    SUM(samples) AS samples,
+    SUM(sum_running) AS sum_running,
+    SUM(sum_queued) AS sum_queued,
+    MAX(peak_total) AS peak_total
+FROM pool_stats_15m
+GROUP BY 1, runner_pool
+WITH NO DATA;
+
+-- Refresh windows stay inside the retention of the level below so that dropped chunks
+-- never clear rows that were already rolled up. The first run backfills the whole window.
+SELECT add_continuous_aggregate_policy('runner_stats_1m',
+    start_offset => INTERVAL '29 days', end_offset => INTERVAL '1 minute', schedule_interval => INTERVAL '1 minute');
+SELECT add_continuous_aggregate_policy('runner_stats_15m',
+    start_offset => INTERVAL '29 days', end_offset => INTERVAL '15 minutes', schedule_interval => INTERVAL '15 minutes');
+SELECT add_continuous_aggregate_policy('runner_stats_1h',
+    start_offset => INTERVAL '29 days', end_offset => INTERVAL '1 hour', schedule_interval => INTERVAL '30 minutes');
+SELECT add_continuous_aggregate_policy('pool_stats_1m',
+    start_offset => INTERVAL '29 days', end_offset => INTERVAL '1 minute', schedule_interval => INTERVAL '1 minute');
+SELECT add_continuous_aggregate_policy('pool_stats_15m',
+    start_offset => INTERVAL '29 days', end_offset => INTERVAL '15 minutes', schedule_interval => INTERVAL '15 minutes');
+SELECT add_continuous_aggregate_policy('pool_stats_1h',
+    start_offset => INTERVAL '29 days', end_offset => INTERVAL '1 hour', schedule_interval => INTERVAL '30 minutes');
+
+SELECT add_retention_policy('runner_stats_1m', INTERVAL '90 days');
+SELECT add_retention_policy('runner_stats_15m', INTERVAL '1 year');
+SELECT add_retention_policy('runner_stats_1h', INTERVAL '2 years');
+SELECT add_retention_policy('pool_stats_1m', INTERVAL '90 days');
+SELECT add_retention_policy('pool_stats_15m', INTERVAL '1 year');
+SELECT add_retention_policy('pool_stats_1h', INTERVAL '2 years');
@@ -0,0 +1,2 @@
+-- Payloads are kept so that stored deliveries can be replayed
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS payload BYTEA;
@@ -0,0 +1,12 @@
+-- Bearer tokens of the /api/v1 endpoints, stored as SHA-256 hashes of their secrets
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    CONSTRAINT api_tokens_pkey PRIMARY KEY (id),
+    CONSTRAINT api_tokens_token_hash_key UNIQUE (token_hash)
+);
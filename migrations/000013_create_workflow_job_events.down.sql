@@ -0,0 +1,3 @@
+SELECT remove_retention_policy('workflow_job_events');
+
+DROP TABLE IF EXISTS workflow_job_events;
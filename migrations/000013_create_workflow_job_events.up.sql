@@ -0,0 +1,24 @@
+-- Every workflow_job event is kept next to the merged state in workflow_jobs. Events are
+-- partitioned by the creation time of their job, so they are dropped together with it.
+CREATE TABLE IF NOT EXISTS workflow_job_events (
+    id BIGSERIAL,
+    job_id BIGINT NOT NULL,
+    job_created_at TIMESTAMPTZ NOT NULL,
+    delivery_id TEXT,
+    action TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL,
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    conclusion TEXT,
+    runner_id BIGINT,
+    runner_name TEXT,
+    runner_group_name TEXT,
+    CONSTRAINT workflow_job_events_pkey PRIMARY KEY (id, job_created_at),
+    CONSTRAINT workflow_job_events_delivery_key UNIQUE (delivery_id, job_created_at)
+);
+
+SELECT create_hypertable('workflow_job_events', 'job_created_at', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS workflow_job_events_job_idx ON workflow_job_events (job_id, job_created_at, received_at);
+
+SELECT add_retention_policy('workflow_job_events', INTERVAL '30 days');
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS approval_wait_durations_job_key;
+
+DROP INDEX IF EXISTS queue_time_durations_job_key;
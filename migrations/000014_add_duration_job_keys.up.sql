@@ -0,0 +1,17 @@
+-- A job's queue time and approval wait are recorded once, however often its deliveries are
+-- processed. TimescaleDB requires unique indexes to include the partitioning column, so the
+-- index cannot enforce one row per job on its own: inserts check for the job's row under an
+-- advisory lock on the job, as the SQLite store's (job_id, job_created_at) key does.
+DELETE FROM queue_time_durations a
+    USING queue_time_durations b
+    WHERE a.job_id = b.job_id AND a.job_created_at = b.job_created_at
+        AND (a.recorded_at, a.id) > (b.recorded_at, b.id);
+
+DELETE FROM approval_wait_durations a
+    USING approval_wait_durations b
+    WHERE a.job_id = b.job_id AND a.job_created_at = b.job_created_at
+        AND (a.recorded_at, a.id) > (b.recorded_at, b.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS queue_time_durations_job_key ON queue_time_durations (job_id, job_created_at, recorded_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS approval_wait_durations_job_key ON approval_wait_durations (job_id, job_created_at, recorded_at);
@@ -0,0 +1,3 @@
+-- A delivery is claimed by the request that processes it, so concurrent copies of a delivery are
+-- processed once. Deliveries recorded before have no claim and are processed by a redelivery.
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
@@ -0,0 +1,10 @@
+// Package migrations embeds the PostgreSQL schema migrations so the binary
+// can migrate a database without the SQL files being present on disk.
+package migrations
+
+import "embed"
+
+// FS holds the up and down migrations, named {version}_{description}.{up|down}.sql
+//
+//go:embed *.sql
+var FS embed.FS
@@ -2,12 +2,113 @@ package models
 
 import "time"
 
-// HistoricalEntry represents a point in time with the count of running workflows
+// HistoricalEntry represents a point in time with the count of running workflows.
+// PeakTotal is the highest running and queued total seen since the previous entry.
 type HistoricalEntry struct {
 	Timestamp         string `json:"timestamp"`
 	CountSelfHosted   int    `json:"count_self_hosted"`
 	CountGitHubHosted int    `json:"count_github_hosted"`
 	CountQueued       int    `json:"count_queued"`
+	PeakTotal         int    `json:"peak_total"`
+}
+
+// PoolHistoricalEntry represents a point in time with the running and queued job counts of one runner pool.
+// PeakTotal is the highest running and queued total of the pool seen since the previous entry.
+type PoolHistoricalEntry struct {
+	Timestamp    string `json:"timestamp"`
+	Pool         string `json:"pool"`
+	CountRunning int    `json:"count_running"`
+	CountQueued  int    `json:"count_queued"`
+	PeakTotal    int    `json:"peak_total"`
+}
+
+// TimeRange selects the history from From up to, but excluding, To in buckets of Step
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+	Step time.Duration
+}
+
+// RetentionPolicies is how long each class of data is kept before TimescaleDB drops it
+type RetentionPolicies struct {
+	Raw       time.Duration // runner and pool demand samples
+	Jobs      time.Duration // workflow jobs with their events, workflow runs, and reaped job counts
+	Durations time.Duration // queue and approval wait durations
+	Rollup1m  time.Duration
+	Rollup15m time.Duration
+	Rollup1h  time.Duration
+}
+
+// RetentionPolicy is the retention policy in effect on one table
+type RetentionPolicy struct {
+	Table     string `json:"table"`
+	DataClass string `json:"data_class"`
+	DropAfter string `json:"drop_after"`
+}
+
+// QueueTimeFilter selects the queue times to summarize. Empty fields do not filter.
+// Labels matches jobs that requested at least all of the given labels.
+type QueueTimeFilter struct {
+	Period     string
+	Pool       string
+	Repository string
+	Labels     []string
+}
+
+// QueueTimeStats summarizes the queue times matching a QueueTimeFilter
+type QueueTimeStats struct {
+	Count int64 `json:"count"`
+	AvgMs int64 `json:"avg_ms"`
+	P50Ms int64 `json:"p50_ms"`
+	P90Ms int64 `json:"p90_ms"`
+	P95Ms int64 `json:"p95_ms"`
+	P99Ms int64 `json:"p99_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// HistogramBucket counts the durations from MinMs up to, but excluding, MaxMs.
+// The last bucket has no upper bound and omits MaxMs.
+type HistogramBucket struct {
+	MinMs int64 `json:"min_ms"`
+	MaxMs int64 `json:"max_ms,omitempty"`
+	Count int64 `json:"count"`
+}
+
+// JobDurationFilter selects the completed jobs to summarize. Empty fields do not filter.
+type JobDurationFilter struct {
+	Period     string
+	Pool       string
+	Repository string
+	Workflow   string
+	Job        string
+}
+
+// JobDuration is how long a completed job ran on its runner
+type JobDuration struct {
+	ID          int64     `json:"id"`
+	RunID       int64     `json:"run_id"`
+	Repository  string    `json:"repository"`
+	Workflow    string    `json:"workflow"`
+	Job         string    `json:"job"`
+	Pool        string    `json:"pool"`
+	Conclusion  string    `json:"conclusion"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// JobDurationStats summarizes the run durations of one group of completed jobs.
+// Only the fields the jobs are grouped by are set.
+type JobDurationStats struct {
+	Pool          string  `json:"pool,omitempty"`
+	Repository    string  `json:"repository,omitempty"`
+	Workflow      string  `json:"workflow,omitempty"`
+	Job           string  `json:"job,omitempty"`
+	Count         int64   `json:"count"`
+	AvgMs         int64   `json:"avg_ms"`
+	P50Ms         int64   `json:"p50_ms"`
+	P95Ms         int64   `json:"p95_ms"`
+	RunnerMinutes float64 `json:"runner_minutes"`
 }
 
 // RunnerType represents the type of runner (GitHub-hosted or self-hosted)
@@ -22,9 +123,12 @@ const (
 type JobStatus string
 
 const (
+	JobStatusWaiting    JobStatus = "waiting"
 	JobStatusQueued     JobStatus = "queued"
 	JobStatusInProgress JobStatus = "in_progress"
 	JobStatusCompleted  JobStatus = "completed"
+	// JobStatusAbandoned marks a job reaped after its completed event never arrived
+	JobStatusAbandoned JobStatus = "abandoned"
 )
 
 // QueueTimeEntry tracks a workflow's queue state with its timestamp
@@ -35,24 +139,236 @@ type QueueTimeEntry struct {
 
 // WebhookEvent represents the incoming webhook payload
 type WebhookEvent struct {
-	Action      string             `json:"action" binding:"required"`
-	WorkflowJob WebhookWorkflowJob `json:"workflow_job" binding:"required"`
+	Action       string             `json:"action" binding:"required"`
+	WorkflowJob  WebhookWorkflowJob `json:"workflow_job" binding:"required"`
+	Repository   Repository         `json:"repository"`
+	Organization Organization       `json:"organization"`
+	Enterprise   Enterprise         `json:"enterprise"`
 }
 
 type WebhookWorkflowJob struct {
-	ID          int64     `json:"id" binding:"required"`
-	Labels      []string  `json:"labels" binding:"required"`
-	CreatedAt   time.Time `json:"created_at" binding:"required"`
-	StartedAt   time.Time `json:"started_at"`
-	CompletedAt time.Time `json:"completed_at"`
+	ID              int64     `json:"id" binding:"required"`
+	RunID           int64     `json:"run_id"`
+	RunAttempt      int       `json:"run_attempt"`
+	WorkflowName    string    `json:"workflow_name"`
+	Name            string    `json:"name"`
+	HeadBranch      string    `json:"head_branch"`
+	HeadSHA         string    `json:"head_sha"`
+	Conclusion      string    `json:"conclusion"`
+	Labels          []string  `json:"labels" binding:"required"`
+	RunnerID        int64     `json:"runner_id"`
+	RunnerName      string    `json:"runner_name"`
+	RunnerGroupID   int64     `json:"runner_group_id"`
+	RunnerGroupName string    `json:"runner_group_name"`
+	CreatedAt       time.Time `json:"created_at" binding:"required"`
+	StartedAt       time.Time `json:"started_at"`
+	CompletedAt     time.Time `json:"completed_at"`
+}
+
+// Repository identifies the repository a webhook event belongs to
+type Repository struct {
+	ID       int64  `json:"id"`
+	FullName string `json:"full_name"`
+}
+
+// Organization identifies the organization a webhook event belongs to
+type Organization struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+// Enterprise identifies the enterprise a webhook event belongs to
+type Enterprise struct {
+	ID   int64  `json:"id"`
+	Slug string `json:"slug"`
+}
+
+// WebhookPingEvent represents the ping payload sent when a webhook is created
+type WebhookPingEvent struct {
+	Zen    string `json:"zen"`
+	HookID int64  `json:"hook_id"`
+}
+
+// WebhookWorkflowRunEvent represents the incoming workflow_run webhook payload
+type WebhookWorkflowRunEvent struct {
+	Action      string             `json:"action" binding:"required"`
+	WorkflowRun WebhookWorkflowRun `json:"workflow_run" binding:"required"`
+}
+
+type WebhookWorkflowRun struct {
+	ID           int64     `json:"id" binding:"required"`
+	RunAttempt   int       `json:"run_attempt"`
+	WorkflowID   int64     `json:"workflow_id"`
+	Name         string    `json:"name"`
+	Event        string    `json:"event"`
+	Status       string    `json:"status"`
+	Conclusion   string    `json:"conclusion"`
+	CreatedAt    time.Time `json:"created_at" binding:"required"`
+	RunStartedAt time.Time `json:"run_started_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// WorkflowRun represents a run attempt in the workflow_runs table
+type WorkflowRun struct {
+	ID           int64         `json:"id"`
+	RunAttempt   int           `json:"run_attempt"`
+	WorkflowID   int64         `json:"workflow_id"`
+	WorkflowName string        `json:"workflow_name"`
+	Event        string        `json:"event"`
+	Status       string        `json:"status"`
+	Conclusion   string        `json:"conclusion"`
+	CreatedAt    time.Time     `json:"created_at"`
+	RunStartedAt time.Time     `json:"run_started_at"`
+	CompletedAt  time.Time     `json:"completed_at"`
+	Duration     time.Duration `json:"duration"`
 }
 
 // WorkflowJob represents a job in the workflow_jobs table
 type WorkflowJob struct {
-	ID          int64      `json:"id"`
-	Status      JobStatus  `json:"status"`
-	RunnerType  RunnerType `json:"runner_type"`
-	CreatedAt   time.Time  `json:"created_at"`
-	StartedAt   time.Time  `json:"started_at"`
-	CompletedAt time.Time  `json:"completed_at"`
+	ID              int64        `json:"id"`
+	Status          JobStatus    `json:"status"`
+	RunnerType      RunnerType   `json:"runner_type"`
+	RunnerPool      string       `json:"runner_pool"`
+	RunID           int64        `json:"run_id"`
+	RunAttempt      int          `json:"run_attempt"`
+	WorkflowName    string       `json:"workflow_name"`
+	Name            string       `json:"name"`
+	HeadBranch      string       `json:"head_branch"`
+	HeadSHA         string       `json:"head_sha"`
+	Conclusion      string       `json:"conclusion"`
+	Labels          []string     `json:"labels"`
+	RunnerID        int64        `json:"runner_id"`
+	RunnerName      string       `json:"runner_name"`
+	RunnerGroupID   int64        `json:"runner_group_id"`
+	RunnerGroupName string       `json:"runner_group_name"`
+	Repository      Repository   `json:"repository"`
+	Organization    Organization `json:"organization"`
+	Enterprise      Enterprise   `json:"enterprise"`
+	CreatedAt       time.Time    `json:"created_at"`
+	WaitingAt       time.Time    `json:"waiting_at"`
+	QueuedAt        time.Time    `json:"queued_at"`
+	StartedAt       time.Time    `json:"started_at"`
+	CompletedAt     time.Time    `json:"completed_at"`
+}
+
+// JobSort is the order jobs are listed in. Every order lists the largest values first.
+type JobSort string
+
+const (
+	// JobSortCreated lists the most recently created jobs first
+	JobSortCreated JobSort = "created"
+	// JobSortQueueTime lists the started jobs that waited the longest for a runner first
+	JobSortQueueTime JobSort = "queue_time"
+	// JobSortDuration lists the completed jobs that ran the longest first
+	JobSortDuration JobSort = "duration"
+)
+
+// JobFilter selects the jobs to list. Zero fields do not filter. Time ranges include From and
+// exclude To, and a job without the timestamp of a range does not match it. Labels matches jobs
+// that requested at least all of the given labels. A minimum queue time only matches started jobs,
+// and a minimum duration only completed jobs, like sorting by them does.
+type JobFilter struct {
+	Status        JobStatus
+	Pool          string
+	Repository    string
+	Workflow      string
+	Labels        []string
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	StartedFrom   time.Time
+	StartedTo     time.Time
+	CompletedFrom time.Time
+	CompletedTo   time.Time
+	MinQueueTime  time.Duration
+	MinDuration   time.Duration
+	Sort          JobSort
+	After         *JobCursor
+	Limit         int
+}
+
+// JobCursor continues a job listing after the job it identifies. Value is the sort key of the
+// job: its creation time in Unix microseconds, or its queue time or duration in milliseconds.
+type JobCursor struct {
+	Value int64
+	ID    int64
+}
+
+// JobEvent is a workflow_job webhook event received for the job identified by JobID and JobCreatedAt.
+// The timestamps, conclusion and runner are the ones the event reported, so they are empty in the
+// events sent before the job reached them. DeliveryID is empty for events received without one.
+type JobEvent struct {
+	JobID           int64
+	JobCreatedAt    time.Time
+	DeliveryID      string
+	Action          string
+	ReceivedAt      time.Time
+	StartedAt       time.Time
+	CompletedAt     time.Time
+	Conclusion      string
+	RunnerID        int64
+	RunnerName      string
+	RunnerGroupName string
+}
+
+// JobPhaseName names a stage of a job's life
+type JobPhaseName string
+
+const (
+	// JobPhaseWaiting is the time a job waited on deployment protection rules
+	JobPhaseWaiting JobPhaseName = "waiting"
+	// JobPhaseQueued is the time a job waited for a runner
+	JobPhaseQueued JobPhaseName = "queued"
+	// JobPhaseRunning is the time a job ran on its runner
+	JobPhaseRunning JobPhaseName = "running"
+)
+
+// JobPhase is a stage a job went through. A zero End is a phase the job has not left, because it
+// is still in it or was abandoned in it.
+type JobPhase struct {
+	Name  JobPhaseName
+	Start time.Time
+	End   time.Time
+}
+
+// WebhookDelivery is a delivery from the webhook delivery log with the payload it was received with
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	Payload    []byte    `json:"-"`
+	ReceivedAt time.Time `json:"received_at"`
+	Attempts   int       `json:"attempts"`
+	Processed  bool      `json:"processed"`
+}
+
+// DeliveryFilter selects the deliveries stored with a payload, in the order they were first received.
+// Zero fields do not filter. AfterReceivedAt and AfterID continue a listing after the delivery they identify.
+type DeliveryFilter struct {
+	From            time.Time
+	To              time.Time
+	Unprocessed     bool
+	AfterReceivedAt time.Time
+	AfterID         string
+	Limit           int
+}
+
+// TokenScope is the access an API token grants
+type TokenScope string
+
+const (
+	// TokenScopeRead grants access to the runner demand data
+	TokenScopeRead TokenScope = "read"
+	// TokenScopeAdmin grants read access and the management of API tokens
+	TokenScopeAdmin TokenScope = "admin"
+)
+
+// APIToken is a bearer token of the API. Only the SHA-256 hash of its secret is stored.
+// A zero ExpiresAt never expires and a zero RevokedAt is not revoked.
+type APIToken struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"-"`
+	Scope     TokenScope `json:"scope"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt time.Time  `json:"revoked_at"`
 }
@@ -0,0 +1,227 @@
+// Package apiv1 defines the JSON documents of the /api/v1 endpoints.
+//
+// These documents are the stable contract of the API: fields may be added in
+// later releases, but existing fields are never renamed, removed or given a
+// different meaning. Durations are whole milliseconds and times are RFC3339.
+// Lists are wrapped in an object so they can gain fields too.
+package apiv1
+
+import "time"
+
+// Error is the body of every response with an error status
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Counts is the current number of jobs, returned by GET /api/v1/counts
+type Counts struct {
+	Time                time.Time    `json:"time"`
+	RunningSelfHosted   int          `json:"running_self_hosted"`
+	RunningGitHubHosted int          `json:"running_github_hosted"`
+	Queued              int          `json:"queued"`
+	Waiting             int          `json:"waiting"`
+	Pools               []PoolCounts `json:"pools"`
+}
+
+// PoolCounts is the current number of jobs of a runner pool
+type PoolCounts struct {
+	Pool    string `json:"pool"`
+	Running int    `json:"running"`
+	Queued  int    `json:"queued"`
+	Waiting int    `json:"waiting"`
+}
+
+// History is the runner demand of a time range, returned by GET /api/v1/history
+type History struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	StepSeconds int64     `json:"step_seconds"`
+	Points      []Point   `json:"points"`
+}
+
+// Point is the average demand of a step of a History, and its peak
+type Point struct {
+	Time                time.Time `json:"time"`
+	RunningSelfHosted   int       `json:"running_self_hosted"`
+	RunningGitHubHosted int       `json:"running_github_hosted"`
+	Queued              int       `json:"queued"`
+	PeakTotal           int       `json:"peak_total"`
+}
+
+// PoolHistory is the demand of a runner pool over a time range, returned by
+// GET /api/v1/pools/{pool}/history
+type PoolHistory struct {
+	Pool        string      `json:"pool"`
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	StepSeconds int64       `json:"step_seconds"`
+	Points      []PoolPoint `json:"points"`
+}
+
+// PoolPoint is the average demand of a step of a PoolHistory, and its peak
+type PoolPoint struct {
+	Time      time.Time `json:"time"`
+	Running   int       `json:"running"`
+	Queued    int       `json:"queued"`
+	PeakTotal int       `json:"peak_total"`
+}
+
+// QueueTime summarizes how long jobs waited for a runner, returned by GET /api/v1/queue-time
+type QueueTime struct {
+	Period     string   `json:"period"`
+	Pool       string   `json:"pool,omitempty"`
+	Repository string   `json:"repository,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+	Count      int64    `json:"count"`
+	AvgMs      int64    `json:"avg_ms"`
+	P50Ms      int64    `json:"p50_ms"`
+	P90Ms      int64    `json:"p90_ms"`
+	P95Ms      int64    `json:"p95_ms"`
+	P99Ms      int64    `json:"p99_ms"`
+	MaxMs      int64    `json:"max_ms"`
+}
+
+// JobDurations aggregates the run times of completed jobs by group, returned by
+// GET /api/v1/job-durations
+type JobDurations struct {
+	Period  string             `json:"period"`
+	GroupBy string             `json:"group_by"`
+	Groups  []JobDurationGroup `json:"groups"`
+}
+
+// JobDurationGroup is the run time of the jobs of a group. Only the field grouped by is set.
+type JobDurationGroup struct {
+	Pool          string  `json:"pool,omitempty"`
+	Repository    string  `json:"repository,omitempty"`
+	Workflow      string  `json:"workflow,omitempty"`
+	Job           string  `json:"job,omitempty"`
+	Count         int64   `json:"count"`
+	AvgMs         int64   `json:"avg_ms"`
+	P50Ms         int64   `json:"p50_ms"`
+	P95Ms         int64   `json:"p95_ms"`
+	RunnerMinutes float64 `json:"runner_minutes"`
+}
+
+// CompletedJobs lists completed jobs, returned by GET /api/v1/job-durations/jobs
+type CompletedJobs struct {
+	Period string         `json:"period"`
+	Jobs   []CompletedJob `json:"jobs"`
+}
+
+// CompletedJob is a completed job and how long it ran
+type CompletedJob struct {
+	ID          int64     `json:"id"`
+	RunID       int64     `json:"run_id"`
+	Repository  string    `json:"repository"`
+	Workflow    string    `json:"workflow"`
+	Job         string    `json:"job"`
+	Pool        string    `json:"pool"`
+	Conclusion  string    `json:"conclusion"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// Jobs is a page of the jobs matching a search, returned by GET /api/v1/jobs. NextCursor is
+// set when more jobs match, and is passed as the cursor parameter to get the next page.
+type Jobs struct {
+	Sort       string `json:"sort"`
+	Jobs       []Job  `json:"jobs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Job is a workflow job in its latest known state. The timestamps of the stages a job did not
+// reach are omitted, as are its queue time before it started and its duration before it completed.
+type Job struct {
+	ID          int64      `json:"id"`
+	RunID       int64      `json:"run_id"`
+	RunAttempt  int        `json:"run_attempt"`
+	Repository  string     `json:"repository"`
+	Workflow    string     `json:"workflow"`
+	Job         string     `json:"job"`
+	Branch      string     `json:"branch"`
+	Status      string     `json:"status"`
+	Conclusion  string     `json:"conclusion,omitempty"`
+	Labels      []string   `json:"labels"`
+	Pool        string     `json:"pool"`
+	RunnerName  string     `json:"runner_name,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	WaitingAt   *time.Time `json:"waiting_at,omitempty"`
+	QueuedAt    *time.Time `json:"queued_at,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	QueueTimeMs *int64     `json:"queue_time_ms,omitempty"`
+	DurationMs  *int64     `json:"duration_ms,omitempty"`
+}
+
+// JobDetail is a job with every workflow_job event received for it and the phases derived from
+// them, returned by GET /api/v1/jobs/{id}. Runner is omitted until a runner picked the job up.
+// Jobs stored before events were recorded have no events.
+type JobDetail struct {
+	Job
+	Runner *Runner    `json:"runner,omitempty"`
+	Phases []JobPhase `json:"phases"`
+	Events []JobEvent `json:"events"`
+}
+
+// Runner is the runner that picked a job up
+type Runner struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	GroupID   int64  `json:"group_id,omitempty"`
+	GroupName string `json:"group_name,omitempty"`
+}
+
+// JobPhase is a stage a job went through: waiting on deployment protection rules, queued for a
+// runner or running on it. The phase an active job is in is ongoing, has no end and lasts until
+// the response. The phase an abandoned job was left in has neither an end nor a duration.
+type JobPhase struct {
+	Name       string     `json:"name"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	DurationMs *int64     `json:"duration_ms,omitempty"`
+	Ongoing    bool       `json:"ongoing"`
+}
+
+// JobEvent is a workflow_job webhook event in the order it was received. Its timestamps,
+// conclusion and runner are the ones the event reported.
+type JobEvent struct {
+	Action      string     `json:"action"`
+	DeliveryID  string     `json:"delivery_id,omitempty"`
+	ReceivedAt  time.Time  `json:"received_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Conclusion  string     `json:"conclusion,omitempty"`
+	RunnerName  string     `json:"runner_name,omitempty"`
+}
+
+// Token is an API token, without its secret
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Tokens lists the API tokens, returned by GET /api/v1/tokens
+type Tokens struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// CreateTokenRequest is the body of POST /api/v1/tokens. The scope defaults to read and
+// the token never expires without an expiry.
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedToken is a new API token with its secret, returned by POST /api/v1/tokens.
+// The secret cannot be retrieved again.
+type CreatedToken struct {
+	Token
+	Secret string `json:"secret"`
+}
@@ -18,6 +18,12 @@ var logLevels = map[string]zapcore.Level{
 }
 
 func InitLogger(level string) {
+	InitLoggerTo(level, os.Stdout)
+}
+
+// InitLoggerTo initializes the logger to write to out, so commands whose output goes to
+// standard output can log to standard error instead
+func InitLoggerTo(level string, out zapcore.WriteSyncer) {
 	config := zapcore.EncoderConfig{
 		TimeKey:        "time",
 		LevelKey:       "level",
@@ -40,7 +46,7 @@ func InitLogger(level string) {
 
 	core := zapcore.NewCore(
 		zapcore.NewConsoleEncoder(config),
-		zapcore.AddSync(os.Stdout),
+		out,
 		l,
 	)
 
@@ -0,0 +1,9 @@
+// Package templates embeds the HTML templates served by the dashboard.
+package templates
+
+import "embed"
+
+// FS holds the HTML templates, each named after its file
+//
+//go:embed *.html
+var FS embed.FS